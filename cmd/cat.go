@@ -1,13 +1,12 @@
 package cmd
 
 import (
-	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
-	"github.com/ozkatz/cloudzip/pkg/remote"
 	"github.com/ozkatz/cloudzip/pkg/zipfile"
 )
 
@@ -15,35 +14,64 @@ var catCmd = &cobra.Command{
 	Use:     "cat",
 	Short:   "Extract a specific file from the remote archive to stdout",
 	Example: "cz cat s3://example-bucket/path/to/archive.zip images/file.png > image.png",
-	Args:    cobra.ExactArgs(2),
+	Args:    cobra.RangeArgs(1, 2),
 	Run: func(cmd *cobra.Command, args []string) {
 		remoteFile := args[0]
-		internalPath := args[1]
+		entryIndex, err := cmd.Flags().GetInt("index")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		byIndex := cmd.Flags().Changed("index")
+		if byIndex == (len(args) == 2) {
+			die("specify either a path within the archive or --index\n")
+		}
 		uri, err := expandStdin(remoteFile)
 		if err != nil {
-			_, _ = os.Stderr.WriteString(fmt.Sprintf("could not read stdin: %v\n", err))
-			os.Exit(1)
+			die("could not read stdin: %v\n", err)
+		}
+		entryLimit, err := cmd.Flags().GetUint64("entry-limit-bytes")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		verify, err := cmd.Flags().GetBool("verify")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		entryPath := ""
+		if !byIndex {
+			entryPath = args[1]
+			// an entry of a nested archive: inner.zip!path/to/file
+			if i := strings.LastIndex(entryPath, zipfile.NestedSeparator); i >= 0 {
+				uri += zipfile.NestedSeparator + entryPath[:i]
+				entryPath = entryPath[i+1:]
+			}
 		}
 		ctx := cmd.Context()
-		obj, err := remote.Object(uri)
+		obj, err := openObject(uri)
 		if err != nil {
-			_, _ = os.Stderr.WriteString(fmt.Sprintf("could not open zip file: %v\n", err))
-			os.Exit(1)
+			die("could not open zip file: %v\n", err)
+		}
+		zip := zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(ctx, obj), zipfile.WithEntryLimit(entryLimit), zipfile.WithAllowedMethods(allowedMethods(cmd)), zipfile.WithVerifyReads(verify), zipfile.WithChecksumAlgorithm(checksumAlgorithm(cmd)), zipfile.WithScanForStart(scanForStart()), zipfile.WithTolerant(tolerant()), zipfile.WithConcatenated(concatenatedPolicy()))
+		var reader io.Reader
+		if byIndex {
+			reader, err = zip.ReadIndex(entryIndex)
+		} else {
+			reader, err = zip.Read(entryPath)
 		}
-		zip := zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(ctx, obj))
-		reader, err := zip.Read(internalPath)
 		if err != nil {
-			_, _ = os.Stderr.WriteString(fmt.Sprintf("could not open zip file stream: %v\n", err))
-			os.Exit(1)
+			die("could not open zip file stream: %v\n", err)
 		}
 		_, err = io.Copy(os.Stdout, reader)
 		if err != nil {
-			_, _ = os.Stderr.WriteString(fmt.Sprintf("could not download file: %v\n", err))
-			os.Exit(1)
+			die("could not download file: %v\n", err)
 		}
 	},
 }
 
 func init() {
+	catCmd.Flags().Uint64("entry-limit-bytes", 0, "refuse to extract entries larger than this (uncompressed), 0 for no limit")
+	addAllowedMethodsFlag(catCmd)
+	addVerifyReadsFlag(catCmd)
+	catCmd.Flags().Int("index", 0, "extract the entry at this (0-based) position in the central directory, instead of by path")
 	rootCmd.AddCommand(catCmd)
 }
@@ -7,7 +7,13 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
 	"github.com/ozkatz/cloudzip/pkg/remote"
 	"github.com/ozkatz/cloudzip/pkg/zipfile"
 )
@@ -25,11 +31,14 @@ func expandStdin(arg string) (string, error) {
 }
 
 func die(fstring string, args ...interface{}) {
-	if !strings.HasSuffix(fstring, "\n") {
-		fstring += "\n"
-	}
-	_, _ = os.Stderr.WriteString(fmt.Sprintf(fstring, args...))
-	os.Exit(1)
+	exitWithError(newCommandError(fstring, args...))
+}
+
+// dieWithCode is die, for errors that aren't classified by the error they format (if any)
+func dieWithCode(code errorCode, fstring string, args ...interface{}) {
+	e := newCommandError(fstring, args...)
+	e.Code = code
+	exitWithError(e)
 }
 
 func setupLogging() {
@@ -55,26 +64,504 @@ func isDir(path string) (bool, error) {
 	return stat.IsDir(), nil
 }
 
-func getCdr(remoteFile string) []*zipfile.CDR {
+var (
+	credentialsCommandOnce sync.Once
+	credentialsCommand     *remote.CredentialsCommand
+)
+
+// objectOpts returns the options used to open remote objects, based on the global flags
+func objectOpts() []remote.ObjectOpt {
+	var opts []remote.ObjectOpt
+	command, err := rootCmd.PersistentFlags().GetString("credentials-command")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if command != "" {
+		credentialsCommandOnce.Do(func() {
+			credentialsCommand = remote.NewCredentialsCommand(command)
+		})
+		opts = append(opts, remote.WithCredentialsCommand(credentialsCommand))
+	}
+	addressingStyle, err := rootCmd.PersistentFlags().GetString("s3-addressing-style")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if addressingStyle != "" {
+		style, err := remote.ParseS3AddressingStyle(addressingStyle)
+		if err != nil {
+			die("%v\n", err)
+		}
+		opts = append(opts, remote.WithS3AddressingStyle(style))
+	}
+	provider, err := rootCmd.PersistentFlags().GetString("provider")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if provider != "" {
+		p, err := remote.ParseS3Provider(provider)
+		if err != nil {
+			die("%v\n", err)
+		}
+		opts = append(opts, remote.WithS3Provider(p))
+	}
+	accelerate, err := rootCmd.PersistentFlags().GetBool("s3-accelerate")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if accelerate {
+		opts = append(opts, remote.WithS3Accelerate())
+	}
+	dualStack, err := rootCmd.PersistentFlags().GetBool("s3-dualstack")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if dualStack {
+		opts = append(opts, remote.WithS3DualStack())
+	}
+	rangeStyle, err := rootCmd.PersistentFlags().GetString("http-range-style")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if rangeStyle != "" {
+		style, err := remote.ParseHttpRangeStyle(rangeStyle)
+		if err != nil {
+			die("%v\n", err)
+		}
+		opts = append(opts, remote.WithHttpRangeStyle(style))
+	}
+	timeoutBreakdown, err := rootCmd.PersistentFlags().GetString("http-timeout-breakdown")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if timeoutBreakdown != "" {
+		timeouts, err := remote.ParseHttpTimeouts(timeoutBreakdown)
+		if err != nil {
+			die("%v\n", err)
+		}
+		opts = append(opts, remote.WithHttpTimeouts(timeouts))
+	}
+	ipfsGateway, err := rootCmd.PersistentFlags().GetString("ipfs-gateway")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if ipfsGateway != "" {
+		gateway, err := remote.ParseIpfsGateway(ipfsGateway)
+		if err != nil {
+			die("%v\n", err)
+		}
+		opts = append(opts, remote.WithIpfsGateway(gateway))
+	}
+	if jumpHost != nil {
+		opts = append(opts, remote.WithDialer(jumpHost))
+	}
+	return opts
+}
+
+var (
+	uriMapOnce sync.Once
+	uriMap     remote.URIMap
+)
+
+// uriResolvers returns the resolvers applied to archive URIs before they are opened, based on the global flags
+func uriResolvers() []remote.URIResolver {
+	location, err := rootCmd.PersistentFlags().GetString("uri-map")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if location == "" {
+		return nil
+	}
+	uriMapOnce.Do(func() {
+		location, err = homedir.Expand(location)
+		if err == nil {
+			uriMap, err = remote.LoadURIMap(location)
+		}
+		if err != nil {
+			die("could not load URI map: %v\n", err)
+		}
+	})
+	return []remote.URIResolver{uriMap.Resolve}
+}
+
+// loadFallbackPaths has objects read through the paths given with --fallback-paths, if any
+func loadFallbackPaths(cmd *cobra.Command) {
+	location, err := cmd.Flags().GetString("fallback-paths")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if location == "" {
+		return
+	}
+	location, err = homedir.Expand(location)
+	if err != nil {
+		die("could not load fallback paths: %v\n", err)
+	}
+	paths, err := remote.LoadFallbackPaths(location)
+	if err != nil {
+		die("could not load fallback paths: %v\n", err)
+	}
+	remote.SetFallbackPaths(paths)
+}
+
+// openObject resolves uri and opens the object it refers to, with the options set by the global flags.
+// If uri points into nested archives (outer.zip!inner.zip), the innermost archive is returned.
+func openObject(uri string) (remote.Fetcher, error) {
+	uri, nested, err := zipfile.SplitNestedURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	uri, err = remote.ResolveURI(uri, uriResolvers()...)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := remote.Object(uri, objectOpts()...)
+	if err != nil || len(nested) == 0 {
+		return obj, err
+	}
+	// the archive is only closed (removing any decompressed copy) when the process exits
+	archive, err := zipfile.OpenNested(context.Background(), obj, nested)
+	if err != nil {
+		return nil, err
+	}
+	return archive.Fetcher(obj), nil
+}
+
+// jumpHost, once connected to by connectVia, opens the connections of remote objects
+var jumpHost *remote.SSHTunnel
+
+// connectVia connects to the SSH jump host given with --connect-via, if any, through which objects are then opened.
+// The jump host is connected to right away, so that it being unreachable fails the command before anything is read.
+func connectVia(cmd *cobra.Command) error {
+	target, err := cmd.Flags().GetString("connect-via")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if target == "" {
+		return nil
+	}
+	tunnel, err := remote.ConnectVia(context.Background(), target)
+	if err != nil {
+		return err
+	}
+	jumpHost = tunnel
+	slog.Debug("routing requests through SSH jump host", "target", target)
+	return nil
+}
+
+// scanForStart returns whether to scan for the start of the zip data of archives that can't be parsed otherwise
+func scanForStart() bool {
+	scan, err := rootCmd.PersistentFlags().GetBool("scan-for-start")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	return scan
+}
+
+// tolerant returns whether to recover the sizes of entries missing their zip64 extra field, rather than failing
+func tolerant() bool {
+	value, err := rootCmd.PersistentFlags().GetBool("tolerant")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	return value
+}
+
+// concatenatedPolicy returns the collision policy given with --concatenated, empty if archives aren't merged
+func concatenatedPolicy() zipfile.CollisionPolicy {
+	value, err := rootCmd.PersistentFlags().GetString("concatenated")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if value == "" {
+		return ""
+	}
+	policy, err := zipfile.ParseCollisionPolicy(value)
+	if err != nil {
+		die("could not parse --concatenated: %v\n", err)
+	}
+	return policy
+}
+
+func getCdr(remoteFile string, filters ...zipfile.Filter) []*zipfile.CDR {
+	_, files := getArchive(remoteFile, filters...)
+	return files
+}
+
+// getArchive reads the central directory of remoteFile, returning the parser along with the (filtered) records,
+// so that other details of the archive can be read without another request
+func getArchive(remoteFile string, filters ...zipfile.Filter) (*zipfile.CentralDirectoryParser, []*zipfile.CDR) {
 	zipfilePath, err := expandStdin(remoteFile)
 	if err != nil {
-		_, _ = os.Stderr.WriteString(fmt.Sprintf("could not read stdin: %v\n", err))
-		os.Exit(1)
+		die("could not read stdin: %v\n", err)
 	}
 	ctx := context.Background()
-	obj, err := remote.Object(zipfilePath)
+	obj, err := openObject(zipfilePath)
 	if err != nil {
-		_, _ = os.Stderr.WriteString(fmt.Sprintf("could not open remote zip file: %v\n", err))
-		os.Exit(1)
+		die("could not open remote zip file: %v\n", err)
 	}
-	zip := zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(ctx, obj))
+	opts := []zipfile.ParserOpt{zipfile.WithScanForStart(scanForStart()), zipfile.WithTolerant(tolerant()), zipfile.WithConcatenated(concatenatedPolicy())}
+	if isTerminal(os.Stderr) {
+		opts = append(opts, zipfile.WithProgress(printProgress))
+	}
+	zip := zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(ctx, obj), opts...)
 
 	files, err := zip.GetCentralDirectory()
+	if isTerminal(os.Stderr) {
+		_, _ = os.Stderr.WriteString("\r\033[K") // clear progress line
+	}
 	if err != nil {
-		_, _ = os.Stderr.WriteString(fmt.Sprintf("could not read zip file contents: %v\n", err))
-		os.Exit(1)
+		die("could not read zip file contents: %v\n", err)
 	}
-	return files
+	return zip, zipfile.FilterRecords(files, filters...)
+}
+
+const defaultAllowedMethods = "store,deflate,deflate64"
+
+func addAllowedMethodsFlag(cmd *cobra.Command) {
+	cmd.Flags().String("allowed-methods", defaultAllowedMethods, "comma-separated compression methods entries may be decoded with")
+}
+
+func allowedMethods(cmd *cobra.Command) []uint16 {
+	value, err := cmd.Flags().GetString("allowed-methods")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	methods, err := zipfile.ParseCompressionMethods(value)
+	if err != nil {
+		die("could not parse --allowed-methods: %v\n", err)
+	}
+	return methods
+}
+
+func addConcurrencyFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("max-concurrency", 0, "maximum concurrent requests to the remote archive, reduced automatically when throttled (0 for no limit)")
+	cmd.Flags().Int("min-concurrency", 1, "concurrent requests never drop below this when throttled, used with --max-concurrency")
+}
+
+func addParallelReadFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("read-parallelism", 1, "split large reads into parts fetched concurrently, up to this many at once (1 to disable)")
+	cmd.Flags().Int64("part-size", 0, "size in bytes of the parts large reads are split into, 0 for the backend's default (8MiB for S3, 4MiB for HTTP)")
+}
+
+func addNameMappingFlags(cmd *cobra.Command) {
+	cmd.Flags().String("strip-prefix", "", "remove this directory prefix from entry paths (e.g. 'project-1.0/')")
+	cmd.Flags().String("add-prefix", "", "place all entries under this directory, applied after --strip-prefix")
+	cmd.Flags().Bool("flatten-single", false, "if the archive holds a single file, expose it at the root of the mount")
+}
+
+// nameMappers returns the entry path mappers selected by the name mapping flags
+func nameMappers(cmd *cobra.Command) []mount.NameMapper {
+	var mappers []mount.NameMapper
+	strip, err := cmd.Flags().GetString("strip-prefix")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if strip != "" {
+		mappers = append(mappers, mount.StripPrefix(strip))
+	}
+	add, err := cmd.Flags().GetString("add-prefix")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if add != "" {
+		mappers = append(mappers, mount.AddPrefix(add))
+	}
+	return mappers
+}
+
+func addIdleTimeoutFlag(cmd *cobra.Command) {
+	cmd.Flags().Duration("idle-timeout", 0, "shut the mount server down after no client activity for this long (e.g. 30m), 0 to never")
+}
+
+func addMountLabelFlags(cmd *cobra.Command) {
+	cmd.Flags().String("mount-name", "", "name of the mount, added to all of its log records (e.g. to tell mounts apart on a host)")
+	cmd.Flags().StringArray("tag", nil, "label added to all log records of the mount, as key=value (can be repeated)")
+}
+
+// mountLabels returns the name and tags given with --mount-name and --tag, dying if a tag isn't a key=value pair
+func mountLabels(cmd *cobra.Command) (string, map[string]string) {
+	name, err := cmd.Flags().GetString("mount-name")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	values, err := cmd.Flags().GetStringArray("tag")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	tags := make(map[string]string, len(values))
+	for _, value := range values {
+		key, v, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			dieWithCode(errorCodeInvalidArgument, "invalid --tag '%s', expected key=value\n", value)
+		}
+		tags[key] = v
+	}
+	return name, tags
+}
+
+func addPrewarmFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("prewarm", false, "download entries into the cache before serving the mount")
+	cmd.Flags().StringArray("prewarm-match", nil, "only prewarm entries whose path matches this glob pattern (e.g. 'data/*.csv'), may be repeated")
+	cmd.Flags().Int("prewarm-concurrency", mount.DefaultPrewarmConcurrency, "number of entries to prewarm concurrently")
+}
+
+func addVerifyReadsFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("verify", false, "check the size and CRC32 of entries as they are read, failing on a mismatch")
+	cmd.Flags().String("checksum-algorithm", string(zipfile.ChecksumCRC32), "checksum used for verification (crc32-ieee | crc32c | sha256 | none), where the archive or backend stores it")
+}
+
+func checksumAlgorithm(cmd *cobra.Command) zipfile.ChecksumAlgorithm {
+	value, err := cmd.Flags().GetString("checksum-algorithm")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	algorithm, err := zipfile.ParseChecksumAlgorithm(value)
+	if err != nil {
+		die("could not parse --checksum-algorithm: %v\n", err)
+	}
+	return algorithm
+}
+
+func addVerifyFlag(cmd *cobra.Command) {
+	cmd.Flags().String("verify-on-mount", "", "check archive integrity before serving it (structure | sample | full)")
+}
+
+func verifyLevel(cmd *cobra.Command) zipfile.VerifyLevel {
+	value, err := cmd.Flags().GetString("verify-on-mount")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	level, err := zipfile.ParseVerifyLevel(value)
+	if err != nil {
+		die("could not parse --verify-on-mount: %v\n", err)
+	}
+	return level
+}
+
+func addTimeFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().String("since", "", "only include entries modified at or after this time (RFC3339, YYYY-MM-DD, or a duration such as 24h)")
+	cmd.Flags().String("until", "", "only include entries modified before this time (RFC3339, YYYY-MM-DD, or a duration such as 24h)")
+	cmd.Flags().Bool("include-missing-mtime", true, "when using --since/--until, include entries with no modification time")
+}
+
+// parseTimeFlag accepts an absolute time (RFC3339 or date), or a duration that is subtracted from now
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s': expected RFC3339, YYYY-MM-DD or a duration", value)
+	}
+	return now.Add(-d), nil
+}
+
+// timeFilters returns the filters requested by the flags registered with addTimeFilterFlags
+func timeFilters(cmd *cobra.Command) []zipfile.Filter {
+	since, err := cmd.Flags().GetString("since")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	until, err := cmd.Flags().GetString("until")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	includeMissing, err := cmd.Flags().GetBool("include-missing-mtime")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if since == "" && until == "" {
+		return nil
+	}
+	now := time.Now()
+	sinceTime, err := parseTimeFlag(since, now)
+	if err != nil {
+		die("could not parse --since: %v\n", err)
+	}
+	untilTime, err := parseTimeFlag(until, now)
+	if err != nil {
+		die("could not parse --until: %v\n", err)
+	}
+	return []zipfile.Filter{zipfile.ModifiedBetween(sinceTime, untilTime, includeMissing)}
+}
+
+func addPatternFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("include", nil, "only include entries whose path matches this pattern (path.Match syntax, can be repeated)")
+	cmd.Flags().StringArray("exclude", nil, "leave out entries whose path matches this pattern, and everything below a matching directory (can be repeated)")
+	addPatternFileFlags(cmd)
+}
+
+func addPatternFileFlags(cmd *cobra.Command) {
+	cmd.Flags().String("include-from", "", "read --include patterns from this file, one per line ('#' starts a comment)")
+	cmd.Flags().String("exclude-from", "", "read --exclude patterns from this file, one per line ('#' starts a comment)")
+}
+
+// readPatternFile returns the patterns listed in the file given by flag, if any
+func readPatternFile(cmd *cobra.Command, flag string) []string {
+	filename, err := cmd.Flags().GetString(flag)
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	if filename == "" {
+		return nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		die("could not read --%s: %v\n", flag, err)
+	}
+	defer func() { _ = f.Close() }()
+	patterns, err := zipfile.ReadPatterns(f)
+	if err != nil {
+		die("could not read --%s: %v\n", flag, err)
+	}
+	return patterns
+}
+
+// patterns returns the --include and --exclude patterns, combined with those read from --include-from and --exclude-from
+func patterns(cmd *cobra.Command) (include, exclude []string) {
+	include, err := cmd.Flags().GetStringArray("include")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	exclude, err = cmd.Flags().GetStringArray("exclude")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	return append(include, readPatternFile(cmd, "include-from")...), append(exclude, readPatternFile(cmd, "exclude-from")...)
+}
+
+// entryFilters returns the filters requested by the flags registered with addTimeFilterFlags and addPatternFilterFlags
+func entryFilters(cmd *cobra.Command) []zipfile.Filter {
+	filters := timeFilters(cmd)
+	include, exclude := patterns(cmd)
+	if len(include) == 0 && len(exclude) == 0 {
+		return filters
+	}
+	filter, err := zipfile.MatchPatterns(include, exclude)
+	if err != nil {
+		die("%v\n", err)
+	}
+	return append(filters, filter)
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// printProgress renders central directory parsing progress on a single (overwritten) stderr line
+func printProgress(p zipfile.Progress) {
+	_, _ = fmt.Fprintf(os.Stderr, "\r\033[Kreading index: %s / %s, %d entries parsed",
+		byteCountIEC(uint64(p.BytesRead)), byteCountIEC(uint64(p.BytesTotal)), p.EntriesParsed)
 }
 
 func byteCountIEC(b uint64) string {
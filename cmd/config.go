@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configDefaultLocation = "~/.cloudzip.yaml"
+	configEnvVar          = "CLOUDZIP_CONFIG"
+
+	// configEnvKey holds environment variables to set (if not already set) rather than a flag value
+	configEnvKey = "env"
+)
+
+// flagEnvironmentVariables maps flags whose default comes from the environment to their variable,
+// so that a variable set in the environment takes precedence over the config file
+var flagEnvironmentVariables = map[string]string{
+	"credentials-command": credentialsCommandEnvironmentVariableName,
+	"s3-addressing-style": s3AddressingStyleEnvironmentVariableName,
+	"provider":            s3ProviderEnvironmentVariableName,
+	"http-range-style":    httpRangeStyleEnvironmentVariableName,
+	"ipfs-gateway":        ipfsGatewayEnvironmentVariableName,
+	"uri-map":             uriMapEnvironmentVariableName,
+	"fallback-paths":      fallbackPathsEnvironmentVariableName,
+}
+
+// configLocation returns the path of the config file, and whether it was explicitly requested
+func configLocation() (string, bool, error) {
+	if location := os.Getenv(configEnvVar); location != "" {
+		location, err := homedir.Expand(location)
+		return location, true, err
+	}
+	location, err := homedir.Expand(configDefaultLocation)
+	return location, false, err
+}
+
+// loadConfig reads the config file, if one exists.
+// It's a YAML mapping of flag names to values, plus an optional "env" mapping of environment variables.
+func loadConfig() (string, map[string]any, error) {
+	location, explicit, err := configLocation()
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(location)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	config := map[string]any{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return "", nil, fmt.Errorf("could not parse config file %s: %w", location, err)
+	}
+	return location, config, nil
+}
+
+// applyConfig sets flags of cmd from config, unless they were given on the command line
+// (or, for flags with an environment variable, in the environment).
+// Keys that aren't a flag of any command are ignored with a warning.
+func applyConfig(cmd *cobra.Command, location string, config map[string]any) error {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	known := knownFlags(cmd.Root())
+	for _, key := range keys {
+		value := config[key]
+		if key == configEnvKey {
+			if err := applyConfigEnv(value); err != nil {
+				return fmt.Errorf("%s: %w", location, err)
+			}
+			continue
+		}
+		if !known[key] {
+			slog.Warn("unknown key in config file", "file", location, "key", key)
+			continue
+		}
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil || flag.Changed {
+			continue // not used by this command, or overridden on the command line
+		}
+		if envVar, ok := flagEnvironmentVariables[key]; ok && os.Getenv(envVar) != "" {
+			continue
+		}
+		if err := setFlagFromConfig(cmd.Flags(), key, value); err != nil {
+			return fmt.Errorf("%s: invalid value for '%s': %w", location, key, err)
+		}
+	}
+	return nil
+}
+
+func applyConfigEnv(value any) error {
+	env, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("'%s' must be a mapping of environment variable names to values", configEnvKey)
+	}
+	for name, v := range env {
+		if _, set := os.LookupEnv(name); set {
+			continue
+		}
+		if err := os.Setenv(name, fmt.Sprint(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setFlagFromConfig(flags *pflag.FlagSet, name string, value any) error {
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+	for _, v := range values {
+		if err := flags.Set(name, fmt.Sprint(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// knownFlags returns the names of all flags defined by cmd and its subcommands
+func knownFlags(cmd *cobra.Command) map[string]bool {
+	known := map[string]bool{}
+	addFlag := func(f *pflag.Flag) { known[f.Name] = true }
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		c.Flags().VisitAll(addFlag)
+		c.PersistentFlags().VisitAll(addFlag)
+		for _, child := range c.Commands() {
+			walk(child)
+		}
+	}
+	walk(cmd)
+	return known
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// configTestCommand returns a subcommand with the kinds of flags config files set, under a root with another
+// subcommand, whose flags are known but not set
+func configTestCommand(t *testing.T) *cobra.Command {
+	t.Helper()
+	root := &cobra.Command{Use: "cz"}
+	root.PersistentFlags().String("s3-addressing-style", "", "")
+	sub := &cobra.Command{Use: "mount", Run: func(*cobra.Command, []string) {}}
+	sub.Flags().String("cache-dir", "", "")
+	sub.Flags().Bool("probe-range", false, "")
+	sub.Flags().StringArray("include", nil, "")
+	other := &cobra.Command{Use: "ls", Run: func(*cobra.Command, []string) {}}
+	other.Flags().String("output", "table", "")
+	root.AddCommand(sub, other)
+	return sub
+}
+
+func TestApplyConfig(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	t.Setenv("CLOUDZIP_TEST_SET", "from environment")
+	t.Setenv(s3AddressingStyleEnvironmentVariableName, "virtual")
+
+	cmd := configTestCommand(t)
+	if err := cmd.Flags().Set("probe-range", "false"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := applyConfig(cmd, "config.yaml", map[string]any{
+		"cache-dir":           "/var/cache/cz",
+		"include":             []any{"*.csv", "*.json"},
+		"probe-range":         true,
+		"output":              "json",
+		"s3-addressing-style": "path",
+		"cahce-dir":           "/tmp",
+		"env":                 map[string]any{"CLOUDZIP_TEST_SET": "from config", "CLOUDZIP_TEST_UNSET": 1},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Unsetenv("CLOUDZIP_TEST_UNSET") })
+
+	if value, _ := cmd.Flags().GetString("cache-dir"); value != "/var/cache/cz" {
+		t.Errorf("expected cache-dir from the config file, got %q", value)
+	}
+	if values, _ := cmd.Flags().GetStringArray("include"); !slices.Equal(values, []string{"*.csv", "*.json"}) {
+		t.Errorf("expected each value of a list to be added, got %q", values)
+	}
+	if value, _ := cmd.Flags().GetBool("probe-range"); value {
+		t.Error("expected a flag given on the command line to take precedence")
+	}
+	if value, _ := cmd.Root().PersistentFlags().GetString("s3-addressing-style"); value != "" {
+		t.Errorf("expected a flag whose variable is set in the environment to be left alone, got %q", value)
+	}
+	if value := os.Getenv("CLOUDZIP_TEST_SET"); value != "from environment" {
+		t.Errorf("expected a variable already set to be kept, got %q", value)
+	}
+	if value := os.Getenv("CLOUDZIP_TEST_UNSET"); value != "1" {
+		t.Errorf("expected a variable to be set from the config file, got %q", value)
+	}
+	if !strings.Contains(logs.String(), "unknown key in config file") || !strings.Contains(logs.String(), "key=cahce-dir") {
+		t.Errorf("expected a warning about the unknown key, got %q", logs.String())
+	}
+	if strings.Contains(logs.String(), "key=output") {
+		t.Errorf("expected no warning for a flag of another command, got %q", logs.String())
+	}
+
+	t.Run("invalid value", func(t *testing.T) {
+		err := applyConfig(configTestCommand(t), "config.yaml", map[string]any{"probe-range": "sometimes"})
+		if err == nil || !strings.Contains(err.Error(), "config.yaml: invalid value for 'probe-range'") {
+			t.Errorf("expected an invalid value error, got %v", err)
+		}
+	})
+	t.Run("invalid env", func(t *testing.T) {
+		if err := applyConfig(configTestCommand(t), "config.yaml", map[string]any{"env": "A=B"}); err == nil {
+			t.Error("expected an error for an env key that isn't a mapping")
+		}
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	t.Run("no default file", func(t *testing.T) {
+		location, config, err := loadConfig()
+		if err != nil || location != "" || config != nil {
+			t.Errorf("expected no config, got %s %v (err: %v)", location, config, err)
+		}
+	})
+	t.Run("default file", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(home, ".cloudzip.yaml"), []byte("cache-dir: /var/cache/cz\n"), 0o600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = os.Remove(filepath.Join(home, ".cloudzip.yaml")) }()
+		location, config, err := loadConfig()
+		if err != nil || location != filepath.Join(home, ".cloudzip.yaml") || config["cache-dir"] != "/var/cache/cz" {
+			t.Errorf("expected the default file to be loaded, got %s %v (err: %v)", location, config, err)
+		}
+	})
+	t.Run("missing explicit file", func(t *testing.T) {
+		t.Setenv(configEnvVar, "~/missing.yaml")
+		if _, _, err := loadConfig(); err == nil {
+			t.Error("expected an error for a config file that was asked for but doesn't exist")
+		}
+	})
+	t.Run("invalid file", func(t *testing.T) {
+		location := filepath.Join(home, "invalid.yaml")
+		if err := os.WriteFile(location, []byte("- not\n- a mapping\n"), 0o600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Setenv(configEnvVar, location)
+		if _, _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "could not parse config file") {
+			t.Errorf("expected a parse error, got %v", err)
+		}
+	})
+}
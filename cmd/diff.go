@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// entryChange is the machine-readable description of an entry that differs between archives, as printed by 'diff --json'
+type entryChange struct {
+	Change string       `json:"change"`
+	Name   string       `json:"name"`
+	Fields []string     `json:"fields,omitempty"`
+	Old    *entryHeader `json:"old,omitempty"`
+	New    *entryHeader `json:"new,omitempty"`
+	// ContentChanged is set with --content, for changed files
+	ContentChanged *bool `json:"content_changed,omitempty"`
+}
+
+var changeSymbols = map[zipfile.ChangeKind]string{
+	zipfile.EntryAdded:   "+",
+	zipfile.EntryRemoved: "-",
+	zipfile.EntryChanged: "~",
+}
+
+// describeChange returns how the fields of a changed entry differ, e.g. "size 10 -> 12"
+func describeChange(c zipfile.EntryChange) string {
+	var parts []string
+	for _, field := range c.Fields {
+		switch field {
+		case zipfile.FieldMode:
+			parts = append(parts, fmt.Sprintf("mode %s -> %s", c.Old.Mode, c.New.Mode))
+		case zipfile.FieldSize:
+			parts = append(parts, fmt.Sprintf("size %d -> %d", c.Old.UncompressedSizeBytes, c.New.UncompressedSizeBytes))
+		case zipfile.FieldCRC32:
+			parts = append(parts, fmt.Sprintf("crc32 %08x -> %08x", c.Old.CRC32Uncompressed, c.New.CRC32Uncompressed))
+		case zipfile.FieldModified:
+			parts = append(parts, fmt.Sprintf("modified %s -> %s", c.Old.Modified.Format(time.RFC3339), c.New.Modified.Format(time.RFC3339)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// recordIndices maps records to their index in the central directory
+func recordIndices(records []*zipfile.CDR) map[*zipfile.CDR]int {
+	indices := make(map[*zipfile.CDR]int, len(records))
+	for i, f := range records {
+		indices[f] = i
+	}
+	return indices
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "List the entries added, removed or changed between two remote archives, comparing their central directories",
+	Example: "cz diff s3://example-bucket/releases/v1.zip s3://example-bucket/releases/v2.zip\n" +
+		"cz diff --content --exit-code old.zip new.zip",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		content, err := cmd.Flags().GetBool("content")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		hashFlag, err := cmd.Flags().GetString("hash")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		algorithm, err := zipfile.ParseHashAlgorithm(hashFlag)
+		if err != nil {
+			die("%v\n", err)
+		}
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		exitCode, err := cmd.Flags().GetBool("exit-code")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		filters := entryFilters(cmd)
+		before, beforeRecords := getArchive(args[0], filters...)
+		after, afterRecords := getArchive(args[1], filters...)
+		changes := zipfile.DiffRecords(beforeRecords, afterRecords)
+
+		beforeIndex, afterIndex := recordIndices(beforeRecords), recordIndices(afterRecords)
+		encoder := json.NewEncoder(os.Stdout)
+		for _, c := range changes {
+			var contentChanged *bool
+			if content && c.Kind == zipfile.EntryChanged && !c.Old.Mode.IsDir() && !c.New.Mode.IsDir() {
+				changed, err := zipfile.ContentChanged(c, before, after, algorithm)
+				if err != nil {
+					die("could not compare the content of %s: %v\n", c.Name, err)
+				}
+				contentChanged = &changed
+			}
+			if asJSON {
+				out := &entryChange{Change: string(c.Kind), Name: c.Name, Fields: c.Fields, ContentChanged: contentChanged}
+				if c.Old != nil {
+					out.Old = newEntryHeader(beforeIndex[c.Old], c.Old)
+				}
+				if c.New != nil {
+					out.New = newEntryHeader(afterIndex[c.New], c.New)
+				}
+				if err := encoder.Encode(out); err != nil {
+					die("could not write change: %v\n", err)
+				}
+				continue
+			}
+			line := changeSymbols[c.Kind] + " " + c.Name
+			if c.Kind == zipfile.EntryChanged {
+				line += "  " + describeChange(c)
+			}
+			if contentChanged != nil && *contentChanged {
+				line += " (content differs)"
+			} else if contentChanged != nil {
+				line += " (same content)"
+			}
+			fmt.Println(line)
+		}
+		if len(changes) > 0 && exitCode {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	addTimeFilterFlags(diffCmd)
+	addPatternFilterFlags(diffCmd)
+	diffCmd.Flags().Bool("content", false,
+		"also compare the content of changed files, by reading and hashing them in both archives")
+	diffCmd.Flags().String("hash", string(zipfile.HashSHA256), "the hash --content compares files with: sha256 or xxh64")
+	diffCmd.Flags().Bool("json", false, "print each change as a JSON object on its own line")
+	diffCmd.Flags().Bool("exit-code", false, "exit with status 1 if the archives differ, like diff(1)")
+	rootCmd.AddCommand(diffCmd)
+}
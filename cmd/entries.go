@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// entryHeader is the machine-readable description of an archive entry, as printed by 'ls --output json|csv'
+type entryHeader struct {
+	Index            int       `json:"index"`
+	Name             string    `json:"name"`
+	Mode             string    `json:"mode"`
+	IsDir            bool      `json:"is_dir"`
+	CompressedSize   uint64    `json:"compressed_size"`
+	UncompressedSize uint64    `json:"uncompressed_size"`
+	Modified         time.Time `json:"modified"`
+	CRC32            string    `json:"crc32"`
+	Method           string    `json:"method"`
+	Comment          string    `json:"comment,omitempty"`
+	// Hash is the digest of the content, prefixed with its algorithm (e.g. "sha256:..."), if requested
+	Hash string `json:"hash,omitempty"`
+	// Xattrs are the extended attributes of the entry (base64 encoded in JSON), if requested
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+}
+
+func newEntryHeader(index int, f *zipfile.CDR) *entryHeader {
+	return &entryHeader{
+		Index:            index,
+		Name:             f.FileName,
+		Mode:             f.Mode.String(),
+		IsDir:            f.Mode.IsDir(),
+		CompressedSize:   f.CompressedSizeBytes,
+		UncompressedSize: f.UncompressedSizeBytes,
+		Modified:         f.Modified,
+		CRC32:            fmt.Sprintf("%08x", f.CRC32Uncompressed),
+		Method:           zipfile.CompressionMethodName(f.CompressionMethod),
+		Comment:          string(f.FileComment),
+	}
+}
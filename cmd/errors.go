@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// errorCode is a stable, machine-readable classification of the error a command failed with
+type errorCode string
+
+const (
+	errorCodeNotFound         errorCode = "NOT_FOUND"
+	errorCodeNotAZip          errorCode = "NOT_A_ZIP"
+	errorCodeCorruptArchive   errorCode = "CORRUPT_ARCHIVE"
+	errorCodeEncrypted        errorCode = "ENCRYPTED"
+	errorCodeTruncated        errorCode = "TRUNCATED"
+	errorCodeAuth             errorCode = "AUTH"
+	errorCodeClockSkew        errorCode = "CLOCK_SKEW"
+	errorCodeUnavailable      errorCode = "UNAVAILABLE"
+	errorCodeRangeUnsupported errorCode = "RANGE_UNSUPPORTED"
+	errorCodeOffline          errorCode = "OFFLINE"
+	errorCodeInvalidArgument  errorCode = "INVALID_ARGUMENT"
+	errorCodeInternal         errorCode = "INTERNAL"
+)
+
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// errorFormat is how fatal errors are written to stderr, set by --error-format
+var errorFormat = errorFormatText
+
+// commandError is the error a command failed with, as written to stderr with --error-format json
+// and sent to the callback address by the mount server
+type commandError struct {
+	Code    errorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// errorCodeOf classifies err by the sentinel errors it wraps
+func errorCodeOf(err error) errorCode {
+	switch {
+	case errors.Is(err, remote.ErrDoesNotExist), errors.Is(err, zipfile.ErrFileNotFound), errors.Is(err, fs.ErrNotExist):
+		return errorCodeNotFound
+	case errors.Is(err, zipfile.ErrInvalidZip):
+		return errorCodeNotAZip
+	case errors.Is(err, zipfile.ErrStrongEncryptionUnsupported):
+		return errorCodeEncrypted
+	case errors.Is(err, zipfile.ErrCorruptArchive), errors.Is(err, zipfile.ErrEntryChanged), errors.Is(err, zipfile.ErrInvalidIndex):
+		return errorCodeCorruptArchive
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errorCodeTruncated
+	case errors.Is(err, remote.ErrAccessDenied), errors.Is(err, remote.ErrSwiftAuth), errors.Is(err, remote.ErrGCSAuth),
+		errors.Is(err, remote.ErrAzureAuth), errors.Is(err, remote.ErrCredentialsCommand), errors.Is(err, fs.ErrPermission):
+		return errorCodeAuth
+	case errors.Is(err, remote.ErrClockSkew):
+		return errorCodeClockSkew
+	case errors.Is(err, remote.ErrThrottled), errors.Is(err, remote.ErrHttpTimeout), errors.Is(err, remote.ErrSSHTunnel),
+		errors.Is(err, remote.ErrSFTP), remote.IsTransient(err):
+		return errorCodeUnavailable
+	case errors.Is(err, zipfile.ErrRangeIgnored), errors.Is(err, remote.ErrContentEncoded):
+		return errorCodeRangeUnsupported
+	case errors.Is(err, mount.ErrOffline):
+		return errorCodeOffline
+	case errors.Is(err, remote.ErrInvalidURI), errors.Is(err, remote.ErrInvalidS3Config), errors.Is(err, remote.ErrInvalidHttpConfig),
+		errors.Is(err, zipfile.ErrUnknownChecksumAlgorithm), errors.Is(err, zipfile.ErrUnknownHashAlgorithm),
+		errors.Is(err, zipfile.ErrUnknownCollisionPolicy):
+		return errorCodeInvalidArgument
+	}
+	var netErr *net.OpError
+	if errors.As(err, &netErr) {
+		return errorCodeUnavailable
+	}
+	return errorCodeInternal
+}
+
+// newCommandError formats a message like fmt.Sprintf, classified by the first error among args.
+// Messages that don't format an error are about how the command was invoked.
+func newCommandError(fstring string, args ...interface{}) commandError {
+	e := commandError{
+		Code:    errorCodeInvalidArgument,
+		Message: strings.TrimSuffix(fmt.Sprintf(fstring, args...), "\n"),
+	}
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			e.Code = errorCodeOf(err)
+			break
+		}
+	}
+	return e
+}
+
+func (e commandError) String() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		// only strings are marshalled, this can't happen
+		panic(err)
+	}
+	return string(data)
+}
+
+// parseCommandError parses an error sent to the callback address.
+// Mount servers of older versions sent only a message, which is classified as internal.
+func parseCommandError(s string) commandError {
+	var e commandError
+	if err := json.Unmarshal([]byte(s), &e); err != nil || e.Code == "" {
+		return commandError{Code: errorCodeInternal, Message: s}
+	}
+	return e
+}
+
+// exitWithError writes e to stderr in the format chosen with --error-format and exits
+func exitWithError(e commandError) {
+	if errorFormat == errorFormatJSON {
+		_, _ = fmt.Fprintln(os.Stderr, e)
+	} else {
+		_, _ = fmt.Fprintln(os.Stderr, e.Message)
+	}
+	os.Exit(1)
+}
@@ -30,7 +30,7 @@ var httpCmd = &cobra.Command{
 			func(w http.ResponseWriter, r *http.Request) {
 				internalPath := r.URL.Query().Get("filename")
 				slog.Debug("HTTP Handler", "objectPath", r.URL.Path, "internalPath", internalPath)
-				obj, err := remote.Object(remotePath + r.URL.Path)
+				obj, err := openObject(remotePath + r.URL.Path)
 				if err != nil {
 					slog.Warn("could not open zip file", "error", err)
 					w.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+var indexCmd = &cobra.Command{
+	Use:     "index",
+	Short:   "Write the central directory of the remote archive to stdout as an index, for mounts to preload with --index-url",
+	Example: "cz index s3://example-bucket/path/to/archive.zip > archive.czix",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri, err := expandStdin(args[0])
+		if err != nil {
+			die("could not read stdin: %v\n", err)
+		}
+		obj, err := openObject(uri)
+		if err != nil {
+			die("could not open remote zip file: %v\n", err)
+		}
+		// described before its records are read, so that an archive replaced in between doesn't match the index
+		archive, err := zipfile.DescribeArchive(cmd.Context(), uri, obj)
+		if err != nil {
+			die("could not read the size of the archive: %v\n", err)
+		}
+		files := getCdr(uri)
+		if err := zipfile.ExportArchiveIndex(os.Stdout, archive, files); err != nil {
+			die("could not write index: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+}
@@ -14,7 +14,8 @@ var infoCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		remoteFile := args[0]
 		var totalCompressed, totalUncompressed, totalFiles uint64
-		for _, f := range getCdr(remoteFile) {
+		zip, files := getArchive(remoteFile, timeFilters(cmd)...)
+		for _, f := range files {
 			if f.Mode.IsDir() {
 				continue
 			}
@@ -28,9 +29,20 @@ var infoCmd = &cobra.Command{
 		fmt.Printf("total bytes (uncompressed): %d\n", totalUncompressed)
 		fmt.Printf("total bytes (compressed, human readable): %s\n", byteCountIEC(totalCompressed))
 		fmt.Printf("total bytes (uncompressed, human readable): %s\n", byteCountIEC(totalUncompressed))
+		if stub, err := zip.Stub(); err == nil && stub != nil {
+			if stub.Scanned {
+				fmt.Printf("zip data found by scanning, at offset %d (preceded by: %s)\n", stub.Size, stub.Kind)
+			} else {
+				fmt.Printf("self-extracting stub: %s, %d bytes\n", stub.Kind, stub.Size)
+			}
+		}
+		if comment, err := zip.ArchiveComment(); err == nil && comment != "" {
+			fmt.Printf("comment: %q\n", comment)
+		}
 	},
 }
 
 func init() {
+	addTimeFilterFlags(infoCmd)
 	rootCmd.AddCommand(infoCmd)
 }
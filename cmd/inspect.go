@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// archiveKind describes a zip-based package format and where its manifest lives
+type archiveKind struct {
+	Name       string
+	Extensions []string
+	Manifests  []string
+	// BinaryManifest is set for formats whose manifest isn't human-readable (e.g. compiled Android XML)
+	BinaryManifest bool
+}
+
+var archiveKinds = []archiveKind{
+	{Name: "Java archive", Extensions: []string{".jar", ".war", ".ear"}, Manifests: []string{"META-INF/MANIFEST.MF"}},
+	{Name: "Android package", Extensions: []string{".apk", ".aab"}, Manifests: []string{"AndroidManifest.xml", "base/manifest/AndroidManifest.xml"}, BinaryManifest: true},
+	{Name: "Browser extension", Extensions: []string{".xpi", ".crx"}, Manifests: []string{"manifest.json", "install.rdf"}},
+}
+
+func detectArchiveKind(uri string, files []*zipfile.CDR) (*archiveKind, *zipfile.CDR) {
+	ext := strings.ToLower(path.Ext(uri))
+	if parsed, err := url.Parse(uri); err == nil {
+		ext = strings.ToLower(path.Ext(parsed.Path))
+	}
+	byName := make(map[string]*zipfile.CDR, len(files))
+	for _, f := range files {
+		byName[f.FileName] = f
+	}
+	// prefer matching by extension, fall back to looking for a known manifest
+	for _, matchExt := range []bool{true, false} {
+		for i, kind := range archiveKinds {
+			if matchExt && !containsString(kind.Extensions, ext) {
+				continue
+			}
+			for _, manifest := range kind.Manifests {
+				if f, ok := byName[manifest]; ok {
+					return &archiveKinds[i], f
+				}
+			}
+			if matchExt {
+				return &archiveKinds[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+var inspectCmd = &cobra.Command{
+	Use:     "inspect",
+	Short:   "Identify zip-based package formats (jar, apk, xpi) and print their manifest",
+	Example: "cz inspect s3://example-bucket/path/to/app.jar",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri, err := expandStdin(args[0])
+		if err != nil {
+			die("could not read stdin: %v\n", err)
+		}
+		files := getCdr(uri)
+		kind, manifest := detectArchiveKind(uri, files)
+		if kind == nil {
+			fmt.Printf("type: zip archive (no known package manifest found)\n")
+			return
+		}
+		fmt.Printf("type: %s\n", kind.Name)
+		if manifest == nil {
+			fmt.Printf("manifest: not found (expected one of: %s)\n", strings.Join(kind.Manifests, ", "))
+			return
+		}
+		fmt.Printf("manifest: %s (%s)\n", manifest.FileName, byteCountIEC(manifest.UncompressedSizeBytes))
+		if kind.BinaryManifest {
+			fmt.Printf("manifest is in a binary format, extract it with: cz cat %s %s\n", uri, manifest.FileName)
+			return
+		}
+		obj, err := openObject(uri)
+		if err != nil {
+			die("could not open zip file: %v\n", err)
+		}
+		fetcher := zipfile.NewStorageAdapter(cmd.Context(), obj)
+		reader, err := zipfile.ReaderForRecord(manifest, fetcher)
+		if err != nil {
+			die("could not open manifest: %v\n", err)
+		}
+		fmt.Println()
+		_, err = io.Copy(os.Stdout, reader)
+		if err != nil {
+			die("could not download manifest: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+}
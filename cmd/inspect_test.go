@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestDetectArchiveKind(t *testing.T) {
+	files := func(names ...string) []*zipfile.CDR {
+		var cdrs []*zipfile.CDR
+		for _, name := range names {
+			cdrs = append(cdrs, &zipfile.CDR{FileName: name})
+		}
+		return cdrs
+	}
+	cases := []struct {
+		name     string
+		uri      string
+		files    []*zipfile.CDR
+		kind     string
+		manifest string
+	}{
+		{"jar", "s3://bucket/app.jar", files("a.class", "META-INF/MANIFEST.MF"), "Java archive", "META-INF/MANIFEST.MF"},
+		{"extension case", "s3://bucket/APP.WAR", files("META-INF/MANIFEST.MF"), "Java archive", "META-INF/MANIFEST.MF"},
+		{"jar without manifest", "s3://bucket/app.jar", files("a.class"), "Java archive", ""},
+		{"bundle manifest", "s3://bucket/app.aab", files("base/manifest/AndroidManifest.xml"), "Android package", "base/manifest/AndroidManifest.xml"},
+		{"query string", "s3://bucket/addon.xpi?versionId=3", files("manifest.json"), "Browser extension", "manifest.json"},
+		{"manifest without extension", "s3://bucket/archive.zip", files("README", "manifest.json"), "Browser extension", "manifest.json"},
+		{"plain zip", "s3://bucket/archive.zip", files("README", "data.csv"), "", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kind, manifest := detectArchiveKind(c.uri, c.files)
+			var kindName, manifestName string
+			if kind != nil {
+				kindName = kind.Name
+			}
+			if manifest != nil {
+				manifestName = manifest.FileName
+			}
+			if kindName != c.kind || manifestName != c.manifest {
+				t.Errorf("expected %q with manifest %q, got %q with manifest %q", c.kind, c.manifest, kindName, manifestName)
+			}
+		})
+	}
+}
@@ -1,26 +1,96 @@
 package cmd
 
 import (
-	"fmt"
-	"time"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
 )
 
 var lsCmd = &cobra.Command{
 	Use:     "ls",
 	Short:   "List the files that exist in the remote zip archive",
-	Example: "ls s3://example-bucket/path/to/archive.zip",
+	Example: "ls --output csv s3://example-bucket/path/to/archive.zip",
 	Args:    cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		remoteFile := args[0]
-		for _, f := range getCdr(remoteFile) {
-			fmt.Printf("%s\t%-12d\t%-12d\t%s\t%s\n",
-				f.Mode, f.CompressedSizeBytes, f.UncompressedSizeBytes, f.Modified.Format(time.RFC822Z), f.FileName)
+		showIndex, err := cmd.Flags().GetBool("index")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		format := outputFormat(cmd)
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if asJSON {
+			format = outputJSON
+		}
+		hashFlag, err := cmd.Flags().GetString("hash")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		var algorithm zipfile.HashAlgorithm
+		if hashFlag != "" {
+			if algorithm, err = zipfile.ParseHashAlgorithm(hashFlag); err != nil {
+				die("%v\n", err)
+			}
+		}
+		withXattrs, err := cmd.Flags().GetBool("xattrs")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if withXattrs && format != outputJSON {
+			die("--xattrs requires --output json\n")
+		}
+		filters := entryFilters(cmd)
+		out := newEntryWriter(os.Stdout, format, showIndex, algorithm != "")
+		archive, records := getArchive(remoteFile)
+		var appleDoubles map[string]*zipfile.CDR
+		if withXattrs {
+			appleDoubles = zipfile.AppleDoubleIndex(records)
+		}
+		// filter here rather than in getArchive, so printed indices match the central directory order
+		for i, f := range records {
+			if !zipfile.MatchAll(f, filters...) {
+				continue
+			}
+			entry := newEntryHeader(i, f)
+			if algorithm != "" {
+				digest, err := archive.Hash(f, algorithm)
+				if err != nil {
+					die("could not hash %s: %v\n", f.FileName, err)
+				}
+				if digest != "" {
+					entry.Hash = string(algorithm) + ":" + digest
+				}
+			}
+			if appleDouble, ok := appleDoubles[strings.TrimSuffix(f.FileName, "/")]; ok {
+				if entry.Xattrs, err = archive.ExtendedAttributes(appleDouble); err != nil {
+					die("could not read extended attributes of %s: %v\n", f.FileName, err)
+				}
+			}
+			if err := out.Write(entry); err != nil {
+				die("could not write entry: %v\n", err)
+			}
+		}
+		if err := out.Close(); err != nil {
+			die("could not write entries: %v\n", err)
 		}
 	},
 }
 
 func init() {
+	addTimeFilterFlags(lsCmd)
+	addPatternFilterFlags(lsCmd)
+	addOutputFlag(lsCmd)
+	lsCmd.Flags().Bool("json", false, "same as --output json")
+	lsCmd.Flags().String("hash", "",
+		"also print a digest of each file's content, computed by reading the entry: sha256 or xxh64")
+	lsCmd.Flags().Bool("xattrs", false,
+		"also print the extended attributes of each entry stored by macOS archivers (in __MACOSX/), requires --output json")
+	lsCmd.Flags().Bool("index", false, "print the index of each entry in the central directory (see 'cat --index')")
 	rootCmd.AddCommand(lsCmd)
 }
@@ -11,15 +11,22 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/mount/dav"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
 )
 
 type mountServerStatus string
 
+// The mount server reports back to the launching process over a callback address, with a STATUS=message line
+// per connection. SUCCESS or ERROR is the final status. If the server was started with --callback-progress,
+// PROGRESS lines may come before it, while the index is being built.
 const (
-	mountServerStatusSuccess mountServerStatus = "SUCCESS"
-	mountServerStatusError   mountServerStatus = "ERROR"
+	mountServerStatusSuccess  mountServerStatus = "SUCCESS"
+	mountServerStatusError    mountServerStatus = "ERROR"
+	mountServerStatusProgress mountServerStatus = "PROGRESS"
 )
 
 type mountServerCallback struct {
@@ -27,33 +34,57 @@ type mountServerCallback struct {
 	Message string
 }
 
+// getMountServerCallback returns the status updates sent by the mount server, closing the channel after the final one
 func getMountServerCallback(callbackListener net.Listener) chan mountServerCallback {
 	statusUpdates := make(chan mountServerCallback)
 	go func() {
-		conn, err := callbackListener.Accept()
-		if err != nil {
-			die("could not receive communications from mount server")
-		}
-		var zeroTime time.Time
-		err = conn.SetReadDeadline(zeroTime)
-		if err != nil {
-			die("could not receive communications from mount server")
+		defer close(statusUpdates)
+		for {
+			msg := receiveCallback(callbackListener)
+			statusUpdates <- msg
+			if msg.Status != mountServerStatusProgress {
+				return
+			}
 		}
-
-		received, err := bufio.NewReader(conn).ReadString('\n')
-		if err != nil {
-			die("could not get back status from mount server: %v (received = '%s')", err, received)
-		}
-		received = strings.TrimSuffix(received, "\n")
-		parts := strings.SplitN(received, "=", 2)
-		msg := mountServerCallback{mountServerStatus(parts[0]), parts[1]}
-		statusUpdates <- msg
-		close(statusUpdates)
-		_ = conn.Close()
 	}()
 	return statusUpdates
 }
 
+func receiveCallback(callbackListener net.Listener) mountServerCallback {
+	conn, err := callbackListener.Accept()
+	if err != nil {
+		dieWithCode(errorCodeInternal, "could not receive communications from mount server")
+	}
+	defer func() { _ = conn.Close() }()
+	var zeroTime time.Time
+	err = conn.SetReadDeadline(zeroTime)
+	if err != nil {
+		dieWithCode(errorCodeInternal, "could not receive communications from mount server")
+	}
+
+	received, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		dieWithCode(errorCodeInternal, "could not get back status from mount server: %v (received = '%s')", err, received)
+	}
+	received = strings.TrimSuffix(received, "\n")
+	parts := strings.SplitN(received, "=", 2)
+	if len(parts) != 2 {
+		dieWithCode(errorCodeInternal, "unexpected status from mount server: '%s'", received)
+	}
+	return mountServerCallback{mountServerStatus(parts[0]), parts[1]}
+}
+
+// formatCallbackProgress encodes progress building the index as the message of a PROGRESS callback
+func formatCallbackProgress(p zipfile.Progress) string {
+	return fmt.Sprintf("entries_parsed=%d,bytes_read=%d,bytes_total=%d", p.EntriesParsed, p.BytesRead, p.BytesTotal)
+}
+
+func parseCallbackProgress(msg string) (zipfile.Progress, error) {
+	var p zipfile.Progress
+	_, err := fmt.Sscanf(msg, "entries_parsed=%d,bytes_read=%d,bytes_total=%d", &p.EntriesParsed, &p.BytesRead, &p.BytesTotal)
+	return p, err
+}
+
 var mountCmd = &cobra.Command{
 	Use:     "mount",
 	Short:   "Virtually mount the remote archive onto a local directory",
@@ -64,38 +95,74 @@ var mountCmd = &cobra.Command{
 		targetDirectory := args[1]
 		uri, err := expandStdin(remoteFile)
 		if err != nil {
-			_, _ = os.Stderr.WriteString(fmt.Sprintf("could not read stdin: %v\n", err))
-			os.Exit(1)
+			die("could not read stdin: %v\n", err)
 		}
-		cacheDir, err := cmd.Flags().GetString("cache-dir")
+		listenAddr, err := cmd.Flags().GetString("listen")
 		if err != nil {
 			die("could not parse command flags: %v\n", err)
 		}
-		listenAddr, err := cmd.Flags().GetString("listen")
+		noSpawn, err := cmd.Flags().GetBool("no-spawn")
 		if err != nil {
 			die("could not parse command flags: %v\n", err)
 		}
-		noSpawn, err := cmd.Flags().GetBool("no-spawn")
+		protocol, err := cmd.Flags().GetString("protocol")
 		if err != nil {
 			die("could not parse command flags: %v\n", err)
 		}
-		logFile, err := cmd.Flags().GetString("log")
+		if protocol == "grpc" {
+			die("the 'grpc' protocol can't be mounted as a directory, serve it with 'cz mount-server --protocol grpc' instead\n")
+		}
+		if protocol == "" {
+			protocol = selectProtocol()
+		}
+		tlsCert, err := cmd.Flags().GetString("tls-cert")
 		if err != nil {
 			die("could not parse command flags: %v\n", err)
 		}
-		protocol, err := cmd.Flags().GetString("protocol")
+		tlsKey, err := cmd.Flags().GetString("tls-key")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		tlsSelfSigned, err := cmd.Flags().GetBool("tls-self-signed")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		useTLS := tlsCert != "" || tlsKey != "" || tlsSelfSigned
+		htpasswdFile, err := cmd.Flags().GetString("htpasswd")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		authTokenFile, err := cmd.Flags().GetString("auth-token-file")
 		if err != nil {
 			die("could not parse command flags: %v\n", err)
 		}
+		webdavUser, err := cmd.Flags().GetString("webdav-user")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		var webdavOpts []mount.WebDavMountOpt
+		if protocol == "webdav" {
+			user, password, err := webdavClientCredentials(webdavUser, htpasswdFile, authTokenFile)
+			if err != nil {
+				die("could not setup authentication: %v\n", err)
+			}
+			if user != "" || password != "" {
+				webdavOpts = append(webdavOpts, mount.WithWebDavCredentials(user, password))
+			}
+		}
 
-		serverCmd := []string{"mount-server", uri}
-		if cacheDir != "" {
-			serverCmd = append(serverCmd, "--cache-dir", cacheDir)
+		partSize, err := cmd.Flags().GetInt64("part-size")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
 		}
-		if listenAddr != "" {
-			serverCmd = append(serverCmd, "--listen", listenAddr)
+		if partSize < 0 {
+			die("--part-size must not be negative\n")
 		}
 
+		// fail on malformed tags before spawning the server
+		mountLabels(cmd)
+		serverCmd := append([]string{"mount-server", uri}, mountServerArgs(cmd)...)
+
 		var serverAddr string
 		if !noSpawn {
 			callbackListener, err := net.Listen("tcp4", "127.0.0.1:0")
@@ -103,10 +170,7 @@ var mountCmd = &cobra.Command{
 				die("could not spawn mount server: %v\n", err)
 			}
 			callbackAddr := callbackListener.Addr().String()
-			serverCmd = append(serverCmd, "--callback-addr", callbackAddr)
-			if logFile != "" {
-				serverCmd = append(serverCmd, "--log", logFile)
-			}
+			serverCmd = append(serverCmd, "--callback-addr", callbackAddr, "--callback-progress")
 			switch protocol {
 			case "nfs", "webdav":
 				serverCmd = append(serverCmd, "--protocol", protocol)
@@ -118,12 +182,27 @@ var mountCmd = &cobra.Command{
 			if err != nil {
 				die("could not spawn mount server: %v\n", err)
 			}
-			callback := <-serverStatus
-			switch callback.Status {
-			case mountServerStatusSuccess:
-				serverAddr = callback.Message
-			case mountServerStatusError:
-				die("mount server initialization error:\n%s\n", callback.Message)
+			showProgress := isTerminal(os.Stderr)
+			for callback := range serverStatus {
+				if callback.Status == mountServerStatusProgress {
+					if p, err := parseCallbackProgress(callback.Message); err == nil && showProgress {
+						printProgress(p)
+					}
+					continue
+				}
+				if showProgress {
+					_, _ = os.Stderr.WriteString("\r\033[K") // clear progress line
+				}
+				switch callback.Status {
+				case mountServerStatusSuccess:
+					serverAddr = strings.TrimPrefix(callback.Message, "https://")
+				case mountServerStatusError:
+					e := parseCommandError(callback.Message)
+					if errorFormat != errorFormatJSON {
+						e.Message = "mount server initialization error:\n" + e.Message
+					}
+					exitWithError(e)
+				}
 			}
 			_ = callbackListener.Close()
 			slog.Info("mount server started", "pid", pid, "listen_addr", serverAddr, "protocol", protocol)
@@ -147,10 +226,10 @@ var mountCmd = &cobra.Command{
 		switch protocol {
 		case "nfs":
 			if err := mount.NFSMount(serverAddr, targetDirectory); err != nil {
-				die("could not run mount command: %v\n", err)
+				die("could not run mount command: %v\n%s", err, nfsMountHint(serverAddr, targetDirectory))
 			}
 		case "webdav":
-			if err := mount.WebDavMount(serverAddr, targetDirectory); err != nil {
+			if err := mount.WebDavMount(serverAddr, targetDirectory, useTLS, webdavOpts...); err != nil {
 				die("could not run mount command: %v\n", err)
 			}
 		default:
@@ -160,15 +239,122 @@ var mountCmd = &cobra.Command{
 }
 
 func init() {
-	var defaultProtocol = "nfs"
-	if runtime.GOOS == "windows" {
-		defaultProtocol = "webdav"
-	}
 	mountCmd.Flags().String("cache-dir", "", "directory to cache read files in")
 	mountCmd.Flags().StringP("listen", "l", MountServerBindAddress, "address to listen on")
 	mountCmd.Flags().String("log", "", "log file for the server to write to")
 	mountCmd.Flags().Bool("no-spawn", false, "will not spawn a new server, assume one is already running")
-	mountCmd.Flags().String("protocol", defaultProtocol, "protocol to use (nfs | webdav)")
+	mountCmd.Flags().String("protocol", "", "protocol to use (nfs | webdav), by default nfs, or webdav where NFS can't be mounted")
+	mountCmd.Flags().String("tls-cert", "", "TLS certificate file to serve WebDAV over HTTPS")
+	mountCmd.Flags().String("tls-key", "", "TLS private key file to serve WebDAV over HTTPS")
+	mountCmd.Flags().Bool("tls-self-signed", false, "serve WebDAV over HTTPS using a generated self-signed certificate")
+	mountCmd.Flags().String("htpasswd", "", "htpasswd file with users allowed to access the WebDAV server (bcrypt or SHA1 hashes)")
+	mountCmd.Flags().String("auth-token-file", "", "file containing a bearer token required to access the WebDAV server")
+	mountCmd.Flags().String("webdav-user", "", "user to mount the WebDAV server as, with the password in "+webdavPasswordEnvironmentVariableName)
+	mountCmd.Flags().String("access-log", "", "file to append an access log of WebDAV requests to, in the format of --access-log-format")
+	mountCmd.Flags().String("access-log-format", string(dav.AccessLogCommon), "format of the WebDAV access log (common | combined), NCSA Common or Combined Log Format")
+	mountCmd.Flags().String("cache-warm-from", "", "directory the archive was previously extracted to, used to seed the cache with matching files")
+	mountCmd.Flags().String("cache-policy", "cache", "whether read files are kept in the cache (cache | bypass)")
+	mountCmd.Flags().Duration("cache-ttl", 0, "check cached files against the archive when opened, once cached longer than this ago (e.g. 1h), 0 to never")
+	mountCmd.Flags().Int("max-open-files", 0, "maximum number of files open at once, further opens wait (0 for no limit)")
+	mountCmd.Flags().Bool("allow-stale-cache", false, "keep the central directory in --cache-dir, and mount from the cache (serving only cached files) when the archive can't be read")
+	mountCmd.Flags().String("normalize", "none", "Unicode normalization of entry names and lookups (nfc | nfd | none)")
+	mountCmd.Flags().Int64("block-cache-size", 0, "keep blocks of this many bytes read from the archive in --cache-dir, so that ranges read again are served locally (0 to disable)")
+	mountCmd.Flags().String("verify-signature", "", "refuse to mount unless the archive's detached GPG signature (see --signature-uri) was made by a key in this keyring file")
+	mountCmd.Flags().String("signature-uri", "", "URI of the detached signature checked by --verify-signature (default: the archive's URI, with '.asc' appended)")
+	mountCmd.Flags().Bool("mmap-cache", false, "read cached files through a memory mapping, for entries read over and over")
+	mountCmd.Flags().String("index-url", "", "URI of an index written by 'cz index', read instead of the archive's central directory if it was built from the same archive")
+	mountCmd.Flags().Bool("cache-readonly", false, "serve files from --cache-dir without ever writing to it, reading files that aren't cached from the archive every time")
+	mountCmd.Flags().String("cache-encryption-key-file", "", "file containing a key used to encrypt cached files at rest")
+	mountCmd.Flags().Uint64("entry-limit-bytes", 0, "refuse to open entries larger than this (uncompressed), 0 for no limit")
+	addTimeFilterFlags(mountCmd)
+	addPatternFilterFlags(mountCmd)
+	addAllowedMethodsFlag(mountCmd)
+	addConcurrencyFlags(mountCmd)
+	addParallelReadFlags(mountCmd)
+	addNameMappingFlags(mountCmd)
+	addIdleTimeoutFlag(mountCmd)
+	addVerifyFlag(mountCmd)
+	addPrewarmFlags(mountCmd)
+	addVerifyReadsFlag(mountCmd)
+	addMountLabelFlags(mountCmd)
+	mountCmd.Flags().Bool("probe-range", false, "before serving, check that the backend honors range requests and the archive starts with a zip signature")
+	mountCmd.Flags().Bool("keep-backslashes", false, "keep backslashes in entry names instead of treating them as path separators")
+	mountCmd.Flags().Bool("raw", false, "expose the remote archive as a single file instead of its contents")
 	_ = mountCmd.Flags().MarkHidden("no-spawn")
 	rootCmd.AddCommand(mountCmd)
 }
+
+// mountServerArgs returns the flags set on cmd (on the command line or in the config file) that the spawned
+// mount server accepts too, so that every flag registered on both commands is passed on as given.
+// The server keeps cz mount's working directory and environment, so relative paths resolve the same way.
+// --protocol is left out, as cz mount picks the protocol when it isn't given.
+func mountServerArgs(cmd *cobra.Command) []string {
+	var args []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name == "protocol" || mountServerCmd.Flag(f.Name) == nil {
+			return
+		}
+		if values, ok := f.Value.(pflag.SliceValue); ok {
+			for _, value := range values.GetSlice() {
+				args = append(args, fmt.Sprintf("--%s=%s", f.Name, value))
+			}
+			return
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+	})
+	return args
+}
+
+// webdavClientCredentials returns the credentials cz mounts an authenticated WebDAV server with:
+// --webdav-user with its password from the environment, or the bearer token, which the server also accepts
+// as a Basic password. An htpasswd file only holds hashes, so it can't be mounted without --webdav-user.
+func webdavClientCredentials(webdavUser, htpasswdFile, tokenFile string) (string, string, error) {
+	if webdavUser != "" {
+		password := os.Getenv(webdavPasswordEnvironmentVariableName)
+		if password == "" {
+			return "", "", fmt.Errorf("--webdav-user requires the password in %s", webdavPasswordEnvironmentVariableName)
+		}
+		return webdavUser, password, nil
+	}
+	token, err := webdavToken(tokenFile)
+	if err != nil {
+		return "", "", err
+	}
+	if token != "" {
+		return "cz", token, nil
+	}
+	if htpasswdFile != "" {
+		return "", "", fmt.Errorf("--htpasswd requires --webdav-user and %s to mount the server",
+			webdavPasswordEnvironmentVariableName)
+	}
+	return "", "", nil
+}
+
+// selectProtocol picks the protocol to mount with when --protocol isn't given: NFS, unless this host can't mount it.
+// WebDAV is used instead where cz can mount it (Windows, macOS), elsewhere the NFS client is required, so this fails
+// before spawning a server that can't be mounted. Passing --protocol nfs always serves NFS.
+func selectProtocol() string {
+	err := mount.CheckNFSClient()
+	if err == nil {
+		return "nfs"
+	}
+	if runtime.GOOS == mount.GOOSWindows || runtime.GOOS == mount.GOOSMacOS {
+		slog.Info("NFS can't be mounted on this host, mounting over WebDAV", "reason", err)
+		return "webdav"
+	}
+	die("could not mount: %v\n\n"+
+		"Install the NFS client utilities (e.g. 'apt install nfs-common' or 'dnf install nfs-utils'), or serve the archive\n"+
+		"with 'cz mount-server --protocol webdav' and mount it with a WebDAV client such as davfs2.\n"+
+		"Pass '--protocol nfs' to start the NFS server anyway, and mount it manually.\n", err)
+	return ""
+}
+
+// nfsMountHint explains how to recover from a failed NFS mount: the server is still running,
+// so it can be mounted manually (no rpcbind/portmap needed), or remounted with WebDAV
+func nfsMountHint(serverAddr, targetDirectory string) string {
+	hint := "\nThe mount server is still listening at " + serverAddr + ".\n"
+	if command, err := mount.NFSMountCommand(serverAddr, targetDirectory); err == nil {
+		hint += "It can be mounted manually (rpcbind/portmap isn't required) with:\n\n\t" + command + "\n\n"
+	}
+	return hint + "If NFS isn't available in this environment, use '--protocol webdav' instead.\n"
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/ozkatz/cloudzip/pkg/mount/dav"
 	"io"
@@ -9,28 +11,40 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 
 	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	mountgrpc "github.com/ozkatz/cloudzip/pkg/mount/grpc"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
 	"github.com/ozkatz/cloudzip/pkg/mount/nfs"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
 )
 
 const (
-	cacheDirEnvironmentVariableName = "CLOUDZIP_CACHE_DIR"
+	cacheDirEnvironmentVariableName       = "CLOUDZIP_CACHE_DIR"
+	webdavTokenEnvironmentVariableName    = "CLOUDZIP_WEBDAV_TOKEN"
+	webdavPasswordEnvironmentVariableName = "CLOUDZIP_WEBDAV_PASSWORD"
+	cacheKeyEnvironmentVariableName       = "CLOUDZIP_CACHE_ENCRYPTION_KEY"
 )
 
 func dieWithCallback(toAddr, fstring string, args ...interface{}) {
-	errMessage := fmt.Sprintf(fstring, args...)
+	e := newCommandError(fstring, args...)
 	var err error
 	if toAddr != "" {
-		err = sendCallback(toAddr, mountServerStatusError, errMessage)
+		err = sendCallback(toAddr, mountServerStatusError, e.String())
 	}
 	if err != nil {
-		errMessage += fmt.Sprintf(" (could not notify callback address %s: %v)", toAddr, err)
+		e.Message += fmt.Sprintf(" (could not notify callback address %s: %v)", toAddr, err)
 	}
-	die(errMessage)
+	exitWithError(e)
 }
 
 func sendCallback(toAddr string, className mountServerStatus, msg string) error {
@@ -45,6 +59,26 @@ func sendCallback(toAddr string, className mountServerStatus, msg string) error
 	return conn.Close()
 }
 
+// callbackProgressInterval is how often progress building the index is reported to the callback address, at most
+const callbackProgressInterval = time.Second
+
+// callbackProgress reports progress building the index to the launching process, as PROGRESS callbacks
+type callbackProgress struct {
+	toAddr string
+	last   time.Time
+	done   bool
+}
+
+func (c *callbackProgress) report(p zipfile.Progress) {
+	done := p.BytesTotal > 0 && p.BytesRead >= p.BytesTotal
+	if c.done || (!done && time.Since(c.last) < callbackProgressInterval) {
+		return
+	}
+	c.last, c.done = time.Now(), done
+	// progress is best effort: if the launcher went away, the final status can't be delivered either
+	_ = sendCallback(c.toAddr, mountServerStatusProgress, formatCallbackProgress(p))
+}
+
 func serverLogging(logFile string) (*slog.Logger, error) {
 	writer := io.Discard
 	var err error
@@ -65,6 +99,96 @@ func serverLogging(logFile string) (*slog.Logger, error) {
 	return slog.New(handler), nil
 }
 
+// mountLogAttrs returns the labels added to every log record of a mount: its ID, its name if it has one, and its tags
+func mountLogAttrs(id, name string, tags map[string]string) []any {
+	attrs := []any{slog.String("mount_id", id)}
+	if name != "" {
+		attrs = append(attrs, slog.String("mount_name", name))
+	}
+	if len(tags) > 0 {
+		var tagAttrs []any
+		for _, key := range sortedKeys(tags) {
+			tagAttrs = append(tagAttrs, slog.String(key, tags[key]))
+		}
+		attrs = append(attrs, slog.Group("tags", tagAttrs...))
+	}
+	return attrs
+}
+
+// formatTags formats tags as key=value lines, sorted by key, as exposed in .cz/tags
+func formatTags(tags map[string]string) string {
+	var b strings.Builder
+	for _, key := range sortedKeys(tags) {
+		fmt.Fprintf(&b, "%s=%s\n", key, tags[key])
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readKeyring reads the public keys of a keyring file, armored or binary. It returns no keys if filename is empty.
+func readKeyring(filename string) (openpgp.EntityList, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	keyring, err := remote.ReadKeyring(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("%s: no keys found", filename)
+	}
+	return keyring, nil
+}
+
+// webdavAuth builds the WebDAV authenticator from an htpasswd file and/or a static bearer token.
+// The token is read from a file or the environment so that it never shows up in the process list.
+func webdavAuth(htpasswdFile, tokenFile string) (dav.Authenticator, error) {
+	var authenticators dav.AnyAuth
+	if htpasswdFile != "" {
+		basicAuth, err := dav.LoadHtpasswd(htpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, basicAuth)
+	}
+	token, err := webdavToken(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		authenticators = append(authenticators, &dav.BearerTokenAuth{Token: token})
+	}
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	return authenticators, nil
+}
+
+// webdavToken returns the bearer token read from tokenFile, or otherwise from the environment
+func webdavToken(tokenFile string) (string, error) {
+	if tokenFile == "" {
+		return os.Getenv(webdavTokenEnvironmentVariableName), nil
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 var mountServerCmd = &cobra.Command{
 	Use:    "mount-server",
 	Hidden: true,
@@ -84,6 +208,13 @@ var mountServerCmd = &cobra.Command{
 		if err != nil {
 			die("could not parse command flags: %v\n", err)
 		}
+		if err := connectVia(cmd); err != nil {
+			dieWithCallback(callbackAddr, "%v\n", err)
+		}
+		reportProgress, err := cmd.Flags().GetBool("callback-progress")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
 		logFile, err := cmd.Flags().GetString("log")
 		if err != nil {
 			die("could not parse command flags: %v\n", err)
@@ -92,6 +223,242 @@ var mountServerCmd = &cobra.Command{
 		if err != nil {
 			die("could not parse command flags: %v\n", err)
 		}
+		tlsCert, err := cmd.Flags().GetString("tls-cert")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		tlsKey, err := cmd.Flags().GetString("tls-key")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		tlsSelfSigned, err := cmd.Flags().GetBool("tls-self-signed")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		useTLS := tlsCert != "" || tlsKey != "" || tlsSelfSigned
+		if useTLS && protocol != "webdav" {
+			dieWithCallback(callbackAddr, "TLS is only supported with the 'webdav' protocol")
+		}
+		htpasswdFile, err := cmd.Flags().GetString("htpasswd")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		authTokenFile, err := cmd.Flags().GetString("auth-token-file")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		entryLimit, err := cmd.Flags().GetUint64("entry-limit-bytes")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		minConcurrency, err := cmd.Flags().GetInt("min-concurrency")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		maxConcurrency, err := cmd.Flags().GetInt("max-concurrency")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		var limiter *remote.ConcurrencyLimiter
+		if maxConcurrency > 0 {
+			limiter = remote.NewConcurrencyLimiter(minConcurrency, maxConcurrency)
+		}
+		readParallelism, err := cmd.Flags().GetInt("read-parallelism")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		partSize, err := cmd.Flags().GetInt64("part-size")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if partSize < 0 {
+			dieWithCallback(callbackAddr, "--part-size must not be negative")
+		}
+		idleTimeout, err := cmd.Flags().GetDuration("idle-timeout")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		raw, err := cmd.Flags().GetBool("raw")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		prewarm, err := cmd.Flags().GetBool("prewarm")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		prewarmMatch, err := cmd.Flags().GetStringArray("prewarm-match")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		prewarmConcurrency, err := cmd.Flags().GetInt("prewarm-concurrency")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		verifyReads, err := cmd.Flags().GetBool("verify")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		probeRange, err := cmd.Flags().GetBool("probe-range")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		keepBackslashes, err := cmd.Flags().GetBool("keep-backslashes")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		cacheWarmFrom, err := cmd.Flags().GetString("cache-warm-from")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		flattenSingle, err := cmd.Flags().GetBool("flatten-single")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		allowStaleCache, err := cmd.Flags().GetBool("allow-stale-cache")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if prewarm && raw {
+			dieWithCallback(callbackAddr, "--prewarm is not supported with --raw")
+		}
+		if (len(nameMappers(cmd)) > 0 || flattenSingle) && raw {
+			dieWithCallback(callbackAddr, "--strip-prefix, --add-prefix and --flatten-single are not supported with --raw")
+		}
+		if allowStaleCache && raw {
+			dieWithCallback(callbackAddr, "--allow-stale-cache is not supported with --raw")
+		}
+		if cacheWarmFrom != "" && raw {
+			dieWithCallback(callbackAddr, "--cache-warm-from is not supported with --raw")
+		}
+		cachePolicyName, err := cmd.Flags().GetString("cache-policy")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		cachePolicy, err := fs.ParseCachePolicy(cachePolicyName)
+		if err != nil {
+			dieWithCallback(callbackAddr, "%v\n", err)
+		}
+		if cachePolicy == fs.CachePolicyBypass && prewarm {
+			dieWithCallback(callbackAddr, "--prewarm is not supported with --cache-policy bypass")
+		}
+		cacheTTL, err := cmd.Flags().GetDuration("cache-ttl")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if cacheTTL < 0 {
+			dieWithCallback(callbackAddr, "--cache-ttl must not be negative")
+		}
+		if cacheTTL > 0 && raw {
+			dieWithCallback(callbackAddr, "--cache-ttl is not supported with --raw")
+		}
+		maxOpenFiles, err := cmd.Flags().GetInt("max-open-files")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		normalizationName, err := cmd.Flags().GetString("normalize")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		normalization, err := mount.ParseNormalization(normalizationName)
+		if err != nil {
+			dieWithCallback(callbackAddr, "%v\n", err)
+		}
+		cacheKeyFile, err := cmd.Flags().GetString("cache-encryption-key-file")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		cacheKey := []byte(os.Getenv(cacheKeyEnvironmentVariableName))
+		if cacheKeyFile != "" {
+			cacheKey, err = os.ReadFile(cacheKeyFile)
+			if err != nil {
+				dieWithCallback(callbackAddr, "could not read cache encryption key: %v\n", err)
+			}
+		}
+		blockCacheSize, err := cmd.Flags().GetInt64("block-cache-size")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if blockCacheSize < 0 {
+			dieWithCallback(callbackAddr, "--block-cache-size must not be negative")
+		}
+		if blockCacheSize > 0 && len(cacheKey) > 0 {
+			dieWithCallback(callbackAddr, "--block-cache-size is not supported with cache encryption, cached blocks aren't encrypted")
+		}
+		mmapCache, err := cmd.Flags().GetBool("mmap-cache")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if mmapCache && len(cacheKey) > 0 {
+			dieWithCallback(callbackAddr, "--mmap-cache is not supported with cache encryption, encrypted files are decrypted as they are read")
+		}
+		indexURI, err := cmd.Flags().GetString("index-url")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if indexURI != "" && raw {
+			dieWithCallback(callbackAddr, "--index-url is not supported with --raw")
+		}
+		cacheReadOnly, err := cmd.Flags().GetBool("cache-readonly")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if cacheReadOnly && prewarm {
+			dieWithCallback(callbackAddr, "--prewarm is not supported with --cache-readonly")
+		}
+		if cacheReadOnly && verifyReads {
+			dieWithCallback(callbackAddr, "--verify is not supported with --cache-readonly, entries that aren't cached are read at random offsets")
+		}
+		if cacheReadOnly && blockCacheSize > 0 {
+			dieWithCallback(callbackAddr, "--block-cache-size is not supported with --cache-readonly, blocks are kept in --cache-dir")
+		}
+		keyringFile, err := cmd.Flags().GetString("verify-signature")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		signatureURI, err := cmd.Flags().GetString("signature-uri")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		if signatureURI != "" && keyringFile == "" {
+			dieWithCallback(callbackAddr, "--signature-uri requires --verify-signature")
+		}
+		keyring, err := readKeyring(keyringFile)
+		if err != nil {
+			dieWithCallback(callbackAddr, "could not read keyring for --verify-signature: %v\n", err)
+		}
+		if (htpasswdFile != "" || authTokenFile != "") && protocol != "webdav" {
+			dieWithCallback(callbackAddr, "authentication is only supported with the 'webdav' protocol")
+		}
+		var auth dav.Authenticator
+		if protocol == "webdav" {
+			// the token variable may be exported for other mounts, so it only applies to WebDAV servers
+			auth, err = webdavAuth(htpasswdFile, authTokenFile)
+			if err != nil {
+				dieWithCallback(callbackAddr, "could not setup authentication: %v\n", err)
+			}
+		}
+		accessLogFile, err := cmd.Flags().GetString("access-log")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		accessLogFormatFlag, err := cmd.Flags().GetString("access-log-format")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		accessLogFormat, err := dav.ParseAccessLogFormat(accessLogFormatFlag)
+		if err != nil {
+			dieWithCallback(callbackAddr, "could not parse --access-log-format: %v\n", err)
+		}
+		var accessLog io.Writer
+		if accessLogFile != "" {
+			if protocol != "webdav" {
+				dieWithCallback(callbackAddr, "access logs are only supported with the 'webdav' protocol")
+			}
+			accessLog, err = os.OpenFile(accessLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				dieWithCallback(callbackAddr, "could not open access log %s: %v\n", accessLogFile, err)
+			}
+		}
 
 		// setup logging
 		logger, err := serverLogging(logFile)
@@ -100,6 +467,12 @@ var mountServerCmd = &cobra.Command{
 				dieWithCallback(callbackAddr, "could not open log file %s: %v\n", logFile, err)
 			}
 		}
+		mountID := uuid.Must(uuid.NewV7()).String()
+		mountName, tags := mountLabels(cmd)
+		logger = logger.With(mountLogAttrs(mountID, mountName, tags)...)
+		if jumpHost != nil {
+			jumpHost.SetLogger(logger)
+		}
 
 		logger.InfoContext(
 			cmd.Context(),
@@ -114,8 +487,14 @@ var mountServerCmd = &cobra.Command{
 		if cacheDir == "" {
 			cacheDir = os.Getenv(cacheDirEnvironmentVariableName)
 		}
+		if cacheDir == "" && cacheReadOnly {
+			dieWithCallback(callbackAddr, "--cache-readonly requires --cache-dir, the cache to read files from")
+		}
 		if cacheDir == "" {
-			cacheDir = filepath.Join(os.TempDir(), "cz-mount-cache", uuid.Must(uuid.NewV7()).String())
+			if allowStaleCache {
+				logger.Warn("--allow-stale-cache has no effect without --cache-dir: the default cache directory is removed on exit")
+			}
+			cacheDir = filepath.Join(os.TempDir(), "cz-mount-cache", mountID)
 			// auto generated cache dir. Let's try and remove it when done:
 			defer func() {
 				err := os.RemoveAll(cacheDir)
@@ -129,6 +508,9 @@ var mountServerCmd = &cobra.Command{
 			dieWithCallback(callbackAddr, "could not check if cache directory '%s' exists: %v\n", cacheDir, err)
 		}
 
+		if !dirExists && cacheReadOnly {
+			dieWithCallback(callbackAddr, "cache directory '%s' does not exist, and isn't created with --cache-readonly\n", cacheDir)
+		}
 		if !dirExists {
 			err := os.MkdirAll(cacheDir, 0755)
 			if err != nil {
@@ -141,23 +523,117 @@ var mountServerCmd = &cobra.Command{
 		if err != nil {
 			dieWithCallback(callbackAddr, "could not listen on %s: %v\n", listenAddr, err)
 		}
+		activity := mount.NewActivityTracker()
+		listener = activity.Listener(listener)
 		boundAddr := listener.Addr()
+		serverURL := fmt.Sprintf("http://%s", boundAddr)
+		if useTLS {
+			host, _, _ := net.SplitHostPort(boundAddr.String())
+			tlsConfig, err := dav.TLSConfig(tlsCert, tlsKey, tlsSelfSigned, host, "localhost")
+			if err != nil {
+				dieWithCallback(callbackAddr, "could not setup TLS: %v\n", err)
+			}
+			listener = tls.NewListener(listener, tlsConfig)
+			serverURL = fmt.Sprintf("https://%s", boundAddr)
+		}
 
 		// build index for remote archive
-		tree, err := mount.BuildZipTree(ctx, logger, cacheDir, remoteFile, map[string]interface{}{
+		stats := &remote.Stats{}
+		attrs := map[string]interface{}{
 			"listen_addr": boundAddr,
+			"url":         serverURL,
 			"protocol":    protocol,
 			"version":     CloudZipVersion,
 			"logfile":     logFile,
-		})
-		if err != nil {
+			"mount_id":    mountID,
+		}
+		if mountName != "" {
+			attrs["mount_name"] = mountName
+		}
+		if len(tags) > 0 {
+			attrs["tags"] = formatTags(tags)
+		}
+		var blockCacheDir string
+		if blockCacheSize > 0 {
+			blockCacheDir = filepath.Join(cacheDir, "blocks")
+		}
+		var tree index.Tree
+		if raw {
+			tree, err = mount.BuildRawTree(ctx, logger, remoteFile, attrs,
+				mount.WithProbeRange(probeRange), mount.WithStats(stats), mount.WithConcurrencyLimiter(limiter), mount.WithParallelReads(partSize, readParallelism), mount.WithNormalization(normalization), mount.WithURIResolver(uriResolvers()...), mount.WithObjectOpts(objectOpts()...),
+				mount.WithBlockCache(blockCacheDir, blockCacheSize),
+				mount.WithSignature(keyring, signatureURI))
+		} else {
+			progress := &callbackProgress{toAddr: callbackAddr}
+			tree, err = mount.BuildZipTree(ctx, logger, cacheDir, remoteFile, attrs, mount.WithProgress(func(p zipfile.Progress) {
+				logger.DebugContext(ctx, "building index",
+					"entries_parsed", p.EntriesParsed, "bytes_read", p.BytesRead, "bytes_total", p.BytesTotal)
+				if reportProgress && callbackAddr != "" {
+					progress.report(p)
+				}
+			}), mount.WithStats(stats), mount.WithConcurrencyLimiter(limiter), mount.WithParallelReads(partSize, readParallelism), mount.WithEntryLimit(entryLimit),
+				mount.WithAllowedMethods(allowedMethods(cmd)),
+				mount.WithVerify(verifyLevel(cmd)),
+				mount.WithKeepBackslashes(keepBackslashes),
+				mount.WithProbeRange(probeRange),
+				mount.WithVerifyReads(verifyReads),
+				mount.WithChecksumAlgorithm(checksumAlgorithm(cmd)),
+				mount.WithCacheEncryptionKey(cacheKey),
+				mount.WithMmapCache(mmapCache),
+				mount.WithReadOnlyCache(cacheReadOnly),
+				mount.WithIndexURI(indexURI),
+				mount.WithCacheWarmFrom(cacheWarmFrom),
+				mount.WithCachePolicy(cachePolicy),
+				mount.WithCacheTTL(cacheTTL),
+				mount.WithMaxOpenFiles(maxOpenFiles),
+				mount.WithNameMapper(nameMappers(cmd)...),
+				mount.WithNormalization(normalization),
+				mount.WithFlattenSingleEntry(flattenSingle),
+				mount.WithScanForStart(scanForStart()),
+				mount.WithTolerant(tolerant()),
+				mount.WithConcatenated(concatenatedPolicy()),
+				mount.WithAllowStaleCache(allowStaleCache),
+				mount.WithFilter(entryFilters(cmd)...),
+				mount.WithURIResolver(uriResolvers()...),
+				mount.WithObjectOpts(objectOpts()...),
+				mount.WithBlockCache(blockCacheDir, blockCacheSize),
+				mount.WithSignature(keyring, signatureURI))
+		}
+		if errors.Is(err, remote.ErrBadSignature) {
+			dieWithCallback(callbackAddr, "refusing to mount, the archive's signature doesn't verify: %v\n", err)
+		} else if errors.Is(err, zipfile.ErrRangeIgnored) {
+			dieWithCallback(callbackAddr, "range probe failed, the backend doesn't support range requests: %v\n", err)
+		} else if err != nil {
 			dieWithCallback(callbackAddr, "could not create filesystem: %v\n", err)
 		}
+		if prewarm {
+			prewarmStart := time.Now()
+			err = mount.Prewarm(ctx, tree, prewarmMatch, prewarmConcurrency, func(p mount.PrewarmProgress) {
+				if p.Entries%100 == 0 || p.Entries == p.EntriesTotal {
+					logger.InfoContext(ctx, "prewarming cache",
+						"entries", p.Entries, "entries_total", p.EntriesTotal,
+						"bytes", p.BytesDone, "bytes_total", p.BytesTotal)
+				}
+			})
+			if err != nil {
+				dieWithCallback(callbackAddr, "could not prewarm cache: %v\n", err)
+			}
+			logger.InfoContext(ctx, "prewarmed cache", "took_ms", time.Since(prewarmStart).Milliseconds())
+		}
 
 		// setup signal handling
 		ctx, cancelFn := signal.NotifyContext(ctx, os.Interrupt) // SIGTERM
 		defer cancelFn()
 
+		if idleTimeout > 0 {
+			go func() {
+				if activity.WaitIdle(ctx, idleTimeout) {
+					logger.InfoContext(ctx, "idle timeout reached, shutting down", "idle_timeout", idleTimeout)
+					cancelFn()
+				}
+			}()
+		}
+
 		if protocol == "nfs" {
 			handler := nfs.NewHandler(ctx, tree, &nfs.Options{
 				Logger:          logger,
@@ -173,20 +649,40 @@ var mountServerCmd = &cobra.Command{
 			}()
 		} else if protocol == "webdav" {
 			go func() {
-				err = dav.Serve(listener, tree, logger)
+				err = dav.Serve(listener, tree, &dav.Options{
+					Logger:          logger,
+					Auth:            auth,
+					AccessLog:       accessLog,
+					AccessLogFormat: accessLogFormat,
+				})
 				if err != nil {
 					dieWithCallback(callbackAddr,
 						"could not serve WebDav server on listener: %s: %v\n",
 						boundAddr, err)
 				}
 			}()
+		} else if protocol == "grpc" {
+			go func() {
+				err = mountgrpc.Serve(listener, tree, &mountgrpc.Options{
+					Logger: logger,
+				})
+				if err != nil {
+					dieWithCallback(callbackAddr,
+						"could not serve gRPC server on listener: %s: %v\n",
+						boundAddr, err)
+				}
+			}()
 		} else {
 			dieWithCallback(callbackAddr,
-				"unknown protocol: '%s'. Supported types are 'nfs' and 'webdav'", protocol)
+				"unknown protocol: '%s'. Supported types are 'nfs', 'webdav' and 'grpc'", protocol)
 		}
 
 		if callbackAddr != "" {
-			err = sendCallback(callbackAddr, mountServerStatusSuccess, boundAddr.String())
+			reportAddr := boundAddr.String()
+			if useTLS {
+				reportAddr = serverURL
+			}
+			err = sendCallback(callbackAddr, mountServerStatusSuccess, reportAddr)
 			if err != nil {
 				die("could not send listen address back to caller: %v\n", err)
 			}
@@ -196,14 +692,53 @@ var mountServerCmd = &cobra.Command{
 			"mount server started successfully",
 			"bound_addr", boundAddr.String(), "protocol", protocol)
 		<-ctx.Done()
+		logger.Info("mount server stopped",
+			"requests", stats.Requests(), "bytes_read", stats.BytesRead(),
+			"part_size", stats.PartSize(), "peak_parallelism", stats.PeakParallelism())
 	},
 }
 
 func init() {
+	addTimeFilterFlags(mountServerCmd)
+	addPatternFilterFlags(mountServerCmd)
+	addAllowedMethodsFlag(mountServerCmd)
+	addConcurrencyFlags(mountServerCmd)
+	addParallelReadFlags(mountServerCmd)
+	addNameMappingFlags(mountServerCmd)
+	addIdleTimeoutFlag(mountServerCmd)
+	addVerifyFlag(mountServerCmd)
+	addPrewarmFlags(mountServerCmd)
+	addVerifyReadsFlag(mountServerCmd)
+	addMountLabelFlags(mountServerCmd)
+	mountServerCmd.Flags().Bool("probe-range", false, "before serving, check that the backend honors range requests and the archive starts with a zip signature")
+	mountServerCmd.Flags().Bool("keep-backslashes", false, "keep backslashes in entry names instead of treating them as path separators")
+	mountServerCmd.Flags().Bool("raw", false, "expose the remote archive as a single file instead of its contents")
 	mountServerCmd.Flags().String("cache-dir", "", "directory to cache read files in")
 	mountServerCmd.Flags().StringP("listen", "l", MountServerBindAddress, "address to listen on")
-	mountServerCmd.Flags().String("protocol", "nfs", "protocol to use (nfs | webdav)")
+	mountServerCmd.Flags().String("protocol", "nfs", "protocol to use (nfs | webdav | grpc)")
 	mountServerCmd.Flags().String("log", "", "optional log file to write to")
 	mountServerCmd.Flags().String("callback-addr", "", "callback address to report back to")
+	mountServerCmd.Flags().Bool("callback-progress", false, "also report progress building the index to the callback address, before the final status")
+	mountServerCmd.Flags().String("tls-cert", "", "TLS certificate file to serve WebDAV over HTTPS")
+	mountServerCmd.Flags().String("tls-key", "", "TLS private key file to serve WebDAV over HTTPS")
+	mountServerCmd.Flags().Bool("tls-self-signed", false, "serve WebDAV over HTTPS using a generated self-signed certificate")
+	mountServerCmd.Flags().String("htpasswd", "", "htpasswd file with users allowed to access the WebDAV server (bcrypt or SHA1 hashes)")
+	mountServerCmd.Flags().String("auth-token-file", "", "file containing a bearer token required to access the WebDAV server")
+	mountServerCmd.Flags().String("access-log", "", "file to append an access log of WebDAV requests to, in the format of --access-log-format")
+	mountServerCmd.Flags().String("access-log-format", string(dav.AccessLogCommon), "format of the WebDAV access log (common | combined), NCSA Common or Combined Log Format")
+	mountServerCmd.Flags().String("cache-warm-from", "", "directory the archive was previously extracted to, used to seed the cache with matching files")
+	mountServerCmd.Flags().String("cache-policy", "cache", "whether read files are kept in the cache (cache | bypass)")
+	mountServerCmd.Flags().Duration("cache-ttl", 0, "check cached files against the archive when opened, once cached longer than this ago (e.g. 1h), 0 to never")
+	mountServerCmd.Flags().Int("max-open-files", 0, "maximum number of files open at once, further opens wait (0 for no limit)")
+	mountServerCmd.Flags().Bool("allow-stale-cache", false, "keep the central directory in --cache-dir, and mount from the cache (serving only cached files) when the archive can't be read")
+	mountServerCmd.Flags().String("normalize", "none", "Unicode normalization of entry names and lookups (nfc | nfd | none)")
+	mountServerCmd.Flags().Int64("block-cache-size", 0, "keep blocks of this many bytes read from the archive in --cache-dir, so that ranges read again are served locally (0 to disable)")
+	mountServerCmd.Flags().String("verify-signature", "", "refuse to mount unless the archive's detached GPG signature (see --signature-uri) was made by a key in this keyring file")
+	mountServerCmd.Flags().String("signature-uri", "", "URI of the detached signature checked by --verify-signature (default: the archive's URI, with '.asc' appended)")
+	mountServerCmd.Flags().Bool("mmap-cache", false, "read cached files through a memory mapping, for entries read over and over")
+	mountServerCmd.Flags().String("index-url", "", "URI of an index written by 'cz index', read instead of the archive's central directory if it was built from the same archive")
+	mountServerCmd.Flags().Bool("cache-readonly", false, "serve files from --cache-dir without ever writing to it, reading files that aren't cached from the archive every time")
+	mountServerCmd.Flags().String("cache-encryption-key-file", "", "file containing a key used to encrypt cached files at rest")
+	mountServerCmd.Flags().Uint64("entry-limit-bytes", 0, "refuse to open entries larger than this (uncompressed), 0 for no limit")
 	rootCmd.AddCommand(mountServerCmd)
 }
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestMountLabels(t *testing.T) {
+	cmd := &cobra.Command{Use: "mount-server"}
+	addMountLabelFlags(cmd)
+	if err := cmd.ParseFlags([]string{"--mount-name", "nightly", "--tag", "team=data", "--tag", "env=prod=eu", "--tag", "empty="}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	name, tags := mountLabels(cmd)
+	if name != "nightly" || len(tags) != 3 || tags["team"] != "data" || tags["env"] != "prod=eu" || tags["empty"] != "" {
+		t.Fatalf("unexpected labels: %q %q", name, tags)
+	}
+	if formatted := formatTags(tags); formatted != "empty=\nenv=prod=eu\nteam=data\n" {
+		t.Errorf("expected tags sorted by key, got %q", formatted)
+	}
+
+	var logs bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logs, nil)).With(mountLogAttrs("0190-id", name, tags)...).Info("serving")
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	recordTags, _ := record["tags"].(map[string]any)
+	if record["mount_id"] != "0190-id" || record["mount_name"] != "nightly" || recordTags["team"] != "data" || recordTags["env"] != "prod=eu" {
+		t.Errorf("expected the labels on the record, got %v", record)
+	}
+
+	logs.Reset()
+	slog.New(slog.NewJSONHandler(&logs, nil)).With(mountLogAttrs("0190-id", "", nil)...).Info("serving")
+	record = nil
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := record["mount_name"]; ok {
+		t.Errorf("expected no mount name without --mount-name, got %v", record)
+	}
+	if _, ok := record["tags"]; ok {
+		t.Errorf("expected no tags group without --tag, got %v", record)
+	}
+}
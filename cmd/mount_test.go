@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestNFSMountHint(t *testing.T) {
+	hint := nfsMountHint("127.0.0.1:2049", "/mnt/archive")
+	if !strings.Contains(hint, "still listening at 127.0.0.1:2049") || !strings.Contains(hint, "--protocol webdav") {
+		t.Errorf("expected the server address and the WebDAV alternative, got %q", hint)
+	}
+	if runtime.GOOS == mount.GOOSLinux || runtime.GOOS == mount.GOOSMacOS {
+		command, _ := mount.NFSMountCommand("127.0.0.1:2049", "/mnt/archive")
+		if !strings.Contains(hint, "\t"+command+"\n") {
+			t.Errorf("expected the mount command %q, got %q", command, hint)
+		}
+	}
+}
+
+func TestCallbackProgress(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	updates := getMountServerCallback(listener)
+
+	progress := &callbackProgress{toAddr: listener.Addr().String()}
+	progress.report(zipfile.Progress{EntriesParsed: 1, BytesRead: 10, BytesTotal: 100})
+	// reported less than callbackProgressInterval after the previous one
+	progress.report(zipfile.Progress{EntriesParsed: 2, BytesRead: 20, BytesTotal: 100})
+	// completion is always reported, once
+	progress.report(zipfile.Progress{EntriesParsed: 9, BytesRead: 100, BytesTotal: 100})
+	progress.report(zipfile.Progress{EntriesParsed: 9, BytesRead: 100, BytesTotal: 100})
+	if err := sendCallback(listener.Addr().String(), mountServerStatusSuccess, "127.0.0.1:2049"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var received []mountServerCallback
+	for update := range updates {
+		received = append(received, update)
+	}
+	if len(received) != 3 {
+		t.Fatalf("expected 2 progress updates and the final status, got %v", received)
+	}
+	for i, expected := range []zipfile.Progress{{EntriesParsed: 1, BytesRead: 10, BytesTotal: 100}, {EntriesParsed: 9, BytesRead: 100, BytesTotal: 100}} {
+		p, err := parseCallbackProgress(received[i].Message)
+		if received[i].Status != mountServerStatusProgress || err != nil || p != expected {
+			t.Errorf("expected progress %+v, got %v (%+v, err: %v)", expected, received[i], p, err)
+		}
+	}
+	if received[2] != (mountServerCallback{mountServerStatusSuccess, "127.0.0.1:2049"}) {
+		t.Errorf("expected the final status last, got %v", received[2])
+	}
+}
+
+func TestSelectProtocol(t *testing.T) {
+	switch runtime.GOOS {
+	case mount.GOOSWindows:
+		if protocol := selectProtocol(); protocol != "webdav" {
+			t.Errorf("expected WebDAV where cz doesn't mount NFS, got %s", protocol)
+		}
+	case mount.GOOSMacOS:
+		if protocol := selectProtocol(); protocol != "nfs" {
+			t.Errorf("expected NFS on macOS, got %s", protocol)
+		}
+	case mount.GOOSLinux:
+		bin := t.TempDir()
+		if err := os.WriteFile(filepath.Join(bin, "mount.nfs"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Setenv("PATH", bin)
+		if protocol := selectProtocol(); protocol != "nfs" {
+			t.Errorf("expected NFS when mount.nfs is installed, got %s", protocol)
+		}
+	}
+}
+
+func TestWebdavClientCredentials(t *testing.T) {
+	t.Setenv(webdavTokenEnvironmentVariableName, "")
+	t.Setenv(webdavPasswordEnvironmentVariableName, "")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if user, password, err := webdavClientCredentials("", "", ""); err != nil || user != "" || password != "" {
+		t.Errorf("expected no credentials without authentication, got %q %q (err: %v)", user, password, err)
+	}
+	if user, password, err := webdavClientCredentials("", "", tokenFile); err != nil || user != "cz" || password != "secret" {
+		t.Errorf("expected the token as the password, got %q %q (err: %v)", user, password, err)
+	}
+	if _, _, err := webdavClientCredentials("", "htpasswd", ""); err == nil {
+		t.Error("expected an error for an htpasswd file without --webdav-user")
+	}
+	if _, _, err := webdavClientCredentials("alice", "htpasswd", ""); err == nil {
+		t.Error("expected an error for --webdav-user without a password")
+	}
+	t.Setenv(webdavPasswordEnvironmentVariableName, "password")
+	if user, password, err := webdavClientCredentials("alice", "htpasswd", tokenFile); err != nil || user != "alice" || password != "password" {
+		t.Errorf("expected the credentials of --webdav-user, got %q %q (err: %v)", user, password, err)
+	}
+	t.Setenv(webdavTokenEnvironmentVariableName, "from environment")
+	if _, password, err := webdavClientCredentials("", "", ""); err != nil || password != "from environment" {
+		t.Errorf("expected the token from the environment, got %q (err: %v)", password, err)
+	}
+}
+
+func TestMountServerArgs(t *testing.T) {
+	cmd := &cobra.Command{Use: "mount"}
+	cmd.Flags().String("cache-dir", "", "")
+	cmd.Flags().String("uri-map", "", "")
+	cmd.Flags().StringArray("include", nil, "")
+	cmd.Flags().Bool("raw", false, "")
+	cmd.Flags().Bool("keep-backslashes", false, "")
+	cmd.Flags().String("protocol", "", "")
+	cmd.Flags().Bool("no-spawn", false, "")
+	for _, args := range [][]string{
+		{"cache-dir", "cache"}, {"uri-map", "map.yaml"}, {"include", "*.csv"}, {"include", "data/*"},
+		{"raw", "true"}, {"protocol", "webdav"}, {"no-spawn", "true"},
+	} {
+		if err := cmd.Flags().Set(args[0], args[1]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got := mountServerArgs(cmd)
+	expected := []string{"--cache-dir=cache", "--include=*.csv", "--include=data/*", "--raw=true", "--uri-map=map.yaml"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
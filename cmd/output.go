@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputCSV}
+
+// entryWriter renders entry headers in one of the output formats. Close must be called to flush the output.
+type entryWriter interface {
+	Write(e *entryHeader) error
+	Close() error
+}
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().String("output", outputTable,
+		fmt.Sprintf("output format, one of: %s", strings.Join(outputFormats, ", ")))
+}
+
+// outputFormat returns the format requested with --output, validating it
+func outputFormat(cmd *cobra.Command) string {
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		die("could not parse command flags: %v\n", err)
+	}
+	format = strings.ToLower(strings.TrimSpace(format))
+	if !containsString(outputFormats, format) {
+		die("unknown output format: '%s' (expected one of: %s)\n", format, strings.Join(outputFormats, ", "))
+	}
+	return format
+}
+
+// newEntryWriter returns a writer rendering entries to w in format.
+// showIndex and showHash only apply to tables: JSON and CSV always include the index, and the hash if computed.
+func newEntryWriter(w io.Writer, format string, showIndex, showHash bool) entryWriter {
+	switch format {
+	case outputJSON:
+		return &jsonEntryWriter{encoder: json.NewEncoder(w)}
+	case outputCSV:
+		return &csvEntryWriter{w: csv.NewWriter(w)}
+	default:
+		return &tableEntryWriter{w: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0), showIndex: showIndex, showHash: showHash}
+	}
+}
+
+type tableEntryWriter struct {
+	w         *tabwriter.Writer
+	showIndex bool
+	showHash  bool
+}
+
+func (t *tableEntryWriter) Write(e *entryHeader) error {
+	if t.showIndex {
+		if _, err := fmt.Fprintf(t.w, "%d\t", e.Index); err != nil {
+			return err
+		}
+	}
+	if t.showHash {
+		hash := e.Hash
+		if hash == "" {
+			hash = "-" // directories
+		}
+		if _, err := fmt.Fprintf(t.w, "%s\t", hash); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(t.w, "%s\t%d\t%d\t%s\t%s\n",
+		e.Mode, e.CompressedSize, e.UncompressedSize, e.Modified.Format(time.RFC822Z), e.Name)
+	return err
+}
+
+func (t *tableEntryWriter) Close() error {
+	return t.w.Flush()
+}
+
+// jsonEntryWriter writes each entry as a JSON object on its own line
+type jsonEntryWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonEntryWriter) Write(e *entryHeader) error {
+	return j.encoder.Encode(e)
+}
+
+func (j *jsonEntryWriter) Close() error {
+	return nil
+}
+
+// csvEntryWriter writes a header row followed by a row per entry, with the same field names as the JSON output
+type csvEntryWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+var csvEntryColumns = []string{
+	"index", "name", "mode", "is_dir", "compressed_size", "uncompressed_size", "modified", "crc32", "method", "comment", "hash",
+}
+
+func (c *csvEntryWriter) Write(e *entryHeader) error {
+	if !c.headerWritten {
+		c.headerWritten = true
+		if err := c.w.Write(csvEntryColumns); err != nil {
+			return err
+		}
+	}
+	// csv.Writer quotes fields containing commas, quotes or newlines
+	return c.w.Write([]string{
+		strconv.Itoa(e.Index),
+		e.Name,
+		e.Mode,
+		strconv.FormatBool(e.IsDir),
+		strconv.FormatUint(e.CompressedSize, 10),
+		strconv.FormatUint(e.UncompressedSize, 10),
+		e.Modified.Format(time.RFC3339),
+		e.CRC32,
+		e.Method,
+		e.Comment,
+		e.Hash,
+	})
+}
+
+func (c *csvEntryWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntries() []*entryHeader {
+	modified := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	return []*entryHeader{
+		{Index: 0, Name: "data/", Mode: "drwxr-xr-x", IsDir: true, Modified: modified, CRC32: "00000000", Method: "store"},
+		{Index: 1, Name: "data/a, \"quoted\".csv", Mode: "-rw-r--r--", CompressedSize: 12, UncompressedSize: 40,
+			Modified: modified, CRC32: "0a1b2c3d", Method: "deflate", Comment: "line one\nline two", Hash: "sha256:ab"},
+	}
+}
+
+func renderEntries(t *testing.T, format string, showIndex, showHash bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newEntryWriter(&buf, format, showIndex, showHash)
+	for _, e := range testEntries() {
+		if err := w.Write(e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return buf.String()
+}
+
+func TestEntryWriter_Table(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(renderEntries(t, outputTable, true, true), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per entry, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "0  -          drwxr-xr-x") || !strings.HasPrefix(lines[1], "1  sha256:ab  -rw-r--r--") {
+		t.Errorf("expected the index and hash columns first, got %q", lines)
+	}
+	// columns are aligned
+	if strings.Index(lines[0], "drwxr-xr-x") != strings.Index(lines[1], "-rw-r--r--") {
+		t.Errorf("expected aligned columns, got %q", lines)
+	}
+	if !strings.HasSuffix(lines[1], "01 Mar 24 12:30 +0000  data/a, \"quoted\".csv") {
+		t.Errorf("unexpected modification time or name: %q", lines[1])
+	}
+	if plain := renderEntries(t, outputTable, false, false); !strings.HasPrefix(plain, "drwxr-xr-x") {
+		t.Errorf("expected no index or hash columns, got %q", plain)
+	}
+}
+
+func TestEntryWriter_JSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSuffix(renderEntries(t, outputJSON, false, false), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected an object per line, got %q", lines)
+	}
+	var e map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// JSON always includes the index and hash, whatever the table flags
+	if e["index"] != float64(1) || e["hash"] != "sha256:ab" || e["modified"] != "2024-03-01T12:30:00Z" || e["is_dir"] != false {
+		t.Errorf("unexpected entry: %v", e)
+	}
+}
+
+func TestEntryWriter_CSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(renderEntries(t, outputCSV, false, false))).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != strings.Join(csvEntryColumns, ",") {
+		t.Fatalf("expected a header row and a row per entry, got %q", records)
+	}
+	expected := []string{"1", "data/a, \"quoted\".csv", "-rw-r--r--", "false", "12", "40", "2024-03-01T12:30:00Z",
+		"0a1b2c3d", "deflate", "line one\nline two", "sha256:ab"}
+	if strings.Join(records[2], "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, records[2])
+	}
+
+	var empty bytes.Buffer
+	if err := newEntryWriter(&empty, outputCSV, false, false).Close(); err != nil || empty.Len() != 0 {
+		t.Errorf("expected no output without entries, got %q (err: %v)", empty.String(), err)
+	}
+}
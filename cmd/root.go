@@ -5,11 +5,21 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
 )
 
 const (
 	CloudZipVersion        = "0.0.1dev"
 	MountServerBindAddress = "127.0.0.1:0"
+
+	credentialsCommandEnvironmentVariableName = "CLOUDZIP_CREDENTIALS_COMMAND"
+	s3AddressingStyleEnvironmentVariableName  = "CLOUDZIP_S3_ADDRESSING_STYLE"
+	s3ProviderEnvironmentVariableName         = "CLOUDZIP_S3_PROVIDER"
+	httpRangeStyleEnvironmentVariableName     = "CLOUDZIP_HTTP_RANGE_STYLE"
+	ipfsGatewayEnvironmentVariableName        = "CLOUDZIP_IPFS_GATEWAY"
+	uriMapEnvironmentVariableName             = "CLOUDZIP_URI_MAP"
+	fallbackPathsEnvironmentVariableName      = "CLOUDZIP_FALLBACK_PATHS"
 )
 
 var rootCmd = &cobra.Command{
@@ -18,6 +28,26 @@ var rootCmd = &cobra.Command{
 	CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		setupLogging()
+		location, config, err := loadConfig()
+		if err != nil {
+			die("could not load config: %v\n", err)
+		}
+		if err := applyConfig(cmd, location, config); err != nil {
+			die("could not load config: %v\n", err)
+		}
+		if errorFormat != errorFormatText && errorFormat != errorFormatJSON {
+			format := errorFormat
+			errorFormat = errorFormatText
+			die("unknown error format: '%s' (expected one of: %s, %s)\n", format, errorFormatText, errorFormatJSON)
+		}
+		loadFallbackPaths(cmd)
+		// the mount server connects once it can report failures to the callback address, and cz mount
+		// only spawns the server, passing --connect-via on to it
+		if cmd.Name() != "mount-server" && cmd.Name() != "mount" {
+			if err := connectVia(cmd); err != nil {
+				die("%v\n", err)
+			}
+		}
 	},
 }
 
@@ -30,3 +60,37 @@ func Execute() {
 		os.Exit(1)
 	}
 }
+
+func init() {
+	rootCmd.PersistentFlags().String("credentials-command", os.Getenv(credentialsCommandEnvironmentVariableName),
+		"command that prints backend credentials as JSON to stdout, used for S3 and HTTP(S) access")
+	rootCmd.PersistentFlags().String("s3-addressing-style", os.Getenv(s3AddressingStyleEnvironmentVariableName),
+		"S3 request addressing style (path | virtual | auto), defaults to the AWS SDK's choice")
+	rootCmd.PersistentFlags().String("provider", os.Getenv(s3ProviderEnvironmentVariableName),
+		"preset for an S3 compatible service (aws | do | wasabi | r2 | minio), setting its endpoint, region and addressing style")
+	rootCmd.PersistentFlags().Bool("s3-accelerate", false,
+		"read S3 objects through S3 Transfer Acceleration, which must be enabled on the bucket")
+	rootCmd.PersistentFlags().Bool("s3-dualstack", false,
+		"read S3 objects through dualstack endpoints, which are reachable over IPv6 (e.g. from IPv6-only networks)")
+	rootCmd.PersistentFlags().String("http-range-style", os.Getenv(httpRangeStyleEnvironmentVariableName),
+		"how ranges are requested from HTTP(S) servers (header | post-json | multipart), defaults to a Range header")
+	rootCmd.PersistentFlags().String("http-timeout-breakdown", "",
+		"timeouts for phases of HTTP(S) requests, as phase=duration pairs (tls, first-byte, total), e.g. tls=5s,total=10m")
+	rootCmd.PersistentFlags().String("uri-map", os.Getenv(uriMapEnvironmentVariableName),
+		"YAML file mapping logical archive URIs (or prefixes ending with '/') to the URIs of the objects backing them")
+	rootCmd.PersistentFlags().String("fallback-paths", os.Getenv(fallbackPathsEnvironmentVariableName),
+		"YAML file mapping archive URIs (or prefixes ending with '/') to the paths they are read through, tried in order")
+	rootCmd.PersistentFlags().String("ipfs-gateway", os.Getenv(ipfsGatewayEnvironmentVariableName),
+		"base URL of the HTTP gateway used to read ipfs:// URIs, defaults to "+remote.DefaultIpfsGateway)
+	rootCmd.PersistentFlags().StringVar(&errorFormat, "error-format", errorFormatText,
+		"how fatal errors are written to stderr (text | json), json includes a stable error code")
+	rootCmd.PersistentFlags().String("connect-via", "",
+		"[user@]host[:port] of an SSH jump host to open the connections of HTTP(S) and S3 requests through, authenticating with ssh-agent or ~/.ssh keys")
+	rootCmd.PersistentFlags().Bool("scan-for-start", false,
+		"if the archive can't be parsed, scan its first 16MiB for the start of the zip data (for archives with bytes prepended to them)")
+	rootCmd.PersistentFlags().Bool("tolerant", false,
+		"recover the sizes of entries stored as 0xffffffff without a zip64 extra field from their local file header, rather than failing")
+	rootCmd.PersistentFlags().String("concatenated", "",
+		"read every archive concatenated into the object (e.g. with 'cat a.zip b.zip'), not just the last, "+
+			"keeping the entry of the last or first archive on name collisions, or failing (last | first | error)")
+}
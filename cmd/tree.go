@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+)
+
+// treeNode is an entry of the hierarchy printed by 'tree'
+type treeNode struct {
+	name     string
+	isDir    bool
+	size     int64
+	children []*treeNode
+}
+
+// prune drops directories with nothing left in them once files are filtered, summing up directory sizes
+func (n *treeNode) prune(keepEmpty bool) bool {
+	if !n.isDir {
+		return true
+	}
+	kept := n.children[:0]
+	n.size = 0
+	for _, child := range n.children {
+		if child.prune(keepEmpty) {
+			kept = append(kept, child)
+			n.size += child.size
+		}
+	}
+	n.children = kept
+	return keepEmpty || len(kept) > 0
+}
+
+type treePrinter struct {
+	w        io.Writer
+	maxDepth int
+	showSize bool
+	dirs     int
+	files    int
+}
+
+func (p *treePrinter) print(n *treeNode, prefix string, depth int) {
+	if p.maxDepth > 0 && depth > p.maxDepth {
+		return
+	}
+	for i, child := range n.children {
+		connector, indent := "├── ", "│   "
+		if i == len(n.children)-1 {
+			connector, indent = "└── ", "    "
+		}
+		size := ""
+		if p.showSize {
+			size = fmt.Sprintf("[%12d]  ", child.size)
+		}
+		_, _ = fmt.Fprintf(p.w, "%s%s%s%s\n", prefix, connector, size, child.name)
+		if child.isDir {
+			p.dirs++
+			p.print(child, prefix+indent, depth+1)
+		} else {
+			p.files++
+		}
+	}
+}
+
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, pluralForm)
+}
+
+var treeCmd = &cobra.Command{
+	Use:   "tree",
+	Short: "Print the hierarchy of files in the remote zip archive",
+	Long: "Print the hierarchy of files in the remote zip archive, like the Unix tree command.\n" +
+		"Only the central directory is read. --include and --exclude patterns (path.Match syntax) match full paths within the archive.",
+	Example: "cz tree --max-depth 2 --include '*/*.png' s3://example-bucket/path/to/archive.zip",
+	Args:    cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		remoteFile := args[0]
+		root := ""
+		if len(args) == 2 {
+			root = strings.Trim(args[1], "/")
+		}
+		maxDepth, err := cmd.Flags().GetInt("max-depth")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		showSize, err := cmd.Flags().GetBool("size")
+		if err != nil {
+			die("could not parse command flags: %v\n", err)
+		}
+		include, exclude := patterns(cmd)
+		records := getCdr(remoteFile)
+		tree, err := mount.IndexRecords(records, mount.WithFilter(timeFilters(cmd)...))
+		if err != nil {
+			die("could not index archive: %v\n", err)
+		}
+
+		nodes := make(map[string]*treeNode)
+		var top *treeNode
+		err = tree.Walk(root, func(p string, fi os.FileInfo) error {
+			node := &treeNode{name: path.Base(p), isDir: fi.IsDir(), size: fi.Size()}
+			nodes[p] = node
+			if top == nil {
+				top = node
+				return nil
+			}
+			parent := path.Dir(p)
+			if parent == "." {
+				parent = ""
+			}
+			nodes[parent].children = append(nodes[parent].children, node)
+			return nil
+		}, index.WithInclude(include...), index.WithExclude(exclude...))
+		if err != nil {
+			die("could not list %s: %v\n", path.Join("/", root), err)
+		}
+		if !top.isDir {
+			die("%s is not a directory\n", root)
+		}
+		// directories are visited even when they hold no included files, leave those out
+		top.prune(len(include) == 0)
+
+		label := remoteFile
+		if root != "" {
+			label = root
+		}
+		if showSize {
+			label = fmt.Sprintf("[%12d]  %s", top.size, label)
+		}
+		p := &treePrinter{w: os.Stdout, maxDepth: maxDepth, showSize: showSize}
+		_, _ = fmt.Fprintln(p.w, label)
+		p.print(top, "", 1)
+		_, _ = fmt.Fprintf(p.w, "\n%s, %s\n", plural(p.dirs, "directory", "directories"), plural(p.files, "file", "files"))
+	},
+}
+
+func init() {
+	addTimeFilterFlags(treeCmd)
+	treeCmd.Flags().IntP("max-depth", "L", 0, "descend at most this many directories deep (0 for no limit)")
+	treeCmd.Flags().BoolP("size", "s", false, "print the (uncompressed) size of each file, and the total size of each directory")
+	treeCmd.Flags().StringArray("include", nil, "only print files whose path matches this pattern (can be repeated)")
+	treeCmd.Flags().StringArray("exclude", nil, "leave out files and directories whose path matches this pattern (can be repeated)")
+	addPatternFileFlags(treeCmd)
+	rootCmd.AddCommand(treeCmd)
+}
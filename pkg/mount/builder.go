@@ -10,10 +10,14 @@ import (
 	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+
 	"github.com/ozkatz/cloudzip/pkg/mount/fs"
 	"github.com/ozkatz/cloudzip/pkg/mount/index"
 	"github.com/ozkatz/cloudzip/pkg/mount/procfs"
@@ -30,74 +34,717 @@ func asKey(strs ...string) string {
 	return hex.EncodeToString(out)
 }
 
-func getOpenerFor(logger *slog.Logger, zipPath string, record *zipfile.CDR, cache *fs.FileCache) fs.OpenFn {
+func getOpenerFor(logger *slog.Logger, zipPath string, record *zipfile.CDR, cache *fs.FileCache, cfg *buildConfig) fs.OpenFn {
 	return func(fullPath string, flag int, perm os.FileMode) (fs.FileLike, error) {
+		if err := zipfile.CheckEntryLimit(record, cfg.entryLimit); err != nil {
+			logger.Warn("refusing to open entry", "filename", record.FileName, "error", err)
+			return nil, err
+		}
+		if err := zipfile.CheckCompressionMethod(record, cfg.allowedMethods); err != nil {
+			logger.Warn("refusing to open entry", "filename", record.FileName, "error", err)
+			return nil, err
+		}
 		filename := path.Clean(record.FileName)
 		key := asKey(zipPath, filename, strconv.Itoa(int(record.CRC32Uncompressed)))
 		f, err := cache.Get(key)
+		if errors.Is(err, os.ErrNotExist) && cfg.cacheWarmFrom != "" {
+			local, localErr := openLocalCopy(cfg.cacheWarmFrom, record)
+			if localErr == nil && cache.ReadOnly() {
+				logger.Debug("serving local copy", "filename", record.FileName)
+				return local, nil
+			}
+			if localErr == nil {
+				logger.Debug("seeding cache from local copy", "filename", record.FileName)
+				f, err = cache.SetWithPolicy(key, local, int64(record.UncompressedSizeBytes), cfg.cachePolicy)
+				_ = local.Close()
+				return f, err
+			}
+			logger.Debug("no usable local copy, fetching entry", "filename", record.FileName, "error", localErr)
+		}
 		if errors.Is(err, os.ErrNotExist) {
 			// cache miss!
-			remoteZip, err := remote.Object(zipPath, remote.WithLogger(logger))
-			if err != nil {
-				return nil, err
-			}
-			ctx := context.Background()
-			fetcher := zipfile.NewStorageAdapter(ctx, remoteZip)
-			reader, err := zipfile.ReaderForRecord(record, fetcher)
-			if err != nil {
-				return nil, err
+			f, err = fetchEntry(logger, zipPath, record, cache, key, cfg)
+			if err != nil && cfg.allowStaleCache {
+				logger.Warn("entry isn't cached, and could not be read from the archive", "filename", record.FileName,
+					"offline", cfg.offline, "error", err)
 			}
-			f, err = cache.Set(key, io.NopCloser(reader), int64(record.UncompressedSizeBytes))
 			return f, err
 		} else if err != nil {
 			return nil, err
 		}
 		// cache hit!
-		return f, err
+		if cfg.offline {
+			logger.Debug("serving cached entry offline", "filename", record.FileName)
+			return f, nil
+		}
+		if cfg.cacheTTL > 0 {
+			return revalidate(logger, zipPath, record, cache, key, f, cfg)
+		}
+		return f, nil
 	}
 }
 
-func BuildZipTree(ctx context.Context, logger *slog.Logger, cacheDir, remoteZipURI string, procAttrs map[string]interface{}) (index.Tree, error) {
-	obj, err := remote.Object(remoteZipURI, remote.WithLogger(logger))
+// fetchEntry reads record from the archive at zipPath into the cache, under key. With a read-only cache,
+// the returned file reads record from the archive as it is read instead, unverified (see BuildZipTree).
+func fetchEntry(logger *slog.Logger, zipPath string, record *zipfile.CDR, cache *fs.FileCache, key string, cfg *buildConfig) (fs.FileLike, error) {
+	remoteZip, err := cfg.archiveFetcher(logger, zipPath)
 	if err != nil {
 		return nil, err
 	}
-	zip := zipfile.NewStorageAdapter(ctx, obj)
-	parser := zipfile.NewCentralDirectoryParser(zip)
-	cdr, err := parser.GetCentralDirectory()
+	ctx := context.Background()
+	fetcher := zipfile.NewStorageAdapter(ctx, remoteZip)
+	if cache.ReadOnly() {
+		return newStreamedFile(zipfile.ReaderAtForRecord(record, fetcher), int64(record.UncompressedSizeBytes)), nil
+	}
+	reader, err := zipfile.ReaderForRecord(record, fetcher)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.verifyReads {
+		reader = zipfile.VerifyingReaderFor(reader, record, cfg.checksum)
+	}
+	return cache.SetWithPolicy(key, io.NopCloser(reader), int64(record.UncompressedSizeBytes), cfg.cachePolicy)
+}
+
+var ErrNameCollision = errors.New("entry name collision")
+
+type buildConfig struct {
+	progress           zipfile.ProgressFn
+	stats              *remote.Stats
+	entryLimit         uint64
+	cacheEncryptionKey []byte
+	mmapCache          bool
+	readOnlyCache      bool
+	filters            []zipfile.Filter
+	objectOpts         []remote.ObjectOpt
+	allowedMethods     []uint16
+	limiter            *remote.ConcurrencyLimiter
+	verify             zipfile.VerifyLevel
+	keepBackslashes    bool
+	probeRange         bool
+	verifyReads        bool
+	checksum           zipfile.ChecksumAlgorithm
+	cacheWarmFrom      string
+	nameMappers        []NameMapper
+	partSize           int64
+	readParallelism    int
+	uriResolvers       []remote.URIResolver
+	cachePolicy        fs.CachePolicy
+	cacheTTL           time.Duration
+	flattenSingle      bool
+	maxOpenFiles       int
+	openFiles          *openFiles
+	normalization      Normalization
+	scanForStart       bool
+	tolerant           bool
+	concatenated       zipfile.CollisionPolicy
+	middlewares        []remote.Middleware
+	allowStaleCache    bool
+	blockCacheDir      string
+	blockSize          int64
+	keyring            openpgp.EntityList
+	signatureURI       string
+	indexURI           string
+	// offline is set if the tree was built from the cached central directory, the archive being unreachable
+	offline bool
+	// nested is set if the archive is nested in another one, see openArchive
+	nested *zipfile.NestedArchive
+}
+
+// DefaultSingleEntryParallelism is the number of parts fetched at once when reading the only file of an archive,
+// unless parallel reads are configured: such files tend to be large and streamed sequentially
+const DefaultSingleEntryParallelism = 4
+
+// forSingleEntry returns the configuration used to read the only file of an archive
+func (c *buildConfig) forSingleEntry() *buildConfig {
+	single := *c
+	if single.readParallelism <= 1 {
+		single.readParallelism = DefaultSingleEntryParallelism
+	}
+	return &single
+}
+
+// fileNames returns the names of the file (not directory) entries in records, as they appear in the tree
+// before name mapping, so that directory entries don't mask files of the same name
+func fileNames(records []*zipfile.CDR, convertBackslashes bool) map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range records {
+		if !f.Mode.IsDir() {
+			names[sanitizeEntryName(f.FileName, convertBackslashes)] = true
+		}
+	}
+	return names
+}
+
+// singleFileRecord returns the only file in records, or nil if there are none or more than one
+func singleFileRecord(records []*zipfile.CDR) *zipfile.CDR {
+	var single *zipfile.CDR
+	for _, f := range records {
+		if f.Mode.IsDir() {
+			continue
+		}
+		if single != nil {
+			return nil
+		}
+		single = f
+	}
+	return single
+}
+
+// wrapFetcher applies parallel reads, concurrency limiting, stats accounting and the configured middlewares
+// (outermost first) to requests made by f, which reads the object at uri
+func (c *buildConfig) wrapFetcher(f remote.Fetcher, uri string) remote.Fetcher {
+	partSize := c.partSize
+	if defaultPartSize := remote.DefaultPartSize(uri); partSize == 0 || defaultPartSize == 0 {
+		// local files are read through a single handle, so they are never split
+		partSize = defaultPartSize
+	}
+	// innermost, as it needs f to fetch batches of ranges
+	f = remote.BatchingFetcher(f)
+	var middlewares []remote.Middleware
+	if c.blockCacheDir != "" {
+		// outermost, so that reads served from the cache aren't split, limited or accounted for
+		middlewares = append(middlewares, remote.BlockCache(filepath.Join(c.blockCacheDir, asKey("blocks\x00", uri)), c.blockSize))
+	}
+	middlewares = append(middlewares, remote.SplitReads(partSize, c.readParallelism, c.stats))
+	if c.limiter != nil {
+		middlewares = append(middlewares, remote.LimitConcurrency(c.limiter))
+	}
+	middlewares = append(middlewares, remote.Counting(c.stats))
+	return remote.Chain(f, append(middlewares, c.middlewares...)...)
+}
+
+// openArchive resolves uri and opens the archive it refers to, which may be nested in other archives
+// (outer.zip!inner.zip). It returns a fetcher for the innermost archive, and the resolved URI
+// to pass to archiveFetcher when opening it again.
+func (c *buildConfig) openArchive(ctx context.Context, logger *slog.Logger, uri string) (remote.Fetcher, string, error) {
+	outerURI, nestedPath, err := c.resolveArchiveURI(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	if c.keyring != nil {
+		if err := c.verifySignature(ctx, logger, outerURI); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(nestedPath) > 0 {
+		outer, err := c.archiveFetcher(logger, outerURI)
+		if err != nil {
+			return nil, "", err
+		}
+		c.nested, err = zipfile.OpenNested(ctx, outer, nestedPath, zipfile.WithContext(ctx), zipfile.WithLogger(logger),
+			zipfile.WithEntryLimit(c.entryLimit), zipfile.WithAllowedMethods(c.allowedMethods))
+		if err != nil {
+			return nil, "", err
+		}
+		logger.Info("opened nested archive", "uri", outerURI, "path", strings.Join(nestedPath, zipfile.NestedSeparator))
+	}
+	resolved := strings.Join(append([]string{outerURI}, nestedPath...), zipfile.NestedSeparator)
+	f, err := c.archiveFetcher(logger, resolved)
+	return f, resolved, err
+}
+
+// archiveFetcher opens the archive at uri, as resolved by openArchive
+func (c *buildConfig) archiveFetcher(logger *slog.Logger, uri string) (remote.Fetcher, error) {
+	outerURI, _, isNested := strings.Cut(uri, zipfile.NestedSeparator)
+	if isNested && c.nested == nil {
+		// mounted offline, the nested archive couldn't be located
+		return nil, fmt.Errorf("%w: %s", ErrOffline, uri)
+	}
+	obj, err := remote.Object(outerURI, append([]remote.ObjectOpt{remote.WithLogger(logger)}, c.objectOpts...)...)
 	if err != nil {
 		return nil, err
 	}
+	obj = c.wrapFetcher(obj, outerURI)
+	if c.nested != nil {
+		return c.nested.Fetcher(obj), nil
+	}
+	return obj, nil
+}
+
+type BuildOpt func(c *buildConfig)
+
+// WithProgress reports the progress of reading and parsing the archive's central directory
+func WithProgress(fn zipfile.ProgressFn) BuildOpt {
+	return func(c *buildConfig) {
+		c.progress = fn
+	}
+}
+
+// WithStats accounts for all requests and bytes read from the remote archive into the given stats
+func WithStats(stats *remote.Stats) BuildOpt {
+	return func(c *buildConfig) {
+		c.stats = stats
+	}
+}
+
+// WithEntryLimit refuses to open entries whose uncompressed size is larger than limitBytes
+func WithEntryLimit(limitBytes uint64) BuildOpt {
+	return func(c *buildConfig) {
+		c.entryLimit = limitBytes
+	}
+}
+
+// WithAllowedMethods refuses to open entries compressed with a method not in methods
+func WithAllowedMethods(methods []uint16) BuildOpt {
+	return func(c *buildConfig) {
+		c.allowedMethods = methods
+	}
+}
+
+// WithConcurrencyLimiter bounds concurrent requests to the remote archive, backing off when throttled
+func WithConcurrencyLimiter(l *remote.ConcurrencyLimiter) BuildOpt {
+	return func(c *buildConfig) {
+		c.limiter = l
+	}
+}
+
+// WithParallelReads splits large reads into parts of partSize bytes, fetching up to parallelism parts concurrently.
+// A partSize of 0 uses the default part size for the backend (see remote.DefaultPartSize).
+func WithParallelReads(partSize int64, parallelism int) BuildOpt {
+	return func(c *buildConfig) {
+		c.partSize = partSize
+		c.readParallelism = parallelism
+	}
+}
+
+// WithMiddleware wraps requests to the remote archive with middlewares, the first being the outermost.
+// They are applied closest to the backend, below parallel reads, concurrency limiting and stats accounting,
+// so they see every part request and every retry of a throttled one.
+func WithMiddleware(middlewares ...remote.Middleware) BuildOpt {
+	return func(c *buildConfig) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithBlockCache keeps the blocks of blockSize bytes read from the remote archive in dir (see remote.BlockCachingFetcher),
+// so that reads of ranges read before, such as those of nested archives or in raw mode, are served locally.
+// Blocks aren't encrypted, and aren't revalidated: the archive at a URI is assumed not to change.
+func WithBlockCache(dir string, blockSize int64) BuildOpt {
+	return func(c *buildConfig) {
+		c.blockCacheDir = dir
+		c.blockSize = blockSize
+	}
+}
+
+// WithAllowStaleCache keeps the central directory of the archive in the cache, and falls back to it (and to cached
+// entries) if the archive can't be read, so that previously read archives can be mounted offline
+func WithAllowStaleCache(allow bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.allowStaleCache = allow
+	}
+}
+
+// WithScanForStart scans for the start of the zip data if the archive can't be parsed otherwise,
+// see zipfile.WithScanForStart
+func WithScanForStart(scan bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.scanForStart = scan
+	}
+}
+
+// WithTolerant recovers the sizes of entries missing their zip64 extra field, see zipfile.WithTolerant
+func WithTolerant(tolerant bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.tolerant = tolerant
+	}
+}
+
+// WithConcatenated reads every archive concatenated into the object, see zipfile.WithConcatenated
+func WithConcatenated(policy zipfile.CollisionPolicy) BuildOpt {
+	return func(c *buildConfig) {
+		c.concatenated = policy
+	}
+}
+
+// WithVerify checks the integrity of the archive at the given level before building the tree,
+// failing the build if the archive is corrupt
+func WithVerify(level zipfile.VerifyLevel) BuildOpt {
+	return func(c *buildConfig) {
+		c.verify = level
+	}
+}
+
+// WithVerifyReads checks the size and CRC32 of entries as they are downloaded, refusing to serve a mismatching entry
+func WithVerifyReads(verify bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.verifyReads = verify
+	}
+}
+
+// WithChecksumAlgorithm selects the checksum used by WithVerify and WithVerifyReads (CRC32 by default),
+// see zipfile.WithChecksumAlgorithm
+func WithChecksumAlgorithm(algorithm zipfile.ChecksumAlgorithm) BuildOpt {
+	return func(c *buildConfig) {
+		c.checksum = algorithm
+	}
+}
+
+// WithProbeRange checks that the backend honors range requests and that the archive looks like a zip archive,
+// with a single tiny request, before doing anything else
+func WithProbeRange(probe bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.probeRange = probe
+	}
+}
+
+// WithKeepBackslashes keeps backslashes in entry names as is, rather than treating them as path separators
+func WithKeepBackslashes(keep bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.keepBackslashes = keep
+	}
+}
+
+// WithCacheWarmFrom seeds the cache from dir, a directory the archive was previously extracted to:
+// entries whose local copy matches their size and CRC32 are read from it rather than from the remote archive
+func WithCacheWarmFrom(dir string) BuildOpt {
+	return func(c *buildConfig) {
+		c.cacheWarmFrom = dir
+	}
+}
+
+// WithCacheTTL revalidates cached entries against the archive when they are opened,
+// once they were cached longer than ttl ago (0 to never)
+func WithCacheTTL(ttl time.Duration) BuildOpt {
+	return func(c *buildConfig) {
+		c.cacheTTL = ttl
+	}
+}
+
+// WithCachePolicy decides whether entries read from the remote archive are kept in the cache.
+// With fs.CachePolicyBypass, entries that aren't cached already are downloaded for every open.
+func WithCachePolicy(policy fs.CachePolicy) BuildOpt {
+	return func(c *buildConfig) {
+		c.cachePolicy = policy
+	}
+}
+
+// WithFlattenSingleEntry exposes the file of an archive holding a single file at the root of the tree,
+// under its base name, rather than under the directories it's in. Archives with more files are unaffected.
+func WithFlattenSingleEntry(flatten bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.flattenSingle = flatten
+	}
+}
+
+// WithMaxOpenFiles bounds the number of entry files open at once, so that heavy concurrent access
+// doesn't exhaust file descriptors. Opens beyond the limit wait for another file to be closed.
+// A limit of 0 means no limit.
+func WithMaxOpenFiles(limit int) BuildOpt {
+	return func(c *buildConfig) {
+		c.maxOpenFiles = limit
+	}
+}
+
+// WithNormalization normalizes entry names to the given Unicode normalization form, along with names looked up
+// in the tree, so that clients using a different form than the archive (such as macOS, which uses NFD) find them.
+// Building the tree fails with ErrNameCollision if two entries normalize to the same path.
+func WithNormalization(n Normalization) BuildOpt {
+	return func(c *buildConfig) {
+		c.normalization = n
+	}
+}
+
+// WithNameMapper rewrites entry paths as they appear in the tree. Mappers are applied in the order given,
+// after backslashes and control characters are fixed up. Building the tree fails with ErrNameCollision
+// if two different entries (other than directories) map to the same path.
+func WithNameMapper(mappers ...NameMapper) BuildOpt {
+	return func(c *buildConfig) {
+		c.nameMappers = append(c.nameMappers, mappers...)
+	}
+}
+
+// WithCacheEncryptionKey encrypts cached files at rest using the given key material
+func WithCacheEncryptionKey(key []byte) BuildOpt {
+	return func(c *buildConfig) {
+		c.cacheEncryptionKey = key
+	}
+}
+
+// WithMmapCache reads cached files through a memory mapping (see fs.WithMemoryMap). It doesn't apply to
+// encrypted caches.
+func WithMmapCache(mmapCache bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.mmapCache = mmapCache
+	}
+}
+
+// WithReadOnlyCache serves entries from the cache, without ever writing to it (see fs.WithReadOnly): entries that
+// aren't cached are read from the archive every time they are opened, expired entries aren't marked fresh,
+// and changed entries aren't dropped.
+func WithReadOnlyCache(readOnly bool) BuildOpt {
+	return func(c *buildConfig) {
+		c.readOnlyCache = readOnly
+	}
+}
+
+// WithIndexURI reads the records of the archive from the index at uri (see zipfile.ExportArchiveIndex), rather than
+// from its central directory, if the index was built from the same archive: its URI, size and ETag (if any) match.
+// Otherwise, a warning is logged and the central directory is read as usual.
+func WithIndexURI(uri string) BuildOpt {
+	return func(c *buildConfig) {
+		c.indexURI = uri
+	}
+}
+
+// WithFilter only includes entries matching all given filters in the tree
+func WithFilter(filters ...zipfile.Filter) BuildOpt {
+	return func(c *buildConfig) {
+		c.filters = append(c.filters, filters...)
+	}
+}
+
+// WithObjectOpts passes additional options when opening the remote archive
+func WithObjectOpts(opts ...remote.ObjectOpt) BuildOpt {
+	return func(c *buildConfig) {
+		c.objectOpts = append(c.objectOpts, opts...)
+	}
+}
+
+// WithURIResolver translates the archive URI with resolvers, in order, before it is opened,
+// e.g. to map a stable logical name to the archive's current location
+func WithURIResolver(resolvers ...remote.URIResolver) BuildOpt {
+	return func(c *buildConfig) {
+		c.uriResolvers = append(c.uriResolvers, resolvers...)
+	}
+}
+
+// statsFileSize is the size of the fixed-width output of formatStats
+var statsFileSize = int64(len(formatStats(&remote.Stats{}, newOpenFiles(0, nil))))
+
+func formatStats(stats *remote.Stats, files *openFiles) []byte {
+	return []byte(fmt.Sprintf("requests: %20d\nbytes_read: %20d\npart_size: %20d\npeak_parallelism: %20d\n"+
+		"open_files: %20d\nopen_file_waits: %20d\n",
+		stats.Requests(), stats.BytesRead(), stats.PartSize(), stats.PeakParallelism(), files.Open(), files.Waits()))
+}
+
+// BuildZipTree parses the central directory of the remote archive and returns a tree of its entries.
+// logger receives logs from building the tree and from reading entries later on; if nil, slog.Default() is used.
+func BuildZipTree(ctx context.Context, logger *slog.Logger, cacheDir, remoteZipURI string, procAttrs map[string]interface{}, opts ...BuildOpt) (index.Tree, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	cfg := &buildConfig{stats: &remote.Stats{}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.openFiles = newOpenFiles(cfg.maxOpenFiles, logger)
+	if cfg.normalization.enabled() {
+		// last, so that other mappers see names as they are stored
+		cfg.nameMappers = append(cfg.nameMappers, cfg.normalization.Normalize)
+	}
+	if cfg.verifyReads && cfg.readOnlyCache {
+		// entries that aren't cached are read at random offsets, which a checksum of the whole entry can't cover
+		return nil, errors.New("verifying reads is not supported with a read-only cache")
+	}
+	if cfg.verifyReads && cfg.checksum != "" && !cfg.checksum.StoredForEntries() {
+		logger.Warn("zip archives don't store this checksum for entries, reads are only checked for size",
+			"checksum_algorithm", cfg.checksum)
+	}
+	var cacheOpts []fs.CacheOpt
+	if cfg.mmapCache {
+		cacheOpts = append(cacheOpts, fs.WithMemoryMap())
+	}
+	if cfg.readOnlyCache {
+		cacheOpts = append(cacheOpts, fs.WithReadOnly())
+	}
+	cache := fs.NewFileCache(cacheDir, cacheOpts...)
+	if len(cfg.cacheEncryptionKey) > 0 {
+		var err error
+		cache, err = fs.NewEncryptedFileCache(cacheDir, cfg.cacheEncryptionKey, cacheOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("could not setup cache encryption: %w", err)
+		}
+	}
+	parser, cdr, resolvedURI, err := cfg.readArchive(ctx, logger, remoteZipURI)
+	if err != nil {
+		if !cfg.allowStaleCache || cfg.keyring != nil || ctx.Err() != nil {
+			return nil, err
+		}
+		resolvedURI, cdr, err = cfg.readCachedIndex(logger, cache, remoteZipURI, err)
+		if err != nil {
+			return nil, err
+		}
+		cfg.offline = true
+	} else if cfg.allowStaleCache && !cache.ReadOnly() {
+		if err := cacheIndex(cache, resolvedURI, cdr); err != nil {
+			logger.Warn("could not keep the central directory in the cache, the archive can't be mounted offline", "error", err)
+		}
+	}
+	remoteZipURI = resolvedURI
+	cdr = zipfile.FilterRecords(cdr, cfg.filters...)
 	startTime := time.Now()
+	single := singleFileRecord(cdr)
+	if single != nil {
+		logger.Info("archive holds a single file", "filename", single.FileName,
+			"size", single.UncompressedSizeBytes, "flatten", cfg.flattenSingle)
+	}
 
 	// build index
 	infos := make(fs.FileInfoList, 0)
-	cache := fs.NewFileCache(cacheDir)
+	// mapped names, to detect different entries ending up with the same name
+	mapped := make(map[string]*zipfile.CDR)
+	files := fileNames(cdr, !cfg.keepBackslashes)
 	for _, f := range cdr {
+		name := sanitizeEntryName(f.FileName, !cfg.keepBackslashes)
+		if name != f.FileName {
+			logger.Warn("fixed up entry name", "filename", f.FileName, "name", name)
+		}
+		if f.Mode.IsDir() {
+			// entries ending with "/" are directories by convention, even if a buggy tool stored content for them
+			if f.UncompressedSizeBytes > 0 {
+				logger.Warn("ambiguous entry: directory with content, treating it as a directory",
+					"filename", f.FileName, "size", f.UncompressedSizeBytes)
+			}
+			if files[name] {
+				logger.Warn("ambiguous entry: directory with the same name as a file, keeping the file",
+					"filename", f.FileName)
+				continue
+			}
+		}
+		entryCfg := cfg
+		if single != nil && cfg.flattenSingle {
+			if f != single {
+				continue // only directories, which would be left empty
+			}
+			name = path.Base(name)
+		}
+		if f == single {
+			entryCfg = cfg.forSingleEntry()
+		}
+		if len(cfg.nameMappers) > 0 {
+			name = mapName(name, cfg.nameMappers)
+			key := strings.Trim(name, fs.Delimiter)
+			if key == "" {
+				continue
+			}
+			if other, ok := mapped[key]; ok && other.FileName != f.FileName && !(other.Mode.IsDir() && f.Mode.IsDir()) {
+				return nil, fmt.Errorf("%w: '%s' and '%s' both map to '%s'", ErrNameCollision, other.FileName, f.FileName, key)
+			}
+			mapped[key] = f
+		}
 		infos = append(infos, fs.ImmutableInfo(
-			f.FileName,
+			name,
 			f.Modified,
 			f.Mode,
 			int64(f.UncompressedSizeBytes),
-			getOpenerFor(logger, remoteZipURI, f, cache),
+			cfg.openFiles.wrap(f.FileName, getOpenerFor(logger, remoteZipURI, f, cache, entryCfg)),
 		))
 	}
 
-	// "proc" filesystem exposed to users
-	infos = append(infos, procfs.NewProcFile(".cz/server.pid", []byte(strconv.Itoa(os.Getpid())), startTime))
-	infos = append(infos, procfs.NewProcFile(".cz/cachedir", []byte(cacheDir), startTime))
-	infos = append(infos, procfs.NewProcFile(".cz/source", []byte(remoteZipURI), startTime))
+	infos = append(infos, procInfos(cacheDir, remoteZipURI, procAttrs, cfg, startTime)...)
+	if parser != nil {
+		if comment, err := parser.ArchiveComment(); err == nil && comment != "" {
+			infos = append(infos, procfs.NewProcFile(".cz/comment", []byte(comment), startTime))
+		}
+	}
+	return indexTree(infos, startTime, cfg)
+}
+
+// readArchive opens the archive at uri and reads its central directory (or the index given with WithIndexURI),
+// returning the parser, the (unfiltered) records and the resolved URI of the archive
+func (c *buildConfig) readArchive(ctx context.Context, logger *slog.Logger, uri string) (*zipfile.CentralDirectoryParser, []*zipfile.CDR, string, error) {
+	obj, resolvedURI, err := c.openArchive(ctx, logger, uri)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	zip := zipfile.NewStorageAdapter(ctx, obj)
+	parserOpts := []zipfile.ParserOpt{zipfile.WithContext(ctx), zipfile.WithLogger(logger), zipfile.WithScanForStart(c.scanForStart),
+		zipfile.WithTolerant(c.tolerant), zipfile.WithConcatenated(c.concatenated)}
+	if c.checksum != "" {
+		parserOpts = append(parserOpts, zipfile.WithChecksumAlgorithm(c.checksum))
+	}
+	if c.progress != nil {
+		parserOpts = append(parserOpts, zipfile.WithProgress(c.progress))
+	}
+	parser := zipfile.NewCentralDirectoryParser(zip, parserOpts...)
+	if c.probeRange {
+		if err := parser.ProbeRange(); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	var cdr []*zipfile.CDR
+	if c.indexURI != "" {
+		cdr = c.preloadIndex(ctx, logger, uri, obj)
+	}
+	if cdr == nil {
+		cdr, err = parser.GetCentralDirectory()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, nil, "", err
+		}
+		if stub, err := parser.Stub(); err == nil && stub != nil {
+			logger.Info("self-extracting archive", "stub", stub.Kind, "stub_size", stub.Size, "scanned", stub.Scanned)
+		}
+	}
+	if c.verify != zipfile.VerifyNone {
+		verifyStart := time.Now()
+		if err := parser.Verify(cdr, c.verify); err != nil {
+			return nil, nil, "", err
+		}
+		logger.Info("verified archive", "level", c.verify, "took_ms", time.Since(verifyStart).Milliseconds())
+	}
+	return parser, cdr, resolvedURI, nil
+}
+
+// IndexRecords builds a tree of records for browsing the structure of an archive from its central directory alone:
+// its files can't be opened. Filters, backslash handling, name mappers and normalization apply as in BuildZipTree.
+func IndexRecords(records []*zipfile.CDR, opts ...BuildOpt) (index.Tree, error) {
+	cfg := &buildConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.normalization.enabled() {
+		cfg.nameMappers = append(cfg.nameMappers, cfg.normalization.Normalize)
+	}
+	records = zipfile.FilterRecords(records, cfg.filters...)
+	files := fileNames(records, !cfg.keepBackslashes)
+	infos := make(fs.FileInfoList, 0, len(records))
+	for _, f := range records {
+		name := sanitizeEntryName(f.FileName, !cfg.keepBackslashes)
+		if f.Mode.IsDir() && files[name] {
+			continue
+		}
+		name = mapName(name, cfg.nameMappers)
+		if strings.Trim(name, fs.Delimiter) == "" {
+			continue
+		}
+		infos = append(infos, fs.ImmutableInfo(name, f.Modified, f.Mode, int64(f.UncompressedSizeBytes), nil))
+	}
+	return indexTree(infos, time.Now(), cfg)
+}
+
+// procInfos returns the "proc" filesystem exposed to users under .cz/
+func procInfos(cacheDir, remoteURI string, procAttrs map[string]interface{}, cfg *buildConfig, startTime time.Time) fs.FileInfoList {
+	infos := fs.FileInfoList{
+		procfs.NewProcFile(".cz/server.pid", []byte(strconv.Itoa(os.Getpid())), startTime),
+		procfs.NewProcFile(".cz/cachedir", []byte(cacheDir), startTime),
+		procfs.NewProcFile(".cz/source", []byte(remoteURI), startTime),
+		procfs.NewDynamicProcFile(".cz/stats", statsFileSize, func() []byte {
+			return formatStats(cfg.stats, cfg.openFiles)
+		}, startTime),
+	}
 	for k, v := range procAttrs {
 		infos = append(infos, procfs.NewProcFile(fmt.Sprintf(".cz/%s", k),
 			[]byte(fmt.Sprintf("%s", v)),
 			startTime))
 	}
+	return infos
+}
+
+func indexTree(infos fs.FileInfoList, startTime time.Time, cfg *buildConfig) (index.Tree, error) {
 	// sort it
 	sort.Sort(infos)
+	var opts []index.TreeOpt
+	if cfg.normalization.enabled() {
+		opts = append(opts, index.WithNameNormalizer(cfg.normalization.Normalize))
+	}
 	tree := index.NewInMemoryTreeBuilder(func(entry string) *fs.FileInfo {
 		return fs.ImmutableDir(entry, startTime)
-	})
-	err = tree.Index(infos)
+	}, opts...)
+	err := tree.Index(infos)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,111 @@
+package dav
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownAccessLogFormat = errors.New("unknown access log format")
+
+// AccessLogFormat is the NCSA format access logs are written in
+type AccessLogFormat string
+
+const (
+	// AccessLogCommon is the Common Log Format: host, user, time, request line, status and response size
+	AccessLogCommon AccessLogFormat = "common"
+	// AccessLogCombined is the Common Log Format, followed by the Referer and User-Agent of the request
+	AccessLogCombined AccessLogFormat = "combined"
+)
+
+// clfTimeFormat is the format of the time of requests in NCSA logs
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// ParseAccessLogFormat parses one of "common" or "combined"
+func ParseAccessLogFormat(s string) (AccessLogFormat, error) {
+	switch format := AccessLogFormat(s); format {
+	case AccessLogCommon, AccessLogCombined:
+		return format, nil
+	}
+	return "", fmt.Errorf("%w: '%s', select 'common' or 'combined'", ErrUnknownAccessLogFormat, s)
+}
+
+var _ http.Handler = &accessLogHandler{}
+
+// accessLogHandler writes a line per request to w, once it's served
+type accessLogHandler struct {
+	w      io.Writer
+	format AccessLogFormat
+	next   http.Handler
+	// mu keeps lines of concurrent requests from interleaving
+	mu sync.Mutex
+}
+
+func (h *accessLogHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	start := time.Now()
+	w := &loggingWriter{
+		writer: writer,
+	}
+	h.next.ServeHTTP(w, request)
+	line := accessLogLine(request, start, w.statusCode, w.n, h.format)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, _ = io.WriteString(h.w, line)
+}
+
+// accessLogLine formats the access log line of request, answered with status and size bytes
+func accessLogLine(request *http.Request, start time.Time, status, size int, format AccessLogFormat) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	user := "-"
+	if username, _, ok := request.BasicAuth(); ok && username != "" {
+		user = clfEscape(username)
+	}
+	if status == 0 {
+		status = http.StatusOK // the handler wrote a body without calling WriteHeader, or nothing at all
+	}
+	bytes := "-"
+	if size > 0 {
+		bytes = strconv.Itoa(size)
+	}
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s", clfValue(host), user, start.Format(clfTimeFormat),
+		clfEscape(request.Method), clfEscape(request.URL.RequestURI()), clfEscape(request.Proto), status, bytes)
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", clfValue(clfEscape(request.Referer())), clfValue(clfEscape(request.UserAgent())))
+	}
+	return line + "\n"
+}
+
+// clfEscape escapes quotes, backslashes and control characters, so that client supplied values can't break
+// the fields of a line, or forge lines
+func clfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// clfValue returns "-" for empty values, as NCSA logs do
+func clfValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
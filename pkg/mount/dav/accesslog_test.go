@@ -0,0 +1,110 @@
+package dav_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/dav"
+)
+
+// syncBuffer is written by the server and read by the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestServe_AccessLog(t *testing.T) {
+	tree := testTree(t)
+
+	cases := []struct {
+		format   dav.AccessLogFormat
+		expected []string
+	}{
+		{dav.AccessLogCommon, []string{
+			`^127\.0\.0\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /mount/a\.txt HTTP/1\.1" 200 5$`,
+			`^127\.0\.0\.1 - - \[.+\] "GET /mount/a\.txt\?x=1 HTTP/1\.1" 401 13$`,
+		}},
+		{dav.AccessLogCombined, []string{
+			`^127\.0\.0\.1 - - \[.+\] "GET /mount/a\.txt HTTP/1\.1" 200 5 "http://example\.com/" "agent \\"quoted\\""$`,
+			`^127\.0\.0\.1 - - \[.+\] "GET /mount/a\.txt\?x=1 HTTP/1\.1" 401 13 "-" "Go-http-client/1\.1"$`,
+		}},
+	}
+	for _, c := range cases {
+		t.Run(string(c.format), func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			t.Cleanup(func() { _ = listener.Close() })
+			accessLog := &syncBuffer{}
+			go func() {
+				_ = dav.Serve(listener, tree, &dav.Options{
+					Auth:            &dav.BearerTokenAuth{Token: "secret"},
+					AccessLog:       accessLog,
+					AccessLogFormat: c.format,
+				})
+			}()
+			base := "http://" + listener.Addr().String()
+
+			req, _ := http.NewRequest(http.MethodGet, base+"/mount/a.txt", nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("Referer", "http://example.com/")
+			req.Header.Set("User-Agent", `agent "quoted"`)
+			if resp, err := http.DefaultClient.Do(req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else {
+				_ = resp.Body.Close()
+			}
+			// rejected requests are logged too
+			if resp, err := http.Get(base + "/mount/a.txt?x=1"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else {
+				_ = resp.Body.Close()
+			}
+
+			// lines are written once handlers return, which may be after the client read the response
+			deadline := time.Now().Add(5 * time.Second)
+			for bytes.Count([]byte(accessLog.String()), []byte("\n")) < len(c.expected) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			lines := bytes.Split(bytes.TrimSuffix([]byte(accessLog.String()), []byte("\n")), []byte("\n"))
+			if len(lines) != len(c.expected) {
+				t.Fatalf("expected %d lines, got %q", len(c.expected), accessLog.String())
+			}
+			for i, pattern := range c.expected {
+				if !regexp.MustCompile(pattern).Match(lines[i]) {
+					t.Errorf("expected line %d to match %s, got %s", i, pattern, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseAccessLogFormat(t *testing.T) {
+	for _, s := range []string{"common", "combined"} {
+		if format, err := dav.ParseAccessLogFormat(s); err != nil || string(format) != s {
+			t.Errorf("expected %s to parse, got %s (%v)", s, format, err)
+		}
+	}
+	if _, err := dav.ParseAccessLogFormat("json"); !errors.Is(err, dav.ErrUnknownAccessLogFormat) {
+		t.Errorf("expected ErrUnknownAccessLogFormat, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package dav
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnsupportedHash = errors.New("unsupported htpasswd hash")
+)
+
+// Authenticator decides whether a request is allowed to access the WebDAV server
+type Authenticator interface {
+	Authenticate(r *http.Request) bool
+}
+
+// BearerTokenAuth accepts requests carrying the given static token as "Authorization: Bearer <token>",
+// or as the password of HTTP Basic credentials (with any user), for clients such as mount_webdav
+// that can't send bearer tokens
+type BearerTokenAuth struct {
+	Token string
+}
+
+func (a *BearerTokenAuth) Authenticate(r *http.Request) bool {
+	if a.Token == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, token, ok = r.BasicAuth()
+	}
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1
+}
+
+// BasicAuth accepts requests carrying HTTP Basic credentials that match an htpasswd-style user list.
+// Supported hashes are bcrypt ("$2y$", "$2a$", "$2b$") and SHA1 ("{SHA}").
+type BasicAuth struct {
+	users map[string]string
+}
+
+// LoadHtpasswd reads an htpasswd file, one "user:hash" pair per line
+func LoadHtpasswd(filename string) (*BasicAuth, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: invalid htpasswd line", filename, lineNumber)
+		}
+		if !isBcrypt(hash) && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("%w: %s:%d: use bcrypt (htpasswd -B) or SHA1 (htpasswd -s)",
+				ErrUnsupportedHash, filename, lineNumber)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &BasicAuth{users: users}, nil
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2y$") || strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$")
+}
+
+func (a *BasicAuth) Authenticate(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, ok := a.users[user]
+	if !ok {
+		return false
+	}
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	sum := sha1.Sum([]byte(password))
+	expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+}
+
+// AnyAuth accepts a request if any of the given authenticators accepts it
+type AnyAuth []Authenticator
+
+func (a AnyAuth) Authenticate(r *http.Request) bool {
+	for _, auth := range a {
+		if auth.Authenticate(r) {
+			return true
+		}
+	}
+	return false
+}
+
+var _ http.Handler = &authHandler{}
+
+type authHandler struct {
+	auth Authenticator
+	next http.Handler
+}
+
+func (h *authHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if !h.auth.Authenticate(request) {
+		writer.Header().Add("WWW-Authenticate", `Basic realm="cloudzip", charset="UTF-8"`)
+		writer.Header().Add("WWW-Authenticate", `Bearer realm="cloudzip"`)
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	h.next.ServeHTTP(writer, request)
+}
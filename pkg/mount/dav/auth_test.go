@@ -0,0 +1,198 @@
+package dav_test
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/mount/dav"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// testTree builds the tree of an archive holding a.txt
+func testTree(t *testing.T) index.Tree {
+	t.Helper()
+	archive := filepath.Join(t.TempDir(), "test.zip")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w := zip.NewWriter(out)
+	f, _ := w.Create("a.txt")
+	_, _ = f.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = out.Close()
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	return tree
+}
+
+// writeHtpasswd writes an htpasswd file with the given lines
+func writeHtpasswd(t *testing.T, lines string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(filename, []byte(lines), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return filename
+}
+
+func basicRequest(user, password string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "/mount/a.txt", nil)
+	r.SetBasicAuth(user, password)
+	return r
+}
+
+func bearerRequest(token string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "/mount/a.txt", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sum := sha1.Sum([]byte("sha-password"))
+	auth, err := dav.LoadHtpasswd(writeHtpasswd(t, "# users\n\n"+
+		"alice:"+string(bcryptHash)+"\n"+
+		"bob:{SHA}"+base64.StdEncoding.EncodeToString(sum[:])+"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		name     string
+		request  *http.Request
+		expected bool
+	}{
+		{"bcrypt", basicRequest("alice", "bcrypt-password"), true},
+		{"sha1", basicRequest("bob", "sha-password"), true},
+		{"wrong password", basicRequest("alice", "sha-password"), false},
+		{"unknown user", basicRequest("carol", "bcrypt-password"), false},
+		{"no credentials", bearerRequest("bcrypt-password"), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := auth.Authenticate(c.request); got != c.expected {
+				t.Errorf("expected %t, got %t", c.expected, got)
+			}
+		})
+	}
+
+	t.Run("unsupported hash", func(t *testing.T) {
+		for _, line := range []string{"md5:$apr1$salt$hash", "crypt:rqXexS6ZhobKA", "plain:password"} {
+			if _, err := dav.LoadHtpasswd(writeHtpasswd(t, line+"\n")); !errors.Is(err, dav.ErrUnsupportedHash) {
+				t.Errorf("%s: expected ErrUnsupportedHash, got %v", line, err)
+			}
+		}
+	})
+	t.Run("malformed line", func(t *testing.T) {
+		if _, err := dav.LoadHtpasswd(writeHtpasswd(t, "alice\n")); err == nil || errors.Is(err, dav.ErrUnsupportedHash) {
+			t.Errorf("expected an invalid line error, got %v", err)
+		}
+	})
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := dav.LoadHtpasswd(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected os.ErrNotExist, got %v", err)
+		}
+	})
+}
+
+func TestBearerTokenAuth(t *testing.T) {
+	auth := &dav.BearerTokenAuth{Token: "secret"}
+	if !auth.Authenticate(bearerRequest("secret")) {
+		t.Error("expected the token to be accepted")
+	}
+	// clients that only send Basic credentials pass the token as the password
+	if !auth.Authenticate(basicRequest("cz", "secret")) {
+		t.Error("expected the token to be accepted as a Basic password")
+	}
+	for name, r := range map[string]*http.Request{
+		"wrong token":    bearerRequest("guess"),
+		"token as user":  basicRequest("secret", "guess"),
+		"no credentials": basicRequest("", ""),
+	} {
+		if auth.Authenticate(r) {
+			t.Errorf("%s: expected the request to be rejected", name)
+		}
+	}
+	// an empty token accepts nothing, not even an empty bearer token
+	if (&dav.BearerTokenAuth{}).Authenticate(bearerRequest("")) {
+		t.Error("expected an empty token to reject every request")
+	}
+}
+
+func TestAnyAuth(t *testing.T) {
+	sum := sha1.Sum([]byte("password"))
+	basic, err := dav.LoadHtpasswd(writeHtpasswd(t, "alice:{SHA}"+base64.StdEncoding.EncodeToString(sum[:])+"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	auth := dav.AnyAuth{basic, &dav.BearerTokenAuth{Token: "secret"}}
+	if !auth.Authenticate(basicRequest("alice", "password")) || !auth.Authenticate(bearerRequest("secret")) {
+		t.Error("expected either authenticator to accept the request")
+	}
+	if auth.Authenticate(bearerRequest("password")) || auth.Authenticate(basicRequest("alice", "guess")) {
+		t.Error("expected requests neither authenticator accepts to be rejected")
+	}
+	if (dav.AnyAuth{}).Authenticate(bearerRequest("secret")) {
+		t.Error("expected no authenticators to reject every request")
+	}
+}
+
+func TestServe_Auth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	tree := testTree(t)
+	go func() {
+		_ = dav.Serve(listener, tree, &dav.Options{Auth: &dav.BearerTokenAuth{Token: "secret"}})
+	}()
+	url := "http://" + listener.Addr().String() + "/mount/a.txt"
+
+	do := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+	if resp := do("secret"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 with the token, got %d", resp.StatusCode)
+	}
+	for _, token := range []string{"", "guess"} {
+		resp := do(token)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: expected 401, got %d", token, resp.StatusCode)
+		}
+		challenges := resp.Header.Values("WWW-Authenticate")
+		expected := []string{`Basic realm="cloudzip", charset="UTF-8"`, `Bearer realm="cloudzip"`}
+		if !slices.Equal(challenges, expected) {
+			t.Errorf("token %q: expected challenges %q, got %q", token, expected, challenges)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	mntfs "github.com/ozkatz/cloudzip/pkg/mount/fs"
 	"github.com/ozkatz/cloudzip/pkg/mount/index"
 	"golang.org/x/net/webdav"
+	"io"
 	"io/fs"
 )
 
@@ -13,8 +14,9 @@ type treeFile struct {
 	tree index.Tree
 	fi   *mntfs.FileInfo
 
-	handle  mntfs.FileLike
-	voffset int64
+	handle    mntfs.FileLike
+	voffset   int64
+	dirOffset int
 }
 
 func (f *treeFile) Close() error {
@@ -50,20 +52,22 @@ func (f *treeFile) Seek(offset int64, whence int) (int64, error) {
 	return f.handle.Seek(offset, whence)
 }
 
+// Readdir follows os.File.Readdir: with count > 0, it returns the next count entries
+// (io.EOF once the directory is exhausted), otherwise it returns all remaining entries.
 func (f *treeFile) Readdir(count int) ([]fs.FileInfo, error) {
-	fis, err := f.tree.Readdir(f.fi.Name())
+	fis, err := f.tree.ReaddirRange(f.fi.FullPath(), f.dirOffset, count)
 	if err != nil {
 		return nil, err
 	}
+	if count > 0 && len(fis) == 0 {
+		return nil, io.EOF
+	}
+	f.dirOffset += len(fis)
 	infos := make([]fs.FileInfo, len(fis))
 	for i, fi := range fis {
 		infos[i] = fi
 	}
-	if count > 0 {
-		return infos[:count], nil
-	}
 	return infos, nil
-
 }
 
 func (f *treeFile) Stat() (fs.FileInfo, error) {
@@ -2,13 +2,18 @@ package dav
 
 import (
 	"context"
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
 	"github.com/ozkatz/cloudzip/pkg/mount/index"
 	"golang.org/x/net/webdav"
 	"os"
+	"path"
 )
 
 var _ webdav.FileSystem = &davFS{}
 
+// davFS serves the tree over WebDAV. The properties PROPFIND requests are computed from the FileInfo of entries
+// (which implements webdav.ContentTyper and webdav.ETager), only for the properties requested, so listing
+// a directory never reads the content of its files.
 type davFS struct {
 	tree index.Tree
 }
@@ -28,7 +33,7 @@ func (fs *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.Fi
 	}
 	return &treeFile{
 		tree: fs.tree,
-		fi:   f,
+		fi:   baseNamed(f),
 	}, nil
 }
 
@@ -41,5 +46,15 @@ func (fs *davFS) Rename(ctx context.Context, oldName, newName string) error {
 }
 
 func (fs *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
-	return fs.tree.Stat(name)
+	f, err := fs.tree.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return baseNamed(f), nil
+}
+
+// baseNamed names f by its base name, as os.FileInfo does, rather than by its path in the tree (which would
+// be the displayname of every entry)
+func baseNamed(f *fs.FileInfo) *fs.FileInfo {
+	return f.AsPath(path.Base(f.FullPath()))
 }
@@ -0,0 +1,154 @@
+package dav_test
+
+import (
+	"encoding/xml"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/dav"
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+)
+
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"href"`
+		Propstats []struct {
+			Prop struct {
+				Values []struct {
+					XMLName xml.Name
+					Value   string `xml:",innerxml"`
+				} `xml:",any"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// props returns the properties of href with the given status, by name
+func (m *multistatus) props(href, status string) map[string]string {
+	props := make(map[string]string)
+	for _, response := range m.Responses {
+		if response.Href != href {
+			continue
+		}
+		for _, propstat := range response.Propstats {
+			if !strings.Contains(propstat.Status, status) {
+				continue
+			}
+			for _, v := range propstat.Prop.Values {
+				props[v.XMLName.Local] = v.Value
+			}
+		}
+	}
+	return props
+}
+
+func TestServe_Propfind(t *testing.T) {
+	var opened atomic.Int64
+	opener := fs.OpenFn(func(fullPath string, flag int, perm os.FileMode) (fs.FileLike, error) {
+		opened.Add(1)
+		return nil, os.ErrInvalid
+	})
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tree := index.NewInMemoryTreeBuilder(func(filename string) *fs.FileInfo {
+		return fs.ImmutableDir(filename, mtime)
+	})
+	err := tree.Index([]*fs.FileInfo{
+		fs.ImmutableInfo("dir/a.bin", mtime, 0644, 5, opener),
+		fs.ImmutableInfo("dir/sub/b.txt", mtime, 0644, 7, opener),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = dav.Serve(listener, tree, nil) }()
+	base := "http://" + listener.Addr().String()
+
+	propfind := func(t *testing.T, body string) *multistatus {
+		req, _ := http.NewRequest("PROPFIND", base+"/mount/dir/", strings.NewReader(body))
+		req.Header.Set("Depth", "1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusMultiStatus {
+			t.Fatalf("expected status 207, got %d", resp.StatusCode)
+		}
+		m := &multistatus{}
+		if err := xml.NewDecoder(resp.Body).Decode(m); err != nil {
+			t.Fatalf("unexpected error decoding response: %v", err)
+		}
+		if len(m.Responses) != 3 {
+			t.Fatalf("expected responses for dir, dir/a.bin and dir/sub, got %d", len(m.Responses))
+		}
+		return m
+	}
+
+	t.Run("allprop", func(t *testing.T) {
+		m := propfind(t, `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`)
+		file := m.props("/mount/dir/a.bin", "200")
+		for name, expected := range map[string]string{
+			"getcontentlength": "5",
+			"getlastmodified":  "Fri, 01 Mar 2024 12:00:00 GMT",
+			"displayname":      "a.bin",
+			"getcontenttype":   "application/octet-stream",
+		} {
+			if file[name] != expected {
+				t.Errorf("expected %s of a.bin to be %q, got %q", name, expected, file[name])
+			}
+		}
+		if _, ok := file["getetag"]; !ok {
+			t.Error("expected a.bin to have a getetag")
+		}
+		dir := m.props("/mount/dir/sub/", "200")
+		if _, ok := dir["getcontentlength"]; ok {
+			t.Error("expected no getcontentlength for a directory")
+		}
+		if !strings.Contains(dir["resourcetype"], "collection") {
+			t.Errorf("expected the resourcetype of a directory to be a collection, got %q", dir["resourcetype"])
+		}
+	})
+
+	t.Run("propname", func(t *testing.T) {
+		m := propfind(t, `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:propname/></D:propfind>`)
+		file := m.props("/mount/dir/a.bin", "200")
+		for _, name := range []string{"getcontentlength", "getlastmodified", "getcontenttype", "getetag", "resourcetype"} {
+			value, ok := file[name]
+			if !ok {
+				t.Errorf("expected %s in the property names of a.bin", name)
+			} else if value != "" {
+				t.Errorf("expected no value for %s, got %q", name, value)
+			}
+		}
+	})
+
+	t.Run("named", func(t *testing.T) {
+		m := propfind(t, `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:getcontentlength/><D:resourcetype/></D:prop></D:propfind>`)
+		file := m.props("/mount/dir/a.bin", "200")
+		if len(file) != 2 || file["getcontentlength"] != "5" {
+			t.Errorf("expected only getcontentlength and resourcetype for a.bin, got %v", file)
+		}
+		dir := m.props("/mount/dir/sub/", "200")
+		if _, ok := dir["resourcetype"]; len(dir) != 1 || !ok {
+			t.Errorf("expected only resourcetype for a directory, got %v", dir)
+		}
+		if _, ok := m.props("/mount/dir/sub/", "404")["getcontentlength"]; !ok {
+			t.Error("expected getcontentlength of a directory to be reported as not found")
+		}
+	})
+
+	if n := opened.Load(); n != 0 {
+		t.Errorf("expected properties to be read from the tree, without opening files, but %d were opened", n)
+	}
+}
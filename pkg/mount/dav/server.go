@@ -1,6 +1,7 @@
 package dav
 
 import (
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
@@ -10,6 +11,16 @@ import (
 	"github.com/ozkatz/cloudzip/pkg/mount/index"
 )
 
+type Options struct {
+	Logger *slog.Logger
+	// Auth, if set, is required to accept a request before it is served
+	Auth Authenticator
+	// AccessLog, if set, is written a line per request in AccessLogFormat (AccessLogCommon if not set),
+	// including requests rejected by Auth
+	AccessLog       io.Writer
+	AccessLogFormat AccessLogFormat
+}
+
 func newHandler(fs webdav.FileSystem, prefix string) http.Handler {
 	return &webdav.Handler{
 		Prefix:     prefix,
@@ -18,11 +29,31 @@ func newHandler(fs webdav.FileSystem, prefix string) http.Handler {
 	}
 }
 
-func Serve(listener net.Listener, tree index.Tree, logger *slog.Logger) error {
+func Serve(listener net.Listener, tree index.Tree, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
 	h := newHandler(NewDavFS(tree), "/mount")
-	if logger != nil {
+	if opts.Auth != nil {
+		h = &authHandler{
+			auth: opts.Auth,
+			next: h,
+		}
+	}
+	if opts.Logger != nil {
 		h = &loggingHandler{
-			logger: logger,
+			logger: opts.Logger,
+			next:   h,
+		}
+	}
+	if opts.AccessLog != nil {
+		format := opts.AccessLogFormat
+		if format == "" {
+			format = AccessLogCommon
+		}
+		h = &accessLogHandler{
+			w:      opts.AccessLog,
+			format: format,
 			next:   h,
 		}
 	}
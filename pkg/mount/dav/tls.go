@@ -0,0 +1,82 @@
+package dav
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+var (
+	ErrInvalidTLSConfig = errors.New("invalid TLS configuration")
+)
+
+const selfSignedValidity = time.Hour * 24 * 365
+
+// TLSConfig returns a server TLS configuration, either from the given certificate and key files,
+// or using a freshly generated self-signed certificate for the given hosts.
+func TLSConfig(certFile, keyFile string, selfSigned bool, hosts ...string) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case selfSigned && (certFile != "" || keyFile != ""):
+		return nil, fmt.Errorf("%w: cannot use a self-signed certificate together with a certificate file",
+			ErrInvalidTLSConfig)
+	case selfSigned:
+		cert, err = selfSignedCertificate(hosts...)
+	case certFile != "" && keyFile != "":
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	default:
+		return nil, fmt.Errorf("%w: both a certificate and a key file are required", ErrInvalidTLSConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func selfSignedCertificate(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"cloudzip"}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
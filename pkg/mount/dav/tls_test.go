@@ -0,0 +1,120 @@
+package dav_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/dav"
+)
+
+// writeKeyPair writes a certificate for localhost and its key as PEM files, returning their names
+func writeKeyPair(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	certFile, keyFile := writeKeyPair(t)
+	otherCertFile, _ := writeKeyPair(t)
+
+	t.Run("certificate and key", func(t *testing.T) {
+		cfg, err := dav.TLSConfig(certFile, keyFile, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(cfg.Certificates) != 1 {
+			t.Fatalf("expected a certificate, got %d", len(cfg.Certificates))
+		}
+		leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+		if err != nil || leaf.Subject.CommonName != "localhost" {
+			t.Errorf("expected the certificate from the file, got %v (err: %v)", leaf.Subject, err)
+		}
+	})
+
+	t.Run("self-signed", func(t *testing.T) {
+		cfg, err := dav.TLSConfig("", "", true, "localhost", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := leaf.VerifyHostname("localhost"); err != nil {
+			t.Errorf("expected the certificate to be valid for localhost: %v", err)
+		}
+		if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+			t.Errorf("expected the certificate to be valid for 127.0.0.1: %v", err)
+		}
+		if leaf.NotAfter.Before(time.Now().Add(24 * time.Hour)) {
+			t.Errorf("expected the certificate to be valid for longer, expires %s", leaf.NotAfter)
+		}
+	})
+
+	for _, c := range []struct {
+		name       string
+		certFile   string
+		keyFile    string
+		selfSigned bool
+	}{
+		{"certificate without key", certFile, "", false},
+		{"key without certificate", "", keyFile, false},
+		{"neither", "", "", false},
+		{"self-signed with a certificate", certFile, keyFile, true},
+		{"self-signed with a key", "", keyFile, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := dav.TLSConfig(c.certFile, c.keyFile, c.selfSigned); !errors.Is(err, dav.ErrInvalidTLSConfig) {
+				t.Errorf("expected ErrInvalidTLSConfig, got %v", err)
+			}
+		})
+	}
+
+	t.Run("mismatched key", func(t *testing.T) {
+		if _, err := dav.TLSConfig(otherCertFile, keyFile, false); err == nil {
+			t.Error("expected an error for a certificate that doesn't match the key")
+		}
+	})
+	t.Run("unreadable key", func(t *testing.T) {
+		if _, err := dav.TLSConfig(certFile, filepath.Join(t.TempDir(), "missing.pem"), false); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected os.ErrNotExist, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package mount_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBuildZipTree_EmptyEntries(t *testing.T) {
+	archive := writeTestZipEntries(t, testEntry{name: "empty/"}, testEntry{name: "empty.txt"})
+
+	stats := &remote.Stats{}
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+		mount.WithStats(stats))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+
+	dir, err := tree.Stat("empty")
+	if err != nil {
+		t.Fatalf("unexpected error statting empty directory: %v", err)
+	}
+	if !dir.IsDir() {
+		t.Errorf("expected empty to be a directory")
+	}
+	entries, err := tree.Readdir("empty")
+	if err != nil {
+		t.Fatalf("unexpected error listing empty directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries in empty directory, got %d", len(entries))
+	}
+
+	info, err := tree.Stat("empty.txt")
+	if err != nil {
+		t.Fatalf("unexpected error statting zero-byte file: %v", err)
+	}
+	if info.IsDir() || info.Size() != 0 {
+		t.Errorf("expected a zero-byte file, got dir=%t size=%d", info.IsDir(), info.Size())
+	}
+	requests := stats.Requests()
+	file, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening zero-byte file: %v", err)
+	}
+	data, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil || len(data) != 0 {
+		t.Errorf("expected no content, got %d bytes (err: %v)", len(data), err)
+	}
+	if stats.Requests() != requests {
+		t.Errorf("expected no requests to read a zero-byte file, got %d", stats.Requests()-requests)
+	}
+}
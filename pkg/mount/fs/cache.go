@@ -1,42 +1,177 @@
 package fs
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 )
 
+// ErrCacheReadOnly is returned writing to a cache opened with WithReadOnly
+var ErrCacheReadOnly = errors.New("cache is read-only")
+
 type FileCache struct {
 	dir string
+	// when set, cached files are encrypted at rest using this key
+	encryptionKey []byte
+	// when set, cached files are read through a memory mapping
+	memoryMap bool
+	// when set, nothing is ever written to (or removed from) dir
+	readOnly bool
+}
+
+type CacheOpt func(c *FileCache)
+
+// WithReadOnly serves files from the cache without ever writing to it, e.g. a shared cache that was warmed
+// beforehand, or one on a read-only filesystem. Set, Touch and Remove fail with ErrCacheReadOnly.
+func WithReadOnly() CacheOpt {
+	return func(c *FileCache) {
+		c.readOnly = true
+	}
 }
 
-func NewFileCache(dir string) *FileCache {
-	return &FileCache{dir: dir}
+// WithMemoryMap reads cached files through a read-only memory mapping, which saves a syscall per read of
+// entries read over and over. It doesn't apply to encrypted caches, whose files are decrypted as they are
+// read, nor to platforms without mmap.
+func WithMemoryMap() CacheOpt {
+	return func(c *FileCache) {
+		c.memoryMap = true
+	}
 }
 
-func (c *FileCache) Get(key string) (*os.File, error) {
+func NewFileCache(dir string, opts ...CacheOpt) *FileCache {
+	c := &FileCache{dir: dir}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewEncryptedFileCache returns a cache that transparently encrypts files written to dir (using AES-GCM),
+// decrypting them on read. The key is derived from the key material with scrypt, salted with a random salt
+// stored in dir. The key material itself is never written to the cache directory.
+func NewEncryptedFileCache(dir string, keyMaterial []byte, opts ...CacheOpt) (*FileCache, error) {
+	c := NewFileCache(dir, opts...)
+	key, err := deriveCacheKey(dir, keyMaterial, c.readOnly)
+	if err != nil {
+		return nil, err
+	}
+	c.encryptionKey = key
+	return c, nil
+}
+
+// ReadOnly returns whether the cache was opened with WithReadOnly
+func (c *FileCache) ReadOnly() bool {
+	return c.readOnly
+}
+
+func (c *FileCache) Get(key string) (FileLike, error) {
 	path := filepath.Join(c.dir, key)
-	return os.Open(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.encryptionKey == nil {
+		if c.memoryMap {
+			return openMapped(f)
+		}
+		return f, nil
+	}
+	ef, err := openEncrypted(c.encryptionKey, f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return ef, nil
+}
+
+// ModTime returns when the file cached under key was written, or last marked fresh with Touch
+func (c *FileCache) ModTime(key string) (time.Time, error) {
+	info, err := os.Stat(filepath.Join(c.dir, key))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
 }
 
-func (c *FileCache) Set(key string, content io.ReadCloser, expected int64) (*os.File, error) {
+// Touch marks the file cached under key as fresh, as if it was just written
+func (c *FileCache) Touch(key string) error {
+	if c.readOnly {
+		return ErrCacheReadOnly
+	}
+	now := time.Now()
+	return os.Chtimes(filepath.Join(c.dir, key), now, now)
+}
+
+// Remove drops the file cached under key. Files already opened can still be read.
+func (c *FileCache) Remove(key string) error {
+	if c.readOnly {
+		return ErrCacheReadOnly
+	}
+	return os.Remove(filepath.Join(c.dir, key))
+}
+
+// CachePolicy decides whether the content of a read is kept in the cache
+type CachePolicy int
+
+const (
+	// CachePolicyCache keeps content in the cache, so later reads are served locally
+	CachePolicyCache CachePolicy = iota
+	// CachePolicyBypass serves content from a temporary file that is removed once it's closed,
+	// for one-shot reads that shouldn't churn the cache
+	CachePolicyBypass
+)
+
+var cachePolicyNames = []string{"cache", "bypass"}
+
+func (p CachePolicy) String() string {
+	if p < 0 || int(p) >= len(cachePolicyNames) {
+		return fmt.Sprintf("CachePolicy(%d)", int(p))
+	}
+	return cachePolicyNames[p]
+}
+
+// ParseCachePolicy parses one of "cache" or "bypass". An empty string means cache.
+func ParseCachePolicy(s string) (CachePolicy, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return CachePolicyCache, nil
+	}
+	i := slices.Index(cachePolicyNames, s)
+	if i == -1 {
+		return CachePolicyCache, fmt.Errorf("unknown cache policy: '%s' (expected one of: %s)",
+			s, strings.Join(cachePolicyNames, ", "))
+	}
+	return CachePolicy(i), nil
+}
+
+func (c *FileCache) Set(key string, content io.ReadCloser, expected int64) (FileLike, error) {
+	return c.SetWithPolicy(key, content, expected, CachePolicyCache)
+}
+
+// SetWithPolicy stores content under key, unless policy is CachePolicyBypass, returning a file to read it from
+func (c *FileCache) SetWithPolicy(key string, content io.ReadCloser, expected int64, policy CachePolicy) (FileLike, error) {
+	if c.readOnly {
+		return nil, ErrCacheReadOnly
+	}
+	if policy == CachePolicyBypass {
+		return c.temporary(content, expected)
+	}
 	path := filepath.Join(c.dir, fmt.Sprintf("%s-w", key))
 	out, err := os.Create(path)
 	if err != nil {
 		return nil, err
 	}
-	n, err := io.Copy(out, content)
-	if err != nil {
+	if err := c.write(out, content, expected); err != nil {
 		// we now have a bad file on our hands
 		_ = out.Close()
 		_ = os.Remove(path)
 		return nil, err
 	}
-	if expected > 0 && n != expected {
-		return nil, os.ErrInvalid
-	}
-
 	err = out.Close()
 	if err != nil {
 		return nil, err
@@ -49,3 +184,47 @@ func (c *FileCache) Set(key string, content io.ReadCloser, expected int64) (*os.
 	f, err := c.Get(key)
 	return f, err
 }
+
+func (c *FileCache) write(out *os.File, content io.Reader, expected int64) error {
+	var n int64
+	var err error
+	if c.encryptionKey != nil {
+		n, err = writeEncrypted(c.encryptionKey, out, content)
+	} else {
+		n, err = io.Copy(out, content)
+	}
+	if err != nil {
+		return err
+	}
+	if expected > 0 && n != expected {
+		return os.ErrInvalid
+	}
+	return nil
+}
+
+// temporary writes content to a file that is unlinked right away, so it's never visible in the cache
+// and its space is reclaimed once it's closed. It's still encrypted if the cache is.
+func (c *FileCache) temporary(content io.Reader, expected int64) (FileLike, error) {
+	out, err := os.CreateTemp(c.dir, "bypass-*")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(out.Name())
+	if err := c.write(out, content, expected); err != nil {
+		_ = out.Close()
+		return nil, err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		_ = out.Close()
+		return nil, err
+	}
+	if c.encryptionKey == nil {
+		return out, nil
+	}
+	ef, err := openEncrypted(c.encryptionKey, out)
+	if err != nil {
+		_ = out.Close()
+		return nil, err
+	}
+	return ef, nil
+}
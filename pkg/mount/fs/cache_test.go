@@ -0,0 +1,238 @@
+package fs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+)
+
+func newEncryptedFileCache(t *testing.T, dir string, key string, opts ...fs.CacheOpt) *fs.FileCache {
+	t.Helper()
+	cache, err := fs.NewEncryptedFileCache(dir, []byte(key), opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return cache
+}
+
+func TestEncryptedFileCache(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 10000) // spans several chunks
+	cache := newEncryptedFileCache(t, dir, "secret key")
+	f, err := cache.Set("key", io.NopCloser(bytes.NewReader(content)), int64(len(content)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("decrypted content doesn't match")
+	}
+
+	// random access across a chunk boundary
+	buf := make([]byte, 10)
+	n, err := f.ReadAt(buf, 64*1024-5)
+	if err != nil || n != 10 {
+		t.Fatalf("unexpected ReadAt result: n=%d, err=%v", n, err)
+	}
+	if !bytes.Equal(buf, content[64*1024-5:64*1024+5]) {
+		t.Errorf("ReadAt returned wrong content: %s", buf)
+	}
+	_ = f.Close()
+
+	// data at rest is not plaintext
+	raw, err := os.ReadFile(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Contains(raw, content[:64]) {
+		t.Errorf("expected cache file to be encrypted")
+	}
+
+	// a different key can't read it
+	if _, err = newEncryptedFileCache(t, dir, "wrong key").Get("key"); !errors.Is(err, fs.ErrCorruptCacheFile) {
+		t.Errorf("expected ErrCorruptCacheFile, got %v", err)
+	}
+
+	// the same key opens it again, with the salt stored in the cache directory
+	f, err = newEncryptedFileCache(t, dir, "secret key", fs.WithReadOnly()).Get("key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = f.Close()
+	// a read-only cache can't create the salt
+	if _, err := fs.NewEncryptedFileCache(t.TempDir(), []byte("secret key"), fs.WithReadOnly()); err == nil {
+		t.Error("expected an error for a read-only cache without a salt")
+	}
+}
+
+func TestEncryptedFileCache_Tampering(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 10000) // 3 chunks
+	lastChunk := len(content) - 2*64*1024 + 16
+	cases := map[string]func(raw []byte) []byte{
+		"truncated chunk": func(raw []byte) []byte { return raw[:len(raw)-1] },
+		"dropped chunk":   func(raw []byte) []byte { return raw[:len(raw)-lastChunk] },
+		// dropping whole chunks and rewriting the size is caught by the header tag
+		"rewritten size": func(raw []byte) []byte {
+			raw = raw[:len(raw)-lastChunk]
+			binary.LittleEndian.PutUint64(raw[20:], 2*64*1024)
+			return raw
+		},
+	}
+	for name, tamper := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			cache := newEncryptedFileCache(t, dir, "secret key")
+			f, err := cache.Set("key", io.NopCloser(bytes.NewReader(content)), int64(len(content)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = f.Close()
+			path := filepath.Join(dir, "key")
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := os.WriteFile(path, tamper(raw), 0o600); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			f, err = cache.Get("key")
+			if err == nil {
+				_, err = io.ReadAll(f)
+				_ = f.Close()
+			}
+			if !errors.Is(err, fs.ErrCorruptCacheFile) {
+				t.Errorf("expected ErrCorruptCacheFile, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileCache_Bypass(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	caches := map[string]func(dir string) *fs.FileCache{
+		"plain":     func(dir string) *fs.FileCache { return fs.NewFileCache(dir) },
+		"encrypted": func(dir string) *fs.FileCache { return newEncryptedFileCache(t, dir, "secret key") },
+	}
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			cache := newCache(dir)
+			f, err := cache.SetWithPolicy("key", io.NopCloser(bytes.NewReader(content)), int64(len(content)), fs.CachePolicyBypass)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatalf("unexpected error reading: %v", err)
+			}
+			_ = f.Close()
+			if !bytes.Equal(data, content) {
+				t.Errorf("content doesn't match")
+			}
+			if _, err := cache.Get("key"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected bypassed content not to be cached, got %v", err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// the salt of the encryption key is the only file
+			entries = slices.DeleteFunc(entries, func(e os.DirEntry) bool { return e.Name() == ".encryption-salt" })
+			if len(entries) != 0 {
+				t.Errorf("expected the cache directory to be empty, found %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestParseCachePolicy(t *testing.T) {
+	for s, expected := range map[string]fs.CachePolicy{"": fs.CachePolicyCache, "Bypass": fs.CachePolicyBypass} {
+		policy, err := fs.ParseCachePolicy(s)
+		if err != nil || policy != expected {
+			t.Errorf("%q: expected %s, got %s (%v)", s, expected, policy, err)
+		}
+	}
+	if _, err := fs.ParseCachePolicy("no-evict"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
+
+func TestFileCache_MemoryMap(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	cache := fs.NewFileCache(dir, fs.WithMemoryMap())
+	if _, err := cache.Set("key", io.NopCloser(bytes.NewReader(content)), int64(len(content))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := cache.Get("key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// evicting a mapped file leaves it readable
+	if err := cache.Remove("key"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("mapped content doesn't match")
+	}
+	buf := make([]byte, 10)
+	if n, err := f.ReadAt(buf, int64(len(content))-5); n != 5 || err != io.EOF {
+		t.Errorf("expected a short read at the end, got n=%d, err=%v", n, err)
+	}
+	if off, err := f.Seek(-16, io.SeekEnd); err != nil || off != int64(len(content))-16 {
+		t.Errorf("unexpected Seek result: off=%d, err=%v", off, err)
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected writes to fail, got %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+	if _, err := f.ReadAt(buf, 0); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected reads after Close to fail with os.ErrClosed, got %v", err)
+	}
+}
+
+func BenchmarkFileCache_ReadAt(b *testing.B) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	for _, c := range []struct {
+		name string
+		opts []fs.CacheOpt
+	}{
+		{"file", nil},
+		{"mmap", []fs.CacheOpt{fs.WithMemoryMap()}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			cache := fs.NewFileCache(b.TempDir(), c.opts...)
+			f, err := cache.Set("key", io.NopCloser(bytes.NewReader(content)), int64(len(content)))
+			if err != nil {
+				b.Fatalf("unexpected error: %v", err)
+			}
+			defer func() { _ = f.Close() }()
+			buf := make([]byte, 512)
+			b.SetBytes(int64(len(buf)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := f.ReadAt(buf, int64(i%8)*512); err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
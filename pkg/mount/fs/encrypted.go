@@ -0,0 +1,316 @@
+package fs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted cache files are made of a header followed by fixed-size chunks, each sealed independently with
+// AES-256-GCM, so that random reads only need to decrypt the chunks they touch.
+// Every file uses its own key, derived from the cache key and a random per-file salt.
+//
+//	header: magic (4 bytes) | salt (16 bytes) | plaintext size (8 bytes, little endian) | GCM tag of the header (16 bytes)
+//	chunk:  ciphertext of up to encryptedChunkSize bytes | GCM tag (16 bytes)
+//
+// The header tag authenticates the plaintext size, and each chunk is sealed with the magic, salt and whether it's
+// the last chunk as additional data, so that chunks dropped from the end of a file are detected.
+// A file always has at least one (possibly empty) chunk.
+const (
+	encryptedChunkSize     = 64 * 1024
+	encryptedSaltSize      = 16
+	encryptedTagSize       = 16
+	encryptedHeaderSize    = 4 + encryptedSaltSize + 8 + encryptedTagSize
+	encryptedHeaderTagFrom = encryptedHeaderSize - encryptedTagSize
+
+	// encryptionSaltFile holds the salt the cache key is derived with, in the cache directory
+	encryptionSaltFile = ".encryption-salt"
+)
+
+var (
+	encryptedMagic = []byte("CZE2")
+
+	ErrCorruptCacheFile = errors.New("corrupt encrypted cache file")
+)
+
+// deriveCacheKey turns key material (e.g. a passphrase) into an AES-256 key with scrypt,
+// salted with the salt stored in dir, which is created on first use
+func deriveCacheKey(dir string, keyMaterial []byte, readOnly bool) ([]byte, error) {
+	salt, err := cacheKeySalt(dir, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return scrypt.Key(keyMaterial, salt, 1<<15, 8, 1, 32)
+}
+
+// cacheKeySalt reads the salt stored in dir, creating it if it doesn't exist yet.
+// Concurrent mounts of the same cache directory agree on the salt: the first one to link it in place wins.
+func cacheKeySalt(dir string, readOnly bool) ([]byte, error) {
+	path := filepath.Join(dir, encryptionSaltFile)
+	salt, err := os.ReadFile(path)
+	if err == nil || !os.IsNotExist(err) || readOnly {
+		if err != nil {
+			return nil, fmt.Errorf("could not read cache encryption salt: %w", err)
+		}
+		if len(salt) != encryptedSaltSize {
+			return nil, fmt.Errorf("%w: %s: bad salt size", ErrCorruptCacheFile, path)
+		}
+		return salt, nil
+	}
+	salt = make([]byte, encryptedSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, "salt-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(salt)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Link(tmp.Name(), path); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	return cacheKeySalt(dir, true)
+}
+
+func fileCipher(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(aead cipher.AEAD, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+	return nonce
+}
+
+// headerNonce is the nonce the header tag is computed with, which no chunk uses
+func headerNonce(aead cipher.AEAD) []byte {
+	return chunkNonce(aead, math.MaxUint64)
+}
+
+// chunkAdditionalData binds a chunk to the file (by its magic and salt) and to whether it's the last one
+func chunkAdditionalData(header []byte, last bool) []byte {
+	ad := make([]byte, 0, 4+encryptedSaltSize+1)
+	ad = append(ad, header[:4+encryptedSaltSize]...)
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+// writeEncrypted encrypts content into out, returning the number of plaintext bytes written
+func writeEncrypted(key []byte, out *os.File, content io.Reader) (int64, error) {
+	salt := make([]byte, encryptedSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return 0, err
+	}
+	aead, err := fileCipher(key, salt)
+	if err != nil {
+		return 0, err
+	}
+	// write header with a placeholder size and tag, filled in once the content is consumed
+	header := make([]byte, encryptedHeaderSize)
+	copy(header, encryptedMagic)
+	copy(header[4:], salt)
+	if _, err := out.Write(header); err != nil {
+		return 0, err
+	}
+	// read a chunk ahead, to know whether the current one is the last
+	current := make([]byte, encryptedChunkSize)
+	next := make([]byte, encryptedChunkSize)
+	n, err := io.ReadFull(content, current)
+	var total int64
+	for index := uint64(0); ; index++ {
+		last := err != nil
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return total, err
+		}
+		var nextN int
+		var nextErr error
+		if !last {
+			nextN, nextErr = io.ReadFull(content, next)
+			if nextErr == io.EOF {
+				last = true
+			}
+		}
+		sealed := aead.Seal(nil, chunkNonce(aead, index), current[:n], chunkAdditionalData(header, last))
+		if _, err := out.Write(sealed); err != nil {
+			return total, err
+		}
+		total += int64(n)
+		if last {
+			break
+		}
+		current, next = next, current
+		n, err = nextN, nextErr
+	}
+	binary.LittleEndian.PutUint64(header[4+encryptedSaltSize:], uint64(total))
+	copy(header[encryptedHeaderTagFrom:], aead.Seal(nil, headerNonce(aead), nil, header[:encryptedHeaderTagFrom]))
+	if _, err := out.WriteAt(header, 0); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+var _ FileLike = &encryptedFile{}
+
+// encryptedFile is a read-only view of the plaintext of an encrypted cache file
+type encryptedFile struct {
+	f         *os.File
+	aead      cipher.AEAD
+	header    []byte
+	size      int64
+	lastChunk int64
+	offset    int64
+}
+
+// encryptedFileSize returns the size of an encrypted file holding size bytes of plaintext
+func encryptedFileSize(size int64, overhead int) int64 {
+	chunks := (size + encryptedChunkSize - 1) / encryptedChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return encryptedHeaderSize + size + chunks*int64(overhead)
+}
+
+func openEncrypted(key []byte, f *os.File) (*encryptedFile, error) {
+	header := make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptCacheFile, err)
+	}
+	if string(header[:4]) != string(encryptedMagic) {
+		return nil, fmt.Errorf("%w: bad header", ErrCorruptCacheFile)
+	}
+	salt := header[4 : 4+encryptedSaltSize]
+	aead, err := fileCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := aead.Open(nil, headerNonce(aead), header[encryptedHeaderTagFrom:], header[:encryptedHeaderTagFrom]); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrCorruptCacheFile, err)
+	}
+	size := int64(binary.LittleEndian.Uint64(header[4+encryptedSaltSize:]))
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != encryptedFileSize(size, aead.Overhead()) {
+		return nil, fmt.Errorf("%w: expected %d bytes, found %d", ErrCorruptCacheFile,
+			encryptedFileSize(size, aead.Overhead()), info.Size())
+	}
+	lastChunk := int64(0)
+	if size > 0 {
+		lastChunk = (size - 1) / encryptedChunkSize
+	}
+	return &encryptedFile{
+		f:         f,
+		aead:      aead,
+		header:    header,
+		size:      size,
+		lastChunk: lastChunk,
+	}, nil
+}
+
+func (e *encryptedFile) readChunk(index int64) ([]byte, error) {
+	sealedSize := int64(encryptedChunkSize + e.aead.Overhead())
+	sealed := make([]byte, sealedSize)
+	n, err := e.f.ReadAt(sealed, encryptedHeaderSize+index*sealedSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	ad := chunkAdditionalData(e.header, index == e.lastChunk)
+	plain, err := e.aead.Open(nil, chunkNonce(e.aead, uint64(index)), sealed[:n], ad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chunk %d: %v", ErrCorruptCacheFile, index, err)
+	}
+	return plain, nil
+}
+
+func (e *encryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= e.size {
+		return 0, io.EOF
+	}
+	var n int
+	for n < len(p) && off < e.size {
+		index := off / encryptedChunkSize
+		chunk, err := e.readChunk(index)
+		if err != nil {
+			return n, err
+		}
+		chunkOffset := off - index*encryptedChunkSize
+		if chunkOffset >= int64(len(chunk)) {
+			return n, fmt.Errorf("%w: chunk %d is truncated", ErrCorruptCacheFile, index)
+		}
+		copied := copy(p[n:], chunk[chunkOffset:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (e *encryptedFile) Read(p []byte) (int, error) {
+	n, err := e.ReadAt(p, e.offset)
+	e.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (e *encryptedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += e.offset
+	case io.SeekEnd:
+		offset += e.size
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	e.offset = offset
+	return offset, nil
+}
+
+func (e *encryptedFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (e *encryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (e *encryptedFile) Close() error {
+	return e.f.Close()
+}
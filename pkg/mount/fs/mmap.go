@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+var _ FileLike = &mappedFile{}
+
+// mappedFile reads a cached file through a read-only memory mapping of it, so reads are copies from memory
+// rather than syscalls.
+//
+// Mappings outlive the removal of their file (as open files do), and cache files are replaced by renaming
+// a new file over them, never rewritten or truncated in place, so a mapped file can't shrink under its
+// mapping: evicting or refreshing an entry that is being read is safe. The mapping is released on Close,
+// which waits for reads in progress, and reads after it fail with os.ErrClosed rather than fault.
+type mappedFile struct {
+	name string
+	// mu is held for reading while data is read, and for writing to unmap it
+	mu     sync.RWMutex
+	data   []byte
+	offset int64
+	// offsetMu guards offset, for Read and Seek
+	offsetMu sync.Mutex
+}
+
+// openMapped maps f, closing it: the mapping doesn't need its file descriptor. Empty files, which can't
+// be mapped, and platforms without mmap get f itself.
+func openMapped(f *os.File) (FileLike, error) {
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if info.Size() == 0 || !mmapSupported {
+		return f, nil
+	}
+	data, err := mmap(f, int(info.Size()))
+	_ = f.Close()
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return &mappedFile{name: f.Name(), data: data}, nil
+}
+
+func (m *mappedFile) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.data == nil {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: m.name, Err: os.ErrInvalid}
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *mappedFile) Read(p []byte) (int, error) {
+	m.offsetMu.Lock()
+	defer m.offsetMu.Unlock()
+	n, err := m.ReadAt(p, m.offset)
+	m.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (m *mappedFile) Seek(offset int64, whence int) (int64, error) {
+	m.offsetMu.Lock()
+	defer m.offsetMu.Unlock()
+	m.mu.RLock()
+	size := int64(len(m.data))
+	closed := m.data == nil
+	m.mu.RUnlock()
+	if closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += m.offset
+	case io.SeekEnd:
+		offset += size
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: m.name, Err: os.ErrInvalid}
+	}
+	m.offset = offset
+	return offset, nil
+}
+
+// Write fails, as it does for cached files opened read-only
+func (m *mappedFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: m.name, Err: os.ErrPermission}
+}
+
+func (m *mappedFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: m.name, Err: os.ErrPermission}
+}
+
+func (m *mappedFile) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return os.ErrClosed
+	}
+	data := m.data
+	m.data = nil
+	return munmap(data)
+}
@@ -0,0 +1,211 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mount.proto
+
+const (
+	// ReadChunkSize is the maximal size of the chunks Read streams
+	ReadChunkSize = 64 * 1024
+	// readDirPageSize is the number of entries ReadDir gets from the tree at a time
+	readDirPageSize = 1024
+	// maxRequestSize bounds the size of request messages, which only hold paths and patterns
+	maxRequestSize = 1024 * 1024
+)
+
+type Options struct {
+	Logger *slog.Logger
+}
+
+// Serve serves the Mount service of mount.proto for tree, without TLS: gRPC clients connect to it with
+// insecure credentials
+func Serve(listener net.Listener, tree index.Tree, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	s := &server{tree: tree, logger: opts.Logger}
+	if s.logger == nil {
+		s.logger = remote.DummyLogger()
+	}
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxRequestSize),
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	)
+	RegisterMountServer(srv, s)
+	return srv.Serve(listener)
+}
+
+type server struct {
+	UnimplementedMountServer
+	tree   index.Tree
+	logger *slog.Logger
+}
+
+func (s *server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	return resp, s.done(ctx, info.FullMethod, start, err)
+}
+
+func (s *server) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	return s.done(ss.Context(), info.FullMethod, start, err)
+}
+
+// done logs an RPC that ended with err, returning the status error it fails with
+func (s *server) done(ctx context.Context, method string, start time.Time, err error) error {
+	err = s.statusOf(ctx, method, err)
+	s.logger.DebugContext(ctx, "gRPC request done",
+		"method", method,
+		"grpc_status", status.Code(err),
+		"error", err,
+		"took_us", time.Since(start).Microseconds())
+	return err
+}
+
+// statusOf returns the status error an RPC that failed with err ends with
+func (s *server) statusOf(ctx context.Context, method string, err error) error {
+	if _, ok := status.FromError(err); ok {
+		// nil, or already a status
+		return err
+	}
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, path.ErrBadPattern):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, zipfile.ErrEntryChanged):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	s.logger.WarnContext(ctx, "gRPC request failed", "method", method, "error", err)
+	return status.Error(codes.Internal, err.Error())
+}
+
+func fileInfoOf(fullPath string, info os.FileInfo) *FileInfo {
+	return &FileInfo{
+		Path:           strings.Trim(fullPath, fs.Delimiter),
+		IsDir:          info.IsDir(),
+		Size:           info.Size(),
+		Mode:           uint32(info.Mode().Perm()),
+		MtimeUnixNanos: info.ModTime().UnixNano(),
+	}
+}
+
+func (s *server) Stat(_ context.Context, req *StatRequest) (*FileInfo, error) {
+	info, err := s.tree.Stat(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfoOf(req.Path, info), nil
+}
+
+func (s *server) ReadDir(req *ReadDirRequest, stream Mount_ReadDirServer) error {
+	ctx := stream.Context()
+	info, err := s.tree.Stat(req.Path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return status.Errorf(codes.FailedPrecondition, "%s is not a directory", req.Path)
+	}
+	for offset := 0; ; offset += readDirPageSize {
+		entries, err := s.tree.ReaddirRange(req.Path, offset, readDirPageSize)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := stream.Send(fileInfoOf(path.Join(req.Path, entry.Name()), entry)); err != nil {
+				return err
+			}
+		}
+		if len(entries) < readDirPageSize || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *server) List(req *ListRequest, stream Mount_ListServer) error {
+	ctx := stream.Context()
+	root := strings.Trim(req.Root, fs.Delimiter)
+	return s.tree.Walk(root, func(fullPath string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if fullPath == root {
+			return nil
+		}
+		return stream.Send(fileInfoOf(fullPath, info))
+	}, index.WithInclude(req.Include...), index.WithExclude(req.Exclude...))
+}
+
+func (s *server) Read(req *ReadRequest, stream Mount_ReadServer) error {
+	ctx := stream.Context()
+	if req.Offset < 0 || req.Length < 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid range: offset %d, length %d", req.Offset, req.Length)
+	}
+	info, err := s.tree.Stat(req.Path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return status.Errorf(codes.FailedPrecondition, "%s is a directory", req.Path)
+	}
+	end := info.Size()
+	// compared to what's left rather than summed with the offset, which may overflow
+	if req.Length > 0 && req.Length < end-req.Offset {
+		end = req.Offset + req.Length
+	}
+	if req.Offset >= end {
+		return nil
+	}
+	file, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	buf := make([]byte, ReadChunkSize)
+	for offset := req.Offset; offset < end; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := file.ReadAt(buf[:min(int64(len(buf)), end-offset)], offset)
+		if n > 0 {
+			if err := stream.Send(&ReadResponse{Data: buf[:n]}); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("could not read %s at offset %d: %w", req.Path, offset, io.ErrNoProgress)
+		}
+	}
+	return nil
+}
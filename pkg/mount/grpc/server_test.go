@@ -0,0 +1,234 @@
+package grpc_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/mount/grpc"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func writeZip(t *testing.T, files map[string]string) string {
+	archive := filepath.Join(t.TempDir(), "test.zip")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w := zip.NewWriter(out)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, _ = f.Write([]byte(files[name]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = out.Close()
+	return archive
+}
+
+func serve(t *testing.T, files map[string]string) (grpc.MountClient, *googlegrpc.ClientConn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	tree, err := mount.BuildZipTree(ctx, remote.DummyLogger(), t.TempDir(), "file://"+writeZip(t, files), nil)
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		_ = grpc.Serve(listener, tree, nil)
+	}()
+	conn, err := googlegrpc.NewClient(listener.Addr().String(), googlegrpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return grpc.NewMountClient(conn), conn
+}
+
+// receive returns the messages of a response stream, and the error it ended with
+func receive[T any](stream interface{ Recv() (*T, error) }, err error) ([]*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	var messages []*T
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			return messages, nil
+		} else if err != nil {
+			return messages, err
+		}
+		messages = append(messages, message)
+	}
+}
+
+func paths(infos []*grpc.FileInfo) []string {
+	result := make([]string, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, info.Path)
+	}
+	return result
+}
+
+func TestServe(t *testing.T) {
+	large := make([]byte, 3*grpc.ReadChunkSize/2)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	files := map[string]string{
+		"a/b.txt":     "hello, gRPC",
+		"a/c/d.csv":   "d",
+		"e.txt":       "e",
+		"a/large.bin": string(large),
+	}
+	c, conn := serve(t, files)
+	ctx := context.Background()
+
+	t.Run("stat", func(t *testing.T) {
+		info, err := c.Stat(ctx, &grpc.StatRequest{Path: "/a/b.txt"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if info.Path != "a/b.txt" || info.IsDir || info.Size != 11 {
+			t.Errorf("unexpected file info: %+v", info)
+		}
+		if info, err := c.Stat(ctx, &grpc.StatRequest{Path: "a"}); err != nil || !info.IsDir {
+			t.Errorf("expected a to be a directory: %+v (err: %v)", info, err)
+		}
+	})
+
+	t.Run("read_dir", func(t *testing.T) {
+		infos, err := receive[grpc.FileInfo](c.ReadDir(ctx, &grpc.ReadDirRequest{Path: "a"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := paths(infos)
+		expected := []string{"a/b.txt", "a/c", "a/large.bin"}
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		infos, err := receive[grpc.FileInfo](c.List(ctx, &grpc.ListRequest{Exclude: []string{".cz", "a/c"}}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := paths(infos)
+		expected := []string{"a", "a/b.txt", "a/large.bin", "e.txt"}
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+		infos, err = receive[grpc.FileInfo](c.List(ctx, &grpc.ListRequest{Root: "a", Include: []string{"a/*/*.csv"}}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = paths(infos)
+		if fmt.Sprint(got) != "[a/c a/c/d.csv]" {
+			t.Errorf("expected only the csv file and its directory, got %v", got)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		cases := []struct {
+			Name   string
+			Offset int64
+			Length int64
+		}{
+			{"whole", 0, 0},
+			{"range", 7, 100},
+			{"across_chunks", grpc.ReadChunkSize - 10, 20},
+			{"past_end", int64(len(large)) + 1, 10},
+			{"length_overflows", 1, math.MaxInt64},
+		}
+		for _, cs := range cases {
+			t.Run(cs.Name, func(t *testing.T) {
+				messages, err := receive[grpc.ReadResponse](c.Read(ctx, &grpc.ReadRequest{Path: "a/large.bin", Offset: cs.Offset, Length: cs.Length}))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				var got []byte
+				for _, resp := range messages {
+					if len(resp.Data) > grpc.ReadChunkSize {
+						t.Errorf("expected chunks of up to %d bytes, got %d", grpc.ReadChunkSize, len(resp.Data))
+					}
+					got = append(got, resp.Data...)
+				}
+				end := int64(len(large))
+				if cs.Length > 0 && cs.Length < end-cs.Offset {
+					end = cs.Offset + cs.Length
+				}
+				expected := large[min(cs.Offset, end):end]
+				if !bytes.Equal(got, expected) {
+					t.Errorf("expected %d bytes from offset %d, got %d different bytes", len(expected), cs.Offset, len(got))
+				}
+			})
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			Name     string
+			Call     func() error
+			Expected codes.Code
+		}{
+			{"stat_missing", func() error {
+				_, err := c.Stat(ctx, &grpc.StatRequest{Path: "missing"})
+				return err
+			}, codes.NotFound},
+			{"read_dir_file", func() error {
+				_, err := receive[grpc.FileInfo](c.ReadDir(ctx, &grpc.ReadDirRequest{Path: "e.txt"}))
+				return err
+			}, codes.FailedPrecondition},
+			{"read_directory", func() error {
+				_, err := receive[grpc.ReadResponse](c.Read(ctx, &grpc.ReadRequest{Path: "a"}))
+				return err
+			}, codes.FailedPrecondition},
+			{"read_negative_offset", func() error {
+				_, err := receive[grpc.ReadResponse](c.Read(ctx, &grpc.ReadRequest{Path: "e.txt", Offset: -1}))
+				return err
+			}, codes.InvalidArgument},
+			{"bad_pattern", func() error {
+				_, err := receive[grpc.FileInfo](c.List(ctx, &grpc.ListRequest{Include: []string{"["}}))
+				return err
+			}, codes.InvalidArgument},
+			{"unknown_method", func() error {
+				return conn.Invoke(ctx, "/"+grpc.Mount_ServiceDesc.ServiceName+"/Write", &grpc.StatRequest{Path: "e.txt"}, &grpc.FileInfo{})
+			}, codes.Unimplemented},
+		}
+		for _, cs := range cases {
+			t.Run(cs.Name, func(t *testing.T) {
+				if code := status.Code(cs.Call()); code != cs.Expected {
+					t.Errorf("expected status %s, got %s", cs.Expected, code)
+				}
+			})
+		}
+	})
+}
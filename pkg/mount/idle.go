@@ -0,0 +1,87 @@
+package mount
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ActivityTracker records when clients were last active, so an idle server can shut itself down.
+// It tracks activity at the connection level, which covers all protocols (NFS and WebDAV) alike.
+type ActivityTracker struct {
+	last atomic.Int64
+}
+
+func NewActivityTracker() *ActivityTracker {
+	a := &ActivityTracker{}
+	a.Touch()
+	return a
+}
+
+// Touch marks the current time as the last activity
+func (a *ActivityTracker) Touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+// IdleFor returns the time passed since the last activity
+func (a *ActivityTracker) IdleFor() time.Duration {
+	return time.Since(time.Unix(0, a.last.Load()))
+}
+
+// WaitIdle blocks until there was no activity for timeout, returning true, or until ctx is done, returning false
+func (a *ActivityTracker) WaitIdle(ctx context.Context, timeout time.Duration) bool {
+	for {
+		remaining := timeout - a.IdleFor()
+		if remaining <= 0 {
+			return true
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// Listener wraps l so that accepting connections and exchanging data with clients counts as activity
+func (a *ActivityTracker) Listener(l net.Listener) net.Listener {
+	return &activityListener{Listener: l, tracker: a}
+}
+
+type activityListener struct {
+	net.Listener
+	tracker *ActivityTracker
+}
+
+func (l *activityListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.tracker.Touch()
+	return &activityConn{Conn: conn, tracker: l.tracker}, nil
+}
+
+type activityConn struct {
+	net.Conn
+	tracker *ActivityTracker
+}
+
+func (c *activityConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.tracker.Touch()
+	}
+	return n, err
+}
+
+func (c *activityConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.tracker.Touch()
+	}
+	return n, err
+}
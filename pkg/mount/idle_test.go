@@ -0,0 +1,60 @@
+package mount_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+)
+
+func TestActivityTracker(t *testing.T) {
+	tracker := mount.NewActivityTracker()
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	listener := tracker.Listener(l)
+	defer func() { _ = listener.Close() }()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	client, err := net.Dial("tcp4", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error connecting: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	// keep the connection busy for longer than the timeout
+	const timeout = 50 * time.Millisecond
+	done := make(chan bool)
+	start := time.Now()
+	go func() {
+		done <- tracker.WaitIdle(context.Background(), timeout)
+	}()
+	for i := 0; i < 5; i++ {
+		if _, err := client.Write([]byte("ping")); err != nil {
+			t.Fatalf("unexpected error writing: %v", err)
+		}
+		time.Sleep(timeout / 2)
+	}
+	if !<-done {
+		t.Fatal("expected WaitIdle to report idle")
+	}
+	if elapsed := time.Since(start); elapsed < 5*timeout/2 {
+		t.Errorf("expected activity to postpone idleness, returned after %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if tracker.WaitIdle(ctx, time.Hour) {
+		t.Error("expected WaitIdle to return false when cancelled")
+	}
+}
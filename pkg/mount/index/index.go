@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 
@@ -21,32 +22,64 @@ type Tree interface {
 	// (some indices have no directory entries at all, so those need to be created)
 	Index(infos []*fs.FileInfo) error
 
-	// Readdir returns the direct descendants of the given directory at entryPath
+	// Readdir returns the direct descendants of the given directory at entryPath,
+	// sorted lexicographically by name (optionally listing directories first)
 	Readdir(entryPath string) (fs.FileInfoList, error)
 
+	// ReaddirRange returns up to limit entries of Readdir(entryPath), starting at offset,
+	// so large directories can be listed incrementally. A limit <= 0 returns all entries from offset.
+	ReaddirRange(entryPath string, offset, limit int) (fs.FileInfoList, error)
+
 	// Stat returns in the FileInfo for the given file/directory at entryPath
 	Stat(entryPath string) (*fs.FileInfo, error)
+
+	// Walk calls fn for root and every entry below it, optionally filtered by include/exclude patterns
+	Walk(root string, fn WalkFunc, opts ...WalkOpt) error
 }
 
 type DirInfoGenerator func(filename string) *fs.FileInfo
 
 // InMemoryTreeBuilder maintains a tree in memory
 type InMemoryTreeBuilder struct {
-	files       map[string]*fs.FileInfo
-	dirs        map[string][]*fs.FileInfo
-	directoryFn DirInfoGenerator
-	l           *sync.Mutex
+	files            map[string]*fs.FileInfo
+	dirs             map[string][]*fs.FileInfo
+	directoryFn      DirInfoGenerator
+	directoriesFirst bool
+	normalize        func(name string) string
+	l                *sync.Mutex
 }
 
 var _ Tree = &InMemoryTreeBuilder{}
 
-func NewInMemoryTreeBuilder(directoryFn DirInfoGenerator) *InMemoryTreeBuilder {
-	return &InMemoryTreeBuilder{
+type TreeOpt func(t *InMemoryTreeBuilder)
+
+// WithDirectoriesFirst lists directories before files in Readdir
+func WithDirectoriesFirst() TreeOpt {
+	return func(t *InMemoryTreeBuilder) {
+		t.directoriesFirst = true
+	}
+}
+
+// WithNameNormalizer applies normalize to paths looked up in the tree (by Stat, Readdir and Walk),
+// so they match entry names that were normalized the same way when the tree was built
+func WithNameNormalizer(normalize func(name string) string) TreeOpt {
+	return func(t *InMemoryTreeBuilder) {
+		t.normalize = normalize
+	}
+}
+
+func NewInMemoryTreeBuilder(directoryFn DirInfoGenerator, opts ...TreeOpt) *InMemoryTreeBuilder {
+	t := &InMemoryTreeBuilder{
 		files:       make(map[string]*fs.FileInfo),
 		dirs:        make(map[string][]*fs.FileInfo),
 		directoryFn: directoryFn,
+		normalize:   func(name string) string { return name },
 		l:           &sync.Mutex{},
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 func (t *InMemoryTreeBuilder) Index(infos []*fs.FileInfo) error {
@@ -75,6 +108,10 @@ func (t *InMemoryTreeBuilder) Index(infos []*fs.FileInfo) error {
 			if explicitDirectory || !fileRegistered {
 				t.files[part] = currentInfo
 			}
+			// an explicit directory entry may have no children, but it should still be listable
+			if _, hasDir := t.dirs[part]; explicitDirectory && !hasDir {
+				t.dirs[part] = []*fs.FileInfo{}
+			}
 
 			// add to parent directory
 			if i > 0 { // we have a parent
@@ -90,10 +127,24 @@ func (t *InMemoryTreeBuilder) Index(infos []*fs.FileInfo) error {
 			}
 		}
 	}
+	// children are added in the order they're first seen, which isn't necessarily sorted by name
+	// (e.g. "a.txt" sorts before "a/b.txt" but after "a"). Sort once, so Readdir is deterministic.
+	for _, entries := range t.dirs {
+		sortEntries(entries, t.directoriesFirst)
+	}
 	// done!
 	return fsck("", t.files, t.dirs) // starting with root
 }
 
+func sortEntries(entries []*fs.FileInfo, directoriesFirst bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if directoriesFirst && entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return path.Base(entries[i].FullPath()) < path.Base(entries[j].FullPath())
+	})
+}
+
 var (
 	ErrIntegrityError = errors.New("integrity error")
 )
@@ -168,13 +219,21 @@ func DirParts(p string) []string {
 }
 
 func (t *InMemoryTreeBuilder) Readdir(entryPath string) (fs.FileInfoList, error) {
+	return t.ReaddirRange(entryPath, 0, 0)
+}
+
+func (t *InMemoryTreeBuilder) ReaddirRange(entryPath string, offset, limit int) (fs.FileInfoList, error) {
 	t.l.Lock()
 	defer t.l.Unlock()
-	entryPath = strings.Trim(entryPath, fs.Delimiter)
+	entryPath = t.normalize(strings.Trim(entryPath, fs.Delimiter))
 	entries, dirExists := t.dirs[entryPath]
 	if !dirExists {
 		return nil, os.ErrNotExist
 	}
+	entries = entries[min(max(offset, 0), len(entries)):]
+	if limit > 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
 	// ReadDir returns paths relative to the read directory, not absolute paths
 	relativeNamedEntries := make(fs.FileInfoList, len(entries))
 	for i, entry := range entries {
@@ -186,7 +245,7 @@ func (t *InMemoryTreeBuilder) Readdir(entryPath string) (fs.FileInfoList, error)
 func (t *InMemoryTreeBuilder) Stat(entryPath string) (*fs.FileInfo, error) {
 	t.l.Lock()
 	defer t.l.Unlock()
-	entryPath = strings.Trim(entryPath, fs.Delimiter)
+	entryPath = t.normalize(strings.Trim(entryPath, fs.Delimiter))
 	stat, ok := t.files[entryPath]
 	if !ok {
 		return nil, os.ErrNotExist
@@ -2,6 +2,7 @@ package index_test
 
 import (
 	"os"
+	"slices"
 	"sort"
 	"testing"
 	"time"
@@ -60,3 +61,94 @@ func TestInMemoryTreeBuilder_Readdir(t *testing.T) {
 		t.Errorf("expected file to exist with modPerm")
 	}
 }
+
+func TestInMemoryTreeBuilder_ReaddirOrder(t *testing.T) {
+	treeData := []string{
+		"a.txt",
+		"a/b.txt",
+		"c",
+		"b/c.txt",
+	}
+	build := func(opts ...index.TreeOpt) *index.InMemoryTreeBuilder {
+		idx := index.NewInMemoryTreeBuilder(func(filename string) *fs.FileInfo {
+			return fs.ImmutableDir(filename, time.Now())
+		}, opts...)
+		infos := make(fs.FileInfoList, len(treeData))
+		for i, p := range treeData {
+			infos[i] = fs.ImmutableInfo(p, time.Now(), os.ModePerm, 100, nil)
+		}
+		sort.Sort(infos)
+		if err := idx.Index(infos); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return idx
+	}
+	names := func(idx *index.InMemoryTreeBuilder) []string {
+		children, err := idx.Readdir("")
+		if err != nil {
+			t.Fatalf("unexpected error listing dir /: %v", err)
+		}
+		result := make([]string, len(children))
+		for i, c := range children {
+			result[i] = c.Name()
+		}
+		return result
+	}
+
+	got := names(build())
+	expected := []string{"a", "a.txt", "b", "c"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got = names(build(index.WithDirectoriesFirst()))
+	expected = []string{"a", "b", "a.txt", "c"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected directories first %v, got %v", expected, got)
+	}
+}
+
+func TestInMemoryTreeBuilder_ReaddirRange(t *testing.T) {
+	treeData := []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"}
+	idx := index.NewInMemoryTreeBuilder(func(filename string) *fs.FileInfo {
+		return fs.ImmutableDir(filename, time.Now())
+	})
+	infos := make(fs.FileInfoList, len(treeData))
+	for i, p := range treeData {
+		infos[i] = fs.ImmutableInfo(p, time.Now(), os.ModePerm, 100, nil)
+	}
+	if err := idx.Index(infos); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for offset := 0; ; offset += 2 {
+		page, err := idx.ReaddirRange("", offset, 2)
+		if err != nil {
+			t.Fatalf("unexpected error listing dir /: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		if len(page) > 2 {
+			t.Fatalf("expected at most 2 entries, got %d", len(page))
+		}
+		for _, c := range page {
+			got = append(got, c.Name())
+		}
+	}
+	if !slices.Equal(got, treeData) {
+		t.Errorf("expected %v, got %v", treeData, got)
+	}
+
+	rest, err := idx.ReaddirRange("", 3, 0)
+	if err != nil {
+		t.Fatalf("unexpected error listing dir /: %v", err)
+	}
+	if len(rest) != 2 {
+		t.Errorf("expected 2 remaining entries, got %d", len(rest))
+	}
+	if _, err := idx.ReaddirRange("missing", 0, 2); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
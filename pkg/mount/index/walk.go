@@ -0,0 +1,113 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+)
+
+// SkipDir and SkipAll may be returned by a WalkFunc, as with filepath.WalkDir
+var (
+	SkipDir = iofs.SkipDir
+	SkipAll = iofs.SkipAll
+)
+
+// WalkFunc is called by Walk for every entry visited, with the entry's full path within the tree.
+// Returning SkipDir from a directory skips its contents; returning it from a file skips the rest of its directory.
+// Returning SkipAll stops the walk. Any other error stops the walk, and is returned by Walk.
+type WalkFunc func(path string, fi os.FileInfo) error
+
+type walkConfig struct {
+	include []string
+	exclude []string
+}
+
+type WalkOpt func(c *walkConfig)
+
+// WithInclude only visits files whose full path matches one of patterns (path.Match syntax).
+// Directories are always visited, so that matching files inside them are found.
+func WithInclude(patterns ...string) WalkOpt {
+	return func(c *walkConfig) {
+		c.include = append(c.include, patterns...)
+	}
+}
+
+// WithExclude doesn't visit entries whose full path matches one of patterns (path.Match syntax).
+// An excluded directory is skipped along with its contents.
+func WithExclude(patterns ...string) WalkOpt {
+	return func(c *walkConfig) {
+		c.exclude = append(c.exclude, patterns...)
+	}
+}
+
+func (c *walkConfig) visit(fullPath string, isDir bool) bool {
+	if matchesAny(fullPath, c.exclude) {
+		return false
+	}
+	return isDir || len(c.include) == 0 || matchesAny(fullPath, c.include)
+}
+
+func matchesAny(fullPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, fullPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk calls fn for root and every entry below it, in lexical order within each directory
+// (or the order Readdir uses).
+func (t *InMemoryTreeBuilder) Walk(root string, fn WalkFunc, opts ...WalkOpt) error {
+	cfg := &walkConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	for _, pattern := range append(cfg.include, cfg.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	root = t.normalize(strings.Trim(root, fs.Delimiter))
+	info, err := t.Stat(root)
+	if err != nil {
+		return err
+	}
+	err = t.walk(root, info, fn, cfg)
+	if errors.Is(err, SkipDir) || errors.Is(err, SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func (t *InMemoryTreeBuilder) walk(fullPath string, info os.FileInfo, fn WalkFunc, cfg *walkConfig) error {
+	if err := fn(fullPath, info); err != nil || !info.IsDir() {
+		return err
+	}
+	entries, err := t.Readdir(fullPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		childPath := path.Join(fullPath, entry.Name())
+		if !cfg.visit(childPath, entry.IsDir()) {
+			continue
+		}
+		err := t.walk(childPath, entry, fn, cfg)
+		if errors.Is(err, SkipDir) {
+			if entry.IsDir() {
+				continue
+			}
+			return nil // skip the rest of this directory
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
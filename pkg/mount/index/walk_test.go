@@ -0,0 +1,127 @@
+package index_test
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+)
+
+func walkTree(t *testing.T) *index.InMemoryTreeBuilder {
+	treeData := []string{
+		"a/b/c.txt",
+		"a/b/d.csv",
+		"a/e.txt",
+		"f/g.csv",
+		"h.txt",
+	}
+	idx := index.NewInMemoryTreeBuilder(func(filename string) *fs.FileInfo {
+		return fs.ImmutableDir(filename, time.Now())
+	})
+	infos := make(fs.FileInfoList, len(treeData))
+	for i, p := range treeData {
+		infos[i] = fs.ImmutableInfo(p, time.Now(), os.ModePerm, 100, nil)
+	}
+	sort.Sort(infos)
+	if err := idx.Index(infos); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return idx
+}
+
+func TestInMemoryTreeBuilder_Walk(t *testing.T) {
+	idx := walkTree(t)
+	errStop := errors.New("stop")
+	cases := []struct {
+		name     string
+		root     string
+		fn       func(p string, fi os.FileInfo) error
+		opts     []index.WalkOpt
+		expected []string
+		err      error
+	}{
+		{
+			name:     "all",
+			expected: []string{"", "a", "a/b", "a/b/c.txt", "a/b/d.csv", "a/e.txt", "f", "f/g.csv", "h.txt"},
+		},
+		{
+			name:     "subtree",
+			root:     "a/b",
+			expected: []string{"a/b", "a/b/c.txt", "a/b/d.csv"},
+		},
+		{
+			name: "skip directory",
+			fn: func(p string, fi os.FileInfo) error {
+				if p == "a/b" {
+					return index.SkipDir
+				}
+				return nil
+			},
+			expected: []string{"", "a", "a/b", "a/e.txt", "f", "f/g.csv", "h.txt"},
+		},
+		{
+			name: "skip rest of directory",
+			fn: func(p string, fi os.FileInfo) error {
+				if p == "a/b/c.txt" {
+					return index.SkipDir
+				}
+				return nil
+			},
+			expected: []string{"", "a", "a/b", "a/b/c.txt", "a/e.txt", "f", "f/g.csv", "h.txt"},
+		},
+		{
+			name: "skip all",
+			fn: func(p string, fi os.FileInfo) error {
+				if p == "f" {
+					return index.SkipAll
+				}
+				return nil
+			},
+			expected: []string{"", "a", "a/b", "a/b/c.txt", "a/b/d.csv", "a/e.txt", "f"},
+		},
+		{
+			name:     "include",
+			opts:     []index.WalkOpt{index.WithInclude("*/*.csv", "*/*/*.csv")},
+			expected: []string{"", "a", "a/b", "a/b/d.csv", "f", "f/g.csv"},
+		},
+		{
+			name:     "exclude",
+			opts:     []index.WalkOpt{index.WithExclude("a/b", "*.txt")},
+			expected: []string{"", "a", "a/e.txt", "f", "f/g.csv"},
+		},
+		{
+			name: "error",
+			fn: func(p string, fi os.FileInfo) error {
+				if p == "a/e.txt" {
+					return errStop
+				}
+				return nil
+			},
+			expected: []string{"", "a", "a/b", "a/b/c.txt", "a/b/d.csv", "a/e.txt"},
+			err:      errStop,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var visited []string
+			err := idx.Walk(c.root, func(p string, fi os.FileInfo) error {
+				visited = append(visited, p)
+				if c.fn != nil {
+					return c.fn(p, fi)
+				}
+				return nil
+			}, c.opts...)
+			if !errors.Is(err, c.err) {
+				t.Errorf("expected error %v, got %v", c.err, err)
+			}
+			if !slices.Equal(visited, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, visited)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package mount
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
@@ -21,10 +23,21 @@ const (
 var (
 	ErrCommandError = errors.New("mount command failed")
 	ErrNotOurMount  = errors.New("this mount is not managed by cz")
+
+	ErrNFSClientMissing = errors.New("NFS client not installed")
 )
 
 func execMountCommand(name string, args ...string) error {
+	return execMountCommandWithInput(nil, name, args...)
+}
+
+// execMountCommandWithInput runs a mount command reading input from its stdin,
+// for credentials that shouldn't show up in the process list
+func execMountCommandWithInput(input []byte, name string, args ...string) error {
 	cmd := exec.Command(name, args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		cmdText := fmt.Sprintf("%s %s", name, strings.Join(args, " "))
@@ -60,38 +73,94 @@ func killPid(pid int) error {
 }
 
 func tryThenSudo(cmd string, args ...string) error {
+	return tryThenSudoWithInput(nil, cmd, args...)
+}
+
+func tryThenSudoWithInput(input []byte, cmd string, args ...string) error {
 	var originalErr error
-	originalErr = execMountCommand(cmd, args...)
+	originalErr = execMountCommandWithInput(input, cmd, args...)
 	if originalErr == nil {
 		return nil
 	}
 	sudoArgs := append([]string{cmd}, args...)
-	err := execMountCommand("sudo", sudoArgs...)
+	err := execMountCommandWithInput(input, "sudo", sudoArgs...)
 	if err != nil {
 		return originalErr
 	}
 	return nil // sudo was successful!
 }
 
-func NFSMount(addr string, location string) error {
+// linuxNFSMountHelpers are the places mount(8) looks for the NFS mount helper, which may not be in PATH
+var linuxNFSMountHelpers = []string{"/sbin/mount.nfs", "/usr/sbin/mount.nfs"}
+
+func linuxNFSClientInstalled() bool {
+	if _, err := exec.LookPath("mount.nfs"); err == nil {
+		return true
+	}
+	for _, helper := range linuxNFSMountHelpers {
+		if _, err := os.Stat(helper); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// nfsMountCommand returns the command used to mount the NFS server at addr on location.
+// The server's port is passed as both the NFS and mount protocol port, so no portmapper (rpcbind) is needed.
+func nfsMountCommand(addr string, location string) ([]string, error) {
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
-		return fmt.Errorf("%w: could not parse address: %s", ErrCommandError, addr)
+		return nil, fmt.Errorf("%w: could not parse address: %s", ErrCommandError, addr)
 	}
 	switch runtime.GOOS {
 	case GOOSMacOS:
 		opts := fmt.Sprintf("nolocks,vers=3,tcp,rsize=1048576,actimeo=120,port=%s,mountport=%s",
 			port, port)
-		return tryThenSudo("mount_nfs", "-o", opts, fmt.Sprintf("%s:/", host), location)
+		return []string{"mount_nfs", "-o", opts, fmt.Sprintf("%s:/", host), location}, nil
 	case GOOSLinux:
 		opts := fmt.Sprintf(
 			"user,noacl,nolock,tcp,vers=3,nconnect=8,rsize=1048576,port=%s,mountport=%s",
 			port, port)
-		return tryThenSudo("mount", "-t", "nfs", "-o", opts, fmt.Sprintf("%s:/", host), location)
+		return []string{"mount", "-t", "nfs", "-o", opts, fmt.Sprintf("%s:/", host), location}, nil
 	case GOOSWindows:
 		// TODO(ozkatz)
 	}
-	return fmt.Errorf("%w: don't know how to mount on OS: %s", ErrCommandError, runtime.GOOS)
+	return nil, fmt.Errorf("%w: don't know how to mount on OS: %s", ErrCommandError, runtime.GOOS)
+}
+
+// NFSMountCommand returns the command line NFSMount runs, so users can mount the server manually
+func NFSMountCommand(addr string, location string) (string, error) {
+	args, err := nfsMountCommand(addr, location)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(args, " "), nil
+}
+
+func NFSMount(addr string, location string) error {
+	args, err := nfsMountCommand(addr, location)
+	if err != nil {
+		return err
+	}
+	if err := CheckNFSClient(); err != nil {
+		return err
+	}
+	return tryThenSudo(args[0], args[1:]...)
+}
+
+// CheckNFSClient returns ErrNFSClientMissing if NFS servers can't be mounted on this host
+func CheckNFSClient() error {
+	switch runtime.GOOS {
+	case GOOSMacOS:
+		return nil
+	case GOOSLinux:
+		if !linuxNFSClientInstalled() {
+			return fmt.Errorf("%w: mount.nfs not found, it's usually part of the nfs-common or nfs-utils package",
+				ErrNFSClientMissing)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: cz doesn't mount NFS on %s", ErrNFSClientMissing, runtime.GOOS)
 }
 
 func Umount(location string) error {
@@ -116,16 +185,55 @@ func Umount(location string) error {
 	return fmt.Errorf("%w: don't know how to unmount on OS: %s", ErrCommandError, runtime.GOOS)
 }
 
-func WebDavMount(addr string, location string) error {
+type webDavMountOptions struct {
+	user     string
+	password string
+}
+
+// WebDavMountOpt configures how WebDAV servers are mounted
+type WebDavMountOpt func(o *webDavMountOptions)
+
+// WithWebDavCredentials mounts with HTTP Basic credentials, for servers that require authentication
+func WithWebDavCredentials(user, password string) WebDavMountOpt {
+	return func(o *webDavMountOptions) {
+		o.user = user
+		o.password = password
+	}
+}
+
+// mountWebDavCredentials encodes credentials the way mount_webdav -a reads them from a file descriptor:
+// the length of the user name as a native int, the user name, then the same for the password
+func mountWebDavCredentials(user, password string) []byte {
+	var buf bytes.Buffer
+	for _, s := range []string{user, password} {
+		_ = binary.Write(&buf, binary.NativeEndian, int32(len(s)))
+		buf.WriteString(s)
+	}
+	return buf.Bytes()
+}
+
+func WebDavMount(addr string, location string, useTLS bool, opts ...WebDavMountOpt) error {
+	o := &webDavMountOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		return fmt.Errorf("%w: could not parse address: %s", ErrCommandError, addr)
 	}
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
 	switch runtime.GOOS {
 	case GOOSMacOS:
-		return tryThenSudo("mount_webdav", "-S",
-			fmt.Sprintf("http://%s:%s/mount/", host, port),
-			location)
+		url := fmt.Sprintf("%s://%s:%s/mount/", scheme, host, port)
+		if o.user != "" || o.password != "" {
+			// read from stdin, which is passed on by sudo
+			return tryThenSudoWithInput(mountWebDavCredentials(o.user, o.password),
+				"mount_webdav", "-S", "-a", "0", url, location)
+		}
+		return tryThenSudo("mount_webdav", "-S", url, location)
 	case GOOSWindows:
 		// check if existing directory
 		// try to remove if empty
@@ -143,6 +251,17 @@ func WebDavMount(addr string, location string) error {
 
 		// create link to url
 		mountUrl := fmt.Sprintf("\\\\%s@%s\\mount", host, port)
+		if useTLS {
+			mountUrl = fmt.Sprintf("\\\\%s@SSL@%s\\mount", host, port)
+		}
+		if o.user != "" || o.password != "" {
+			// connect with the credentials first, the link then reuses the connection.
+			// Not run with execMountCommand, which would include the password in its error
+			cmd := exec.Command("net.exe", "use", mountUrl, o.password, "/user:"+o.user, "/persistent:no")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("%w: \"net.exe use %s /user:%s\":\n%s\n%s", ErrCommandError, mountUrl, o.user, out, err)
+			}
+		}
 		return execMountCommand("cmd.exe", "/c", "mklink", "/d", location, mountUrl)
 	}
 	return fmt.Errorf("%w: don't know how to mount on OS: %s", ErrCommandError, runtime.GOOS)
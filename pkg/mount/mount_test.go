@@ -0,0 +1,55 @@
+package mount_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+)
+
+func TestNFSMountCommand(t *testing.T) {
+	if runtime.GOOS != mount.GOOSLinux && runtime.GOOS != mount.GOOSMacOS {
+		t.Skipf("NFS isn't mounted on %s", runtime.GOOS)
+	}
+	command, err := mount.NFSMountCommand("127.0.0.1:2049", "/mnt/archive")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// both ports are given, so that no portmapper is needed
+	for _, expected := range []string{"vers=3", "port=2049,mountport=2049", " 127.0.0.1:/ /mnt/archive"} {
+		if !strings.Contains(command, expected) {
+			t.Errorf("expected %q in %q", expected, command)
+		}
+	}
+
+	if _, err := mount.NFSMountCommand("127.0.0.1", "/mnt/archive"); !errors.Is(err, mount.ErrCommandError) {
+		t.Errorf("expected ErrCommandError for an address without a port, got %v", err)
+	}
+}
+
+func TestCheckNFSClient(t *testing.T) {
+	if runtime.GOOS != mount.GOOSLinux {
+		t.Skip("mount.nfs is only looked up on Linux")
+	}
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	if err := mount.CheckNFSClient(); !errors.Is(err, mount.ErrNFSClientMissing) {
+		for _, helper := range []string{"/sbin/mount.nfs", "/usr/sbin/mount.nfs"} {
+			if _, statErr := os.Stat(helper); statErr == nil {
+				t.Skipf("%s is installed on this host", helper)
+			}
+		}
+		t.Fatalf("expected ErrNFSClientMissing without mount.nfs, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(bin, "mount.nfs"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mount.CheckNFSClient(); err != nil {
+		t.Errorf("expected mount.nfs to be found in PATH, got %v", err)
+	}
+}
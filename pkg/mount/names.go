@@ -0,0 +1,67 @@
+package mount
+
+import (
+	"strings"
+	"unicode"
+)
+
+// controlCharReplacement replaces control characters in entry names, which can't be safely shown or typed by users
+const controlCharReplacement = '_'
+
+// sanitizeEntryName fixes up names written by misbehaving tools: backslashes written as path separators
+// (e.g. by some Windows archivers) are converted to slashes, and control characters are replaced.
+func sanitizeEntryName(name string, convertBackslashes bool) string {
+	if convertBackslashes {
+		name = strings.ReplaceAll(name, `\`, "/")
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return controlCharReplacement
+		}
+		return r
+	}, name)
+}
+
+// NameMapper rewrites the path of an entry as it appears in the tree, without changing the archive.
+// Returning an empty name leaves the entry out of the tree.
+type NameMapper func(name string) string
+
+// StripPrefix removes the directory prefix from entries under it (e.g. "project-1.0/"),
+// leaving other entries as is. The prefix directory itself is left out.
+func StripPrefix(prefix string) NameMapper {
+	prefix = strings.Trim(prefix, "/")
+	return func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		if strings.Trim(name, "/") == prefix {
+			return ""
+		}
+		if rest, ok := strings.CutPrefix(name, prefix+"/"); ok {
+			return rest
+		}
+		return name
+	}
+}
+
+// AddPrefix places all entries under the directory prefix
+func AddPrefix(prefix string) NameMapper {
+	prefix = strings.Trim(prefix, "/")
+	return func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "/" + strings.TrimLeft(name, "/")
+	}
+}
+
+// mapName applies mappers to name, in order
+func mapName(name string, mappers []NameMapper) string {
+	for _, m := range mappers {
+		if name == "" {
+			break
+		}
+		name = m(name)
+	}
+	return name
+}
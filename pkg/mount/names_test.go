@@ -0,0 +1,191 @@
+package mount_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBuildZipTree_MessyNames(t *testing.T) {
+	archive := writeTestZip(t, `windows\style\path.txt`, "bell\a.txt")
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	info, err := tree.Stat("windows/style/path.txt")
+	if err != nil {
+		t.Fatalf("expected backslashes to be converted to directories: %v", err)
+	}
+	file, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening entry: %v", err)
+	}
+	data, _ := io.ReadAll(file)
+	_ = file.Close()
+	if string(data) != `windows\style\path.txt` {
+		t.Errorf("unexpected content: %q", data)
+	}
+	if _, err := tree.Stat("bell_.txt"); err != nil {
+		t.Errorf("expected control characters to be replaced: %v", err)
+	}
+
+	tree, err = mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+		mount.WithKeepBackslashes(true))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	if _, err := tree.Stat(`windows\style\path.txt`); err != nil {
+		t.Errorf("expected backslashes to be kept: %v", err)
+	}
+}
+
+// writeTestZip writes an archive with the given entries (each containing its name), padded to the size the parser prefetches
+func writeTestZip(t *testing.T, names ...string) string {
+	t.Helper()
+	entries := make([]testEntry, 0, len(names))
+	for _, name := range names {
+		content := name
+		if strings.HasSuffix(name, "/") {
+			content = ""
+		}
+		entries = append(entries, testEntry{name: name, content: content})
+	}
+	return writeTestZipEntries(t, entries...)
+}
+
+// testEntry is an entry of an archive written by writeTestZipEntries
+type testEntry struct {
+	name    string
+	content string
+}
+
+// writeTestZipEntries writes an archive with the given entries, padded to the size the parser prefetches
+func writeTestZipEntries(t *testing.T, entries ...testEntry) string {
+	t.Helper()
+	archive := filepath.Join(t.TempDir(), "test.zip")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w := zip.NewWriter(out)
+	for _, e := range entries {
+		f, err := w.Create(e.name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, _ = f.Write([]byte(e.content))
+	}
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "padding.bin", Method: zip.Store})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = f.Write(make([]byte, 65536))
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = out.Close()
+	return archive
+}
+
+func TestBuildZipTree_NameMapper(t *testing.T) {
+	archive := writeTestZip(t, "project-1.0/", "project-1.0/src/a.go", "project-1.0/README", "other.txt")
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+		mount.WithNameMapper(mount.StripPrefix("project-1.0/"), mount.AddPrefix("v1")))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	for _, name := range []string{"v1/src/a.go", "v1/README", "v1/other.txt"} {
+		if _, err := tree.Stat(name); err != nil {
+			t.Errorf("expected %s in tree: %v", name, err)
+		}
+	}
+	info, err := tree.Stat("v1/src/a.go")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	file, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening entry: %v", err)
+	}
+	data, _ := io.ReadAll(file)
+	_ = file.Close()
+	if string(data) != "project-1.0/src/a.go" {
+		t.Errorf("expected the content of the original entry, got %q", data)
+	}
+	if _, err := tree.Stat("project-1.0"); err == nil {
+		t.Errorf("expected the stripped prefix directory to be left out")
+	}
+
+	archive = writeTestZip(t, "A.txt", "a.txt")
+	_, err = mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+		mount.WithNameMapper(strings.ToLower))
+	if !errors.Is(err, mount.ErrNameCollision) {
+		t.Errorf("expected ErrNameCollision, got %v", err)
+	}
+}
+
+func TestBuildZipTree_AmbiguousDirectories(t *testing.T) {
+	// the zip writer refuses to store content for names ending with "/", so rename the entry afterwards
+	archive := writeTestZip(t, "ambiguous~", "ambiguous/child.txt", "masked", "masked/")
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(archive, bytes.ReplaceAll(data, []byte("ambiguous~"), []byte("ambiguous/")), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	tree, err := mount.BuildZipTree(context.Background(), logger, t.TempDir(), "file://"+archive, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+
+	info, err := tree.Stat("ambiguous")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !info.IsDir() {
+		t.Errorf("expected an entry ending with '/' to be a directory, even with content")
+	}
+	if _, err := tree.Stat("ambiguous/child.txt"); err != nil {
+		t.Errorf("expected the directory's children to be listed: %v", err)
+	}
+
+	info, err = tree.Stat("masked")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.IsDir() {
+		t.Fatalf("expected the file not to be masked by a directory of the same name")
+	}
+	file, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening entry: %v", err)
+	}
+	content, _ := io.ReadAll(file)
+	_ = file.Close()
+	if string(content) != "masked" {
+		t.Errorf("unexpected content: %q", content)
+	}
+
+	for _, expected := range []string{
+		"directory with content, treating it as a directory",
+		"directory with the same name as a file, keeping the file",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("expected the decision to be logged: %q", expected)
+		}
+	}
+}
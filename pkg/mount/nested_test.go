@@ -0,0 +1,70 @@
+package mount_test
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestBuildZipTree_Nested(t *testing.T) {
+	inner, err := os.ReadFile(writeTestZip(t, "a.txt"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive := filepath.Join(t.TempDir(), "outer.zip")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w := zip.NewWriter(out)
+	for name, content := range map[string][]byte{"inner.zip": inner, "a.txt": []byte("a.txt")} {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, _ = f.Write(content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = out.Close()
+
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive+"!inner.zip", nil)
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	info, err := tree.Stat("a.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening entry: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	_ = f.Close()
+	if string(data) != "a.txt" {
+		t.Errorf("unexpected content of nested entry: %q", data)
+	}
+
+	raw, err := mount.BuildRawTree(context.Background(), remote.DummyLogger(), "file://"+archive+"!inner.zip", nil)
+	if err != nil {
+		t.Fatalf("unexpected error building raw tree: %v", err)
+	}
+	if info, err := raw.Stat("inner.zip"); err != nil || info.Size() != int64(len(inner)) {
+		t.Errorf("expected the nested archive as inner.zip, got: %v (err: %v)", info, err)
+	}
+
+	_, err = mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive+"!a.txt", nil)
+	if !errors.Is(err, zipfile.ErrNotZipArchive) {
+		t.Errorf("expected ErrNotZipArchive mounting a file that isn't an archive, got: %v", err)
+	}
+}
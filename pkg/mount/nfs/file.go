@@ -1,6 +1,8 @@
 package nfs
 
 import (
+	"os"
+
 	"github.com/go-git/go-billy/v5"
 	"github.com/willscott/go-nfs/file"
 
@@ -44,3 +46,56 @@ func (n *nfsFile) Truncate(size int64) error {
 func fileLikeToBilly(f fs.FileLike, filename string) billy.File {
 	return &nfsFile{f, filename}
 }
+
+// readOnceFile closes the underlying file after each ReadAt, reopening it when it's used again
+type readOnceFile struct {
+	nfsFile
+	info   *fs.FileInfo
+	closed bool
+}
+
+func (r *readOnceFile) reopen() error {
+	if !r.closed {
+		return nil
+	}
+	f, err := r.info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	r.FileLike, r.closed = f, false
+	return nil
+}
+
+func (r *readOnceFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := r.reopen(); err != nil {
+		return 0, err
+	}
+	n, err := r.FileLike.ReadAt(p, off)
+	r.closed = true
+	if closeErr := r.FileLike.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+func (r *readOnceFile) Read(p []byte) (int, error) {
+	if err := r.reopen(); err != nil {
+		return 0, err
+	}
+	return r.FileLike.Read(p)
+}
+
+func (r *readOnceFile) Seek(offset int64, whence int) (int64, error) {
+	if err := r.reopen(); err != nil {
+		return 0, err
+	}
+	return r.FileLike.Seek(offset, whence)
+}
+
+func (r *readOnceFile) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.FileLike.Close()
+}
@@ -21,8 +21,21 @@ func (fs *ZipFS) Create(filename string) (billy.File, error) {
 	return nil, billy.ErrReadOnly
 }
 
+// Open opens filename for a single read: the NFS server never closes files opened for reading,
+// so the handle is closed after ReadAt and reopened if used again
 func (fs *ZipFS) Open(filename string) (billy.File, error) {
-	return fs.OpenFile(filename, os.O_RDONLY, 0)
+	s, err := fs.Tree.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if s.IsDir() {
+		return nil, billy.ErrNotSupported
+	}
+	f, err := s.Open(os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnceFile{nfsFile: nfsFile{f, filename}, info: s}, nil
 }
 
 func (fs *ZipFS) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
@@ -65,6 +78,8 @@ func (fs *ZipFS) TempFile(dir, prefix string) (billy.File, error) {
 	return nil, billy.ErrReadOnly
 }
 
+// ReadDir returns the full listing: go-nfs caches it per cookie verifier
+// and pages through it across READDIR calls, so responses stay bounded by the client's count.
 func (fs *ZipFS) ReadDir(name string) ([]os.FileInfo, error) {
 	dir, err := fs.Tree.Readdir(name)
 	if err != nil {
@@ -0,0 +1,179 @@
+package nfs_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	nfsc "github.com/willscott/go-nfs-client/nfs"
+	"github.com/willscott/go-nfs-client/nfs/rpc"
+	"github.com/willscott/go-nfs-client/nfs/xdr"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/mount/nfs"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+const (
+	nfsProc3ReadDir     = 16
+	nfsProc3ReadDirPlus = 17
+)
+
+// dirEntry is an entry of a READDIR or READDIRPLUS response
+type dirEntry struct {
+	FileID uint64
+	Name   string
+	// Attr is only returned by READDIRPLUS
+	Attr nfsc.PostOpAttr
+}
+
+// readDir lists the directory with the given handle, returning the first response's entries
+func readDir(t *testing.T, client *rpc.Client, fh []byte, plus bool) []dirEntry {
+	header := rpc.Header{Rpcvers: 2, Prog: nfsc.Nfs3Prog, Vers: nfsc.Nfs3Vers, Proc: nfsProc3ReadDir, Cred: rpc.AuthNull, Verf: rpc.AuthNull}
+	var call any = &struct {
+		rpc.Header
+		FH         []byte
+		Cookie     uint64
+		CookieVerf uint64
+		Count      uint32
+	}{header, fh, 0, 0, 4096}
+	if plus {
+		header.Proc = nfsProc3ReadDirPlus
+		call = &struct {
+			rpc.Header
+			FH         []byte
+			Cookie     uint64
+			CookieVerf uint64
+			DirCount   uint32
+			MaxCount   uint32
+		}{header, fh, 0, 0, 512, 4096}
+	}
+	res, err := client.Call(call)
+	if err != nil {
+		t.Fatalf("unexpected error listing directory: %v", err)
+	}
+	var ok struct {
+		Status     uint32
+		DirAttrs   nfsc.PostOpAttr
+		CookieVerf uint64
+	}
+	if err := xdr.Read(res, &ok); err != nil || ok.Status != 0 {
+		t.Fatalf("unexpected response listing directory: status %d (err: %v)", ok.Status, err)
+	}
+	var entries []dirEntry
+	for {
+		var follows bool
+		if err := xdr.Read(res, &follows); err != nil {
+			t.Fatalf("unexpected error reading entry: %v", err)
+		}
+		if !follows {
+			return entries
+		}
+		var entry dirEntry
+		if plus {
+			var e nfsc.EntryPlus
+			if err := xdr.Read(res, &e); err != nil {
+				t.Fatalf("unexpected error reading entry: %v", err)
+			}
+			entry = dirEntry{FileID: e.FileId, Name: e.FileName, Attr: e.Attr}
+		} else {
+			var e struct {
+				FileID uint64
+				Name   string
+				Cookie uint64
+			}
+			if err := xdr.Read(res, &e); err != nil {
+				t.Fatalf("unexpected error reading entry: %v", err)
+			}
+			entry = dirEntry{FileID: e.FileID, Name: e.Name}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestReadDir_DotEntries(t *testing.T) {
+	tree, err := mount.IndexRecords([]*zipfile.CDR{
+		{FileName: "a", Mode: os.ModeDir | 0755},
+		{FileName: "a/b", Mode: os.ModeDir | 0755},
+		{FileName: "a/b/c.txt", UncompressedSizeBytes: 3},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error indexing records: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = nfs.Serve(ctx, listener, nfs.NewHandler(ctx, tree, nil))
+	}()
+	client, err := rpc.DialTCP("tcp", listener.Addr().String(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.Close()
+	mounter := &nfsc.Mount{Client: client}
+	target, err := mounter.Mount("/", rpc.AuthNull)
+	if err != nil {
+		t.Fatalf("unexpected error mounting: %v", err)
+	}
+
+	fileID := func(p string) uint64 {
+		attr, err := target.Getattr(p)
+		if err != nil {
+			t.Fatalf("unexpected error getting attributes of %s: %v", p, err)
+		}
+		return attr.Fileid
+	}
+	handle := func(p string) []byte {
+		_, fh, err := target.Lookup(p)
+		if err != nil {
+			t.Fatalf("unexpected error looking up %s: %v", p, err)
+		}
+		return fh
+	}
+	cases := []struct {
+		Name   string
+		Dir    string
+		Parent string
+	}{
+		{"root", "/", "/"},
+		{"top_level", "/a", "/"},
+		{"nested", "/a/b", "/a"},
+	}
+	for _, c := range cases {
+		for _, plus := range []bool{false, true} {
+			name := c.Name
+			if plus {
+				name += "_plus"
+			}
+			t.Run(name, func(t *testing.T) {
+				entries := readDir(t, client, handle(c.Dir), plus)
+				if len(entries) < 3 || entries[0].Name != "." || entries[1].Name != ".." {
+					t.Fatalf("expected . and .. to come first, got: %+v", entries)
+				}
+				if dot := entries[0].FileID; dot != fileID(c.Dir) {
+					t.Errorf(". has file id %d, expected %d", dot, fileID(c.Dir))
+				}
+				if dotdot := entries[1].FileID; dotdot != fileID(c.Parent) {
+					t.Errorf(".. has file id %d, expected %d", dotdot, fileID(c.Parent))
+				}
+				if !plus {
+					return
+				}
+				// attributes are optional in READDIRPLUS, the server only returns those of .
+				for i, e := range entries[:2] {
+					if !e.Attr.IsSet && i > 0 {
+						continue
+					}
+					if !e.Attr.IsSet || e.Attr.Attr.Type != nfsc.NF3Dir || e.Attr.Attr.Fileid != e.FileID {
+						t.Errorf("expected %s to have the attributes of a directory with file id %d, got: %+v", e.Name, e.FileID, e.Attr)
+					}
+				}
+			})
+		}
+	}
+}
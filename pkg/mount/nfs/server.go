@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net"
 
+	"github.com/go-git/go-billy/v5"
 	"github.com/willscott/go-nfs"
 	nfshelper "github.com/willscott/go-nfs/helpers"
 
@@ -39,5 +40,21 @@ func NewHandler(ctx context.Context, tree index.Tree, opts *Options) nfs.Handler
 		zipFs = LoggingFS(ctx, zipFs, opts.Logger)
 	}
 	fsHandler := nfshelper.NewNullAuthHandler(zipFs)
-	return nfshelper.NewCachingHandler(fsHandler, opts.HandleCacheSize)
+	return &rootParentHandler{nfshelper.NewCachingHandler(fsHandler, opts.HandleCacheSize)}
+}
+
+// rootParentHandler makes the root directory its own parent, as POSIX has it.
+// The server resolves ".." (in READDIR listings and LOOKUP) by dropping the last element of a directory's path,
+// and has no parent for the root's empty path: listing it with a ".." whose file id is 0, and refusing to look it up.
+// The root is given the path [""] instead, which names the same directory and has the empty path as its parent.
+type rootParentHandler struct {
+	nfs.Handler
+}
+
+func (h *rootParentHandler) FromHandle(fh []byte) (billy.Filesystem, []string, error) {
+	fs, p, err := h.Handler.FromHandle(fh)
+	if err == nil && len(p) == 0 {
+		p = []string{""}
+	}
+	return fs, p, err
 }
@@ -0,0 +1,51 @@
+package mount
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization is the Unicode normalization form applied to entry names and to names looked up in the tree.
+// macOS compares file names in their decomposed form (NFD), while most archives store them precomposed (NFC),
+// so lookups from macOS clients miss accented names unless both sides agree on a form.
+type Normalization string
+
+const (
+	// NormalizeNone keeps names exactly as they are stored in the archive
+	NormalizeNone Normalization = "none"
+	// NormalizeNFC composes characters, e.g. "e" followed by a combining acute accent becomes "é"
+	NormalizeNFC Normalization = "nfc"
+	// NormalizeNFD decomposes characters, e.g. "é" becomes "e" followed by a combining acute accent
+	NormalizeNFD Normalization = "nfd"
+)
+
+var ErrUnknownNormalization = errors.New("unknown normalization")
+
+func ParseNormalization(s string) (Normalization, error) {
+	switch n := Normalization(strings.ToLower(strings.TrimSpace(s))); n {
+	case NormalizeNone, NormalizeNFC, NormalizeNFD:
+		return n, nil
+	case "":
+		return NormalizeNone, nil
+	}
+	return "", fmt.Errorf("%w: '%s', expected one of: %s, %s, %s",
+		ErrUnknownNormalization, s, NormalizeNone, NormalizeNFC, NormalizeNFD)
+}
+
+func (n Normalization) enabled() bool {
+	return n != "" && n != NormalizeNone
+}
+
+// Normalize returns name in the normalization form n
+func (n Normalization) Normalize(name string) string {
+	switch n {
+	case NormalizeNFC:
+		return norm.NFC.String(name)
+	case NormalizeNFD:
+		return norm.NFD.String(name)
+	}
+	return name
+}
@@ -0,0 +1,90 @@
+package mount_test
+
+import (
+	"context"
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+const (
+	precomposed = "caf\u00e9/r\u00e9sum\u00e9.txt"
+	decomposed  = "cafe\u0301/re\u0301sume\u0301.txt"
+)
+
+func TestNormalization_Normalize(t *testing.T) {
+	cases := []struct {
+		n        mount.Normalization
+		in       string
+		expected string
+	}{
+		{mount.NormalizeNone, decomposed, decomposed},
+		{mount.NormalizeNFC, decomposed, precomposed},
+		{mount.NormalizeNFC, precomposed, precomposed},
+		{mount.NormalizeNFD, precomposed, decomposed},
+		{mount.NormalizeNFD, decomposed, decomposed},
+		// combining marks are put in canonical order: dot below (220) before circumflex (230)
+		{mount.NormalizeNFC, "e\u0302\u0323", "\u1ec7"},
+		{mount.NormalizeNFD, "\u1ec7", "e\u0323\u0302"},
+		// Hangul syllables are (de)composed algorithmically
+		{mount.NormalizeNFD, "\ud55c", "\u1112\u1161\u11ab"},
+		{mount.NormalizeNFC, "\u1112\u1161\u11ab", "\ud55c"},
+		{mount.NormalizeNFC, "plain/ascii.txt", "plain/ascii.txt"},
+	}
+	for _, c := range cases {
+		if got := c.n.Normalize(c.in); got != c.expected {
+			t.Errorf("%s(%+q): expected %+q, got %+q", c.n, c.in, c.expected, got)
+		}
+	}
+	if _, err := mount.ParseNormalization("nfkc"); !errors.Is(err, mount.ErrUnknownNormalization) {
+		t.Errorf("expected ErrUnknownNormalization, got: %v", err)
+	}
+}
+
+func TestBuildZipTree_Normalization(t *testing.T) {
+	archive := writeTestZip(t, precomposed)
+	for _, c := range []struct {
+		n      mount.Normalization
+		stored string
+	}{
+		{mount.NormalizeNFD, decomposed},
+		{mount.NormalizeNFC, precomposed},
+	} {
+		tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+			mount.WithNormalization(c.n))
+		if err != nil {
+			t.Fatalf("unexpected error building tree: %v", err)
+		}
+		// lookups match whichever form the client uses
+		for _, name := range []string{precomposed, decomposed} {
+			if _, err := tree.Stat(name); err != nil {
+				t.Errorf("%s: expected %+q to be found, got: %v", c.n, name, err)
+			}
+		}
+		entries, err := tree.Readdir("caf\u00e9")
+		if err != nil {
+			t.Fatalf("%s: unexpected error listing directory: %v", c.n, err)
+		}
+		if len(entries) != 1 || entries[0].Name() != path.Base(c.stored) {
+			t.Errorf("%s: expected a single entry stored as %+q, got: %v", c.n, c.stored, entries)
+		}
+	}
+
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	if _, err := tree.Stat(decomposed); err == nil {
+		t.Errorf("expected names to be matched exactly without normalization")
+	}
+
+	both := writeTestZip(t, precomposed, decomposed)
+	_, err = mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+both, nil,
+		mount.WithNormalization(mount.NormalizeNFC))
+	if !errors.Is(err, mount.ErrNameCollision) {
+		t.Errorf("expected ErrNameCollision for names that only differ in normalization, got: %v", err)
+	}
+}
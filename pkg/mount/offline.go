@@ -0,0 +1,70 @@
+package mount
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// ErrOffline is returned reading entries that aren't cached, from archives mounted offline that can't be read at all
+var ErrOffline = errors.New("archive is offline")
+
+// indexCacheKey is the key the central directory of the archive at uri is cached under, for offline use.
+// The separator keeps it apart from entry keys, which start with the URI.
+func indexCacheKey(uri string) string {
+	return asKey("index\x00", uri)
+}
+
+// cacheIndex keeps records, read from the archive at uri, in the cache
+func cacheIndex(cache *fs.FileCache, uri string, records []*zipfile.CDR) error {
+	buf := &bytes.Buffer{}
+	if err := zipfile.ExportIndex(buf, records); err != nil {
+		return err
+	}
+	f, err := cache.Set(indexCacheKey(uri), io.NopCloser(buf), int64(buf.Len()))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readCachedIndex returns the resolved URI and the cached records of the archive at uri, which couldn't be read
+// because of readErr. readErr is returned if there are no usable cached records.
+func (c *buildConfig) readCachedIndex(logger *slog.Logger, cache *fs.FileCache, uri string, readErr error) (string, []*zipfile.CDR, error) {
+	outerURI, nestedPath, err := c.resolveArchiveURI(uri)
+	if err != nil {
+		return "", nil, readErr
+	}
+	resolvedURI := strings.Join(append([]string{outerURI}, nestedPath...), zipfile.NestedSeparator)
+	f, err := cache.Get(indexCacheKey(resolvedURI))
+	if err != nil {
+		logger.Warn("could not read the archive, and its central directory isn't cached", "uri", resolvedURI, "error", readErr)
+		return "", nil, readErr
+	}
+	defer func() { _ = f.Close() }()
+	records, err := zipfile.LoadIndex(f)
+	if err != nil {
+		logger.Warn("could not read the archive, nor its cached central directory", "uri", resolvedURI,
+			"error", readErr, "cache_error", err)
+		return "", nil, readErr
+	}
+	logger.Warn("could not read the archive, mounting it OFFLINE from the cache: entries that aren't cached can't be read",
+		"uri", resolvedURI, "error", readErr, "records", len(records))
+	return resolvedURI, records, nil
+}
+
+// resolveArchiveURI returns the resolved URI of the outermost archive of uri, and the path of the archives nested in it
+func (c *buildConfig) resolveArchiveURI(uri string) (string, []string, error) {
+	outerURI, nestedPath, err := zipfile.SplitNestedURI(uri)
+	if err != nil {
+		return "", nil, err
+	}
+	outerURI, err = remote.ResolveURI(outerURI, c.uriResolvers...)
+	return outerURI, nestedPath, err
+}
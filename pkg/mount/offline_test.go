@@ -0,0 +1,59 @@
+package mount_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBuildZipTree_AllowStaleCache(t *testing.T) {
+	archive := writeTestZip(t, "cached.txt", "uncached.txt")
+	cacheDir := t.TempDir()
+	build := func(opts ...mount.BuildOpt) (index.Tree, error) {
+		return mount.BuildZipTree(context.Background(), remote.DummyLogger(), cacheDir, "file://"+archive, nil, opts...)
+	}
+	read := func(tree index.Tree, name string) (string, error) {
+		info, err := tree.Stat(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f, err := info.Open(os.O_RDONLY, 0)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = f.Close() }()
+		data, err := io.ReadAll(f)
+		return string(data), err
+	}
+
+	tree, err := build(mount.WithAllowStaleCache(true))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	if content, err := read(tree, "cached.txt"); err != nil || content != "cached.txt" {
+		t.Fatalf("unexpected content %q (err: %v)", content, err)
+	}
+
+	// the backend is gone
+	if err := os.Remove(archive); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := build(); err == nil {
+		t.Fatalf("expected an error building the tree of a missing archive without --allow-stale-cache")
+	}
+	tree, err = build(mount.WithAllowStaleCache(true))
+	if err != nil {
+		t.Fatalf("unexpected error building the tree offline: %v", err)
+	}
+	if content, err := read(tree, "cached.txt"); err != nil || content != "cached.txt" {
+		t.Errorf("expected the cached entry to be served offline, got %q (err: %v)", content, err)
+	}
+	if _, err := read(tree, "uncached.txt"); err == nil {
+		t.Errorf("expected an error reading an entry that isn't cached offline")
+	}
+}
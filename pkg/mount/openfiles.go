@@ -0,0 +1,99 @@
+package mount
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+)
+
+// openFilesWarnInterval is how often waiting for the open files limit is logged, at most
+const openFilesWarnInterval = time.Minute
+
+// openFiles counts the entry files open at once through the tree, and bounds them if it has a limit.
+// Opens beyond the limit wait for another file to be closed, rather than failing.
+type openFiles struct {
+	// slots is nil if there is no limit
+	slots    chan struct{}
+	open     atomic.Int64
+	waits    atomic.Int64
+	lastWarn atomic.Int64 // unix nanoseconds
+	logger   *slog.Logger
+}
+
+func newOpenFiles(limit int, logger *slog.Logger) *openFiles {
+	o := &openFiles{logger: logger}
+	if limit > 0 {
+		o.slots = make(chan struct{}, limit)
+	}
+	return o
+}
+
+// Open returns the number of entry files currently open
+func (o *openFiles) Open() int64 {
+	return o.open.Load()
+}
+
+// Waits returns the number of opens that had to wait for the limit
+func (o *openFiles) Waits() int64 {
+	return o.waits.Load()
+}
+
+func (o *openFiles) acquire(name string) {
+	if o.slots != nil {
+		select {
+		case o.slots <- struct{}{}:
+		default:
+			o.waits.Add(1)
+			o.warn(name)
+			o.slots <- struct{}{}
+		}
+	}
+	o.open.Add(1)
+}
+
+func (o *openFiles) release() {
+	o.open.Add(-1)
+	if o.slots != nil {
+		<-o.slots
+	}
+}
+
+func (o *openFiles) warn(name string) {
+	now := time.Now().UnixNano()
+	last := o.lastWarn.Load()
+	if now-last < int64(openFilesWarnInterval) || !o.lastWarn.CompareAndSwap(last, now) {
+		o.logger.Debug("open files limit reached, waiting", "filename", name, "limit", cap(o.slots))
+		return
+	}
+	o.logger.Warn("open files limit reached, opens are waiting for files to be closed",
+		"filename", name, "limit", cap(o.slots), "waits", o.waits.Load())
+}
+
+// wrap returns an opener whose files count towards the open files until they are closed
+func (o *openFiles) wrap(name string, open fs.OpenFn) fs.OpenFn {
+	return func(fullPath string, flag int, perm os.FileMode) (fs.FileLike, error) {
+		o.acquire(name)
+		f, err := open(fullPath, flag, perm)
+		if err != nil {
+			o.release()
+			return nil, err
+		}
+		return &countedFile{FileLike: f, release: o.release}, nil
+	}
+}
+
+type countedFile struct {
+	fs.FileLike
+	once    sync.Once
+	release func()
+}
+
+func (f *countedFile) Close() error {
+	err := f.FileLike.Close()
+	f.once.Do(f.release)
+	return err
+}
@@ -0,0 +1,73 @@
+package mount_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBuildZipTree_MaxOpenFiles(t *testing.T) {
+	archive := writeTestZip(t, "a.txt", "b.txt")
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+		mount.WithMaxOpenFiles(1))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	a, err := tree.Stat("a.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := tree.Stat("b.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, err := a.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening entry: %v", err)
+	}
+
+	opened := make(chan error)
+	go func() {
+		second, err := b.Open(os.O_RDONLY, 0)
+		if err == nil {
+			err = second.Close()
+		}
+		opened <- err
+	}()
+	select {
+	case err := <-opened:
+		t.Fatalf("expected the second open to wait for the first file to be closed, got: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("unexpected error closing entry: %v", err)
+	}
+	select {
+	case err := <-opened:
+		if err != nil {
+			t.Fatalf("unexpected error opening entry: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the second open is still waiting after the first file was closed")
+	}
+
+	info, err := tree.Stat(".cz/stats")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	stats := strings.Join(strings.Fields(string(data)), " ")
+	if !strings.Contains(stats, "open_files: 0") || !strings.Contains(stats, "open_file_waits: 1") {
+		t.Errorf("expected no open files and a single wait, got: %s", stats)
+	}
+}
@@ -0,0 +1,157 @@
+package mount_test
+
+import (
+	"context"
+	"io"
+	"maps"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBuildZipTree_CachePolicy(t *testing.T) {
+	archive := writeTestZip(t, "a.txt")
+	for _, policy := range []fs.CachePolicy{fs.CachePolicyCache, fs.CachePolicyBypass} {
+		t.Run(policy.String(), func(t *testing.T) {
+			cacheDir := t.TempDir()
+			stats := &remote.Stats{}
+			tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), cacheDir, "file://"+archive, nil,
+				mount.WithStats(stats), mount.WithCachePolicy(policy))
+			if err != nil {
+				t.Fatalf("unexpected error building tree: %v", err)
+			}
+			info, err := tree.Stat("a.txt")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var fetches int
+			for i := 0; i < 2; i++ {
+				requests := stats.Requests()
+				file, err := info.Open(os.O_RDONLY, 0)
+				if err != nil {
+					t.Fatalf("unexpected error opening entry: %v", err)
+				}
+				data, _ := io.ReadAll(file)
+				_ = file.Close()
+				if string(data) != "a.txt" {
+					t.Errorf("unexpected content: %q", data)
+				}
+				if stats.Requests() > requests {
+					fetches++
+				}
+			}
+			expected := 1
+			if policy == fs.CachePolicyBypass {
+				expected = 2
+			}
+			if fetches != expected {
+				t.Errorf("expected the entry to be fetched %d times, got %d", expected, fetches)
+			}
+			entries, err := os.ReadDir(cacheDir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cached := len(entries) > 0; cached != (policy == fs.CachePolicyCache) {
+				t.Errorf("expected cached=%t, found %d files in the cache", policy == fs.CachePolicyCache, len(entries))
+			}
+		})
+	}
+}
+
+func TestBuildZipTree_ReadOnlyCache(t *testing.T) {
+	archive := writeTestZip(t, "a.txt", "b.txt")
+	cacheDir := t.TempDir()
+	// warm the cache with a.txt
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), cacheDir, "file://"+archive, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	readEntry(t, tree, "a.txt")
+	warmed := cacheListing(t, cacheDir)
+
+	stats := &remote.Stats{}
+	tree, err = mount.BuildZipTree(context.Background(), remote.DummyLogger(), cacheDir, "file://"+archive, nil,
+		mount.WithStats(stats), mount.WithReadOnlyCache(true), mount.WithAllowStaleCache(true))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	for _, c := range []struct {
+		name    string
+		fetched bool
+	}{
+		{"a.txt", false},
+		{"b.txt", true},
+		{"b.txt", true},
+	} {
+		requests := stats.Requests()
+		if data := readEntry(t, tree, c.name); string(data) != c.name {
+			t.Errorf("unexpected content of %s: %q", c.name, data)
+		}
+		if fetched := stats.Requests() > requests; fetched != c.fetched {
+			t.Errorf("expected %s to be fetched=%t, made %d requests", c.name, c.fetched, stats.Requests()-requests)
+		}
+	}
+	// stored entries are read with ranged requests
+	if data := readEntry(t, tree, "padding.bin"); len(data) != 65536 {
+		t.Errorf("expected 65536 bytes of padding.bin, got %d", len(data))
+	}
+
+	// expired entries aren't marked fresh
+	tree, err = mount.BuildZipTree(context.Background(), remote.DummyLogger(), cacheDir, "file://"+archive, nil,
+		mount.WithReadOnlyCache(true), mount.WithCacheTTL(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	readEntry(t, tree, "a.txt")
+	if listing := cacheListing(t, cacheDir); !maps.Equal(listing, warmed) {
+		t.Errorf("expected the cache to be left as is, got %v, was %v", listing, warmed)
+	}
+
+	// entries that aren't cached are read at random offsets, which can't be verified
+	_, err = mount.BuildZipTree(context.Background(), remote.DummyLogger(), cacheDir, "file://"+archive, nil,
+		mount.WithReadOnlyCache(true), mount.WithVerifyReads(true))
+	if err == nil {
+		t.Error("expected an error verifying reads with a read-only cache")
+	}
+}
+
+func readEntry(t *testing.T, tree index.Tree, name string) []byte {
+	t.Helper()
+	info, err := tree.Stat(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	file, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening entry: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("unexpected error reading entry: %v", err)
+	}
+	return data
+}
+
+// cacheListing returns the modification time of each file in dir, by name
+func cacheListing(t *testing.T, dir string) map[string]time.Time {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listing := make(map[string]time.Time)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		listing[entry.Name()] = info.ModTime()
+	}
+	return listing
+}
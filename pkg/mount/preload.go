@@ -0,0 +1,45 @@
+package mount
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// preloadIndex returns the records of the index at c.indexURI, if it was built from obj, the archive at uri.
+// An index that can't be loaded, or that doesn't match the archive, isn't fatal: nil is returned, and the
+// central directory is read as usual.
+func (c *buildConfig) preloadIndex(ctx context.Context, logger *slog.Logger, uri string, obj remote.Fetcher) []*zipfile.CDR {
+	start := time.Now()
+	records, err := c.loadIndex(ctx, logger, uri, obj)
+	if err != nil {
+		logger.Warn("could not use the index, reading the central directory instead", "index_uri", c.indexURI, "error", err)
+		return nil
+	}
+	logger.Info("loaded index", "index_uri", c.indexURI, "records", len(records), "took_ms", time.Since(start).Milliseconds())
+	return records
+}
+
+// loadIndex reads the index at c.indexURI, and validates it against obj, the archive at uri
+func (c *buildConfig) loadIndex(ctx context.Context, logger *slog.Logger, uri string, obj remote.Fetcher) ([]*zipfile.CDR, error) {
+	f, err := remote.Object(c.indexURI, append([]remote.ObjectOpt{remote.WithLogger(logger)}, c.objectOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := f.Fetch(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	archive, records, err := zipfile.LoadArchiveIndex(rc)
+	if err != nil {
+		return nil, err
+	}
+	if err := archive.Validate(ctx, uri, obj); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
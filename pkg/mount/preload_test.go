@@ -0,0 +1,87 @@
+package mount_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestBuildZipTree_IndexURI(t *testing.T) {
+	data, err := os.ReadFile(writeTestZip(t, "a.txt"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var etag atomic.Value
+	etag.Store(`"v1"`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag.Load().(string))
+		http.ServeContent(w, r, "a.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	uri := server.URL + "/a.zip"
+
+	// an index whose entry is renamed, to tell whether it was used
+	obj, err := remote.Object(uri)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive, err := zipfile.DescribeArchive(context.Background(), uri, obj)
+	if err != nil || archive.ETag != `"v1"` {
+		t.Fatalf("expected the archive to be described with its ETag, got %+v (err: %v)", archive, err)
+	}
+	records, err := zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), obj)).GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, f := range records {
+		if f.FileName == "a.txt" {
+			f.FileName = "indexed.txt"
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := zipfile.ExportArchiveIndex(buf, archive, records); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	indexPath := filepath.Join(t.TempDir(), "a.czix")
+	if err := os.WriteFile(indexPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		etag     string
+		expected string
+	}{
+		{"matching", `"v1"`, "indexed.txt"},
+		{"changed archive", `"v2"`, "a.txt"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			etag.Store(c.etag)
+			logs := &bytes.Buffer{}
+			tree, err := mount.BuildZipTree(context.Background(), slog.New(slog.NewTextHandler(logs, nil)), t.TempDir(), uri, nil,
+				mount.WithIndexURI("file://"+indexPath))
+			if err != nil {
+				t.Fatalf("unexpected error building tree: %v", err)
+			}
+			if data := readEntry(t, tree, c.expected); string(data) != "a.txt" {
+				t.Errorf("unexpected content of %s: %q", c.expected, data)
+			}
+			if fellBack := strings.Contains(logs.String(), "could not use the index"); fellBack != (c.expected == "a.txt") {
+				t.Errorf("expected fallback=%t, got logs:\n%s", c.expected == "a.txt", logs)
+			}
+		})
+	}
+}
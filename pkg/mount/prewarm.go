@@ -0,0 +1,114 @@
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+const (
+	// procDir holds the files describing the mount server, which aren't part of the archive
+	procDir = ".cz"
+
+	DefaultPrewarmConcurrency = 4
+)
+
+// PrewarmProgress describes how far along Prewarm is
+type PrewarmProgress struct {
+	Entries      int
+	EntriesTotal int
+	BytesDone    int64
+	BytesTotal   int64
+}
+
+// Prewarm opens all files in tree whose path matches any of patterns (path.Match syntax, all files if none given),
+// which downloads them into the cache, so later reads are served locally.
+// Entries refused by the entry limit or compression method allowlist are skipped.
+func Prewarm(ctx context.Context, tree index.Tree, patterns []string, concurrency int, progress func(PrewarmProgress)) error {
+	files, err := prewarmFiles(tree, patterns)
+	if err != nil {
+		return err
+	}
+	var p PrewarmProgress
+	p.EntriesTotal = len(files)
+	for _, f := range files {
+		p.BytesTotal += f.Size()
+	}
+	if concurrency < 1 {
+		concurrency = DefaultPrewarmConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	work := make(chan *fs.FileInfo)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range work {
+				err := prewarmFile(f)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("could not prewarm %s: %w", f.FullPath(), err)
+					cancel()
+				}
+				p.Entries++
+				p.BytesDone += f.Size()
+				if progress != nil {
+					progress(p)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, f := range files {
+		select {
+		case work <- f:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func prewarmFile(f *fs.FileInfo) error {
+	file, err := f.Open(os.O_RDONLY, 0)
+	if errors.Is(err, zipfile.ErrEntryTooLarge) || errors.Is(err, zipfile.ErrMethodNotAllowed) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// prewarmFiles returns all files matching patterns, skipping the mount server's own files
+func prewarmFiles(tree index.Tree, patterns []string) ([]*fs.FileInfo, error) {
+	var files []*fs.FileInfo
+	err := tree.Walk("", func(fullPath string, fi os.FileInfo) error {
+		if fi.IsDir() {
+			return nil
+		}
+		if f, ok := fi.(*fs.FileInfo); ok {
+			files = append(files, f)
+		}
+		return nil
+	}, index.WithInclude(patterns...), index.WithExclude(procDir))
+	return files, err
+}
@@ -0,0 +1,52 @@
+package mount_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestPrewarm(t *testing.T) {
+	stats := &remote.Stats{}
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(),
+		"file://../zipfile/testdata/regular.zip", nil, mount.WithStats(stats))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+
+	var last mount.PrewarmProgress
+	err = mount.Prewarm(context.Background(), tree, []string{"*.txt", "foo/*"}, 2, func(p mount.PrewarmProgress) {
+		last = p
+	})
+	if err != nil {
+		t.Fatalf("unexpected error prewarming: %v", err)
+	}
+	// baz.txt and foo/bar.txt, but not a/b/c/d.txt
+	if last.Entries != 2 || last.EntriesTotal != 2 || last.BytesDone != 37 || last.BytesTotal != 37 {
+		t.Errorf("unexpected progress: %+v", last)
+	}
+
+	// prewarmed entries are served from the cache
+	requests := stats.Requests()
+	for _, name := range []string{"baz.txt", "foo/bar.txt"} {
+		info, err := tree.Stat(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f, err := info.Open(os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("unexpected error opening %s: %v", name, err)
+		}
+		_ = f.Close()
+	}
+	if stats.Requests() != requests {
+		t.Errorf("expected prewarmed entries to be read from the cache, made %d more requests", stats.Requests()-requests)
+	}
+
+	if err := mount.Prewarm(context.Background(), tree, []string{"["}, 1, nil); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
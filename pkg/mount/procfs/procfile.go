@@ -51,3 +51,12 @@ func NewProcFile(path string, content []byte, modTime time.Time) *fs.FileInfo {
 	}
 	return fs.ImmutableInfo(path, modTime, ProcFileMode, f.Size(), fs.OpenFn(opener))
 }
+
+// NewDynamicProcFile returns a file whose content is generated every time it is opened.
+// Since clients rely on the reported size, content must always be exactly size bytes long.
+func NewDynamicProcFile(path string, size int64, content func() []byte, modTime time.Time) *fs.FileInfo {
+	opener := func(fullPath string, flag int, perm os.FileMode) (fs.FileLike, error) {
+		return &InMemFile{bytes.NewReader(content())}, nil
+	}
+	return fs.ImmutableInfo(path, modTime, ProcFileMode, size, fs.OpenFn(opener))
+}
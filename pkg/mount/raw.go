@@ -0,0 +1,168 @@
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	"github.com/ozkatz/cloudzip/pkg/mount/index"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+const (
+	rawFileMode    os.FileMode = 0444
+	rawDefaultName             = "archive.zip"
+)
+
+var (
+	ErrRawSizeUnknown = errors.New("raw mode requires the size of the remote object")
+)
+
+// rawFile is a read-only, seekable view of a remote object. Every read is served by a ranged Fetch.
+type rawFile struct {
+	ctx    context.Context
+	f      remote.Fetcher
+	size   int64
+	offset int64
+	// fetchLock is shared by all handles of the same fetcher, since some fetchers (e.g. local files)
+	// keep a single position and can't serve concurrent ranges
+	fetchLock *sync.Mutex
+}
+
+func (r *rawFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := min(off+int64(len(p)), r.size) - 1 // inclusive
+	r.fetchLock.Lock()
+	defer r.fetchLock.Unlock()
+	body, err := r.f.Fetch(r.ctx, &off, &end)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(body, p[:end-off+1])
+	if err != nil {
+		return n, err
+	}
+	// drain rather than close: closing a local fetcher's reader closes the underlying file,
+	// while reading an HTTP body to EOF is enough to release its connection
+	_, _ = io.Copy(io.Discard, body)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *rawFile) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *rawFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *rawFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (r *rawFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (r *rawFile) Close() error {
+	return nil
+}
+
+func rawFileName(remoteURI string) string {
+	if i := strings.LastIndex(remoteURI, zipfile.NestedSeparator); i >= 0 {
+		// a nested archive, named after its entry
+		name := path.Base(remoteURI[i+1:])
+		if name == "." || name == "/" {
+			return rawDefaultName
+		}
+		return name
+	}
+	parsed, err := url.Parse(remoteURI)
+	if err != nil {
+		return rawDefaultName
+	}
+	name := path.Base(parsed.Path)
+	if name == "." || name == "/" {
+		return rawDefaultName
+	}
+	return name
+}
+
+// BuildRawTree exposes the remote object itself as a single file, without parsing it as a zip archive.
+// This lets tools such as unzip or zipinfo operate on the archive through the mount.
+// If logger is nil, slog.Default() is used.
+func BuildRawTree(ctx context.Context, logger *slog.Logger, remoteURI string, procAttrs map[string]interface{}, opts ...BuildOpt) (index.Tree, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	cfg := &buildConfig{stats: &remote.Stats{}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	// raw files don't hold file descriptors, so they are counted but not limited
+	cfg.openFiles = newOpenFiles(0, logger)
+	obj, remoteURI, err := cfg.openArchive(ctx, logger, remoteURI)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.probeRange {
+		parser := zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(ctx, obj), zipfile.WithLogger(logger))
+		if err := parser.ProbeRange(); err != nil {
+			return nil, err
+		}
+	}
+	size, err := remote.SizeOf(ctx, obj)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRawSizeUnknown, err)
+	}
+	startTime := time.Now()
+	fetchLock := &sync.Mutex{}
+	name := cfg.normalization.Normalize(rawFileName(remoteURI))
+	opener := func(fullPath string, flag int, perm os.FileMode) (fs.FileLike, error) {
+		return &rawFile{ctx: context.Background(), f: obj, size: size, fetchLock: fetchLock}, nil
+	}
+	infos := fs.FileInfoList{
+		fs.ImmutableInfo(name, startTime, rawFileMode, size, cfg.openFiles.wrap(name, opener)),
+	}
+	infos = append(infos, procInfos("", remoteURI, procAttrs, cfg, startTime)...)
+	return indexTree(infos, startTime, cfg)
+}
@@ -0,0 +1,60 @@
+package mount_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBuildRawTree(t *testing.T) {
+	const source = "../zipfile/testdata/regular.zip"
+	expected, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatalf("unexpected error reading test archive: %v", err)
+	}
+	tree, err := mount.BuildRawTree(context.Background(), remote.DummyLogger(), "file://"+source, nil)
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	info, err := tree.Stat("regular.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Size() != int64(len(expected)) {
+		t.Errorf("expected size %d, got %d", len(expected), info.Size())
+	}
+	f, err := info.Open(os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error opening raw file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected error reading raw file: %v", err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Error("raw file content differs from the source archive")
+	}
+
+	// the end of central directory record, as read by zip tools
+	buf := make([]byte, 22)
+	if _, err := f.Seek(-22, io.SeekEnd); err != nil {
+		t.Fatalf("unexpected error seeking: %v", err)
+	}
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(buf, expected[len(expected)-22:]) {
+		t.Error("unexpected content at end of raw file")
+	}
+	n, err := f.ReadAt(make([]byte, 10), int64(len(expected)-4))
+	if n != 4 || err != io.EOF {
+		t.Errorf("expected short read with io.EOF, got n=%d err=%v", n, err)
+	}
+}
@@ -0,0 +1,33 @@
+package mount_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestIndexRecords(t *testing.T) {
+	records := []*zipfile.CDR{
+		{FileName: `docs\readme.txt`, UncompressedSizeBytes: 10},
+		{FileName: "src", Mode: os.ModeDir | 0755},
+		{FileName: "src/main.go", UncompressedSizeBytes: 20},
+	}
+	tree, err := mount.IndexRecords(records)
+	if err != nil {
+		t.Fatalf("unexpected error indexing records: %v", err)
+	}
+	info, err := tree.Stat("docs/readme.txt")
+	if err != nil || info.Size() != 10 {
+		t.Fatalf("expected docs/readme.txt of 10 bytes, got: %v (err: %v)", info, err)
+	}
+	entries, err := tree.Readdir("src")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "main.go" {
+		t.Errorf("expected src/ to hold main.go, got: %v (err: %v)", entries, err)
+	}
+	if _, err := tree.Stat(".cz/stats"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no proc files in an index of records, got: %v", err)
+	}
+}
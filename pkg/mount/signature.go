@@ -0,0 +1,59 @@
+package mount
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// WithSignature refuses to open the archive unless its detached OpenPGP signature, read from signatureURI
+// (by default, the archive's URI with ".asc" appended, see remote.SignatureURI), was made by a key of keyring.
+// The whole archive is read to check it, before anything else. For nested archives, the outermost one is checked.
+// An archive whose signature can't be checked isn't mounted from the cache either, see WithAllowStaleCache.
+func WithSignature(keyring openpgp.EntityList, signatureURI string) BuildOpt {
+	return func(c *buildConfig) {
+		c.keyring = keyring
+		c.signatureURI = signatureURI
+	}
+}
+
+// verifySignature checks the signature of the archive at uri, as configured by WithSignature
+func (c *buildConfig) verifySignature(ctx context.Context, logger *slog.Logger, uri string) error {
+	signatureURI := c.signatureURI
+	if signatureURI == "" {
+		var err error
+		signatureURI, err = remote.SignatureURI(uri)
+		if err != nil {
+			return err
+		}
+	}
+	opts := append([]remote.ObjectOpt{remote.WithLogger(logger)}, c.objectOpts...)
+	sigObj, err := remote.Object(signatureURI, opts...)
+	if err != nil {
+		return fmt.Errorf("could not open signature %s: %w", signatureURI, err)
+	}
+	signature, err := remote.ReadSignature(ctx, sigObj)
+	if err != nil {
+		return fmt.Errorf("could not read signature %s: %w", signatureURI, err)
+	}
+	obj, err := remote.Object(uri, opts...)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	signer, err := remote.VerifySignature(ctx, c.wrapFetcher(obj, uri), signature, c.keyring)
+	if err != nil {
+		return err
+	}
+	attrs := []any{"uri", uri, "signature_uri", signatureURI, "took_ms", time.Since(start).Milliseconds()}
+	if signer != nil && signer.PrimaryKey != nil {
+		attrs = append(attrs, "key_id", signer.PrimaryKey.KeyIdString())
+	}
+	logger.InfoContext(ctx, "verified the archive's signature", attrs...)
+	return nil
+}
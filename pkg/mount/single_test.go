@@ -0,0 +1,81 @@
+package mount_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBuildZipTree_SingleEntry(t *testing.T) {
+	// padding.bin is added by writeTestZip, so these are single file archives
+	t.Run("flatten", func(t *testing.T) {
+		archive := writeTestZip(t)
+		tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+			mount.WithFlattenSingleEntry(true))
+		if err != nil {
+			t.Fatalf("unexpected error building tree: %v", err)
+		}
+		if _, err := tree.Stat("padding.bin"); err != nil {
+			t.Errorf("expected the file at the root: %v", err)
+		}
+	})
+
+	t.Run("flatten_nested", func(t *testing.T) {
+		archive := writeTestZip(t, "data/", "data/nested/")
+		tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+			mount.WithFlattenSingleEntry(true), mount.WithNameMapper(mount.AddPrefix("data/nested")))
+		if err != nil {
+			t.Fatalf("unexpected error building tree: %v", err)
+		}
+		if _, err := tree.Stat("data/nested/padding.bin"); err != nil {
+			t.Errorf("expected name mappers to apply to the flattened file: %v", err)
+		}
+	})
+
+	t.Run("parallel_reads", func(t *testing.T) {
+		for _, c := range []struct {
+			name     string
+			entries  []string
+			partSize int64
+		}{
+			{"single", nil, 1024},
+			{"several", []string{"a.txt"}, 0},
+		} {
+			t.Run(c.name, func(t *testing.T) {
+				// local files are read through a single handle, so parallel reads need a different backend
+				archive := writeTestZip(t, c.entries...)
+				server := httptest.NewServer(http.FileServer(http.Dir(filepath.Dir(archive))))
+				defer server.Close()
+				stats := &remote.Stats{}
+				tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), server.URL+"/"+filepath.Base(archive), nil,
+					mount.WithStats(stats), mount.WithParallelReads(1024, 1))
+				if err != nil {
+					t.Fatalf("unexpected error building tree: %v", err)
+				}
+				info, err := tree.Stat("padding.bin")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				file, err := info.Open(os.O_RDONLY, 0)
+				if err != nil {
+					t.Fatalf("unexpected error opening entry: %v", err)
+				}
+				data, _ := io.ReadAll(file)
+				_ = file.Close()
+				if len(data) != 65536 {
+					t.Errorf("expected 65536 bytes, got %d", len(data))
+				}
+				if stats.PartSize() != c.partSize {
+					t.Errorf("expected part size %d, got %d", c.partSize, stats.PartSize())
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package mount
+
+import (
+	"io"
+	"os"
+)
+
+// streamedFile is a read-only, seekable view of an entry that isn't cached, read from the archive as it is read
+// (see zipfile.ReaderAtForRecord): sequential reads stream the entry, while a read at an earlier offset of a
+// compressed entry reads it again from its start.
+type streamedFile struct {
+	*io.SectionReader
+	closer io.Closer
+}
+
+func newStreamedFile(r interface {
+	io.ReaderAt
+	io.Closer
+}, size int64) *streamedFile {
+	return &streamedFile{SectionReader: io.NewSectionReader(r, 0, size), closer: r}
+}
+
+func (s *streamedFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (s *streamedFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (s *streamedFile) Close() error {
+	return s.closer.Close()
+}
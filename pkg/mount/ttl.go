@@ -0,0 +1,62 @@
+package mount
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount/fs"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// revalidate serves f, the cached content of record, unless it was cached more than the cache TTL ago
+// and the entry changed in the archive since: cached entries are keyed by their CRC32 and never go stale
+// for the archive they were read from, but that archive may be replaced under a long-running mount.
+// An expired entry is checked with a single small request for its local file header, and marked fresh if unchanged.
+// A changed entry is dropped from the cache: it can't be fetched again with the central directory read at mount time,
+// so opening it fails until the archive is mounted again.
+// With WithAllowStaleCache, expired entries are served if they can't be checked.
+// A read-only cache is left as is: expired entries are checked on every open, and changed entries fail to open.
+func revalidate(logger *slog.Logger, zipPath string, record *zipfile.CDR, cache *fs.FileCache, key string, f fs.FileLike, cfg *buildConfig) (fs.FileLike, error) {
+	cachedAt, err := cache.ModTime(key)
+	if err != nil || time.Since(cachedAt) < cfg.cacheTTL {
+		return f, nil
+	}
+	err = checkEntry(logger, zipPath, record, cfg)
+	switch {
+	case err == nil:
+		logger.Debug("revalidated expired cache entry", "filename", record.FileName, "cached_at", cachedAt)
+		if cache.ReadOnly() {
+			return f, nil
+		}
+		if err := cache.Touch(key); err != nil {
+			logger.Warn("could not mark cache entry fresh", "filename", record.FileName, "error", err)
+		}
+		return f, nil
+	case errors.Is(err, zipfile.ErrEntryChanged) && cache.ReadOnly():
+		logger.Warn("entry changed in the archive since it was mounted", "filename", record.FileName, "error", err)
+		_ = f.Close()
+		return nil, err
+	case errors.Is(err, zipfile.ErrEntryChanged):
+		logger.Warn("entry changed in the archive since it was mounted, dropping it from the cache",
+			"filename", record.FileName, "error", err)
+		_ = f.Close()
+		_ = cache.Remove(key)
+		return nil, err
+	case cfg.allowStaleCache:
+		logger.Warn("could not revalidate expired cache entry, serving it stale", "filename", record.FileName, "error", err)
+		return f, nil
+	}
+	_ = f.Close()
+	return nil, err
+}
+
+// checkEntry checks that record still describes the entry in the archive at zipPath, see zipfile.CheckLocalHeader
+func checkEntry(logger *slog.Logger, zipPath string, record *zipfile.CDR, cfg *buildConfig) error {
+	remoteZip, err := cfg.archiveFetcher(logger, zipPath)
+	if err != nil {
+		return err
+	}
+	return zipfile.CheckLocalHeader(record, zipfile.NewStorageAdapter(context.Background(), remoteZip))
+}
@@ -0,0 +1,128 @@
+package mount_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestBuildZipTree_CacheTTL(t *testing.T) {
+	archive := writeTestZip(t, "b.txt", "a.txt")
+	cacheDir := t.TempDir()
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), cacheDir, "file://"+archive, nil,
+		mount.WithCacheTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	read := func() (string, error) {
+		info, err := tree.Stat("a.txt")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f, err := info.Open(os.O_RDONLY, 0)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = f.Close() }()
+		data, err := io.ReadAll(f)
+		return string(data), err
+	}
+	// expire passes time for the cached files, returning when they were cached
+	expire := func() time.Time {
+		cachedAt := time.Now().Add(-2 * time.Hour)
+		entries, err := os.ReadDir(cacheDir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, e := range entries {
+			if err := os.Chtimes(filepath.Join(cacheDir, e.Name()), cachedAt, cachedAt); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		return cachedAt
+	}
+	modTimes := func() []time.Time {
+		entries, err := os.ReadDir(cacheDir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var times []time.Time
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			times = append(times, info.ModTime())
+		}
+		return times
+	}
+
+	if content, err := read(); err != nil || content != "a.txt" {
+		t.Fatalf("unexpected content %q (err: %v)", content, err)
+	}
+
+	// unchanged: revalidated and marked fresh
+	cachedAt := expire()
+	if content, err := read(); err != nil || content != "a.txt" {
+		t.Fatalf("unexpected content of a revalidated entry %q (err: %v)", content, err)
+	}
+	for _, modTime := range modTimes() {
+		if !modTime.After(cachedAt) {
+			t.Errorf("expected the revalidated entry to be marked fresh, modified at %s", modTime)
+		}
+	}
+
+	// the archive is replaced: a.txt isn't where the mounted central directory has it anymore
+	replaced, err := os.ReadFile(writeTestZip(t, "a-much-longer-name-than-before.txt", "a.txt"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(archive, replaced, 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, err := read(); err != nil || content != "a.txt" {
+		t.Errorf("expected a fresh entry to be served without revalidation, got %q (err: %v)", content, err)
+	}
+	expire()
+	if _, err := read(); !errors.Is(err, zipfile.ErrEntryChanged) {
+		t.Errorf("expected ErrEntryChanged opening an entry that changed, got: %v", err)
+	}
+	if times := modTimes(); len(times) != 0 {
+		t.Errorf("expected the changed entry to be dropped from the cache, %d files left", len(times))
+	}
+}
+
+func TestBuildZipTree_CacheTTLAllowStale(t *testing.T) {
+	archive := writeTestZip(t, "a.txt")
+	cacheDir := t.TempDir()
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), cacheDir, "file://"+archive, nil,
+		mount.WithCacheTTL(time.Nanosecond), mount.WithAllowStaleCache(true))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	info, err := tree.Stat("a.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, step := range []string{"cached", "served stale"} {
+		f, err := info.Open(os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step, err)
+		}
+		data, err := io.ReadAll(f)
+		_ = f.Close()
+		if err != nil || string(data) != "a.txt" {
+			t.Fatalf("%s: unexpected content %q (err: %v)", step, data, err)
+		}
+		// the backend is gone: expired entries can't be revalidated
+		_ = os.Remove(archive)
+	}
+}
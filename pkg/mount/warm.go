@@ -0,0 +1,48 @@
+package mount
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// openLocalCopy opens the file for record under dir, a directory the archive was previously extracted to,
+// if its size and CRC32 match the record. The returned file is positioned at its start.
+func openLocalCopy(dir string, record *zipfile.CDR) (*os.File, error) {
+	// rooting the name first keeps entries like "../x" inside dir
+	localPath := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+record.FileName)))
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() || uint64(info.Size()) != record.UncompressedSizeBytes {
+		_ = f.Close()
+		return nil, fmt.Errorf("%w: %s: local copy is %d bytes, expected %d",
+			zipfile.ErrSizeMismatch, localPath, info.Size(), record.UncompressedSizeBytes)
+	}
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if h.Sum32() != record.CRC32Uncompressed {
+		_ = f.Close()
+		return nil, fmt.Errorf("%w: %s: local copy has CRC32 %08x, expected %08x",
+			zipfile.ErrCRCMismatch, localPath, h.Sum32(), record.CRC32Uncompressed)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,67 @@
+package mount_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/mount"
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBuildZipTree_CacheWarmFrom(t *testing.T) {
+	contents := map[string]string{"a/matching.txt": "matching", "a/stale.txt": "fresh content", "missing.txt": "missing"}
+	var entries []testEntry
+	for name, content := range contents {
+		entries = append(entries, testEntry{name: name, content: content})
+	}
+	archive := writeTestZipEntries(t, entries...)
+
+	local := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(local, "a"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, content := range map[string]string{"a/matching.txt": "matching", "a/stale.txt": "stale content"} {
+		if err := os.WriteFile(filepath.Join(local, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	stats := &remote.Stats{}
+	tree, err := mount.BuildZipTree(context.Background(), remote.DummyLogger(), t.TempDir(), "file://"+archive, nil,
+		mount.WithStats(stats), mount.WithCacheWarmFrom(local))
+	if err != nil {
+		t.Fatalf("unexpected error building tree: %v", err)
+	}
+	cases := []struct {
+		name    string
+		fetched bool
+	}{
+		{"a/matching.txt", false},
+		{"a/stale.txt", true},
+		{"missing.txt", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info, err := tree.Stat(c.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			requests := stats.Requests()
+			file, err := info.Open(os.O_RDONLY, 0)
+			if err != nil {
+				t.Fatalf("unexpected error opening entry: %v", err)
+			}
+			data, _ := io.ReadAll(file)
+			_ = file.Close()
+			if string(data) != contents[c.name] {
+				t.Errorf("expected %q, got %q", contents[c.name], data)
+			}
+			if fetched := stats.Requests() > requests; fetched != c.fetched {
+				t.Errorf("expected fetched=%t, got %t", c.fetched, fetched)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package remote
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+const (
+	azureEnvConnectionString   = "AZURE_STORAGE_CONNECTION_STRING"
+	azureEnvAccount            = "AZURE_STORAGE_ACCOUNT"
+	azureDefaultEndpointSuffix = "core.windows.net"
+	// Azurite, the storage emulator, accepts a well-known account and key
+	azuriteAccount      = "devstoreaccount1"
+	azuriteKey          = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	azuriteBlobEndpoint = "http://127.0.0.1:10000/" + azuriteAccount
+)
+
+var ErrAzureAuth = errors.New("azure authentication failed")
+
+// azureAllowHTTPTokens lets Entra tokens be sent to plain HTTP endpoints, which only tests do
+var azureAllowHTTPTokens = false
+
+type azureParsedUri struct {
+	// Account is only set by wasbs:// URIs, az:// URIs are read from the configured account
+	Account   string
+	Host      string
+	Container string
+	Blob      string
+}
+
+// azureParseUri parses az://container/path/to/blob.zip and wasbs://container@account.blob.core.windows.net/path/to/blob.zip
+func azureParseUri(uri string) (*azureParsedUri, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	blobName := strings.TrimPrefix(parsed.Path, "/")
+	result := &azureParsedUri{Container: parsed.Host, Blob: blobName}
+	if parsed.Scheme == "wasbs" {
+		if parsed.User == nil || parsed.User.Username() == "" {
+			return nil, fmt.Errorf("%w: expected wasbs://container@account.blob.core.windows.net/blob, got %s", ErrInvalidURI, uri)
+		}
+		account, _, _ := strings.Cut(parsed.Hostname(), ".")
+		result = &azureParsedUri{Account: account, Host: parsed.Host, Container: parsed.User.Username(), Blob: blobName}
+	}
+	if result.Container == "" || result.Blob == "" {
+		return nil, fmt.Errorf("%w: expected %s://container/blob, got %s", ErrInvalidURI, parsed.Scheme, uri)
+	}
+	return result, nil
+}
+
+// azureConfig is how a storage account is reached: its blob endpoint, and either a (base64-encoded) shared key, a SAS token,
+// or neither, in which case requests are authenticated with tokens from DefaultAzureCredential
+type azureConfig struct {
+	Account  string
+	Endpoint string
+	Key      string
+	SAS      string
+}
+
+// parseAzureConnectionString parses a connection string, as shown by the Azure portal for a storage account
+func parseAzureConnectionString(connectionString string) (*azureConfig, error) {
+	fields := map[string]string{}
+	for _, part := range strings.Split(connectionString, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid connection string field '%s'", ErrAzureAuth, key)
+		}
+		fields[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	if strings.EqualFold(fields["usedevelopmentstorage"], "true") {
+		return &azureConfig{Account: azuriteAccount, Endpoint: azuriteBlobEndpoint, Key: azuriteKey}, nil
+	}
+	cfg := &azureConfig{
+		Account:  fields["accountname"],
+		Endpoint: strings.TrimSuffix(fields["blobendpoint"], "/"),
+		SAS:      strings.TrimPrefix(fields["sharedaccesssignature"], "?"),
+	}
+	if accountKey := fields["accountkey"]; accountKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(accountKey); err != nil {
+			return nil, fmt.Errorf("%w: invalid account key in connection string", ErrAzureAuth)
+		}
+		cfg.Key = accountKey
+	}
+	if cfg.Key != "" && cfg.Account == "" {
+		return nil, fmt.Errorf("%w: connection string has an account key, but no account name", ErrAzureAuth)
+	}
+	if cfg.Endpoint == "" {
+		if cfg.Account == "" {
+			return nil, fmt.Errorf("%w: connection string has neither an account name nor a blob endpoint", ErrAzureAuth)
+		}
+		protocol, suffix := fields["defaultendpointsprotocol"], fields["endpointsuffix"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		if suffix == "" {
+			suffix = azureDefaultEndpointSuffix
+		}
+		cfg.Endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, cfg.Account, suffix)
+	}
+	return cfg, nil
+}
+
+// loadAzureConfig returns how the account of uri is reached: through AZURE_STORAGE_CONNECTION_STRING if set
+// (and for the same account as a wasbs:// URI), or else with DefaultAzureCredential
+func loadAzureConfig(uri *azureParsedUri) (*azureConfig, error) {
+	if connectionString := os.Getenv(azureEnvConnectionString); connectionString != "" {
+		cfg, err := parseAzureConnectionString(connectionString)
+		if err != nil {
+			return nil, err
+		}
+		if uri.Account == "" || strings.EqualFold(uri.Account, cfg.Account) {
+			return cfg, nil
+		}
+	}
+	if uri.Account != "" {
+		return &azureConfig{Account: uri.Account, Endpoint: "https://" + uri.Host}, nil
+	}
+	account := os.Getenv(azureEnvAccount)
+	if account == "" {
+		return nil, fmt.Errorf("%w: no storage account for az:// URIs, set %s or %s",
+			ErrInvalidURI, azureEnvAccount, azureEnvConnectionString)
+	}
+	return &azureConfig{Account: account, Endpoint: fmt.Sprintf("https://%s.blob.%s", account, azureDefaultEndpointSuffix)}, nil
+}
+
+// azureCredential wraps the errors of a token credential with ErrAzureAuth
+type azureCredential struct {
+	azcore.TokenCredential
+}
+
+func (c azureCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	token, err := c.TokenCredential.GetToken(ctx, options)
+	if err != nil {
+		return token, fmt.Errorf("%w: %w", ErrAzureAuth, err)
+	}
+	return token, nil
+}
+
+// newAzureBlobClient returns a client of the blob at blobUrl, authenticated as cfg says, that makes its requests
+// (token requests included) with dialer if set
+func newAzureBlobClient(cfg *azureConfig, blobUrl string, dialer Dialer) (*blob.Client, error) {
+	options := azcore.ClientOptions{
+		Transport:                       &http.Client{Transport: identityTransport{next: dialClient(dialer).Transport}},
+		InsecureAllowCredentialWithHTTP: azureAllowHTTPTokens,
+	}
+	clientOptions := &blob.ClientOptions{ClientOptions: options}
+	switch {
+	case cfg.Key != "":
+		credential, err := blob.NewSharedKeyCredential(cfg.Account, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAzureAuth, err)
+		}
+		return blob.NewClientWithSharedKeyCredential(blobUrl, credential, clientOptions)
+	case cfg.SAS != "":
+		return blob.NewClientWithNoCredential(blobUrl+"?"+cfg.SAS, clientOptions)
+	}
+	credential, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{ClientOptions: options})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAzureAuth, err)
+	}
+	return blob.NewClient(blobUrl, azureCredential{credential}, clientOptions)
+}
+
+// azureError turns errors of the blob client into the errors of this package
+func azureError(op string, err error) error {
+	var responseErr *azcore.ResponseError
+	if err == nil || !errors.As(err, &responseErr) {
+		return err
+	}
+	// expired or invalid credentials are rejected with 403, and an AuthenticationFailed error code
+	if bloberror.HasCode(err, bloberror.AuthenticationFailed) {
+		return fmt.Errorf("%w: %s returned %d (%s)", ErrAzureAuth, op, responseErr.StatusCode, responseErr.ErrorCode)
+	}
+	statusErr := httpStatusError(op, responseErr.StatusCode, ErrAzureAuth)
+	if responseErr.ErrorCode == "" || errors.Is(statusErr, ErrDoesNotExist) {
+		return statusErr
+	}
+	return fmt.Errorf("%w (%s)", statusErr, responseErr.ErrorCode)
+}
+
+// azureRange returns the range of a read from startOffset, to endOffset if set
+func azureRange(startOffset *int64, endOffset *int64) blob.HTTPRange {
+	switch {
+	case startOffset != nil && endOffset != nil:
+		return blob.HTTPRange{Offset: *startOffset, Count: *endOffset - *startOffset + 1}
+	case startOffset != nil:
+		return blob.HTTPRange{Offset: *startOffset}
+	}
+	return blob.HTTPRange{}
+}
+
+// AzureFetcher reads blobs from Azure Blob Storage with azblob, authenticating with a shared key or SAS token from
+// AZURE_STORAGE_CONNECTION_STRING, or with Microsoft Entra tokens from azidentity's DefaultAzureCredential
+type AzureFetcher struct {
+	uri    *azureParsedUri
+	cfg    *azureConfig
+	logger *slog.Logger
+	dialer Dialer
+
+	l      sync.Mutex
+	client *blob.Client
+	// size is looked up once, to turn reads of the end of the blob into absolute ranges
+	size int64
+}
+
+var _ Fetcher = &AzureFetcher{}
+
+func NewAzureFetcher(uri string) (*AzureFetcher, error) {
+	parsed, err := azureParseUri(uri)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadAzureConfig(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return &AzureFetcher{
+		uri:    parsed,
+		cfg:    cfg,
+		logger: DummyLogger(),
+		size:   -1,
+	}, nil
+}
+
+func (a *AzureFetcher) setLogger(logger *slog.Logger) {
+	a.logger = logger
+}
+
+func (a *AzureFetcher) setDialer(dialer Dialer) {
+	a.dialer = dialer
+}
+
+// blobClient returns the client of the blob, creating it on first use
+func (a *AzureFetcher) blobClient() (*blob.Client, error) {
+	a.l.Lock()
+	defer a.l.Unlock()
+	if a.client == nil {
+		blobUrl := fmt.Sprintf("%s/%s/%s", a.cfg.Endpoint, url.PathEscape(a.uri.Container), (&url.URL{Path: a.uri.Blob}).EscapedPath())
+		client, err := newAzureBlobClient(a.cfg, blobUrl, a.dialer)
+		if err != nil {
+			return nil, err
+		}
+		a.client = client
+	}
+	return a.client, nil
+}
+
+// properties returns the properties of the blob
+func (a *AzureFetcher) properties(ctx context.Context) (*blob.GetPropertiesResponse, error) {
+	start := time.Now()
+	var properties blob.GetPropertiesResponse
+	client, err := a.blobClient()
+	if err == nil {
+		properties, err = client.GetProperties(ctx, nil)
+		err = azureError("azure.GetBlobProperties", err)
+	}
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		a.logger.ErrorContext(ctx, "azure.GetBlobProperties", "container", a.uri.Container, "blob", a.uri.Blob, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	a.logger.DebugContext(ctx, "azure.GetBlobProperties", "container", a.uri.Container, "blob", a.uri.Blob, "took_ms", tookMs, "error", nil)
+	return &properties, nil
+}
+
+// absoluteRange turns a read of the last bytes of the blob, which Azure doesn't support, into a range from an offset
+func (a *AzureFetcher) absoluteRange(ctx context.Context, startOffset *int64, endOffset *int64) (*int64, *int64, error) {
+	if startOffset != nil || endOffset == nil {
+		return startOffset, endOffset, nil
+	}
+	a.l.Lock()
+	size := a.size
+	a.l.Unlock()
+	if size < 0 {
+		var err error
+		if size, err = a.SizeOf(ctx); err != nil {
+			return nil, nil, err
+		}
+		a.l.Lock()
+		a.size = size
+		a.l.Unlock()
+	}
+	start := max(size-*endOffset, 0)
+	return &start, nil, nil
+}
+
+func (a *AzureFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	startOffset, endOffset, err := a.absoluteRange(ctx, startOffset, endOffset)
+	if err != nil {
+		return nil, err
+	}
+	rangeHeader := buildRange(startOffset, endOffset)
+	rangeHeaderStr := ""
+	if rangeHeader != nil {
+		rangeHeaderStr = *rangeHeader
+	}
+	start := time.Now()
+	var response blob.DownloadStreamResponse
+	client, err := a.blobClient()
+	if err == nil {
+		response, err = client.DownloadStream(ctx, &blob.DownloadStreamOptions{Range: azureRange(startOffset, endOffset)})
+		err = azureError("azure.GetBlob", err)
+	}
+	tookMs := time.Since(start).Milliseconds()
+	if errors.Is(err, ErrDoesNotExist) {
+		a.logger.WarnContext(ctx, "azure.GetBlob", "range", rangeHeaderStr, "container", a.uri.Container, "blob", a.uri.Blob, "took_ms", tookMs, "error", "NotFound")
+		return nil, err
+	} else if err != nil {
+		a.logger.ErrorContext(ctx, "azure.GetBlob", "range", rangeHeaderStr, "container", a.uri.Container, "blob", a.uri.Blob, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	a.logger.DebugContext(ctx, "azure.GetBlob", "range", rangeHeaderStr, "container", a.uri.Container, "blob", a.uri.Blob, "took_ms", tookMs, "error", nil)
+	return response.Body, nil
+}
+
+// SizeOf returns the size of the blob from its properties
+func (a *AzureFetcher) SizeOf(ctx context.Context) (int64, error) {
+	properties, err := a.properties(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if properties.ContentLength == nil || *properties.ContentLength < 0 {
+		return 0, fmt.Errorf("%w: blob properties have no content length", ErrSizeUnsupported)
+	}
+	return *properties.ContentLength, nil
+}
+
+// ETag returns the ETag of the blob from its properties
+func (a *AzureFetcher) ETag(ctx context.Context) (string, error) {
+	properties, err := a.properties(ctx)
+	if err != nil {
+		return "", err
+	}
+	if properties.ETag == nil || *properties.ETag == "" {
+		return "", fmt.Errorf("%w: blob properties have no ETag", ErrNoETag)
+	}
+	return string(*properties.ETag), nil
+}
@@ -0,0 +1,191 @@
+package remote_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+const azureTestKey = "c2VjcmV0LWFjY291bnQta2V5"
+
+// azureSharedKeyValid checks the Shared Key signature of a GET or HEAD request without content headers
+func azureSharedKeyValid(r *http.Request, account string) bool {
+	var names []string
+	for name := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	sort.Strings(names)
+	stringToSign := r.Method + strings.Repeat("\n", 12)
+	for _, name := range names {
+		stringToSign += name + ":" + r.Header.Get(name) + "\n"
+	}
+	stringToSign += "/" + account + r.URL.EscapedPath()
+	key, _ := base64.StdEncoding.DecodeString(azureTestKey)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return r.Header.Get("Authorization") == "SharedKey "+account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// azureServer serves a blob endpoint with a single blob, accepting requests authorized by authorized,
+// and the token endpoint of an App Service managed identity
+func azureServer(t *testing.T, content string, authorized func(r *http.Request) bool) (*httptest.Server, *atomic.Int64) {
+	var tokens atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/identity/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-IDENTITY-HEADER") != "identity-header" || !strings.HasPrefix(r.URL.Query().Get("resource"), "https://storage.azure.com") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		tokens.Add(1)
+		_, _ = fmt.Fprintf(w, `{"token_type": "Bearer", "expires_on": "%d", "access_token": "entra-token"}`, time.Now().Add(time.Hour).Unix())
+	})
+	mux.HandleFunc("/account/datasets/path/to/archive.zip", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-ms-version") == "" || !authorized(r) {
+			w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if rangeHeader := r.Header.Get("x-ms-range"); rangeHeader != "" {
+			if strings.HasPrefix(rangeHeader, "bytes=-") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.Header.Set("Range", rangeHeader)
+		}
+		w.Header().Set("ETag", `"0x8DC0A1B2C3D4E5F"`)
+		http.ServeContent(w, r, "archive.zip", time.Time{}, strings.NewReader(content))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &tokens
+}
+
+func TestAzureFetcher(t *testing.T) {
+	content := "0123456789abcdef"
+	server, _ := azureServer(t, content, func(r *http.Request) bool {
+		return azureSharedKeyValid(r, "account")
+	})
+	t.Setenv("AZURE_STORAGE_CONNECTION_STRING", "DefaultEndpointsProtocol=http;AccountName=account;AccountKey="+azureTestKey+
+		";BlobEndpoint="+server.URL+"/account;")
+	ctx := context.Background()
+	f, err := remote.Object("az://datasets/path/to/archive.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start, end := int64(2), int64(5)
+	r, err := f.Fetch(ctx, &start, &end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != content[2:6] {
+		t.Errorf("expected %q, got %q", content[2:6], data)
+	}
+	// reads of the end of the blob are made from an offset, as Azure doesn't support suffix ranges
+	last := int64(4)
+	r, err = f.Fetch(ctx, nil, &last)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ = io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != content[len(content)-4:] {
+		t.Errorf("expected %q, got %q", content[len(content)-4:], data)
+	}
+	if size, err := remote.SizeOf(ctx, f); err != nil || size != int64(len(content)) {
+		t.Errorf("expected size %d, got %d (%v)", len(content), size, err)
+	}
+	if etag, err := remote.ETagOf(ctx, f); err != nil || etag != `"0x8DC0A1B2C3D4E5F"` {
+		t.Errorf("unexpected ETag %q (%v)", etag, err)
+	}
+
+	missing, err := remote.Object("az://datasets/missing.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := missing.Fetch(ctx, &start, &end); !errors.Is(err, remote.ErrDoesNotExist) {
+		t.Errorf("expected ErrDoesNotExist, got %v", err)
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		t.Setenv("AZURE_STORAGE_CONNECTION_STRING", "AccountName=account;AccountKey=d3Jvbmc=;BlobEndpoint="+server.URL+"/account")
+		f, err := remote.Object("az://datasets/path/to/archive.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := f.Fetch(ctx, &start, &end); !errors.Is(err, remote.ErrAzureAuth) {
+			t.Errorf("expected ErrAzureAuth, got %v", err)
+		}
+	})
+}
+
+func TestAzureFetcher_ManagedIdentity(t *testing.T) {
+	content := "0123456789abcdef"
+	server, tokens := azureServer(t, content, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer entra-token"
+	})
+	*remote.AzureAllowHTTPTokens = true
+	t.Cleanup(func() { *remote.AzureAllowHTTPTokens = false })
+	// without a key or SAS token, the connection string only sets the endpoint
+	t.Setenv("AZURE_STORAGE_CONNECTION_STRING", "AccountName=account;BlobEndpoint="+server.URL+"/account")
+	for _, name := range []string{"AZURE_TENANT_ID", "AZURE_CLIENT_SECRET", "AZURE_CLIENT_CERTIFICATE_PATH", "AZURE_USERNAME", "AZURE_FEDERATED_TOKEN_FILE"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("IDENTITY_ENDPOINT", server.URL+"/identity/token")
+	t.Setenv("IDENTITY_HEADER", "identity-header")
+	ctx := context.Background()
+	f, err := remote.Object("az://datasets/path/to/archive.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		start, end := int64(i), int64(i+3)
+		r, err := f.Fetch(ctx, &start, &end)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, _ := io.ReadAll(r)
+		_ = r.Close()
+		if string(data) != content[i:i+4] {
+			t.Errorf("expected %q, got %q", content[i:i+4], data)
+		}
+	}
+	if tokens.Load() != 1 {
+		t.Errorf("expected the token to be reused, got %d token requests", tokens.Load())
+	}
+}
+
+func TestAzureFetcher_InvalidURI(t *testing.T) {
+	t.Setenv("AZURE_STORAGE_CONNECTION_STRING", "")
+	t.Setenv("AZURE_STORAGE_ACCOUNT", "")
+	for _, uri := range []string{
+		"az://datasets",
+		"wasbs://account.blob.core.windows.net/archive.zip",
+		// no account configured for az:// URIs
+		"az://datasets/archive.zip",
+	} {
+		if _, err := remote.Object(uri); !errors.Is(err, remote.ErrInvalidURI) {
+			t.Errorf("expected ErrInvalidURI for %s, got %v", uri, err)
+		}
+	}
+	if _, err := remote.Object("wasbs://datasets@account.blob.core.windows.net/archive.zip"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
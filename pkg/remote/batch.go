@@ -0,0 +1,199 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// maxBatchedRangeSize is the size of the largest read that is batched: the ranges of a batch are held
+	// in memory until all of them are read, so larger reads are fetched on their own
+	maxBatchedRangeSize = 1 << 20
+	// maxBatchRanges bounds the ranges fetched at once, as servers limit the ranges of a request
+	maxBatchRanges = 32
+)
+
+// Range is the range of bytes of an object from Start to End, inclusive
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// RangeBatcher is implemented by fetchers that can fetch several ranges of the object at once, over a single
+// request or stream (e.g. HTTP(S) with HttpRangeStyleMultipart), rather than with a request per range
+type RangeBatcher interface {
+	// FetchRanges returns the content of each of ranges, in the order given. Ranges that extend past the end
+	// of the object are cut short, as with Fetch. It returns ErrBatchUnsupported if the backend can't
+	// fetch ranges at once.
+	FetchRanges(ctx context.Context, ranges []Range) ([][]byte, error)
+}
+
+// BatchingFetcher wraps a Fetcher that is a RangeBatcher, fetching reads of up to 1MiB that are outstanding
+// at the same time in a single batch. A read made when no batch is in flight is fetched right away, so only
+// concurrent reads wait, for the batch in flight to be done. Fetchers that aren't a RangeBatcher are
+// returned as they are, and once f fails with ErrBatchUnsupported, reads are no longer batched.
+func BatchingFetcher(f Fetcher) Fetcher {
+	batcher, ok := f.(RangeBatcher)
+	if !ok {
+		return f
+	}
+	return &batchingFetcher{next: f, batcher: batcher}
+}
+
+type batchRequest struct {
+	ctx    context.Context
+	r      Range
+	result chan batchResult
+
+	// mu guards abandoned, set once the caller gave up waiting: its result is then closed rather than delivered
+	mu        sync.Mutex
+	abandoned bool
+}
+
+// deliver hands res to the caller of req, or closes it if the caller gave up waiting
+func (req *batchRequest) deliver(res batchResult) {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	if req.abandoned {
+		res.close()
+		return
+	}
+	req.result <- res
+}
+
+// abandon gives up waiting for the result of req, closing it if it was delivered already
+func (req *batchRequest) abandon() {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	req.abandoned = true
+	select {
+	case res := <-req.result:
+		res.close()
+	default:
+	}
+}
+
+type batchResult struct {
+	rc  io.ReadCloser
+	err error
+}
+
+func (res batchResult) close() {
+	if res.rc != nil {
+		_ = res.rc.Close()
+	}
+}
+
+type batchingFetcher struct {
+	next        Fetcher
+	batcher     RangeBatcher
+	unsupported atomic.Bool
+
+	mu       sync.Mutex
+	pending  []*batchRequest
+	inFlight bool
+}
+
+func (b *batchingFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	if startOffset == nil || endOffset == nil || *endOffset-*startOffset+1 > maxBatchedRangeSize || b.unsupported.Load() {
+		return b.next.Fetch(ctx, startOffset, endOffset)
+	}
+	req := &batchRequest{ctx: ctx, r: Range{Start: *startOffset, End: *endOffset}, result: make(chan batchResult, 1)}
+	b.mu.Lock()
+	b.pending = append(b.pending, req)
+	if !b.inFlight {
+		b.inFlight = true
+		go b.dispatch()
+	}
+	b.mu.Unlock()
+	select {
+	case res := <-req.result:
+		return res.rc, res.err
+	case <-ctx.Done():
+		req.abandon()
+		return nil, ctx.Err()
+	}
+}
+
+func (b *batchingFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return SizeOf(ctx, b.next)
+}
+
+func (b *batchingFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	return StoredChecksum(ctx, b.next, algorithm)
+}
+
+func (b *batchingFetcher) ETag(ctx context.Context) (string, error) {
+	return ETagOf(ctx, b.next)
+}
+
+// dispatch fetches pending reads, a batch at a time, until none are left
+func (b *batchingFetcher) dispatch() {
+	for {
+		b.mu.Lock()
+		n := min(len(b.pending), maxBatchRanges)
+		if n == 0 {
+			b.inFlight = false
+			b.mu.Unlock()
+			return
+		}
+		batch := b.pending[:n:n]
+		b.pending = b.pending[n:]
+		b.mu.Unlock()
+		b.fetch(batch)
+	}
+}
+
+// fetch answers the reads of batch, those whose caller didn't give up waiting yet
+func (b *batchingFetcher) fetch(batch []*batchRequest) {
+	live := batch[:0]
+	for _, req := range batch {
+		if req.ctx.Err() == nil {
+			live = append(live, req)
+		}
+	}
+	if len(live) == 1 {
+		// nothing to batch with: stream it
+		b.fetchEach(live)
+		return
+	}
+	if len(live) == 0 {
+		return
+	}
+	ranges := make([]Range, len(live))
+	for i, req := range live {
+		ranges[i] = req.r
+	}
+	// the batch outlives any one of the reads in it
+	data, err := b.batcher.FetchRanges(context.WithoutCancel(live[0].ctx), ranges)
+	if errors.Is(err, ErrBatchUnsupported) {
+		b.unsupported.Store(true)
+		b.fetchEach(live)
+		return
+	}
+	for i, req := range live {
+		if err != nil {
+			req.deliver(batchResult{err: err})
+		} else {
+			req.deliver(batchResult{rc: io.NopCloser(bytes.NewReader(data[i]))})
+		}
+	}
+}
+
+// fetchEach fetches each of reqs on its own, concurrently
+func (b *batchingFetcher) fetchEach(reqs []*batchRequest) {
+	var wg sync.WaitGroup
+	for _, req := range reqs {
+		wg.Add(1)
+		go func(req *batchRequest) {
+			defer wg.Done()
+			rc, err := b.next.Fetch(req.ctx, &req.r.Start, &req.r.End)
+			req.deliver(batchResult{rc: rc, err: err})
+		}(req)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,186 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestBatchingFetcher(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	cases := []struct {
+		name  string
+		style remote.HttpRangeStyle
+		// ignoreRanges serves the entire object to requests for more than one range
+		ignoreRanges bool
+		batched      bool
+	}{
+		{"multipart", remote.HttpRangeStyleMultipart, false, true},
+		{"header", remote.HttpRangeStyleHeader, false, false},
+		{"multiple ranges ignored", remote.HttpRangeStyleMultipart, true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var requests, multiRangeRequests atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				// keep the first request in flight, so that the others pile up
+				time.Sleep(20 * time.Millisecond)
+				if strings.Contains(r.Header.Get("Range"), ",") {
+					multiRangeRequests.Add(1)
+					if c.ignoreRanges {
+						_, _ = w.Write(data)
+						return
+					}
+				}
+				http.ServeContent(w, r, "a.zip", time.Time{}, bytes.NewReader(data))
+			}))
+			defer server.Close()
+			obj, err := remote.Object(server.URL+"/a.zip", remote.WithHttpRangeStyle(c.style))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			f := remote.BatchingFetcher(obj)
+			if size, err := remote.SizeOf(context.Background(), f); err != nil || size != int64(len(data)) {
+				t.Fatalf("expected the size of the object, got %d (%v)", size, err)
+			}
+
+			const reads = 10
+			var wg sync.WaitGroup
+			for i := 0; i < reads; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					// the last read extends past the end of the object
+					start, end := int64(i*1000+i), int64(i*1000+i+99)
+					if i == reads-1 {
+						end = int64(len(data) + 50)
+					}
+					rc, err := f.Fetch(context.Background(), &start, &end)
+					if err != nil {
+						t.Errorf("unexpected error reading %d-%d: %v", start, end, err)
+						return
+					}
+					got, _ := io.ReadAll(rc)
+					_ = rc.Close()
+					if !bytes.Equal(got, data[start:min(end+1, int64(len(data)))]) {
+						t.Errorf("unexpected content for %d-%d", start, end)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			if c.batched && (multiRangeRequests.Load() == 0 || requests.Load() >= reads) {
+				t.Errorf("expected reads to be batched, got %d requests (%d with multiple ranges)", requests.Load(), multiRangeRequests.Load())
+			}
+			if !c.batched && multiRangeRequests.Load() > 1 {
+				t.Errorf("expected batching to stop once unsupported, got %d requests with multiple ranges", multiRangeRequests.Load())
+			}
+		})
+	}
+}
+
+// gatedBatcher can't batch ranges, and holds reads of a range until its gate is opened
+type gatedBatcher struct {
+	gates   map[int64]chan struct{}
+	entered chan int64
+	closed  chan int64
+}
+
+// trackedBody reports being closed
+type trackedBody struct {
+	io.Reader
+	start  int64
+	closed chan int64
+}
+
+func (b *trackedBody) Close() error {
+	b.closed <- b.start
+	return nil
+}
+
+func (g *gatedBatcher) Fetch(_ context.Context, start, _ *int64) (io.ReadCloser, error) {
+	g.entered <- *start
+	if gate, ok := g.gates[*start]; ok {
+		<-gate
+	}
+	return &trackedBody{Reader: strings.NewReader("data"), start: *start, closed: g.closed}, nil
+}
+
+func (g *gatedBatcher) FetchRanges(_ context.Context, _ []remote.Range) ([][]byte, error) {
+	return nil, remote.ErrBatchUnsupported
+}
+
+func TestBatchingFetcher_CancelledRead(t *testing.T) {
+	g := &gatedBatcher{
+		gates:   map[int64]chan struct{}{0: make(chan struct{}), 100: make(chan struct{})},
+		entered: make(chan int64, 10),
+		closed:  make(chan int64, 10),
+	}
+	f := remote.BatchingFetcher(g)
+	read := func(ctx context.Context, start int64) (io.ReadCloser, error) {
+		end := start + 3
+		return f.Fetch(ctx, &start, &end)
+	}
+	results := make(chan error, 3)
+	go func() {
+		rc, err := read(context.Background(), 0)
+		if err == nil {
+			_ = rc.Close()
+		}
+		results <- err
+	}()
+	<-g.entered
+	// while the first read is in flight, the next two pile up in a batch
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_, err := read(ctx, 100)
+		results <- err
+	}()
+	go func() {
+		rc, err := read(context.Background(), 200)
+		if err == nil {
+			_ = rc.Close()
+		}
+		results <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(g.gates[0])
+
+	// cancel the read of 100 while the batch fetches it, then let it finish
+	for started := <-g.entered; started != 100; started = <-g.entered {
+	}
+	cancel()
+	for i := 0; i < 3; i++ {
+		err := <-results
+		if errors.Is(err, context.Canceled) {
+			// the read fetched for the cancelled caller only finishes once it gave up
+			close(g.gates[100])
+		} else if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	closed := map[int64]bool{}
+	for len(closed) < 3 {
+		select {
+		case start := <-g.closed:
+			closed[start] = true
+		case <-time.After(time.Second):
+			t.Fatalf("expected the bodies of all reads to be closed, closed: %v", closed)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultBlockSize is the size of the blocks BlockCachingFetcher keeps, if not set
+const DefaultBlockSize = 1 << 20
+
+// BlockCache keeps the blocks read through it in dir, see BlockCachingFetcher
+func BlockCache(dir string, blockSize int64) Middleware {
+	return func(next Fetcher) Fetcher {
+		return BlockCachingFetcher(next, dir, blockSize)
+	}
+}
+
+// BlockCachingFetcher wraps a Fetcher of a single object, keeping the blocks of blockSize bytes it reads in dir,
+// one file per block. A read is served from the cached blocks it covers, and the blocks it's missing are fetched
+// from next with a single ranged request per contiguous run of missing blocks, aligned to block boundaries so that
+// whole blocks are kept. Cached and fetched data is stitched in order, fetching each run only once it's reached.
+//
+// A block shorter than blockSize is the last block of the object: reads past it end there.
+// Reads without both a start and an end offset aren't cached, as their blocks aren't known in advance.
+// dir must not be shared between objects, and blocks are kept as they are: they aren't encrypted, nor revalidated.
+func BlockCachingFetcher(f Fetcher, dir string, blockSize int64) Fetcher {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	return &blockCachingFetcher{next: f, dir: dir, blockSize: blockSize}
+}
+
+type blockCachingFetcher struct {
+	next      Fetcher
+	dir       string
+	blockSize int64
+}
+
+// blockRun is a run of consecutive blocks, either all cached or all missing
+type blockRun struct {
+	first, last int64
+	cached      bool
+}
+
+func (b *blockCachingFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	if startOffset == nil || endOffset == nil || *startOffset < 0 || *endOffset < *startOffset {
+		return b.next.Fetch(ctx, startOffset, endOffset)
+	}
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create block cache directory: %w", err)
+	}
+	start, end := *startOffset, *endOffset
+	var runs []blockRun
+	for block := start / b.blockSize; block <= end/b.blockSize; block++ {
+		_, err := os.Stat(b.blockPath(block))
+		cached := err == nil
+		if len(runs) > 0 && runs[len(runs)-1].cached == cached {
+			runs[len(runs)-1].last = block
+		} else {
+			runs = append(runs, blockRun{first: block, last: block, cached: cached})
+		}
+	}
+	r := &blockReader{b: b, ctx: ctx, runs: runs, offset: start, end: end}
+	// fill the first block, so that errors such as a missing object are returned by Fetch
+	if err := r.nextBlock(); errors.Is(err, io.EOF) {
+		r.err = err
+	} else if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (b *blockCachingFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return SizeOf(ctx, b.next)
+}
+
+func (b *blockCachingFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	return StoredChecksum(ctx, b.next, algorithm)
+}
+
+func (b *blockCachingFetcher) ETag(ctx context.Context) (string, error) {
+	return ETagOf(ctx, b.next)
+}
+
+func (b *blockCachingFetcher) blockPath(block int64) string {
+	return filepath.Join(b.dir, strconv.FormatInt(block, 10))
+}
+
+// readBlock returns the content of a cached block
+func (b *blockCachingFetcher) readBlock(block int64) ([]byte, error) {
+	data, err := os.ReadFile(b.blockPath(block))
+	if err != nil {
+		return nil, fmt.Errorf("could not read cached block %d: %w", block, err)
+	}
+	return data, nil
+}
+
+// writeBlock caches the content of a block. It's written to a temporary file first, so that concurrent readers only
+// ever see whole blocks.
+func (b *blockCachingFetcher) writeBlock(block int64, data []byte) error {
+	out, err := os.CreateTemp(b.dir, strconv.FormatInt(block, 10)+"-w*")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), b.blockPath(block))
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+	}
+	return err
+}
+
+// blockReader reads the range offset-end one block at a time, from the cache or from the run being fetched
+type blockReader struct {
+	b      *blockCachingFetcher
+	ctx    context.Context
+	runs   []blockRun
+	offset int64
+	end    int64
+	// buf is what's left to read of the current block
+	buf []byte
+	err error
+	// fetching is the response to the request for the missing run being read
+	fetching io.ReadCloser
+}
+
+// nextBlock fills buf with the part of the next block that is within the range
+func (r *blockReader) nextBlock() error {
+	if r.offset > r.end || len(r.runs) == 0 {
+		return io.EOF
+	}
+	run := r.runs[0]
+	block := r.offset / r.b.blockSize
+	var data []byte
+	var err error
+	if run.cached {
+		data, err = r.b.readBlock(block)
+	} else {
+		data, err = r.fetchBlock(run, block)
+	}
+	if err != nil {
+		return err
+	}
+	if block == run.last {
+		r.runs = r.runs[1:]
+		r.finishFetching()
+	}
+	blockStart := block * r.b.blockSize
+	if int64(len(data)) < r.b.blockSize {
+		// the last block of the object
+		r.runs = nil
+		r.finishFetching()
+	}
+	from := r.offset - blockStart
+	to := min(int64(len(data)), r.end-blockStart+1)
+	if from >= to {
+		return io.EOF
+	}
+	r.buf = data[from:to]
+	r.offset = blockStart + to
+	return nil
+}
+
+// fetchBlock reads block from the request for run, issuing it when the run is reached, and caches it
+func (r *blockReader) fetchBlock(run blockRun, block int64) ([]byte, error) {
+	if r.fetching == nil {
+		start, end := run.first*r.b.blockSize, (run.last+1)*r.b.blockSize-1
+		rc, err := r.b.next.Fetch(r.ctx, &start, &end)
+		if err != nil {
+			return nil, err
+		}
+		r.fetching = rc
+	}
+	data := make([]byte, r.b.blockSize)
+	n, err := io.ReadFull(r.fetching, data)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("could not read block %d: %w", block, err)
+	}
+	data = data[:n]
+	if int64(n) < r.b.blockSize {
+		// a short block is only kept as the last block of the object, not if the response was cut short
+		blockEnd := block*r.b.blockSize + int64(n)
+		if size, err := SizeOf(r.ctx, r.b.next); err == nil && size > blockEnd {
+			return nil, fmt.Errorf("could not read block %d: %w", block, io.ErrUnexpectedEOF)
+		}
+	}
+	if n > 0 {
+		if err := r.b.writeBlock(block, data); err != nil {
+			return nil, fmt.Errorf("could not cache block %d: %w", block, err)
+		}
+	}
+	return data, nil
+}
+
+// finishFetching drops the response to the request for a run that was read entirely. It's drained rather than closed:
+// closing a local fetcher's reader closes the underlying file, while reading an HTTP body to EOF is enough
+// to release its connection.
+func (r *blockReader) finishFetching() {
+	if r.fetching != nil {
+		_, _ = io.Copy(io.Discard, r.fetching)
+		r.fetching = nil
+	}
+}
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.nextBlock()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close aborts the request for the run being read, if any
+func (r *blockReader) Close() error {
+	if r.fetching != nil {
+		err := r.fetching.Close()
+		r.fetching = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// rangeRecorder serves ranges of data, recording the ranges requested
+type rangeRecorder struct {
+	data      []byte
+	requested []string
+	// truncateAt cuts responses short at this offset, as a dropped connection would (if set)
+	truncateAt int64
+}
+
+func (f *rangeRecorder) Fetch(_ context.Context, start *int64, end *int64) (io.ReadCloser, error) {
+	f.requested = append(f.requested, fmt.Sprintf("%d-%d", *start, *end))
+	size := int64(len(f.data))
+	if f.truncateAt > 0 {
+		size = f.truncateAt
+	}
+	from, to := min(*start, size), min(*end+1, size)
+	return io.NopCloser(bytes.NewReader(f.data[from:to])), nil
+}
+
+func (f *rangeRecorder) SizeOf(_ context.Context) (int64, error) {
+	return int64(len(f.data)), nil
+}
+
+func TestBlockCachingFetcher(t *testing.T) {
+	data := make([]byte, 1050)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	read := func(t *testing.T, f remote.Fetcher, start, end int64) {
+		t.Helper()
+		rc, err := f.Fetch(context.Background(), &start, &end)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := data[min(start, int64(len(data))):min(end+1, int64(len(data)))]
+		if !bytes.Equal(got, expected) {
+			t.Errorf("expected %d bytes from offset %d, got %d different bytes", len(expected), start, len(got))
+		}
+	}
+
+	cases := []struct {
+		name string
+		// warm are the ranges read before, with the blocks of 100 bytes they cache
+		warm       [][2]int64
+		start, end int64
+		requested  []string
+	}{
+		{"cold", nil, 150, 420, []string{"100-499"}},
+		{"cached", [][2]int64{{100, 499}}, 150, 420, nil},
+		{"cached_prefix", [][2]int64{{0, 199}}, 150, 420, []string{"200-499"}},
+		{"cached_suffix", [][2]int64{{300, 499}}, 150, 420, []string{"100-299"}},
+		{"gaps", [][2]int64{{200, 299}, {500, 599}}, 50, 750, []string{"0-199", "300-499", "600-799"}},
+		{"last_block", [][2]int64{{1000, 1099}}, 950, 2000, []string{"900-999"}},
+		{"past_the_end", nil, 1020, 1500, []string{"1000-1599"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			next := &rangeRecorder{data: data}
+			f := remote.BlockCachingFetcher(next, dir, 100)
+			for _, r := range c.warm {
+				read(t, f, r[0], r[1])
+			}
+			next.requested = nil
+			read(t, f, c.start, c.end)
+			if fmt.Sprint(next.requested) != fmt.Sprint(c.requested) {
+				t.Errorf("expected requests %v, got %v", c.requested, next.requested)
+			}
+			// everything read is now cached
+			next.requested = nil
+			read(t, f, c.start, c.end)
+			if len(next.requested) > 0 {
+				t.Errorf("expected the range to be served from the cache, got requests %v", next.requested)
+			}
+		})
+	}
+
+	t.Run("local", func(t *testing.T) {
+		// closing a local fetcher's reader closes its file, so runs read entirely must not be closed
+		path := filepath.Join(t.TempDir(), "data")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		next, err := remote.NewLocalFetcher("file://" + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f := remote.BlockCachingFetcher(next, t.TempDir(), 100)
+		read(t, f, 150, 250)
+		read(t, f, 0, 1049)
+	})
+
+	t.Run("truncated_response", func(t *testing.T) {
+		dir := t.TempDir()
+		next := &rangeRecorder{data: data, truncateAt: 250}
+		f := remote.BlockCachingFetcher(next, dir, 100)
+		start, end := int64(0), int64(499)
+		rc, err := f.Fetch(context.Background(), &start, &end)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := io.ReadAll(rc); err == nil {
+			t.Error("expected reading a truncated response to fail")
+		}
+		_ = rc.Close()
+		if _, err := os.Stat(filepath.Join(dir, "2")); !os.IsNotExist(err) {
+			t.Errorf("expected the partial block not to be cached, got %v", err)
+		}
+	})
+}
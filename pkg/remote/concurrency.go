@@ -0,0 +1,141 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// throttledMaxAttempts is the number of times a throttled request is attempted before giving up
+	throttledMaxAttempts = 4
+	throttledBaseBackoff = 100 * time.Millisecond
+)
+
+// ConcurrencyLimiter bounds the number of in-flight requests, adapting the bound to throttling:
+// it is halved whenever the backend throttles a request (e.g. S3 SlowDown or HTTP 503),
+// and grows by one after a full window of successful requests, between min and max.
+type ConcurrencyLimiter struct {
+	mu        sync.Mutex
+	min, max  int
+	limit     int
+	inFlight  int
+	successes int
+	// wake is closed (and replaced) whenever a slot may have become available
+	wake chan struct{}
+}
+
+func NewConcurrencyLimiter(minConcurrency, maxConcurrency int) *ConcurrencyLimiter {
+	minConcurrency = max(minConcurrency, 1)
+	maxConcurrency = max(maxConcurrency, minConcurrency)
+	return &ConcurrencyLimiter{
+		min:   minConcurrency,
+		max:   maxConcurrency,
+		limit: maxConcurrency,
+		wake:  make(chan struct{}),
+	}
+}
+
+// Limit returns the current bound on in-flight requests
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *ConcurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *ConcurrencyLimiter) release(throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if throttled {
+		l.limit = max(l.limit/2, l.min)
+		l.successes = 0
+	} else {
+		l.successes++
+		if l.successes >= l.limit {
+			l.limit = min(l.limit+1, l.max)
+			l.successes = 0
+		}
+	}
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// AdaptiveFetcher wraps a Fetcher, bounding its concurrency with l and retrying throttled requests with backoff
+func AdaptiveFetcher(f Fetcher, l *ConcurrencyLimiter) Fetcher {
+	return &adaptiveFetcher{next: f, limiter: l}
+}
+
+type adaptiveFetcher struct {
+	next    Fetcher
+	limiter *ConcurrencyLimiter
+}
+
+func (a *adaptiveFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	var err error
+	for attempt := 0; attempt < throttledMaxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepWithBackoff(ctx, attempt); err != nil {
+				return nil, err
+			}
+		}
+		if err := a.limiter.acquire(ctx); err != nil {
+			return nil, err
+		}
+		rc, err = a.next.Fetch(ctx, startOffset, endOffset)
+		throttled := errors.Is(err, ErrThrottled)
+		a.limiter.release(throttled)
+		if !throttled {
+			break
+		}
+	}
+	return rc, err
+}
+
+func (a *adaptiveFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return SizeOf(ctx, a.next)
+}
+
+func (a *adaptiveFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	return StoredChecksum(ctx, a.next, algorithm)
+}
+
+func (a *adaptiveFetcher) ETag(ctx context.Context) (string, error) {
+	return ETagOf(ctx, a.next)
+}
+
+// sleepWithBackoff waits an exponentially growing, jittered duration before the given attempt
+func sleepWithBackoff(ctx context.Context, attempt int) error {
+	backoff := throttledBaseBackoff << (attempt - 1)
+	backoff += time.Duration(rand.Int63n(int64(backoff)))
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
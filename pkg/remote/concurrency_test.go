@@ -0,0 +1,94 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// throttlingFetcher throttles its first `throttle` requests, and tracks the peak number of concurrent requests
+type throttlingFetcher struct {
+	throttle atomic.Int64
+	inFlight atomic.Int64
+	peak     atomic.Int64
+}
+
+func (f *throttlingFetcher) Fetch(_ context.Context, _ *int64, _ *int64) (io.ReadCloser, error) {
+	current := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		peak := f.peak.Load()
+		if current <= peak || f.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	if f.throttle.Add(-1) >= 0 {
+		return nil, remote.ErrThrottled
+	}
+	return io.NopCloser(strings.NewReader("data")), nil
+}
+
+func TestAdaptiveFetcher(t *testing.T) {
+	t.Run("bounded concurrency", func(t *testing.T) {
+		next := &throttlingFetcher{}
+		limiter := remote.NewConcurrencyLimiter(1, 3)
+		f := remote.AdaptiveFetcher(next, limiter)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if next.peak.Load() > 3 {
+			t.Errorf("expected at most 3 concurrent requests, got %d", next.peak.Load())
+		}
+	})
+
+	t.Run("throttling reduces concurrency and retries", func(t *testing.T) {
+		next := &throttlingFetcher{}
+		next.throttle.Store(2)
+		limiter := remote.NewConcurrencyLimiter(2, 16)
+		f := remote.AdaptiveFetcher(next, limiter)
+		if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+			t.Fatalf("expected throttled request to be retried, got %v", err)
+		}
+		if limiter.Limit() != 4 {
+			t.Errorf("expected limit to be halved twice to 4, got %d", limiter.Limit())
+		}
+		for i := 0; i < 4; i++ {
+			if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if limiter.Limit() != 5 {
+			t.Errorf("expected limit to grow to 5 after a window of successes, got %d", limiter.Limit())
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		next := &throttlingFetcher{}
+		next.throttle.Store(100)
+		limiter := remote.NewConcurrencyLimiter(1, 4)
+		f := remote.AdaptiveFetcher(next, limiter)
+		_, err := f.Fetch(context.Background(), nil, nil)
+		if !errors.Is(err, remote.ErrThrottled) {
+			t.Errorf("expected ErrThrottled, got %v", err)
+		}
+		if limiter.Limit() != 1 {
+			t.Errorf("expected limit to drop to the minimum, got %d", limiter.Limit())
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// credentialsExpiryWindow refreshes credentials slightly before they expire, to avoid using them mid-expiry
+const credentialsExpiryWindow = time.Minute
+
+var (
+	ErrCredentialsCommand = errors.New("credentials command failed")
+)
+
+// Credentials are returned as JSON on stdout by a credentials command.
+// S3 fetchers use the AWS keys, HTTP fetchers send Authorization and any additional Headers.
+// Credentials without an expiration are cached for the lifetime of the process.
+type Credentials struct {
+	AccessKeyId     string            `json:"access_key_id,omitempty"`
+	SecretAccessKey string            `json:"secret_access_key,omitempty"`
+	SessionToken    string            `json:"session_token,omitempty"`
+	Authorization   string            `json:"authorization,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Expiration      *time.Time        `json:"expiration,omitempty"`
+}
+
+func (c *Credentials) expired(now time.Time) bool {
+	return c.Expiration != nil && !now.Add(credentialsExpiryWindow).Before(*c.Expiration)
+}
+
+// CredentialsCommand obtains credentials by executing an external helper command,
+// similar to git's credential helpers. Results are cached until they expire.
+type CredentialsCommand struct {
+	command string
+
+	mu     sync.Mutex
+	cached *Credentials
+}
+
+func NewCredentialsCommand(command string) *CredentialsCommand {
+	return &CredentialsCommand{command: command}
+}
+
+// Credentials returns the cached credentials, running the command if there are none or they have expired
+func (c *CredentialsCommand) Credentials(ctx context.Context) (*Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached != nil && !c.cached.expired(time.Now()) {
+		return c.cached, nil
+	}
+	creds, err := c.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.cached = creds
+	return creds, nil
+}
+
+// Invalidate drops the cached credentials, so the command runs again on next use
+func (c *CredentialsCommand) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cached = nil
+}
+
+func (c *CredentialsCommand) run(ctx context.Context) (*Credentials, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", c.command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.command)
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v: %s", ErrCredentialsCommand, err, strings.TrimSpace(stderr.String()))
+	}
+	creds := &Credentials{}
+	if err := json.Unmarshal(out, creds); err != nil {
+		return nil, fmt.Errorf("%w: invalid output: %v", ErrCredentialsCommand, err)
+	}
+	return creds, nil
+}
+
+// Retrieve implements aws.CredentialsProvider
+func (c *CredentialsCommand) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := c.Credentials(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	if creds.AccessKeyId == "" || creds.SecretAccessKey == "" {
+		return aws.Credentials{}, fmt.Errorf("%w: no AWS credentials returned", ErrCredentialsCommand)
+	}
+	awsCreds := aws.Credentials{
+		AccessKeyID:     creds.AccessKeyId,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Source:          "CredentialsCommand",
+	}
+	if creds.Expiration != nil {
+		awsCreds.CanExpire = true
+		awsCreds.Expires = *creds.Expiration
+	}
+	return awsCreds, nil
+}
+
+// authorize sets the headers returned by the command on an HTTP request
+func (c *CredentialsCommand) authorize(req *http.Request) error {
+	creds, err := c.Credentials(req.Context())
+	if err != nil {
+		return err
+	}
+	for k, v := range creds.Headers {
+		req.Header.Set(k, v)
+	}
+	if creds.Authorization != "" {
+		req.Header.Set("Authorization", creds.Authorization)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestCredentialsCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credentials test command requires a POSIX shell")
+	}
+	counter := filepath.Join(t.TempDir(), "calls")
+	helper := func(expiration time.Time) string {
+		return fmt.Sprintf(`echo x >> %s; echo '{"authorization": "Bearer secret", "expiration": "%s"}'`,
+			counter, expiration.Format(time.RFC3339))
+	}
+	calls := func() int {
+		data, _ := os.ReadFile(counter)
+		return len(data) / 2
+	}
+
+	t.Run("cached until expiry", func(t *testing.T) {
+		_ = os.Remove(counter)
+		cmd := remote.NewCredentialsCommand(helper(time.Now().Add(time.Hour)))
+		for i := 0; i < 3; i++ {
+			creds, err := cmd.Credentials(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if creds.Authorization != "Bearer secret" {
+				t.Errorf("unexpected authorization: %s", creds.Authorization)
+			}
+		}
+		if calls() != 1 {
+			t.Errorf("expected command to run once, ran %d times", calls())
+		}
+	})
+
+	t.Run("refreshed when expired", func(t *testing.T) {
+		_ = os.Remove(counter)
+		cmd := remote.NewCredentialsCommand(helper(time.Now().Add(-time.Hour)))
+		for i := 0; i < 2; i++ {
+			if _, err := cmd.Credentials(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if calls() != 2 {
+			t.Errorf("expected command to run twice, ran %d times", calls())
+		}
+	})
+
+	t.Run("failing command", func(t *testing.T) {
+		cmd := remote.NewCredentialsCommand("echo nope >&2; exit 1")
+		_, err := cmd.Credentials(context.Background())
+		if !errors.Is(err, remote.ErrCredentialsCommand) {
+			t.Errorf("expected ErrCredentialsCommand, got %v", err)
+		}
+	})
+
+	t.Run("http fetcher", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("hello"))
+		}))
+		defer server.Close()
+		f, err := remote.Object(server.URL, remote.WithCredentialsCommand(
+			remote.NewCredentialsCommand(helper(time.Now().Add(time.Hour)))))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		reader, err := f.Fetch(context.Background(), nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = reader.Close() }()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(data) != "hello" {
+			t.Errorf("unexpected response: %s", data)
+		}
+	})
+}
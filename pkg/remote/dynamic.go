@@ -1,6 +1,7 @@
 package remote
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -16,8 +17,13 @@ func DummyLogger() *slog.Logger {
 
 type ObjectOpt func(f Fetcher)
 
+// WithLogger sets the logger used to report on requests made by the fetcher.
+// Fetchers discard their logs by default; a nil logger keeps the default.
 func WithLogger(logger *slog.Logger) ObjectOpt {
 	return func(f Fetcher) {
+		if logger == nil {
+			return
+		}
 		if lf, ok := f.(CanSetLogger); ok {
 			lf.setLogger(logger)
 		}
@@ -29,7 +35,130 @@ type CanSetLogger interface {
 	setLogger(logger *slog.Logger)
 }
 
+// WithCredentialsCommand authenticates S3 and HTTP requests using credentials returned by cmd
+func WithCredentialsCommand(cmd *CredentialsCommand) ObjectOpt {
+	return func(f Fetcher) {
+		if cf, ok := f.(CanSetCredentials); ok {
+			cf.setCredentials(cmd)
+		}
+	}
+}
+
+type CanSetCredentials interface {
+	Fetcher
+	setCredentials(cmd *CredentialsCommand)
+}
+
+// WithS3AddressingStyle overrides the SDK's choice of path-style or virtual-hosted-style requests for S3 objects
+func WithS3AddressingStyle(style S3AddressingStyle) ObjectOpt {
+	return func(f Fetcher) {
+		if sf, ok := f.(*S3ObjectFetcher); ok {
+			sf.setS3AddressingStyle(style)
+		}
+	}
+}
+
+// WithS3Accelerate reads S3 objects through S3 Transfer Acceleration, which must be enabled on the bucket.
+// Other backends ignore it.
+func WithS3Accelerate() ObjectOpt {
+	return func(f Fetcher) {
+		if sf, ok := f.(*S3ObjectFetcher); ok {
+			sf.setS3Accelerate()
+		}
+	}
+}
+
+// WithS3DualStack reads S3 objects through dualstack endpoints, which are reachable over IPv6 as well as IPv4.
+// Other backends ignore it.
+func WithS3DualStack() ObjectOpt {
+	return func(f Fetcher) {
+		if sf, ok := f.(*S3ObjectFetcher); ok {
+			sf.setS3DualStack()
+		}
+	}
+}
+
+// WithS3Provider reads S3 objects from an S3 compatible service, using its preset endpoint, region and addressing style.
+// Other backends ignore it.
+func WithS3Provider(provider S3Provider) ObjectOpt {
+	return func(f Fetcher) {
+		if sf, ok := f.(*S3ObjectFetcher); ok {
+			sf.setS3Provider(provider)
+		}
+	}
+}
+
+// WithS3Endpoint reads S3 objects through endpoint, in the region configured for the AWS SDK, rather than through
+// AWS's endpoint for the bucket's region. Other backends ignore it.
+func WithS3Endpoint(endpoint string) ObjectOpt {
+	return func(f Fetcher) {
+		if sf, ok := f.(*S3ObjectFetcher); ok {
+			sf.setS3Endpoint(endpoint)
+		}
+	}
+}
+
+// WithHttpRangeStyle changes how HTTP(S) objects are requested, for servers that don't support Range headers
+func WithHttpRangeStyle(style HttpRangeStyle) ObjectOpt {
+	return func(f Fetcher) {
+		if hf, ok := f.(canSetHttpRangeStyle); ok {
+			hf.setHttpRangeStyle(style)
+		}
+	}
+}
+
+type canSetHttpRangeStyle interface {
+	setHttpRangeStyle(style HttpRangeStyle)
+}
+
+// WithHttpTimeouts replaces DefaultHttpTimeouts for HTTP(S) objects (including those read through an IPFS gateway)
+func WithHttpTimeouts(timeouts HttpTimeouts) ObjectOpt {
+	return func(f Fetcher) {
+		if hf, ok := f.(canSetHttpTimeouts); ok {
+			hf.setHttpTimeouts(timeouts)
+		}
+	}
+}
+
+type canSetHttpTimeouts interface {
+	setHttpTimeouts(timeouts HttpTimeouts)
+}
+
+// WithDialer opens the connections of requests through dialer, such as an SSHTunnel, rather than directly.
+// Local files are read as usual.
+func WithDialer(dialer Dialer) ObjectOpt {
+	return func(f Fetcher) {
+		if df, ok := f.(canSetDialer); ok {
+			df.setDialer(dialer)
+		}
+	}
+}
+
+type canSetDialer interface {
+	setDialer(dialer Dialer)
+}
+
+// WithIpfsGateway reads ipfs:// objects through the HTTP gateway at the given base URL, rather than DefaultIpfsGateway
+func WithIpfsGateway(gateway string) ObjectOpt {
+	return func(f Fetcher) {
+		if ipf, ok := f.(*IpfsFetcher); ok {
+			ipf.setIpfsGateway(gateway)
+		}
+	}
+}
+
+// Object opens the object at uri, through its fallback paths if it has any (see SetFallbackPaths)
 func Object(uri string, opts ...ObjectOpt) (Fetcher, error) {
+	fallbackPathsMu.RLock()
+	paths := fallbackPaths.lookup(uri)
+	fallbackPathsMu.RUnlock()
+	if len(paths) > 0 {
+		return openFallbacks(uri, paths, opts)
+	}
+	return object(uri, opts...)
+}
+
+func object(uri string, opts ...ObjectOpt) (Fetcher, error) {
 	f, err := getObject(uri)
 	if err != nil {
 		return nil, err
@@ -37,9 +166,28 @@ func Object(uri string, opts ...ObjectOpt) (Fetcher, error) {
 	for _, opt := range opts {
 		opt(f)
 	}
+	if c, ok := f.(canConnect); ok {
+		if err := c.connect(context.Background()); err != nil {
+			return nil, err
+		}
+	}
 	return f, nil
 }
 
+// canConnect is implemented by fetchers that set up their client once all options are applied
+type canConnect interface {
+	connect(ctx context.Context) error
+}
+
+// SupportedScheme returns whether objects with URIs of the given scheme can be opened by Object
+func SupportedScheme(scheme string) bool {
+	switch scheme {
+	case "s3", "S3", "s3a", "local", "file", "http", "https", "kaggle", "lakefs", "ipfs", "swift", "gs", "az", "wasbs", "sftp":
+		return true
+	}
+	return false
+}
+
 func getObject(uri string) (Fetcher, error) {
 	parsed, err := url.Parse(uri)
 	if err != nil {
@@ -47,7 +195,7 @@ func getObject(uri string) (Fetcher, error) {
 	}
 	switch parsed.Scheme {
 	case "s3", "S3", "s3a":
-		return NewS3ObjectFetcher(uri)
+		return newS3ObjectFetcher(uri)
 	case "local", "file":
 		return NewLocalFetcher(uri)
 	case "http", "https":
@@ -55,7 +203,17 @@ func getObject(uri string) (Fetcher, error) {
 	case "kaggle":
 		return NewKaggleFetcher(uri)
 	case "lakefs":
-		return NewLakeFSFetcher(uri)
+		return newLakeFSFetcher(uri), nil
+	case "ipfs":
+		return NewIpfsFetcher(uri)
+	case "swift":
+		return NewSwiftFetcher(uri)
+	case "gs":
+		return NewGCSFetcher(uri)
+	case "az", "wasbs":
+		return NewAzureFetcher(uri)
+	case "sftp":
+		return NewSFTPFetcher(uri)
 	}
 
 	return nil, fmt.Errorf("%w: unknown scheme: %s", ErrInvalidURI, parsed.Scheme)
@@ -1,8 +1,54 @@
 package remote
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
 var (
-	ErrInvalidURI   = errors.New("invalid URI")
-	ErrDoesNotExist = errors.New("object does not exist")
+	ErrInvalidURI        = errors.New("invalid URI")
+	ErrUnresolvedURI     = errors.New("could not resolve URI")
+	ErrDoesNotExist      = errors.New("object does not exist")
+	ErrSizeUnsupported   = errors.New("cannot determine object size")
+	ErrInvalidS3Config   = errors.New("invalid S3 configuration")
+	ErrInvalidHttpConfig = errors.New("invalid HTTP configuration")
+	ErrClockSkew         = errors.New("clock skew")
+	ErrThrottled         = errors.New("request throttled")
+	ErrNoStoredChecksum  = errors.New("checksum not stored")
+	ErrAccessDenied      = errors.New("access denied")
+	ErrContentEncoded    = errors.New("response is content-encoded")
+	ErrBadSignature      = errors.New("bad signature")
+	ErrSSHTunnel         = errors.New("could not connect through SSH")
+	ErrBatchUnsupported  = errors.New("ranges can't be fetched at once")
+	ErrNoETag            = errors.New("object has no ETag")
+	ErrRangeIgnored      = errors.New("range request ignored")
 )
+
+// httpStatusError returns the error the status code of a response to op stands for, or nil for a success status.
+// Rejected credentials (401) are reported with authErr, the authentication error of the backend.
+func httpStatusError(op string, code int, authErr error) error {
+	status := fmt.Sprintf("%d %s", code, http.StatusText(code))
+	switch {
+	case code == http.StatusNotFound:
+		return ErrDoesNotExist
+	case code == http.StatusServiceUnavailable || code == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", ErrThrottled, status)
+	case code == http.StatusUnauthorized:
+		return fmt.Errorf("%w: %s returned %s", authErr, op, status)
+	case code == http.StatusForbidden:
+		return fmt.Errorf("%w: %s returned %s", ErrAccessDenied, op, status)
+	case code < 200 || code > 299:
+		return fmt.Errorf("%s: %s", op, status)
+	}
+	return nil
+}
+
+// checkResponse turns error responses into errors (see httpStatusError), closing their body
+func checkResponse(op string, response *http.Response, authErr error) error {
+	err := httpStatusError(op, response.StatusCode, authErr)
+	if err != nil {
+		_ = response.Body.Close()
+	}
+	return err
+}
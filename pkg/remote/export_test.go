@@ -0,0 +1,4 @@
+package remote
+
+// AzureAllowHTTPTokens lets tests send Entra tokens to their plain HTTP servers
+var AzureAllowHTTPTokens = &azureAllowHTTPTokens
@@ -0,0 +1,243 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FallbackPath is a way to reach an object, through a backend configured differently from the default
+// (e.g. a private S3 endpoint), or under another URI (e.g. the public HTTPS URL of an S3 object)
+type FallbackPath struct {
+	// URI of the object, if not the URI being opened. For paths of a prefix, the prefix they map it to.
+	URI string `yaml:"uri"`
+	// Endpoint is the endpoint S3 objects are read through (see WithS3Endpoint)
+	Endpoint string `yaml:"endpoint"`
+	// Provider is a preset for an S3 compatible service (see WithS3Provider)
+	Provider S3Provider `yaml:"provider"`
+	// AddressingStyle is the S3 addressing style (see WithS3AddressingStyle)
+	AddressingStyle S3AddressingStyle `yaml:"s3-addressing-style"`
+	// RangeStyle is how ranges are requested from HTTP(S) servers (see WithHttpRangeStyle)
+	RangeStyle HttpRangeStyle `yaml:"http-range-style"`
+}
+
+// String describes the path in logs, as its URI and the endpoint it's read through, if any
+func (p FallbackPath) String() string {
+	if p.Endpoint == "" {
+		return p.URI
+	}
+	return fmt.Sprintf("%s via %s", p.URI, p.Endpoint)
+}
+
+// objectOpts returns the options p sets, on top of the options objects are opened with
+func (p FallbackPath) objectOpts() []ObjectOpt {
+	var opts []ObjectOpt
+	if p.Provider != "" {
+		opts = append(opts, WithS3Provider(p.Provider))
+	}
+	if p.Endpoint != "" {
+		opts = append(opts, WithS3Endpoint(p.Endpoint))
+	}
+	if p.AddressingStyle != "" {
+		opts = append(opts, WithS3AddressingStyle(p.AddressingStyle))
+	}
+	if p.RangeStyle != "" {
+		opts = append(opts, WithHttpRangeStyle(p.RangeStyle))
+	}
+	return opts
+}
+
+// FallbackPaths maps URIs to the paths objects are read through, in order of preference: each path is tried
+// in turn, falling back to the next one when a request fails. Keys are matched exactly, except for keys ending
+// with "/", which apply to every URI they prefix (the longest such key wins), as with URIMap.
+type FallbackPaths map[string][]FallbackPath
+
+var (
+	fallbackPaths   FallbackPaths
+	fallbackPathsMu sync.RWMutex
+)
+
+// SetFallbackPaths has Object open the URIs in paths through their fallback paths
+func SetFallbackPaths(paths FallbackPaths) {
+	fallbackPathsMu.Lock()
+	defer fallbackPathsMu.Unlock()
+	fallbackPaths = paths
+}
+
+// LoadFallbackPaths reads FallbackPaths from a YAML file mapping URIs to lists of paths
+func LoadFallbackPaths(path string) (FallbackPaths, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	paths := FallbackPaths{}
+	if err := yaml.Unmarshal(data, &paths); err != nil {
+		return nil, fmt.Errorf("could not parse fallback paths %s: %w", path, err)
+	}
+	for uri, uriPaths := range paths {
+		for _, p := range uriPaths {
+			if err := p.validate(); err != nil {
+				return nil, fmt.Errorf("invalid fallback path for %s: %w", uri, err)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func (p FallbackPath) validate() error {
+	if p.Provider != "" {
+		if _, err := ParseS3Provider(string(p.Provider)); err != nil {
+			return err
+		}
+	}
+	if p.AddressingStyle != "" {
+		if _, err := ParseS3AddressingStyle(string(p.AddressingStyle)); err != nil {
+			return err
+		}
+	}
+	if p.RangeStyle != "" {
+		if _, err := ParseHttpRangeStyle(string(p.RangeStyle)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the paths of uri, with their URIs filled in
+func (m FallbackPaths) lookup(uri string) []FallbackPath {
+	key, ok := uri, false
+	if _, ok = m[uri]; !ok {
+		key = ""
+		for prefix := range m {
+			if strings.HasSuffix(prefix, "/") && strings.HasPrefix(uri, prefix) && len(prefix) > len(key) {
+				key, ok = prefix, true
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+	paths := make([]FallbackPath, len(m[key]))
+	for i, p := range m[key] {
+		switch {
+		case p.URI == "":
+			p.URI = uri
+		case key != uri:
+			p.URI += strings.TrimPrefix(uri, key)
+		}
+		paths[i] = p
+	}
+	return paths
+}
+
+// openFallbacks opens uri through each of paths, skipping paths that can't be opened (e.g. their S3 client
+// can't be created), unless none can
+func openFallbacks(uri string, paths []FallbackPath, opts []ObjectOpt) (Fetcher, error) {
+	f := &fallbackFetcher{uri: uri, logger: DummyLogger()}
+	f.lastServed.Store(-1)
+	for _, opt := range opts {
+		opt(f)
+	}
+	var errs []error
+	for _, p := range paths {
+		obj, err := object(p.URI, append(append([]ObjectOpt{}, opts...), p.objectOpts()...)...)
+		if err != nil {
+			f.logger.Warn("could not open fallback path, skipping it", "uri", uri, "path", p.String(), "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		f.paths = append(f.paths, obj)
+		f.names = append(f.names, p.String())
+	}
+	if len(f.paths) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return f, nil
+}
+
+// fallbackFetcher reads an object through the first of its paths a request succeeds with
+type fallbackFetcher struct {
+	uri    string
+	paths  []Fetcher
+	names  []string
+	logger *slog.Logger
+	// lastServed is the index of the path the last successful request went through, so that a change is logged
+	lastServed atomic.Int64
+}
+
+func (f *fallbackFetcher) setLogger(logger *slog.Logger) {
+	f.logger = logger
+}
+
+// try calls fn with each path in turn, until it succeeds
+func (f *fallbackFetcher) try(ctx context.Context, op string, fn func(path Fetcher) error) error {
+	var err error
+	for i, path := range f.paths {
+		if err = fn(path); err == nil {
+			if f.lastServed.Swap(int64(i)) != int64(i) {
+				f.logger.InfoContext(ctx, "reading through path", "uri", f.uri, "path", f.names[i], "preference", i+1)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if i < len(f.paths)-1 {
+			f.logger.WarnContext(ctx, "request failed, falling back to the next path", "op", op, "uri", f.uri,
+				"path", f.names[i], "next_path", f.names[i+1], "error", err)
+		}
+	}
+	return err
+}
+
+func (f *fallbackFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := f.try(ctx, "fetch", func(path Fetcher) (err error) {
+		rc, err = path.Fetch(ctx, startOffset, endOffset)
+		return err
+	})
+	return rc, err
+}
+
+func (f *fallbackFetcher) SizeOf(ctx context.Context) (int64, error) {
+	var size int64
+	err := f.try(ctx, "size", func(path Fetcher) (err error) {
+		size, err = SizeOf(ctx, path)
+		return err
+	})
+	return size, err
+}
+
+func (f *fallbackFetcher) ETag(ctx context.Context) (string, error) {
+	var etag string
+	err := f.try(ctx, "etag", func(path Fetcher) (err error) {
+		etag, err = ETagOf(ctx, path)
+		return err
+	})
+	return etag, err
+}
+
+func (f *fallbackFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	// not stored is an answer, not a failure of the path
+	var checksum []byte
+	var notStored error
+	err := f.try(ctx, "checksum", func(path Fetcher) (err error) {
+		checksum, err = StoredChecksum(ctx, path, algorithm)
+		if errors.Is(err, ErrNoStoredChecksum) {
+			notStored, err = err, nil
+		}
+		return err
+	})
+	if err == nil && notStored != nil {
+		return nil, notStored
+	}
+	return checksum, err
+}
@@ -0,0 +1,123 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestObject_FallbackPaths(t *testing.T) {
+	content := []byte("0123456789abcdef")
+	var mu sync.Mutex
+	var served []string
+	var failing atomic.Bool
+	reliable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		served = append(served, r.URL.Path)
+		mu.Unlock()
+		http.ServeContent(w, r, "a.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer reliable.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	location := filepath.Join(t.TempDir(), "paths.yaml")
+	config := "" +
+		"archive://a.zip:\n" +
+		"  - uri: " + down.URL + "/private/a.zip\n" +
+		"  - uri: " + reliable.URL + "/public/a.zip\n" +
+		"archive://bucket/:\n" +
+		"  - uri: " + down.URL + "/private/\n" +
+		"  - uri: " + reliable.URL + "/public/\n"
+	if err := os.WriteFile(location, []byte(config), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	paths, err := remote.LoadFallbackPaths(location)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	remote.SetFallbackPaths(paths)
+	defer remote.SetFallbackPaths(nil)
+
+	cases := []struct {
+		uri  string
+		path string
+	}{
+		{"archive://a.zip", "/public/a.zip"},
+		{"archive://bucket/dir/b.zip", "/public/dir/b.zip"},
+	}
+	for _, c := range cases {
+		t.Run(c.uri, func(t *testing.T) {
+			mu.Lock()
+			served = nil
+			mu.Unlock()
+			logs := &bytes.Buffer{}
+			f, err := remote.Object(c.uri, remote.WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			start, end := int64(2), int64(5)
+			rc, err := f.Fetch(context.Background(), &start, &end)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, _ := io.ReadAll(rc)
+			_ = rc.Close()
+			if string(data) != "2345" {
+				t.Errorf("unexpected content: %q", data)
+			}
+			if size, err := remote.SizeOf(context.Background(), f); err != nil || size != int64(len(content)) {
+				t.Errorf("unexpected size: %d (%v)", size, err)
+			}
+			mu.Lock()
+			if len(served) == 0 || served[0] != c.path {
+				t.Errorf("expected requests for %s, got %v", c.path, served)
+			}
+			mu.Unlock()
+			// the path requests are served through is logged once, when it changes
+			if n := strings.Count(logs.String(), "reading through path"); n != 1 || !strings.Contains(logs.String(), reliable.URL+c.path) {
+				t.Errorf("expected the path serving requests to be logged once, got:\n%s", logs)
+			}
+		})
+	}
+
+	t.Run("all paths fail", func(t *testing.T) {
+		f, err := remote.Object("archive://bucket/c.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		failing.Store(true)
+		start, end := int64(0), int64(1)
+		if _, err := f.Fetch(context.Background(), &start, &end); err == nil {
+			t.Error("expected an error once no path can serve the request")
+		}
+	})
+}
+
+func TestLoadFallbackPaths_Invalid(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "paths.yaml")
+	if err := os.WriteFile(location, []byte("s3://bucket/a.zip:\n  - provider: nope\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := remote.LoadFallbackPaths(location); err == nil || !strings.Contains(err.Error(), "s3://bucket/a.zip") {
+		t.Errorf("expected an error naming the URI with an invalid path, got %v", err)
+	}
+}
@@ -4,12 +4,122 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"strconv"
+	"strings"
 )
 
 type Fetcher interface {
 	Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error)
 }
 
+// Sizer is implemented by fetchers that can report the total size of the remote object
+type Sizer interface {
+	SizeOf(ctx context.Context) (int64, error)
+}
+
+// SizeOf returns the size of the object behind f, if f knows how to find it
+func SizeOf(ctx context.Context, f Fetcher) (int64, error) {
+	sizer, ok := f.(Sizer)
+	if !ok {
+		return 0, ErrSizeUnsupported
+	}
+	return sizer.SizeOf(ctx)
+}
+
+// ETagger is implemented by fetchers of backends that identify versions of an object with an ETag (e.g. S3, HTTP)
+type ETagger interface {
+	ETag(ctx context.Context) (string, error)
+}
+
+// ETagOf returns the ETag of the object behind f. It returns ErrNoETag if the backend doesn't provide one.
+func ETagOf(ctx context.Context, f Fetcher) (string, error) {
+	tagger, ok := f.(ETagger)
+	if !ok {
+		return "", fmt.Errorf("%w: backend doesn't provide ETags", ErrNoETag)
+	}
+	return tagger.ETag(ctx)
+}
+
+// Checksum algorithms of whole objects, as named by StoredChecksum
+const (
+	ChecksumCRC32  = "crc32-ieee"
+	ChecksumCRC32C = "crc32c"
+	ChecksumSHA256 = "sha256"
+)
+
+// ChecksumStore is implemented by fetchers of backends that may store checksums of whole objects (e.g. S3)
+type ChecksumStore interface {
+	StoredChecksum(ctx context.Context, algorithm string) ([]byte, error)
+}
+
+// StoredChecksum returns the checksum of the object behind f computed with algorithm, as stored by its backend.
+// It returns ErrNoStoredChecksum if the backend doesn't store one.
+func StoredChecksum(ctx context.Context, f Fetcher, algorithm string) ([]byte, error) {
+	store, ok := f.(ChecksumStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: backend doesn't store checksums", ErrNoStoredChecksum)
+	}
+	return store.StoredChecksum(ctx, algorithm)
+}
+
+// sizeProbeRange requests a single byte, for backends that don't report an object's size on HEAD:
+// the total size is then taken from the Content-Range of the response
+var sizeProbeRange = "bytes=0-0"
+
+// sizeFromContentRange returns the total size from a Content-Range header, such as "bytes 0-0/1234"
+func sizeFromContentRange(contentRange string) (int64, error) {
+	_, total, found := strings.Cut(contentRange, "/")
+	if !found || total == "*" {
+		return 0, fmt.Errorf("%w: no total size in Content-Range '%s'", ErrSizeUnsupported, contentRange)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(total), 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("%w: invalid Content-Range '%s'", ErrSizeUnsupported, contentRange)
+	}
+	return size, nil
+}
+
+// requestIdentity asks the server not to compress the response body. Archive data is mostly compressed already,
+// and ranges of a content-encoded response would be offsets into the encoded bytes, not into the object.
+func requestIdentity(req *http.Request) {
+	req.Header.Set("Accept-Encoding", "identity")
+}
+
+// identityTransport calls requestIdentity on the requests client libraries make through it
+type identityTransport struct {
+	next http.RoundTripper
+}
+
+func (t identityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	requestIdentity(req)
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// checkIdentity returns ErrContentEncoded if the server compressed the response body regardless, closing it.
+// Object stores return the Content-Encoding objects were uploaded with, sending their bytes as they are:
+// a response is only taken to be compressed in transit if its length is unknown, or doesn't match its Content-Range.
+func checkIdentity(response *http.Response) error {
+	encoding := response.Header.Get("Content-Encoding")
+	if encoding == "" || strings.EqualFold(encoding, "identity") {
+		return nil
+	}
+	if response.ContentLength >= 0 {
+		var first, last int64
+		_, err := fmt.Sscanf(response.Header.Get("Content-Range"), "bytes %d-%d/", &first, &last)
+		if err != nil || response.ContentLength == last-first+1 {
+			return nil
+		}
+	}
+	_ = response.Body.Close()
+	return fmt.Errorf("%w: server sent %s despite Accept-Encoding: identity", ErrContentEncoded, encoding)
+}
+
 func strPtr(s string) *string {
 	return &s
 }
@@ -0,0 +1,258 @@
+package remote
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const (
+	gcsEnvCredentials  = "GOOGLE_APPLICATION_CREDENTIALS"
+	gcsEnvEmulatorHost = "STORAGE_EMULATOR_HOST"
+)
+
+var ErrGCSAuth = errors.New("GCS authentication failed")
+
+type gcsParsedUri struct {
+	Bucket string
+	Object string
+	// Generation selects a specific generation of the object, taken from the generation query parameter (0 if unset)
+	Generation int64
+}
+
+// gcsParseUri parses gs://bucket/path/to/object.zip[?generation=N]
+func gcsParseUri(uri string) (*gcsParsedUri, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	object := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Host == "" || object == "" {
+		return nil, fmt.Errorf("%w: expected gs://bucket/object, got %s", ErrInvalidURI, uri)
+	}
+	var generation int64
+	if value := parsed.Query().Get("generation"); value != "" {
+		generation, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || generation <= 0 {
+			return nil, fmt.Errorf("%w: invalid generation '%s' in %s", ErrInvalidURI, value, uri)
+		}
+	}
+	return &gcsParsedUri{Bucket: parsed.Host, Object: object, Generation: generation}, nil
+}
+
+// gcsClientOptions returns the options of the storage client, making requests with dialer (if set) and
+// authenticating them with Application Default Credentials.
+// With STORAGE_EMULATOR_HOST set, requests are only authenticated if GOOGLE_APPLICATION_CREDENTIALS is set.
+func gcsClientOptions(dialer Dialer) ([]option.ClientOption, error) {
+	base := dialClient(dialer)
+	transport := identityTransport{next: base.Transport}
+	opts := []option.ClientOption{storage.WithJSONReads()}
+	if os.Getenv(gcsEnvEmulatorHost) != "" && os.Getenv(gcsEnvCredentials) == "" {
+		return append(opts, option.WithHTTPClient(&http.Client{Transport: transport})), nil
+	}
+	// the token source outlives the request the client is created for, and gets tokens through the same dialer
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+	creds, err := google.FindDefaultCredentials(ctx, storage.ScopeReadOnly)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGCSAuth, err)
+	}
+	client := &http.Client{Transport: &oauth2.Transport{Source: creds.TokenSource, Base: transport}}
+	return append(opts, option.WithHTTPClient(client)), nil
+}
+
+// gcsError turns errors of the storage client into the errors of this package
+func gcsError(op string, err error) error {
+	var apiErr *googleapi.Error
+	var tokenErr *oauth2.RetrieveError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrObjectNotExist):
+		return ErrDoesNotExist
+	case errors.As(err, &tokenErr):
+		return fmt.Errorf("%w: %v", ErrGCSAuth, err)
+	case errors.As(err, &apiErr):
+		return httpStatusError(op, apiErr.Code, ErrGCSAuth)
+	}
+	return err
+}
+
+// gcsRange returns the offset and length NewRangeReader reads the range buildRange would request with
+func gcsRange(startOffset *int64, endOffset *int64) (int64, int64) {
+	switch {
+	case startOffset != nil && endOffset != nil:
+		return *startOffset, *endOffset - *startOffset + 1
+	case startOffset != nil:
+		return *startOffset, -1
+	case endOffset != nil:
+		return -*endOffset, -1
+	}
+	return 0, -1
+}
+
+// GCSFetcher reads objects from Google Cloud Storage with the storage client library, authenticating with
+// Application Default Credentials
+type GCSFetcher struct {
+	uri    *gcsParsedUri
+	logger *slog.Logger
+	dialer Dialer
+
+	l      sync.Mutex
+	client *storage.Client
+}
+
+var _ Fetcher = &GCSFetcher{}
+
+func NewGCSFetcher(uri string) (*GCSFetcher, error) {
+	parsed, err := gcsParseUri(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSFetcher{
+		uri:    parsed,
+		logger: DummyLogger(),
+	}, nil
+}
+
+func (g *GCSFetcher) setLogger(logger *slog.Logger) {
+	g.logger = logger
+}
+
+func (g *GCSFetcher) setDialer(dialer Dialer) {
+	g.dialer = dialer
+}
+
+// object returns the handle of the object, creating the client (and looking up credentials) on first use
+func (g *GCSFetcher) object(ctx context.Context) (*storage.ObjectHandle, error) {
+	g.l.Lock()
+	defer g.l.Unlock()
+	if g.client == nil {
+		start := time.Now()
+		opts, err := gcsClientOptions(g.dialer)
+		var client *storage.Client
+		if err == nil {
+			client, err = storage.NewClient(ctx, opts...)
+		}
+		tookMs := time.Since(start).Milliseconds()
+		if err != nil {
+			g.logger.ErrorContext(ctx, "gcs.Auth", "took_ms", tookMs, "error", err)
+			return nil, err
+		}
+		g.logger.DebugContext(ctx, "gcs.Auth", "took_ms", tookMs, "error", nil)
+		g.client = client
+	}
+	object := g.client.Bucket(g.uri.Bucket).Object(g.uri.Object)
+	if g.uri.Generation != 0 {
+		object = object.Generation(g.uri.Generation)
+	}
+	return object, nil
+}
+
+// rangeIgnored reports whether reader, opened for length bytes at offset, holds more than that range.
+// Objects stored gzip-encoded are decompressed for clients that don't accept gzip, ignoring the range.
+func rangeIgnored(reader *storage.Reader, offset int64, length int64) bool {
+	if offset < 0 {
+		return reader.Remain() > -offset
+	}
+	return reader.Attrs.StartOffset != offset || (length >= 0 && reader.Remain() > length)
+}
+
+func (g *GCSFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	rangeHeader := buildRange(startOffset, endOffset)
+	rangeHeaderStr := ""
+	if rangeHeader != nil {
+		rangeHeaderStr = *rangeHeader
+	}
+	offset, length := gcsRange(startOffset, endOffset)
+	start := time.Now()
+	var reader *storage.Reader
+	object, err := g.object(ctx)
+	if err == nil {
+		reader, err = object.NewRangeReader(ctx, offset, length)
+		err = gcsError("gcs.Get", err)
+	}
+	if err == nil && rangeIgnored(reader, offset, length) {
+		_ = reader.Close()
+		err = fmt.Errorf("%w: object is stored content-encoded, and served decompressed", ErrContentEncoded)
+	}
+	tookMs := time.Since(start).Milliseconds()
+	if errors.Is(err, ErrDoesNotExist) {
+		g.logger.WarnContext(ctx, "gcs.Get", "range", rangeHeaderStr, "bucket", g.uri.Bucket, "object", g.uri.Object, "took_ms", tookMs, "error", "NotFound")
+		return nil, err
+	} else if err != nil {
+		g.logger.ErrorContext(ctx, "gcs.Get", "range", rangeHeaderStr, "bucket", g.uri.Bucket, "object", g.uri.Object, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	g.logger.DebugContext(ctx, "gcs.Get", "range", rangeHeaderStr, "bucket", g.uri.Bucket, "object", g.uri.Object, "took_ms", tookMs, "error", nil)
+	return reader, nil
+}
+
+// attrs returns the attributes of the object
+func (g *GCSFetcher) attrs(ctx context.Context) (*storage.ObjectAttrs, error) {
+	start := time.Now()
+	var attrs *storage.ObjectAttrs
+	object, err := g.object(ctx)
+	if err == nil {
+		attrs, err = object.Attrs(ctx)
+		err = gcsError("gcs.GetMetadata", err)
+	}
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		g.logger.ErrorContext(ctx, "gcs.GetMetadata", "bucket", g.uri.Bucket, "object", g.uri.Object, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	g.logger.DebugContext(ctx, "gcs.GetMetadata", "bucket", g.uri.Bucket, "object", g.uri.Object, "took_ms", tookMs, "error", nil)
+	return attrs, nil
+}
+
+// SizeOf returns the size of the object from its attributes
+func (g *GCSFetcher) SizeOf(ctx context.Context) (int64, error) {
+	attrs, err := g.attrs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if attrs.Size < 0 {
+		return 0, fmt.Errorf("%w: invalid size %d in object attributes", ErrSizeUnsupported, attrs.Size)
+	}
+	return attrs.Size, nil
+}
+
+// ETag returns the ETag of the object from its attributes
+func (g *GCSFetcher) ETag(ctx context.Context) (string, error) {
+	attrs, err := g.attrs(ctx)
+	if err != nil {
+		return "", err
+	}
+	if attrs.Etag == "" {
+		return "", fmt.Errorf("%w: gs://%s/%s has no ETag", ErrNoETag, g.uri.Bucket, g.uri.Object)
+	}
+	return attrs.Etag, nil
+}
+
+// StoredChecksum returns the CRC32C GCS keeps of every object, including composite ones
+func (g *GCSFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	if algorithm != ChecksumCRC32C {
+		return nil, fmt.Errorf("%w: GCS doesn't store %s checksums", ErrNoStoredChecksum, algorithm)
+	}
+	attrs, err := g.attrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint32(nil, attrs.CRC32C), nil
+}
@@ -0,0 +1,212 @@
+package remote_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// gcsServer serves an OAuth2 token endpoint, accepting assertions signed with key, and the JSON API
+// of a bucket with a single object. Requests for the object without a token are denied if authRequired.
+func gcsServer(t *testing.T, content string, key *rsa.PrivateKey, authRequired bool) (*httptest.Server, *atomic.Int64) {
+	var tokens atomic.Int64
+	var currentToken atomic.Value
+	currentToken.Store("")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/token":
+			_ = r.ParseForm()
+			parts := strings.Split(r.PostForm.Get("assertion"), ".")
+			if len(parts) != 3 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			token := fmt.Sprintf("token-%d", tokens.Add(1))
+			currentToken.Store(token)
+			_, _ = fmt.Fprintf(w, `{"access_token": %q, "expires_in": 3600, "token_type": "Bearer"}`, token)
+		case "/storage/v1/b/bucket/o/path%2Fto%2Farchive.zip":
+			if authRequired && r.Header.Get("Authorization") != "Bearer "+currentToken.Load().(string) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("alt") != "media" {
+				_, _ = fmt.Fprintf(w, `{"size": "%d", "etag": "CKih16GjzO8CEAE=", "crc32c": "vRhVqQ=="}`, len(content))
+				return
+			}
+			http.ServeContent(w, r, "archive.zip", time.Time{}, strings.NewReader(content))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("STORAGE_EMULATOR_HOST", server.URL)
+	return server, &tokens
+}
+
+// writeServiceAccount writes a service account credentials file using key, getting tokens from tokenUri
+func writeServiceAccount(t *testing.T, key *rsa.PrivateKey, tokenUri string) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	creds, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "reader@project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenUri,
+	})
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, creds, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+func TestGCSFetcher(t *testing.T) {
+	content := "0123456789abcdef"
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server, tokens := gcsServer(t, content, key, true)
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", writeServiceAccount(t, key, server.URL+"/token"))
+	ctx := context.Background()
+	f, err := remote.Object("gs://bucket/path/to/archive.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start, end := int64(2), int64(5)
+	r, err := f.Fetch(ctx, &start, &end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != content[2:6] {
+		t.Errorf("expected %q, got %q", content[2:6], data)
+	}
+	suffix := int64(4)
+	r, err = f.Fetch(ctx, nil, &suffix)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ = io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != content[12:] {
+		t.Errorf("expected %q, got %q", content[12:], data)
+	}
+	if size, err := remote.SizeOf(ctx, f); err != nil || size != int64(len(content)) {
+		t.Errorf("expected size %d, got %d (%v)", len(content), size, err)
+	}
+	if etag, err := remote.ETagOf(ctx, f); err != nil || etag != "CKih16GjzO8CEAE=" {
+		t.Errorf("unexpected ETag %q (%v)", etag, err)
+	}
+	if checksum, err := remote.StoredChecksum(ctx, f, remote.ChecksumCRC32C); err != nil || len(checksum) != 4 {
+		t.Errorf("unexpected checksum %x (%v)", checksum, err)
+	}
+	if _, err := remote.StoredChecksum(ctx, f, remote.ChecksumSHA256); !errors.Is(err, remote.ErrNoStoredChecksum) {
+		t.Errorf("expected ErrNoStoredChecksum, got %v", err)
+	}
+	// the token is reused across requests
+	if tokens.Load() != 1 {
+		t.Errorf("expected a single token request, got %d", tokens.Load())
+	}
+
+	missing, err := remote.Object("gs://bucket/missing.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := missing.Fetch(ctx, &start, &end); !errors.Is(err, remote.ErrDoesNotExist) {
+		t.Errorf("expected ErrDoesNotExist, got %v", err)
+	}
+}
+
+func TestGCSFetcher_Auth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	start, end := int64(0), int64(3)
+
+	t.Run("emulator without credentials", func(t *testing.T) {
+		gcsServer(t, "0123456789abcdef", key, false)
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+		f, err := remote.Object("gs://bucket/path/to/archive.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		r, err := f.Fetch(ctx, &start, &end)
+		if err != nil {
+			t.Fatalf("expected unauthenticated requests to the emulator to succeed, got %v", err)
+		}
+		_ = r.Close()
+	})
+
+	t.Run("rejected key", func(t *testing.T) {
+		server, _ := gcsServer(t, "0123456789abcdef", key, true)
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", writeServiceAccount(t, other, server.URL+"/token"))
+		f, err := remote.Object("gs://bucket/path/to/archive.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := f.Fetch(ctx, &start, &end); !errors.Is(err, remote.ErrGCSAuth) {
+			t.Errorf("expected ErrGCSAuth, got %v", err)
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		gcsServer(t, "0123456789abcdef", key, true)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		if err := os.WriteFile(path, []byte(`{"type": "unknown"}`), 0o600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+		f, err := remote.Object("gs://bucket/path/to/archive.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := f.Fetch(ctx, &start, &end); !errors.Is(err, remote.ErrGCSAuth) {
+			t.Errorf("expected ErrGCSAuth, got %v", err)
+		}
+	})
+
+	t.Run("invalid URI", func(t *testing.T) {
+		for _, uri := range []string{"gs://bucket", "gs://bucket/a.zip?generation=latest", "gs://bucket/a.zip?generation=0"} {
+			if _, err := remote.Object(uri); !errors.Is(err, remote.ErrInvalidURI) {
+				t.Errorf("expected ErrInvalidURI for %s, got %v", uri, err)
+			}
+		}
+	})
+}
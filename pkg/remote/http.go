@@ -1,17 +1,50 @@
 package remote
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// HttpRangeStyle selects how ranges of the object are requested from the server
+type HttpRangeStyle string
+
+const (
+	// HttpRangeStyleHeader requests ranges with a GET request and a standard Range header
+	HttpRangeStyleHeader HttpRangeStyle = "header"
+	// HttpRangeStylePostJSON requests ranges with a POST request, whose JSON body is {"offset": N, "length": M}.
+	// The response body is the requested range. This is used by some storage gateways.
+	HttpRangeStylePostJSON HttpRangeStyle = "post-json"
+	// HttpRangeStyleMultipart requests ranges with a Range header, as HttpRangeStyleHeader does, fetching ranges
+	// read at the same time in a single request, whose response is multipart/byteranges (see BatchingFetcher)
+	HttpRangeStyleMultipart HttpRangeStyle = "multipart"
+)
+
+func ParseHttpRangeStyle(style string) (HttpRangeStyle, error) {
+	switch HttpRangeStyle(style) {
+	case HttpRangeStyleHeader, HttpRangeStylePostJSON, HttpRangeStyleMultipart:
+		return HttpRangeStyle(style), nil
+	}
+	return "", fmt.Errorf("%w: unknown HTTP range style '%s', expected header, post-json or multipart", ErrInvalidHttpConfig, style)
+}
+
 type HttpFetcher struct {
-	url    string
-	logger *slog.Logger
+	url         string
+	logger      *slog.Logger
+	credentials *CredentialsCommand
+	rangeStyle  HttpRangeStyle
+	timeouts    HttpTimeouts
+	client      *http.Client
 }
 
 func basicAuth(username, password string) string {
@@ -21,8 +54,10 @@ func basicAuth(username, password string) string {
 
 func NewHttpFetcher(uri string) (*HttpFetcher, error) {
 	return &HttpFetcher{
-		url:    uri,
-		logger: DummyLogger(),
+		url:      uri,
+		logger:   DummyLogger(),
+		timeouts: DefaultHttpTimeouts,
+		client:   dialClient(nil),
 	}, nil
 }
 
@@ -30,29 +65,373 @@ func (h *HttpFetcher) setLogger(logger *slog.Logger) {
 	h.logger = logger
 }
 
+func (h *HttpFetcher) setCredentials(cmd *CredentialsCommand) {
+	h.credentials = cmd
+}
+
+func (h *HttpFetcher) do(req *http.Request) (*http.Response, error) {
+	if h.credentials != nil {
+		if err := h.credentials.authorize(req); err != nil {
+			return nil, err
+		}
+	}
+	req, timed := withTimeouts(req, h.timeouts)
+	response, err := h.client.Do(req)
+	if err != nil {
+		timed.done()
+		return nil, timed.err(err)
+	}
+	response.Body = timed.body(response.Body)
+	return response, nil
+}
+
+func (h *HttpFetcher) setHttpTimeouts(timeouts HttpTimeouts) {
+	h.timeouts = timeouts
+}
+
+func (h *HttpFetcher) setDialer(dialer Dialer) {
+	h.client = dialClient(dialer)
+}
+
+func (h *HttpFetcher) setHttpRangeStyle(style HttpRangeStyle) {
+	h.rangeStyle = style
+}
+
 func (h *HttpFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
-	rangeHeader := buildRange(startOffset, endOffset)
-	req, err := http.NewRequest(http.MethodGet, h.url, nil)
+	var req *http.Request
+	var err error
+	op, rangeHeaderStr := "http.Get", ""
+	if h.rangeStyle == HttpRangeStylePostJSON {
+		op = "http.Post"
+		req, rangeHeaderStr, err = h.postRangeRequest(ctx, startOffset, endOffset)
+	} else {
+		req, rangeHeaderStr, err = h.getRangeRequest(ctx, startOffset, endOffset)
+	}
 	if err != nil {
 		return nil, err
 	}
-	rangeHeaderStr := ""
-	if rangeHeader != nil {
-		rangeHeaderStr = *rangeHeader
-		req.Header.Set("Range", rangeHeaderStr)
-	}
-	req = req.WithContext(ctx)
+	requestIdentity(req)
 	start := time.Now()
-	response, err := http.DefaultClient.Do(req)
+	response, err := h.do(req)
 	tookMs := time.Since(start).Milliseconds()
 	if err != nil {
-		h.logger.ErrorContext(ctx, "http.Get", "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", err)
+		h.logger.ErrorContext(ctx, op, "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", err)
 		return nil, err
 	}
 	if response.StatusCode == http.StatusNotFound {
-		h.logger.WarnContext(ctx, "http.Get", "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", "NotFound")
+		_ = response.Body.Close()
+		h.logger.WarnContext(ctx, op, "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", "NotFound")
 		return nil, ErrDoesNotExist
 	}
-	h.logger.DebugContext(ctx, "http.Get", "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", nil)
+	if response.StatusCode == http.StatusServiceUnavailable || response.StatusCode == http.StatusTooManyRequests {
+		_ = response.Body.Close()
+		h.logger.WarnContext(ctx, op, "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", response.Status)
+		return nil, fmt.Errorf("%w: %s", ErrThrottled, response.Status)
+	}
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		_ = response.Body.Close()
+		h.logger.ErrorContext(ctx, op, "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", response.Status)
+		return nil, fmt.Errorf("%w: %s", ErrAccessDenied, response.Status)
+	}
+	if h.rangeStyle == HttpRangeStylePostJSON && (response.StatusCode < 200 || response.StatusCode > 299) {
+		// a gateway error body must not be mistaken for the requested range
+		_ = response.Body.Close()
+		h.logger.ErrorContext(ctx, op, "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", response.Status)
+		return nil, fmt.Errorf("%s: %s", op, response.Status)
+	}
+	if err := checkIdentity(response); err != nil {
+		h.logger.ErrorContext(ctx, op, "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	if h.rangeStyle != HttpRangeStylePostJSON {
+		// POST requests are answered with the range alone, as a 200
+		if err := checkRangeHonored(response, startOffset, endOffset); err != nil {
+			h.logger.ErrorContext(ctx, op, "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", err)
+			return nil, err
+		}
+	}
+	h.logger.DebugContext(ctx, op, "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", nil)
 	return response.Body, nil
 }
+
+// FetchRanges fetches ranges with a single request, if the range style is HttpRangeStyleMultipart. Parts of
+// the response are matched to ranges by their Content-Range, as servers may reorder or coalesce ranges.
+func (h *HttpFetcher) FetchRanges(ctx context.Context, ranges []Range) ([][]byte, error) {
+	if h.rangeStyle != HttpRangeStyleMultipart {
+		return nil, fmt.Errorf("%w: HTTP range style is %s", ErrBatchUnsupported, h.rangeStyle)
+	}
+	specs := make([]string, len(ranges))
+	var requested int64
+	for i, r := range ranges {
+		specs[i] = fmt.Sprintf("%d-%d", r.Start, r.End)
+		requested += r.End - r.Start + 1
+	}
+	rangeHeaderStr := "bytes=" + strings.Join(specs, ",")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", rangeHeaderStr)
+	requestIdentity(req)
+	start := time.Now()
+	response, err := h.do(req)
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		h.logger.ErrorContext(ctx, "http.Get", "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	defer func() { _ = response.Body.Close() }()
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusNotFound:
+		err = ErrDoesNotExist
+	case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		err = fmt.Errorf("%w: %s", ErrThrottled, response.Status)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		err = fmt.Errorf("%w: %s", ErrAccessDenied, response.Status)
+	default:
+		// don't read the body: if the server ignored the ranges, it's the entire object
+		err = fmt.Errorf("%w: multiple ranges returned %s", ErrBatchUnsupported, response.Status)
+	}
+	if encoding := response.Header.Get("Content-Encoding"); err == nil && encoding != "" && !strings.EqualFold(encoding, "identity") {
+		err = fmt.Errorf("%w: server sent %s despite Accept-Encoding: identity", ErrContentEncoded, encoding)
+	}
+	if err != nil {
+		h.logger.WarnContext(ctx, "http.Get", "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	parts, err := readByteRanges(response, requested)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "http.Get", "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	data := make([][]byte, len(ranges))
+	for i, r := range ranges {
+		if data[i] = parts.slice(r); data[i] == nil {
+			return nil, fmt.Errorf("%w: no part of the response covers bytes %d-%d", ErrBatchUnsupported, r.Start, r.End)
+		}
+	}
+	h.logger.DebugContext(ctx, "http.Get", "range", rangeHeaderStr, "url", h.url, "took_ms", tookMs, "parts", len(parts), "error", nil)
+	return data, nil
+}
+
+// byteRangePart is a part of a 206 response, holding bytes start to end of an object of size bytes
+type byteRangePart struct {
+	start, end, size int64
+	data             []byte
+}
+
+type byteRangeParts []byteRangePart
+
+// slice returns the content of r, cut short at the end of the object, or nil if no part covers it
+func (parts byteRangeParts) slice(r Range) []byte {
+	for _, p := range parts {
+		end := r.End
+		if end >= p.size {
+			end = p.size - 1
+		}
+		if p.start <= r.Start && end <= p.end && r.Start <= end {
+			return p.data[r.Start-p.start : end-p.start+1]
+		}
+	}
+	return nil
+}
+
+// readByteRanges reads the parts of a 206 response: multipart/byteranges, or a single part if the server
+// coalesced the ranges requested into one. Parts larger than limit bytes, more than was requested, are refused.
+func readByteRanges(response *http.Response, limit int64) (byteRangeParts, error) {
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		part, err := readByteRangePart(response.Header.Get("Content-Range"), response.Body, limit)
+		if err != nil {
+			return nil, err
+		}
+		return byteRangeParts{part}, nil
+	}
+	var parts byteRangeParts
+	mr := multipart.NewReader(response.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return parts, nil
+		} else if err != nil {
+			return nil, err
+		}
+		part, err := readByteRangePart(p.Header.Get("Content-Range"), p, limit)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+}
+
+func readByteRangePart(contentRange string, r io.Reader, limit int64) (byteRangePart, error) {
+	var part byteRangePart
+	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &part.start, &part.end, &part.size)
+	if err != nil || part.end < part.start || part.end-part.start+1 > limit {
+		return part, fmt.Errorf("%w: invalid Content-Range '%s'", ErrBatchUnsupported, contentRange)
+	}
+	part.data = make([]byte, part.end-part.start+1)
+	if _, err := io.ReadFull(r, part.data); err != nil {
+		return part, err
+	}
+	return part, nil
+}
+
+// checkRangeHonored returns ErrRangeIgnored if the server answered a range request with the entire object, closing
+// the response body rather than downloading all of it. An object no larger than the range requested from its start
+// is what was asked for, and is accepted.
+func checkRangeHonored(response *http.Response, startOffset *int64, endOffset *int64) error {
+	if response.StatusCode != http.StatusOK || (startOffset == nil && endOffset == nil) {
+		return nil
+	}
+	requested := int64(-1)
+	switch {
+	case startOffset != nil && endOffset != nil:
+		requested = *endOffset - *startOffset + 1
+	case endOffset != nil:
+		requested = *endOffset
+	}
+	fromStart := startOffset == nil || *startOffset == 0
+	if fromStart && (requested < 0 || (response.ContentLength >= 0 && response.ContentLength <= requested)) {
+		return nil
+	}
+	_ = response.Body.Close()
+	return fmt.Errorf("%w: server doesn't support range requests, and sent the entire object (%s)", ErrRangeIgnored, response.Status)
+}
+
+func (h *HttpFetcher) getRangeRequest(ctx context.Context, startOffset *int64, endOffset *int64) (*http.Request, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	rangeHeader := buildRange(startOffset, endOffset)
+	if rangeHeader == nil {
+		return req, "", nil
+	}
+	req.Header.Set("Range", *rangeHeader)
+	return req, *rangeHeader, nil
+}
+
+// httpRangeBody is the request body of HttpRangeStylePostJSON requests. A missing length means up to the end.
+type httpRangeBody struct {
+	Offset int64  `json:"offset"`
+	Length *int64 `json:"length,omitempty"`
+}
+
+func (h *HttpFetcher) postRangeRequest(ctx context.Context, startOffset *int64, endOffset *int64) (*http.Request, string, error) {
+	body := httpRangeBody{}
+	switch {
+	case startOffset != nil && endOffset != nil:
+		length := *endOffset - *startOffset + 1
+		body.Offset, body.Length = *startOffset, &length
+	case startOffset != nil:
+		body.Offset = *startOffset
+	case endOffset != nil:
+		// the last endOffset bytes: an offset and length can only express that given the size of the object
+		size, err := h.SizeOf(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		body.Offset = max(size-*endOffset, 0)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, string(data), nil
+}
+
+// SizeOf returns the size of the object from a HEAD request. If the server doesn't allow HEAD
+// or doesn't return a Content-Length, it falls back to a ranged GET of a single byte.
+func (h *HttpFetcher) SizeOf(ctx context.Context) (int64, error) {
+	size, err := h.headSize(ctx)
+	if !errors.Is(err, ErrSizeUnsupported) {
+		return size, err
+	}
+	h.logger.DebugContext(ctx, "http.Head", "url", h.url, "error", err, "fallback", "ranged GET")
+	return h.rangedGetSize(ctx)
+}
+
+func (h *HttpFetcher) headSize(ctx context.Context) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, h.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	response, err := h.do(req)
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		h.logger.ErrorContext(ctx, "http.Head", "url", h.url, "took_ms", tookMs, "error", err)
+		return 0, err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		h.logger.WarnContext(ctx, "http.Head", "url", h.url, "took_ms", tookMs, "error", "NotFound")
+		return 0, ErrDoesNotExist
+	}
+	h.logger.DebugContext(ctx, "http.Head", "url", h.url, "took_ms", tookMs, "error", nil)
+	if response.StatusCode != http.StatusOK || response.ContentLength < 0 {
+		return 0, fmt.Errorf("%w: HEAD returned %s, content length %d", ErrSizeUnsupported, response.Status, response.ContentLength)
+	}
+	return response.ContentLength, nil
+}
+
+// ETag returns the ETag of the object from a HEAD request
+func (h *HttpFetcher) ETag(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, h.url, nil)
+	if err != nil {
+		return "", err
+	}
+	start := time.Now()
+	response, err := h.do(req)
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		h.logger.ErrorContext(ctx, "http.Head", "url", h.url, "took_ms", tookMs, "error", err)
+		return "", err
+	}
+	_ = response.Body.Close()
+	h.logger.DebugContext(ctx, "http.Head", "url", h.url, "took_ms", tookMs, "status", response.Status)
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return "", ErrDoesNotExist
+	case response.StatusCode != http.StatusOK || response.Header.Get("ETag") == "":
+		return "", fmt.Errorf("%w: HEAD returned %s, without an ETag", ErrNoETag, response.Status)
+	}
+	return response.Header.Get("ETag"), nil
+}
+
+func (h *HttpFetcher) rangedGetSize(ctx context.Context) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", sizeProbeRange)
+	start := time.Now()
+	response, err := h.do(req)
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		h.logger.ErrorContext(ctx, "http.Get", "range", sizeProbeRange, "url", h.url, "took_ms", tookMs, "error", err)
+		return 0, err
+	}
+	// don't read the body: if the server ignored the range, it's the entire object
+	_ = response.Body.Close()
+	h.logger.DebugContext(ctx, "http.Get", "range", sizeProbeRange, "url", h.url, "took_ms", tookMs, "status", response.Status)
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return 0, ErrDoesNotExist
+	case http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		// an empty object can't satisfy any range, but still reports its size as "bytes */0"
+		return sizeFromContentRange(response.Header.Get("Content-Range"))
+	case http.StatusOK:
+		if response.ContentLength >= 0 {
+			return response.ContentLength, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: ranged GET returned %s", ErrSizeUnsupported, response.Status)
+}
@@ -0,0 +1,401 @@
+package remote_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestHttpFetcher_SizeOfFallback(t *testing.T) {
+	const content = "hello, world"
+	cases := []struct {
+		Name    string
+		Content string
+		Handler func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"head_not_allowed", content, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.ServeContent(w, r, "a.zip", time.Time{}, strings.NewReader(content))
+		}},
+		{"range_ignored", content, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(content))
+		}},
+		{"empty_object", "", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Range", "bytes */0")
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(c.Handler))
+			defer server.Close()
+			f, err := remote.NewHttpFetcher(server.URL + "/a.zip")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			size, err := f.SizeOf(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != int64(len(c.Content)) {
+				t.Errorf("expected size %d, got %d", len(c.Content), size)
+			}
+		})
+	}
+
+	t.Run("not_found", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+		f, _ := remote.NewHttpFetcher(server.URL + "/a.zip")
+		if _, err := f.SizeOf(context.Background()); !errors.Is(err, remote.ErrDoesNotExist) {
+			t.Errorf("expected ErrDoesNotExist, got %v", err)
+		}
+	})
+}
+
+func TestHttpFetcher_RangeIgnored(t *testing.T) {
+	const content = "0123456789abcdef"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+	f, err := remote.NewHttpFetcher(server.URL + "/a.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ptr := func(n int64) *int64 { return &n }
+	cases := []struct {
+		Name    string
+		Start   *int64
+		End     *int64
+		Ignored bool
+	}{
+		{"range", ptr(2), ptr(5), true},
+		{"suffix", nil, ptr(4), true},
+		{"from_offset", ptr(2), nil, true},
+		// the entire object is what these ask for
+		{"range_covering_object", ptr(0), ptr(100), false},
+		{"suffix_covering_object", nil, ptr(100), false},
+		{"from_start", ptr(0), nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			r, err := f.Fetch(context.Background(), c.Start, c.End)
+			if c.Ignored {
+				if !errors.Is(err, remote.ErrRangeIgnored) {
+					t.Errorf("expected ErrRangeIgnored, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, _ := io.ReadAll(r)
+			_ = r.Close()
+			if string(data) != content {
+				t.Errorf("expected %q, got %q", content, data)
+			}
+		})
+	}
+}
+
+func TestHttpFetcher_PostJSONRanges(t *testing.T) {
+	const content = "0123456789abcdef"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		case http.MethodPost:
+			if r.Header.Get("Range") != "" {
+				t.Errorf("unexpected Range header: %s", r.Header.Get("Range"))
+			}
+			var body struct {
+				Offset int64  `json:"offset"`
+				Length *int64 `json:"length"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			end := int64(len(content))
+			if body.Length != nil {
+				end = body.Offset + *body.Length
+			}
+			_, _ = w.Write([]byte(content[body.Offset:end]))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	f, err := remote.Object(server.URL+"/a.zip", remote.WithHttpRangeStyle(remote.HttpRangeStylePostJSON))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	offset := func(n int64) *int64 { return &n }
+	cases := []struct {
+		Name       string
+		Start, End *int64
+		Expected   string
+	}{
+		{"range", offset(2), offset(5), "2345"},
+		{"from_offset", offset(12), nil, "cdef"},
+		{"suffix", nil, offset(3), "def"},
+		{"all", nil, nil, content},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			body, err := f.Fetch(context.Background(), c.Start, c.End)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() { _ = body.Close() }()
+			data, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(data) != c.Expected {
+				t.Errorf("expected %q, got %q", c.Expected, data)
+			}
+		})
+	}
+
+	t.Run("not_found", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+		f, _ := remote.Object(server.URL+"/a.zip", remote.WithHttpRangeStyle(remote.HttpRangeStylePostJSON))
+		if _, err := f.Fetch(context.Background(), offset(0), offset(3)); !errors.Is(err, remote.ErrDoesNotExist) {
+			t.Errorf("expected ErrDoesNotExist, got %v", err)
+		}
+	})
+}
+
+func TestHttpFetcher_AccessDenied(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte("<Error>denied</Error>"))
+			}))
+			defer server.Close()
+			f, err := remote.Object(server.URL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// the error page must not be mistaken for the content
+			if _, err := f.Fetch(context.Background(), nil, nil); !errors.Is(err, remote.ErrAccessDenied) {
+				t.Errorf("expected ErrAccessDenied, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHttpFetcher_IdentityEncoding(t *testing.T) {
+	const content = "PK\x03\x04 compressed already"
+	cases := []struct {
+		Name     string
+		Encode   func(w http.ResponseWriter, r *http.Request)
+		Expected error
+	}{
+		{"identity", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "a.zip", time.Time{}, strings.NewReader(content))
+		}, nil},
+		// object stores return the encoding an object was uploaded with, along with its bytes as they are
+		{"stored_encoding", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			http.ServeContent(w, r, "a.zip", time.Time{}, strings.NewReader(content))
+		}, nil},
+		{"compressed_in_transit", func(w http.ResponseWriter, r *http.Request) {
+			// compressing as it is sent, so the length isn't known
+			w.Header().Set("Content-Encoding", "gzip")
+			w.(http.Flusher).Flush()
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write([]byte(content))
+			_ = gz.Close()
+		}, remote.ErrContentEncoded},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if encoding := r.Header.Get("Accept-Encoding"); encoding != "identity" {
+					t.Errorf("expected Accept-Encoding: identity, got %q", encoding)
+				}
+				c.Encode(w, r)
+			}))
+			defer server.Close()
+			f, err := remote.NewHttpFetcher(server.URL + "/a.zip")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			start := int64(4)
+			for _, rng := range [][2]*int64{{nil, nil}, {&start, nil}} {
+				r, err := f.Fetch(context.Background(), rng[0], rng[1])
+				if !errors.Is(err, c.Expected) {
+					t.Fatalf("expected error %v, got %v", c.Expected, err)
+				}
+				if err != nil {
+					continue
+				}
+				data, _ := io.ReadAll(r)
+				_ = r.Close()
+				if rng[0] != nil && string(data) != content[4:] || rng[0] == nil && string(data) != content {
+					t.Errorf("unexpected content %q", data)
+				}
+			}
+		})
+	}
+}
+
+func TestIpfsFetcher(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		if r.URL.Path != "/ipfs/bafyexample/dir/archive.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "archive.zip", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer server.Close()
+
+	f, err := remote.Object("ipfs://bafyexample/dir/archive.zip", remote.WithIpfsGateway(server.URL+"/"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start, end := int64(2), int64(4)
+	rc, err := f.Fetch(context.Background(), &start, &end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(data) != "234" {
+		t.Errorf("expected range '234' from %s, got '%s'", requested, data)
+	}
+
+	missing, err := remote.Object("ipfs://bafyexample/missing.zip", remote.WithIpfsGateway(server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := missing.Fetch(context.Background(), &start, &end); !errors.Is(err, remote.ErrDoesNotExist) {
+		t.Errorf("expected ErrDoesNotExist for a gateway 404, got %v", err)
+	}
+}
+
+func TestHttpFetcher_Timeouts(t *testing.T) {
+	const content = "hello, world"
+	fetch := func(url string, timeouts remote.HttpTimeouts) error {
+		f, err := remote.Object(url, remote.WithHttpTimeouts(timeouts))
+		if err != nil {
+			t.Fatalf("unexpected error creating fetcher: %v", err)
+		}
+		rc, err := f.Fetch(context.Background(), nil, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rc.Close() }()
+		_, err = io.ReadAll(rc)
+		return err
+	}
+	expectPhase := func(err error, phase remote.HttpTimeoutPhase) {
+		t.Helper()
+		var timeoutErr *remote.HttpTimeoutError
+		if !errors.As(err, &timeoutErr) || !errors.Is(err, remote.ErrHttpTimeout) {
+			t.Fatalf("expected an HttpTimeoutError, got: %v", err)
+		}
+		if timeoutErr.Phase != phase {
+			t.Errorf("expected the %s phase to time out, got %s", phase, timeoutErr.Phase)
+		}
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-headers":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		case "/slow-body":
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write([]byte(content[:5]))
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		default:
+			_, _ = w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	short := 50 * time.Millisecond
+	expectPhase(fetch(server.URL+"/slow-headers", remote.HttpTimeouts{FirstByte: short}), remote.HttpPhaseFirstByte)
+	expectPhase(fetch(server.URL+"/slow-body", remote.HttpTimeouts{FirstByte: time.Minute, Total: short}), remote.HttpPhaseTotal)
+	if err := fetch(server.URL+"/fast", remote.HttpTimeouts{FirstByte: short, Total: time.Second}); err != nil {
+		t.Errorf("unexpected error fetching within the timeouts: %v", err)
+	}
+
+	// a server that accepts connections but never completes the TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	expectPhase(fetch("https://"+listener.Addr().String()+"/a.zip", remote.HttpTimeouts{TLSHandshake: short}), remote.HttpPhaseTLSHandshake)
+}
+
+func TestParseHttpTimeouts(t *testing.T) {
+	timeouts, err := remote.ParseHttpTimeouts("tls=1s, total=2m")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := remote.HttpTimeouts{TLSHandshake: time.Second, FirstByte: remote.DefaultHttpTimeouts.FirstByte, Total: 2 * time.Minute}
+	if timeouts != expected {
+		t.Errorf("expected %+v, got %+v", expected, timeouts)
+	}
+	for _, invalid := range []string{"tls", "connect=1s", "total=soon", "first-byte=-1s"} {
+		if _, err := remote.ParseHttpTimeouts(invalid); !errors.Is(err, remote.ErrInvalidHttpConfig) {
+			t.Errorf("%q: expected ErrInvalidHttpConfig, got: %v", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultIpfsGateway = "https://ipfs.io"
+)
+
+// IpfsFetcher reads ipfs://<cid>/path objects through an HTTP gateway, which must support range requests.
+// Requests are made to <gateway>/ipfs/<cid>/path, the path gateway layout.
+type IpfsFetcher struct {
+	*HttpFetcher
+	cid  string
+	path string
+}
+
+var _ Fetcher = &IpfsFetcher{}
+
+func NewIpfsFetcher(uri string) (*IpfsFetcher, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: expected ipfs://<cid>/path, got '%s'", ErrInvalidURI, uri)
+	}
+	h, err := NewHttpFetcher("")
+	if err != nil {
+		return nil, err
+	}
+	f := &IpfsFetcher{HttpFetcher: h, cid: parsed.Host, path: parsed.EscapedPath()}
+	f.setIpfsGateway(DefaultIpfsGateway)
+	return f, nil
+}
+
+func (f *IpfsFetcher) setIpfsGateway(gateway string) {
+	f.url = fmt.Sprintf("%s/ipfs/%s%s", strings.TrimSuffix(gateway, "/"), url.PathEscape(f.cid), f.path)
+}
+
+// ParseIpfsGateway validates the base URL of an IPFS HTTP gateway, such as https://ipfs.io
+func ParseIpfsGateway(gateway string) (string, error) {
+	parsed, err := url.Parse(gateway)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("%w: IPFS gateway must be an http(s):// URL, got '%s'", ErrInvalidURI, gateway)
+	}
+	return gateway, nil
+}
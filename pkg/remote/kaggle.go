@@ -25,6 +25,7 @@ const (
 type KaggleFetcher struct {
 	uri             string
 	logger          *slog.Logger
+	client          *http.Client
 	cacheDatasetUrl string
 	cacheExpiresAt  time.Time
 	l               *sync.Mutex
@@ -61,6 +62,7 @@ func NewKaggleFetcher(uri string) (*KaggleFetcher, error) {
 	return &KaggleFetcher{
 		uri:             uri,
 		logger:          DummyLogger(),
+		client:          dialClient(nil),
 		l:               &sync.Mutex{},
 		cacheDatasetUrl: "",
 	}, nil
@@ -82,6 +84,10 @@ func (k *KaggleFetcher) setLogger(logger *slog.Logger) {
 	k.logger = logger
 }
 
+func (k *KaggleFetcher) setDialer(dialer Dialer) {
+	k.client = dialClient(dialer)
+}
+
 func (k *KaggleFetcher) fetchDatasetUrl() (string, error) {
 	creds, err := getKaggleCredentials()
 	if err != nil {
@@ -95,6 +101,7 @@ func (k *KaggleFetcher) fetchDatasetUrl() (string, error) {
 	auth := fmt.Sprintf("Basic %s", basicAuth(creds.Username, creds.Key))
 	req.Header.Add("Authorization", auth)
 	client := &http.Client{
+		Transport: k.client.Transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
@@ -144,7 +151,7 @@ func (k *KaggleFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset
 	}
 	req = req.WithContext(ctx)
 	start := time.Now()
-	response, err := http.DefaultClient.Do(req)
+	response, err := k.client.Do(req)
 	tookMs := time.Since(start).Milliseconds()
 	if err != nil {
 		k.logger.ErrorContext(ctx, "kaggle.Get", "range", rangeHeaderStr, "url", datasetUrl, "took_ms", tookMs, "error", err)
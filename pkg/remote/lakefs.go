@@ -111,6 +111,9 @@ type LakeFSFetcher struct {
 	uri              string
 	preSignSupported bool
 	logger           *slog.Logger
+	client           *http.Client
+	// connected is set once the server was asked whether it supports pre-signed URLs
+	connected bool
 
 	// for refreshing pre-signed url
 	cachedUrl string
@@ -119,19 +122,38 @@ type LakeFSFetcher struct {
 }
 
 func NewLakeFSFetcher(uri string) (*LakeFSFetcher, error) {
-	preSignSupported, err := canLakeFSPreSign()
-	if err != nil {
+	f := newLakeFSFetcher(uri)
+	if err := f.connect(context.Background()); err != nil {
 		return nil, err
 	}
+	return f, nil
+}
+
+// newLakeFSFetcher returns a fetcher that hasn't contacted the server yet, so that options affecting how it does
+// can be applied before connect is called
+func newLakeFSFetcher(uri string) *LakeFSFetcher {
 	return &LakeFSFetcher{
-		uri:              uri,
-		logger:           DummyLogger(),
-		preSignSupported: preSignSupported,
-		l:                &sync.Mutex{},
-	}, nil
+		uri:    uri,
+		logger: DummyLogger(),
+		client: dialClient(nil),
+		l:      &sync.Mutex{},
+	}
 }
 
-func canLakeFSPreSign() (bool, error) {
+// connect asks the server whether it supports pre-signed URLs
+func (f *LakeFSFetcher) connect(_ context.Context) error {
+	if f.connected {
+		return nil
+	}
+	preSignSupported, err := canLakeFSPreSign(f.client)
+	if err != nil {
+		return err
+	}
+	f.preSignSupported, f.connected = preSignSupported, true
+	return nil
+}
+
+func canLakeFSPreSign(client *http.Client) (bool, error) {
 	cfg, err := loadLakefsConfig()
 	if err != nil {
 		return false, err
@@ -144,7 +166,7 @@ func canLakeFSPreSign() (bool, error) {
 		return false, err
 	}
 	req.Header.Add("Authorization", auth)
-	response, err := http.DefaultClient.Do(req)
+	response, err := client.Do(req)
 	if err != nil {
 		return false, err
 	}
@@ -188,7 +210,7 @@ func parseLakeFSUri(uri string) (*lakeFSUri, error) {
 	}, nil
 }
 
-func getLakeFSUrl(cfg *lakeFSConfig, uri string) (string, time.Time, error) {
+func getLakeFSUrl(client *http.Client, cfg *lakeFSConfig, uri string) (string, time.Time, error) {
 	addr, err := parseLakeFSUri(uri)
 	if err != nil {
 		return "", time.Time{}, err
@@ -206,7 +228,7 @@ func getLakeFSUrl(cfg *lakeFSConfig, uri string) (string, time.Time, error) {
 	q.Add("presign", "true")
 	req.URL.RawQuery = q.Encode()
 
-	response, err := http.DefaultClient.Do(req)
+	response, err := client.Do(req)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -239,6 +261,10 @@ func (f *LakeFSFetcher) setLogger(logger *slog.Logger) {
 	f.logger = logger
 }
 
+func (f *LakeFSFetcher) setDialer(dialer Dialer) {
+	f.client = dialClient(dialer)
+}
+
 func (f *LakeFSFetcher) getURL(cfg *lakeFSConfig) (string, error) {
 	f.l.Lock()
 	defer f.l.Unlock()
@@ -251,7 +277,7 @@ func (f *LakeFSFetcher) getURL(cfg *lakeFSConfig) (string, error) {
 	}
 
 	// do the work to get one
-	zipUrl, expires, err := getLakeFSUrl(cfg, f.uri)
+	zipUrl, expires, err := getLakeFSUrl(f.client, cfg, f.uri)
 	if err != nil {
 		return "", err
 	}
@@ -289,8 +315,9 @@ func (f *LakeFSFetcher) rangeRequest(req *http.Request, startOffset *int64, endO
 		rangeHeaderStr = *rangeHeader
 		req.Header.Set("Range", rangeHeaderStr)
 	}
+	requestIdentity(req)
 	start := time.Now()
-	response, err := http.DefaultClient.Do(req)
+	response, err := f.client.Do(req)
 	tookMs := time.Since(start).Milliseconds()
 	if err != nil {
 		f.logger.Error("lakefs.Get", "range", rangeHeaderStr, "url", f.uri, "took_ms", tookMs, "error", err)
@@ -300,6 +327,10 @@ func (f *LakeFSFetcher) rangeRequest(req *http.Request, startOffset *int64, endO
 		f.logger.Warn("lakefs.Get", "range", rangeHeaderStr, "url", f.uri, "took_ms", tookMs, "error", "NotFound")
 		return nil, ErrDoesNotExist
 	}
+	if err := checkIdentity(response); err != nil {
+		f.logger.Error("lakefs.Get", "range", rangeHeaderStr, "url", f.uri, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
 	f.logger.Debug("lakefs.Get", "range", rangeHeaderStr, "url", f.uri, "took_ms", tookMs, "error", nil)
 	return response.Body, nil
 }
@@ -2,13 +2,16 @@ package remote
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"net/url"
 	"os"
 	"path"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type ReadSeekerCloser interface {
@@ -20,6 +23,11 @@ type ReadSeekerCloser interface {
 type LocalFetcher struct {
 	handle ReadSeekerCloser
 	logger *slog.Logger
+
+	// fifo is set for named pipes, which are read into a spool file on first use, see spool
+	fifo      string
+	spoolOnce sync.Once
+	spoolErr  error
 }
 
 func NewLocalFetcherFromData(data ReadSeekerCloser) *LocalFetcher {
@@ -34,6 +42,9 @@ func NewLocalFetcher(uri string) (*LocalFetcher, error) {
 	if err != nil {
 		return nil, err
 	}
+	if info, err := os.Stat(filePath); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		return &LocalFetcher{fifo: filePath, logger: DummyLogger()}, nil
+	}
 	handle, err := os.Open(filePath)
 	if os.IsNotExist(err) {
 		return nil, ErrDoesNotExist
@@ -51,7 +62,46 @@ func (l *LocalFetcher) setLogger(logger *slog.Logger) {
 	l.logger = logger
 }
 
+// spool reads a named pipe to its end into a temporary file, which is then read like any other local file.
+// A zip archive can only be read once it's complete, since its central directory is at its end: this waits for a
+// writer to open the pipe, and then for it to close it. The temporary file is unlinked right away, so its space is
+// reclaimed once the fetcher's handle is closed.
+func (l *LocalFetcher) spool() error {
+	if l.fifo == "" {
+		return nil
+	}
+	l.spoolOnce.Do(func() {
+		l.logger.Info("waiting for the producer to write the archive to the named pipe, and close it", "path", l.fifo)
+		start := time.Now()
+		in, err := os.Open(l.fifo)
+		if err != nil {
+			l.spoolErr = err
+			return
+		}
+		defer func() { _ = in.Close() }()
+		out, err := os.CreateTemp("", "cz-fifo-*")
+		if err != nil {
+			l.spoolErr = err
+			return
+		}
+		_ = os.Remove(out.Name())
+		n, err := io.Copy(out, in)
+		if err != nil {
+			_ = out.Close()
+			l.spoolErr = fmt.Errorf("could not read named pipe %s: %w", l.fifo, err)
+			return
+		}
+		l.handle = out
+		l.logger.Info("read the archive from the named pipe", "path", l.fifo, "bytes", n,
+			"took_ms", time.Since(start).Milliseconds())
+	})
+	return l.spoolErr
+}
+
 func (l *LocalFetcher) Fetch(_ context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	if err := l.spool(); err != nil {
+		return nil, err
+	}
 	if startOffset == nil && endOffset == nil {
 		// no range, read the whole thing
 		_, err := l.handle.Seek(0, io.SeekStart)
@@ -96,6 +146,13 @@ func (l *LocalFetcher) Fetch(_ context.Context, startOffset *int64, endOffset *i
 
 }
 
+func (l *LocalFetcher) SizeOf(_ context.Context) (int64, error) {
+	if err := l.spool(); err != nil {
+		return 0, err
+	}
+	return l.handle.Seek(0, io.SeekEnd)
+}
+
 type localReader struct {
 	original    io.Closer
 	limitReader io.Reader
@@ -5,7 +5,11 @@ import (
 	"context"
 	"errors"
 	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ozkatz/cloudzip/pkg/remote"
 )
@@ -103,3 +107,81 @@ func TestLocalDownloader_Fetch(t *testing.T) {
 		}
 	})
 }
+
+func TestLocalFetcher_NamedPipe(t *testing.T) {
+	if _, err := exec.LookPath("mkfifo"); err != nil {
+		t.Skip("mkfifo is not available")
+	}
+	fifo := filepath.Join(t.TempDir(), "archive.zip")
+	if out, err := exec.Command("mkfifo", fifo).CombinedOutput(); err != nil {
+		t.Fatalf("could not create named pipe: %v: %s", err, out)
+	}
+	data := bytes.Repeat([]byte("streamed "), 10000)
+	written := make(chan error, 1)
+	go func() {
+		w, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			written <- err
+			return
+		}
+		// the producer writes in pieces, and the fetcher waits for it to close the pipe
+		for i := 0; i < len(data); i += 1000 {
+			_, _ = w.Write(data[i : i+1000])
+			time.Sleep(time.Millisecond)
+		}
+		written <- w.Close()
+	}()
+
+	f, err := remote.NewLocalFetcher("file://" + fifo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	size, err := f.SizeOf(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("unexpected error writing to the named pipe: %v", err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), size)
+	}
+	// the end of the archive, where its central directory is, can be read again and again
+	for i := 0; i < 2; i++ {
+		reader, err := f.Fetch(context.Background(), int64p(size-20), int64p(size-1))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Equal(got, data[len(data)-20:]) {
+			t.Errorf("unexpected data at the end of the archive: %q", got)
+		}
+	}
+}
+
+func TestCountingFetcher(t *testing.T) {
+	r, err := remote.NewLocalFetcher("file://testdata/lorem.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stats := &remote.Stats{}
+	f := remote.CountingFetcher(r, stats)
+	for i := 0; i < 2; i++ {
+		reader, err := f.Fetch(context.Background(), int64p(0), int64p(9))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := io.ReadAll(reader); err != nil {
+			t.Fatalf("could not read file: %v", err)
+		}
+	}
+	if stats.Requests() != 2 {
+		t.Errorf("expected 2 requests, got %d", stats.Requests())
+	}
+	if stats.BytesRead() != 20 {
+		t.Errorf("expected 20 bytes read, got %d", stats.BytesRead())
+	}
+}
@@ -0,0 +1,237 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a Fetcher with additional behavior (accounting, retries, rate limiting...),
+// returning a Fetcher that issues its requests through next
+type Middleware func(next Fetcher) Fetcher
+
+// Chain wraps f with middlewares. The first middleware is the outermost: it sees every request first,
+// and its requests go through the following middlewares, down to f.
+func Chain(f Fetcher, middlewares ...Middleware) Fetcher {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		f = middlewares[i](f)
+	}
+	return f
+}
+
+// Counting accounts for requests and bytes read in stats, see CountingFetcher
+func Counting(stats *Stats) Middleware {
+	return func(next Fetcher) Fetcher {
+		return CountingFetcher(next, stats)
+	}
+}
+
+// LimitConcurrency bounds in-flight requests with l, retrying throttled ones, see AdaptiveFetcher
+func LimitConcurrency(l *ConcurrencyLimiter) Middleware {
+	return func(next Fetcher) Fetcher {
+		return AdaptiveFetcher(next, l)
+	}
+}
+
+// SplitReads fetches large reads as concurrent parts, see ParallelFetcher
+func SplitReads(partSize int64, parallelism int, stats *Stats) Middleware {
+	return func(next Fetcher) Fetcher {
+		return ParallelFetcher(next, partSize, parallelism, stats)
+	}
+}
+
+// IsTransient reports whether a failed request may succeed if it is made again:
+// it was throttled, or timed out on the network
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrThrottled) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Retry makes up to maxAttempts attempts at requests that fail with an error for which retryable returns true
+// (IsTransient if nil), waiting with exponential backoff between attempts.
+// Only failures to start a request are retried, not errors reading the returned reader.
+func Retry(maxAttempts int, retryable func(error) bool) Middleware {
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	return func(next Fetcher) Fetcher {
+		return &retryingFetcher{next: next, maxAttempts: max(maxAttempts, 1), retryable: retryable}
+	}
+}
+
+type retryingFetcher struct {
+	next        Fetcher
+	maxAttempts int
+	retryable   func(error) bool
+}
+
+func (r *retryingFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	var err error
+	for attempt := 0; attempt < r.maxAttempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepWithBackoff(ctx, attempt); err != nil {
+				return nil, err
+			}
+		}
+		rc, err = r.next.Fetch(ctx, startOffset, endOffset)
+		if err == nil || ctx.Err() != nil || !r.retryable(err) {
+			break
+		}
+	}
+	return rc, err
+}
+
+func (r *retryingFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return SizeOf(ctx, r.next)
+}
+
+func (r *retryingFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	return StoredChecksum(ctx, r.next, algorithm)
+}
+
+func (r *retryingFetcher) ETag(ctx context.Context) (string, error) {
+	return ETagOf(ctx, r.next)
+}
+
+// RateLimit spaces requests out evenly, starting at most requestsPerSecond of them every second.
+// Requests beyond the rate wait for their turn (or for their context to be done).
+func RateLimit(requestsPerSecond float64) Middleware {
+	return func(next Fetcher) Fetcher {
+		if requestsPerSecond <= 0 {
+			return next
+		}
+		return &rateLimitedFetcher{next: next, interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+	}
+}
+
+type rateLimitedFetcher struct {
+	next     Fetcher
+	interval time.Duration
+	mu       sync.Mutex
+	// nextSlot is the earliest time the next request may start
+	nextSlot time.Time
+}
+
+// wait blocks until the request's slot
+func (r *rateLimitedFetcher) wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	slot := r.nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	r.nextSlot = slot.Add(r.interval)
+	r.mu.Unlock()
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *rateLimitedFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.next.Fetch(ctx, startOffset, endOffset)
+}
+
+func (r *rateLimitedFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return SizeOf(ctx, r.next)
+}
+
+func (r *rateLimitedFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	return StoredChecksum(ctx, r.next, algorithm)
+}
+
+func (r *rateLimitedFetcher) ETag(ctx context.Context) (string, error) {
+	return ETagOf(ctx, r.next)
+}
+
+// RequestMetrics describes a completed request
+type RequestMetrics struct {
+	// StartOffset and EndOffset are the requested range, as passed to Fetch
+	StartOffset *int64
+	EndOffset   *int64
+	// BytesRead is the number of bytes read from the response before it was closed
+	BytesRead int64
+	// Duration is the time from making the request until its response was closed, or it failed
+	Duration time.Duration
+	// Err is the error the request failed with, or the first error reading its response other than io.EOF
+	Err error
+}
+
+// Metrics calls observe with the metrics of every request, once it fails or its response is closed
+func Metrics(observe func(RequestMetrics)) Middleware {
+	return func(next Fetcher) Fetcher {
+		return &metricsFetcher{next: next, observe: observe}
+	}
+}
+
+type metricsFetcher struct {
+	next    Fetcher
+	observe func(RequestMetrics)
+}
+
+func (m *metricsFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	started := time.Now()
+	rc, err := m.next.Fetch(ctx, startOffset, endOffset)
+	if err != nil {
+		m.observe(RequestMetrics{StartOffset: startOffset, EndOffset: endOffset, Duration: time.Since(started), Err: err})
+		return nil, err
+	}
+	return &metricsReader{next: rc, observe: m.observe, started: started,
+		metrics: RequestMetrics{StartOffset: startOffset, EndOffset: endOffset}}, nil
+}
+
+func (m *metricsFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return SizeOf(ctx, m.next)
+}
+
+func (m *metricsFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	return StoredChecksum(ctx, m.next, algorithm)
+}
+
+func (m *metricsFetcher) ETag(ctx context.Context) (string, error) {
+	return ETagOf(ctx, m.next)
+}
+
+type metricsReader struct {
+	next    io.ReadCloser
+	observe func(RequestMetrics)
+	started time.Time
+	metrics RequestMetrics
+	once    sync.Once
+}
+
+func (r *metricsReader) Read(p []byte) (int, error) {
+	n, err := r.next.Read(p)
+	r.metrics.BytesRead += int64(n)
+	if err != nil && err != io.EOF && r.metrics.Err == nil {
+		r.metrics.Err = err
+	}
+	return n, err
+}
+
+func (r *metricsReader) Close() error {
+	err := r.next.Close()
+	r.once.Do(func() {
+		r.metrics.Duration = time.Since(r.started)
+		r.observe(r.metrics)
+	})
+	return err
+}
@@ -0,0 +1,144 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// failingFetcher fails its first `fail` requests with err
+type failingFetcher struct {
+	fail     atomic.Int64
+	err      error
+	requests atomic.Int64
+}
+
+func (f *failingFetcher) Fetch(_ context.Context, _ *int64, _ *int64) (io.ReadCloser, error) {
+	f.requests.Add(1)
+	if f.fail.Add(-1) >= 0 {
+		return nil, f.err
+	}
+	return io.NopCloser(strings.NewReader("data")), nil
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) remote.Middleware {
+		return func(next remote.Fetcher) remote.Fetcher {
+			return fetcherFunc(func(ctx context.Context, start, end *int64) (io.ReadCloser, error) {
+				order = append(order, name)
+				return next.Fetch(ctx, start, end)
+			})
+		}
+	}
+	f := remote.Chain(&failingFetcher{}, tag("outer"), tag("inner"))
+	if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("expected middlewares to run outermost first, got %v", order)
+	}
+}
+
+type fetcherFunc func(ctx context.Context, start, end *int64) (io.ReadCloser, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, start, end *int64) (io.ReadCloser, error) {
+	return f(ctx, start, end)
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("transient errors are retried", func(t *testing.T) {
+		next := &failingFetcher{err: remote.ErrThrottled}
+		next.fail.Store(2)
+		f := remote.Chain(next, remote.Retry(3, nil))
+		if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if next.requests.Load() != 3 {
+			t.Errorf("expected 3 requests, got %d", next.requests.Load())
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		next := &failingFetcher{err: remote.ErrThrottled}
+		next.fail.Store(10)
+		f := remote.Chain(next, remote.Retry(2, nil))
+		if _, err := f.Fetch(context.Background(), nil, nil); !errors.Is(err, remote.ErrThrottled) {
+			t.Fatalf("expected ErrThrottled, got %v", err)
+		}
+		if next.requests.Load() != 2 {
+			t.Errorf("expected 2 requests, got %d", next.requests.Load())
+		}
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		next := &failingFetcher{err: remote.ErrDoesNotExist}
+		next.fail.Store(1)
+		f := remote.Chain(next, remote.Retry(3, nil))
+		if _, err := f.Fetch(context.Background(), nil, nil); !errors.Is(err, remote.ErrDoesNotExist) {
+			t.Fatalf("expected ErrDoesNotExist, got %v", err)
+		}
+		if next.requests.Load() != 1 {
+			t.Errorf("expected 1 request, got %d", next.requests.Load())
+		}
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	next := &failingFetcher{}
+	f := remote.Chain(next, remote.RateLimit(100))
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// the first request starts right away, the other 4 are spaced 10ms apart
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("expected 5 requests to take at least 40ms at 100 requests/second, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := remote.Chain(next, remote.RateLimit(0.001))
+	_, _ = slow.Fetch(ctx, nil, nil)
+	if _, err := slow.Fetch(ctx, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled request waiting for its turn to fail, got %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var observed []remote.RequestMetrics
+	next := &failingFetcher{err: remote.ErrDoesNotExist}
+	next.fail.Store(1)
+	f := remote.Chain(next, remote.Metrics(func(m remote.RequestMetrics) {
+		observed = append(observed, m)
+	}))
+	if _, err := f.Fetch(context.Background(), nil, nil); err == nil {
+		t.Fatalf("expected the first request to fail")
+	}
+	rc, err := f.Fetch(context.Background(), int64p(0), int64p(3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	_ = rc.Close()
+	_ = rc.Close()
+	if len(observed) != 2 {
+		t.Fatalf("expected 2 observed requests, got %d", len(observed))
+	}
+	if !errors.Is(observed[0].Err, remote.ErrDoesNotExist) {
+		t.Errorf("expected the failed request to be observed with its error, got %v", observed[0].Err)
+	}
+	if observed[1].Err != nil || observed[1].BytesRead != 4 || *observed[1].EndOffset != 3 {
+		t.Errorf("unexpected metrics for the successful request: %+v", observed[1])
+	}
+}
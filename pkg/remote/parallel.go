@@ -0,0 +1,176 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sync/atomic"
+)
+
+const (
+	// DefaultS3PartSize is the part size for S3, and backends that serve from S3 (lakeFS)
+	DefaultS3PartSize = 8 << 20
+	// DefaultHttpPartSize is the part size for HTTP(S) servers: CDNs tend to cache and serve smaller ranges better
+	DefaultHttpPartSize = 4 << 20
+)
+
+// DefaultPartSize returns the part size suited to the backend serving uri,
+// or 0 if reads from it shouldn't be split (local files)
+func DefaultPartSize(uri string) int64 {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return 0
+	}
+	switch parsed.Scheme {
+	case "s3", "S3", "s3a", "lakefs", "gs", "az", "wasbs":
+		return DefaultS3PartSize
+	case "http", "https", "kaggle", "ipfs", "swift", "sftp":
+		return DefaultHttpPartSize
+	}
+	return 0
+}
+
+// ParallelFetcher wraps a Fetcher, splitting reads larger than partSize into parts of partSize bytes,
+// fetching up to parallelism parts concurrently and returning them in order.
+// Parts are buffered in memory, so up to (parallelism + 1) * partSize bytes are held per read.
+// If stats is not nil, the part size and the peak number of parts fetched at once are recorded in it.
+func ParallelFetcher(f Fetcher, partSize int64, parallelism int, stats *Stats) Fetcher {
+	if partSize <= 0 || parallelism <= 1 {
+		return f
+	}
+	if stats != nil {
+		stats.partSize.Store(partSize)
+	}
+	return &parallelFetcher{next: f, partSize: partSize, parallelism: parallelism, stats: stats}
+}
+
+type parallelFetcher struct {
+	next        Fetcher
+	partSize    int64
+	parallelism int
+	stats       *Stats
+	inFlight    atomic.Int64
+}
+
+type partResult struct {
+	data []byte
+	// short is set when the part ended before its requested end, i.e. the end of the object was reached
+	short bool
+	err   error
+}
+
+func (p *parallelFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	if startOffset == nil || endOffset == nil || *endOffset-*startOffset+1 <= p.partSize {
+		return p.next.Fetch(ctx, startOffset, endOffset)
+	}
+	start, end := *startOffset, *endOffset
+	ctx, cancel := context.WithCancel(ctx)
+	r := &parallelReader{slots: make(chan struct{}, p.parallelism), cancel: cancel}
+	for off := start; off <= end; off += p.partSize {
+		r.parts = append(r.parts, make(chan partResult, 1))
+	}
+	go func() {
+		for i := range r.parts {
+			select {
+			case r.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			partStart := start + int64(i)*p.partSize
+			partEnd := min(partStart+p.partSize-1, end)
+			go func(i int) {
+				r.parts[i] <- p.fetchPart(ctx, partStart, partEnd)
+			}(i)
+		}
+	}()
+	// wait for the first part, so that errors such as a missing object are returned by Fetch
+	if err := r.nextPart(); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (p *parallelFetcher) fetchPart(ctx context.Context, start, end int64) partResult {
+	inFlight := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	if p.stats != nil {
+		for peak := p.stats.peakParallelism.Load(); inFlight > peak; peak = p.stats.peakParallelism.Load() {
+			if p.stats.peakParallelism.CompareAndSwap(peak, inFlight) {
+				break
+			}
+		}
+	}
+	rc, err := p.next.Fetch(ctx, &start, &end)
+	if err != nil {
+		return partResult{err: err}
+	}
+	defer func() { _ = rc.Close() }()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return partResult{err: fmt.Errorf("could not read part %d-%d: %w", start, end, err)}
+	}
+	return partResult{data: data, short: int64(len(data)) < end-start+1}
+}
+
+func (p *parallelFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return SizeOf(ctx, p.next)
+}
+
+func (p *parallelFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	return StoredChecksum(ctx, p.next, algorithm)
+}
+
+func (p *parallelFetcher) ETag(ctx context.Context) (string, error) {
+	return ETagOf(ctx, p.next)
+}
+
+type parallelReader struct {
+	parts []chan partResult
+	next  int
+	buf   []byte
+	err   error
+	// slots bounds the number of parts being fetched or waiting to be read
+	slots  chan struct{}
+	cancel context.CancelFunc
+}
+
+// nextPart waits for the next part and makes it the one being read
+func (r *parallelReader) nextPart() error {
+	if r.next == len(r.parts) {
+		return io.EOF
+	}
+	res := <-r.parts[r.next]
+	<-r.slots
+	r.next++
+	if res.err != nil {
+		// readers aren't always closed, so stop fetching the remaining parts now
+		r.cancel()
+		return res.err
+	}
+	if res.short {
+		// nothing past the end of the object
+		r.next = len(r.parts)
+		r.cancel()
+	}
+	r.buf = res.data
+	return nil
+}
+
+func (r *parallelReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.nextPart()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *parallelReader) Close() error {
+	r.cancel()
+	return nil
+}
@@ -0,0 +1,114 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// bytesFetcher serves ranges of data, failing requests starting at failAt (if set)
+type bytesFetcher struct {
+	data     []byte
+	failAt   int64
+	requests atomic.Int64
+}
+
+var errPartFailed = errors.New("part failed")
+
+func (f *bytesFetcher) Fetch(_ context.Context, start *int64, end *int64) (io.ReadCloser, error) {
+	f.requests.Add(1)
+	time.Sleep(time.Millisecond)
+	if f.failAt > 0 && *start == f.failAt {
+		return nil, errPartFailed
+	}
+	from, to := min(*start, int64(len(f.data))), min(*end+1, int64(len(f.data)))
+	return io.NopCloser(bytes.NewReader(f.data[from:to])), nil
+}
+
+func TestParallelFetcher(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	cases := []struct {
+		name       string
+		start, end int64
+		requests   int64 // 0 if it depends on how far ahead parts were fetched
+	}{
+		{"single part", 0, 99, 1},
+		{"split", 0, 999, 10},
+		{"uneven", 50, 404, 4},
+		{"past the end of the object", 900, 1500, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			next := &bytesFetcher{data: data}
+			stats := &remote.Stats{}
+			f := remote.ParallelFetcher(next, 100, 3, stats)
+			rc, err := f.Fetch(context.Background(), &c.start, &c.end)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := io.ReadAll(rc)
+			_ = rc.Close()
+			if err != nil {
+				t.Fatalf("unexpected error reading: %v", err)
+			}
+			expected := data[c.start:min(c.end+1, int64(len(data)))]
+			if !bytes.Equal(got, expected) {
+				t.Errorf("expected %d bytes from %d, got %d bytes", len(expected), c.start, len(got))
+			}
+			if c.requests > 0 && next.requests.Load() != c.requests {
+				t.Errorf("expected %d requests, got %d", c.requests, next.requests.Load())
+			}
+			if stats.PartSize() != 100 || stats.PeakParallelism() > 3 {
+				t.Errorf("expected part size 100 and parallelism <= 3, got %d and %d",
+					stats.PartSize(), stats.PeakParallelism())
+			}
+		})
+	}
+
+	t.Run("failed part", func(t *testing.T) {
+		start, end := int64(0), int64(999)
+		f := remote.ParallelFetcher(&bytesFetcher{data: data, failAt: 500}, 100, 3, nil)
+		rc, err := f.Fetch(context.Background(), &start, &end)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = rc.Close() }()
+		got, err := io.ReadAll(rc)
+		if !errors.Is(err, errPartFailed) {
+			t.Errorf("expected the part's error, got %v", err)
+		}
+		if !bytes.Equal(got, data[:500]) {
+			t.Errorf("expected the 500 bytes before the failed part, got %d", len(got))
+		}
+	})
+
+	t.Run("failed first part", func(t *testing.T) {
+		start, end := int64(100), int64(999)
+		f := remote.ParallelFetcher(&bytesFetcher{data: data, failAt: 100}, 100, 3, nil)
+		if _, err := f.Fetch(context.Background(), &start, &end); !errors.Is(err, errPartFailed) {
+			t.Errorf("expected Fetch to return the first part's error, got %v", err)
+		}
+	})
+}
+
+func TestDefaultPartSize(t *testing.T) {
+	cases := map[string]int64{
+		"s3://bucket/archive.zip":         remote.DefaultS3PartSize,
+		"https://example.com/archive.zip": remote.DefaultHttpPartSize,
+		"file:///tmp/archive.zip":         0,
+	}
+	for uri, expected := range cases {
+		if got := remote.DefaultPartSize(uri); got != expected {
+			t.Errorf("%s: expected %d, got %d", uri, expected, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package remote
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// URIResolver translates a logical URI, such as a stable name for an archive, to the URI of the object backing it.
+// Resolvers return URIs they don't know about unchanged, or an error wrapping ErrUnresolvedURI.
+type URIResolver func(uri string) (string, error)
+
+// URIMap resolves URIs from a lookup table. Keys are matched exactly, except for keys ending with "/",
+// which map every URI they prefix (the longest such key wins).
+type URIMap map[string]string
+
+// LoadURIMap reads a URIMap from a YAML file mapping logical URIs to backend URIs
+func LoadURIMap(path string) (URIMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := URIMap{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("could not parse URI map %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Resolve returns the backend URI uri maps to. URIs that aren't in the map are returned unchanged if they
+// can be opened as they are; otherwise ErrUnresolvedURI is returned.
+func (m URIMap) Resolve(uri string) (string, error) {
+	if resolved, ok := m[uri]; ok {
+		return resolved, nil
+	}
+	prefix := ""
+	for logical := range m {
+		if strings.HasSuffix(logical, "/") && strings.HasPrefix(uri, logical) && len(logical) > len(prefix) {
+			prefix = logical
+		}
+	}
+	if prefix != "" {
+		return m[prefix] + strings.TrimPrefix(uri, prefix), nil
+	}
+	if parsed, err := url.Parse(uri); err != nil || !SupportedScheme(parsed.Scheme) {
+		return "", fmt.Errorf("%w: %s is not in the URI map", ErrUnresolvedURI, uri)
+	}
+	return uri, nil
+}
+
+// ResolveURI passes uri through resolvers, in order
+func ResolveURI(uri string, resolvers ...URIResolver) (string, error) {
+	for _, resolve := range resolvers {
+		resolved, err := resolve(uri)
+		if err != nil {
+			return "", err
+		}
+		uri = resolved
+	}
+	return uri, nil
+}
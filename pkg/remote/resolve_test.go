@@ -0,0 +1,65 @@
+package remote_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestURIMap_Resolve(t *testing.T) {
+	m := remote.URIMap{
+		"datasets/images":    "s3://bucket/images-2024-06.zip",
+		"archive://":         "https://example.com/archives/",
+		"archive://special/": "s3://special-bucket/",
+	}
+	cases := []struct {
+		Name     string
+		URI      string
+		Expected string
+	}{
+		{"exact", "datasets/images", "s3://bucket/images-2024-06.zip"},
+		{"prefix", "archive://a/b.zip", "https://example.com/archives/a/b.zip"},
+		{"longest_prefix", "archive://special/c.zip", "s3://special-bucket/c.zip"},
+		{"unmapped_backend_uri", "s3://bucket/other.zip", "s3://bucket/other.zip"},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			resolved, err := remote.ResolveURI(c.URI, m.Resolve)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resolved != c.Expected {
+				t.Errorf("expected %s, got %s", c.Expected, resolved)
+			}
+		})
+	}
+
+	t.Run("unmapped_logical_uri", func(t *testing.T) {
+		if _, err := m.Resolve("datasets/videos"); !errors.Is(err, remote.ErrUnresolvedURI) {
+			t.Errorf("expected remote.ErrUnresolvedURI, got %v", err)
+		}
+	})
+}
+
+func TestLoadURIMap(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "uris.yaml")
+	if err := os.WriteFile(location, []byte("datasets/images: s3://bucket/images.zip\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := remote.LoadURIMap(location)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m["datasets/images"] != "s3://bucket/images.zip" {
+		t.Errorf("unexpected map: %v", m)
+	}
+	if err := os.WriteFile(location, []byte("- not a mapping\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.LoadURIMap(location); err == nil {
+		t.Errorf("expected an error for an invalid map")
+	}
+}
@@ -2,36 +2,129 @@ package remote
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
+	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 type S3Getter interface {
 	GetObject(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 }
 
 type s3ParsedUri struct {
 	Bucket string
 	Path   string
+	// VersionId selects a specific version of the object in a versioned bucket, taken from the versionId query parameter
+	VersionId string
 }
 
-func s3getServiceForBucket(ctx context.Context, bucket string) (S3Getter, error) {
+// s3Services holds a client per bucket and dialer, so that the bucket's region is only looked up once per process.
+// Clients using dualstack endpoints are kept apart, since their region is looked up through the dualstack endpoint too.
+var (
+	s3Services = newS3ServiceCache(func(ctx context.Context, key s3ServiceKey) (S3Getter, error) {
+		return s3newServiceForBucket(ctx, key.bucket, key.dialer)
+	})
+	s3DualStackServices = newS3ServiceCache(func(ctx context.Context, key s3ServiceKey) (S3Getter, error) {
+		return s3newServiceForBucket(ctx, key.bucket, key.dialer, s3UseDualStack)
+	})
+)
+
+func s3getServiceForBucket(ctx context.Context, bucket string, dualStack bool, dialer Dialer) (S3Getter, error) {
+	key := s3ServiceKey{bucket: bucket, dialer: dialer}
+	if dualStack {
+		return s3DualStackServices.get(ctx, key)
+	}
+	return s3Services.get(ctx, key)
+}
+
+// s3UseDualStack makes requests through the IPv4 and IPv6 (dualstack) S3 endpoints
+func s3UseDualStack(o *s3.Options) {
+	o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+}
+
+// s3ServiceCache creates clients for buckets on first use. Cached clients are returned under a read lock,
+// and concurrent requests for a bucket that isn't cached yet wait for a single lookup of its region.
+// Failed lookups aren't cached.
+type s3ServiceCache struct {
+	mu       sync.RWMutex
+	services map[s3ServiceKey]*s3ServiceEntry
+	create   func(ctx context.Context, key s3ServiceKey) (S3Getter, error)
+}
+
+// s3ServiceKey identifies the clients of a bucket, connecting through dialer if it is set
+type s3ServiceKey struct {
+	bucket string
+	dialer Dialer
+}
+
+type s3ServiceEntry struct {
+	// ready is closed once svc or err are set
+	ready chan struct{}
+	svc   S3Getter
+	err   error
+}
+
+func newS3ServiceCache(create func(ctx context.Context, key s3ServiceKey) (S3Getter, error)) *s3ServiceCache {
+	return &s3ServiceCache{services: make(map[s3ServiceKey]*s3ServiceEntry), create: create}
+}
+
+func (c *s3ServiceCache) get(ctx context.Context, key s3ServiceKey) (S3Getter, error) {
+	c.mu.RLock()
+	entry, ok := c.services[key]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		entry, ok = c.services[key]
+		if !ok {
+			entry = &s3ServiceEntry{ready: make(chan struct{})}
+			c.services[key] = entry
+		}
+		c.mu.Unlock()
+		if !ok {
+			entry.svc, entry.err = c.create(ctx, key)
+			if entry.err != nil {
+				c.mu.Lock()
+				delete(c.services, key)
+				c.mu.Unlock()
+			}
+			close(entry.ready)
+		}
+	}
+	select {
+	case <-entry.ready:
+		return entry.svc, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// s3newServiceForBucket creates a client for the bucket's region, looking it up with a client created with optFns.
+// Both connect through dialer, if it is set.
+func s3newServiceForBucket(ctx context.Context, bucket string, dialer Dialer, optFns ...func(*s3.Options)) (S3Getter, error) {
 	const defaultRegion = "us-east-1"
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(defaultRegion))
+	cfg, err := config.LoadDefaultConfig(ctx, awsConfigOpts(dialer, config.WithRegion(defaultRegion))...)
 	if err != nil {
 		return nil, err
 	}
-	svc := s3.NewFromConfig(cfg)
+	svc := s3.NewFromConfig(cfg, optFns...)
 	region, err := manager.GetBucketRegion(ctx, svc, bucket)
 	if err != nil {
 		if s3IsNotFoundErr(err) {
@@ -40,11 +133,11 @@ func s3getServiceForBucket(ctx context.Context, bucket string) (S3Getter, error)
 		return nil, err
 	}
 	if region != defaultRegion {
-		cfg, err = config.LoadDefaultConfig(ctx, config.WithRegion(region))
+		cfg, err = config.LoadDefaultConfig(ctx, awsConfigOpts(dialer, config.WithRegion(region))...)
 		if err != nil {
 			return nil, err
 		}
-		svc = s3.NewFromConfig(cfg)
+		svc = s3.NewFromConfig(cfg, optFns...)
 	}
 	return svc, nil
 }
@@ -58,6 +151,61 @@ func s3IsNotFoundErr(err error) bool {
 	return errors.As(err, &nf) || errors.As(err, &nosuchkey)
 }
 
+// s3ErrorCode returns the AWS error code of err, or an empty string if err isn't an API error
+func s3ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func s3IsExpiredTokenErr(err error) bool {
+	switch s3ErrorCode(err) {
+	case "ExpiredToken", "ExpiredTokenException", "TokenRefreshRequired":
+		return true
+	}
+	return false
+}
+
+func s3IsThrottledErr(err error) bool {
+	switch s3ErrorCode(err) {
+	case "SlowDown", "ServiceUnavailable", "Throttling", "ThrottlingException", "RequestLimitExceeded":
+		return true
+	}
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusServiceUnavailable
+}
+
+func s3IsAccessDeniedErr(err error) bool {
+	switch s3ErrorCode(err) {
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "AllAccessDisabled":
+		return true
+	}
+	return false
+}
+
+// s3IsHeadUnsupportedErr returns true if a HeadObject request was rejected in a way a GetObject request might not be
+func s3IsHeadUnsupportedErr(err error) bool {
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	switch respErr.HTTPStatusCode() {
+	case http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+func s3IsClockSkewErr(err error) bool {
+	switch s3ErrorCode(err) {
+	case "RequestTimeTooSkewed", "RequestExpired":
+		return true
+	}
+	return false
+}
+
 func s3parseUri(uri string) (*s3ParsedUri, error) {
 	parsed, err := url.Parse(uri)
 	if err != nil {
@@ -68,46 +216,301 @@ func s3parseUri(uri string) (*s3ParsedUri, error) {
 		path = path[1:]
 	}
 	return &s3ParsedUri{
-		Bucket: parsed.Host,
-		Path:   path,
+		Bucket:    parsed.Host,
+		Path:      path,
+		VersionId: parsed.Query().Get("versionId"),
 	}, nil
 }
 
+// S3AddressingStyle selects between path-style (host/bucket/key) and virtual-hosted-style (bucket.host/key) requests
+type S3AddressingStyle string
+
+const (
+	S3AddressingStyleAuto    S3AddressingStyle = "auto"
+	S3AddressingStylePath    S3AddressingStyle = "path"
+	S3AddressingStyleVirtual S3AddressingStyle = "virtual"
+)
+
+func ParseS3AddressingStyle(style string) (S3AddressingStyle, error) {
+	switch S3AddressingStyle(style) {
+	case S3AddressingStyleAuto, S3AddressingStylePath, S3AddressingStyleVirtual:
+		return S3AddressingStyle(style), nil
+	}
+	return "", fmt.Errorf("%w: unknown S3 addressing style '%s', expected path, virtual or auto", ErrInvalidS3Config, style)
+}
+
+// s3EndpointRequiresPathStyle returns true for custom endpoints that can't be used with virtual-hosted-style
+// requests, since there's no DNS name to prefix with the bucket (e.g. a raw IP or localhost MinIO)
+func s3EndpointRequiresPathStyle(endpoint string) bool {
+	if endpoint == "" {
+		return false
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	return host == "localhost" || net.ParseIP(host) != nil
+}
+
+func (style S3AddressingStyle) validate(endpoint string) error {
+	if style == S3AddressingStyleVirtual && s3EndpointRequiresPathStyle(endpoint) {
+		return fmt.Errorf("%w: virtual-hosted-style addressing is not possible with endpoint %s, use path style",
+			ErrInvalidS3Config, endpoint)
+	}
+	return nil
+}
+
+func (style S3AddressingStyle) apply(o *s3.Options) {
+	switch style {
+	case S3AddressingStylePath:
+		o.UsePathStyle = true
+	case S3AddressingStyleVirtual:
+		o.UsePathStyle = false
+	case S3AddressingStyleAuto:
+		o.UsePathStyle = o.UsePathStyle || s3EndpointRequiresPathStyle(aws.ToString(o.BaseEndpoint))
+	}
+}
+
+// s3AccelerateBucketName matches the bucket names Transfer Acceleration can be used with: DNS compatible, without dots
+var s3AccelerateBucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// s3IsAccelerateNotConfiguredErr returns true if a request was rejected because the bucket doesn't have
+// Transfer Acceleration enabled
+func s3IsAccelerateNotConfiguredErr(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRequest" &&
+		strings.Contains(apiErr.ErrorMessage(), "Acceleration")
+}
+
 type S3ObjectFetcher struct {
 	client S3Getter
 	bucket string
 	path   string
-	logger *slog.Logger
+	// versionId, if set, reads a specific version of the object rather than the current one
+	versionId string
+	logger    *slog.Logger
+	opts      []func(*s3.Options)
+	// credentials, if set, override the client's credentials
+	credentials *CredentialsCommand
+	// addressingStyle and accelerate are kept to check that they can be used together
+	addressingStyle S3AddressingStyle
+	accelerate      bool
+	// dualStack creates the client with dualstack endpoints, so that the bucket's region is looked up through them too
+	dualStack bool
+	// provider, if set to a preset, creates the client for an S3 compatible service rather than AWS
+	provider S3Provider
+	// endpoint, if set, creates the client for this endpoint rather than for the bucket's region on AWS
+	endpoint string
+	// dialer, if set, opens the connections of the client
+	dialer Dialer
+	// configErr is returned by all requests, if the fetcher was configured with incompatible options
+	configErr error
 }
 
 func NewS3ObjectFetcher(uri string) (*S3ObjectFetcher, error) {
-	parsed, err := s3parseUri(uri)
+	s, err := newS3ObjectFetcher(uri)
 	if err != nil {
 		return nil, err
 	}
-	client, err := s3getServiceForBucket(context.Background(), parsed.Bucket)
+	if err := s.connect(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newS3ObjectFetcher returns a fetcher without a client, so that options affecting how it is created can be applied
+// before connect is called
+func newS3ObjectFetcher(uri string) (*S3ObjectFetcher, error) {
+	parsed, err := s3parseUri(uri)
 	if err != nil {
 		return nil, err
 	}
 	return &S3ObjectFetcher{
-		client: client,
-		bucket: parsed.Bucket,
-		path:   parsed.Path,
-		logger: DummyLogger(),
+		bucket:    parsed.Bucket,
+		path:      parsed.Path,
+		versionId: parsed.VersionId,
+		logger:    DummyLogger(),
 	}, nil
 }
 
+// connect creates the client, looking up the bucket's region unless a provider preset is used
+func (s *S3ObjectFetcher) connect(ctx context.Context) error {
+	if s.client != nil {
+		return nil
+	}
+	var err error
+	if s.endpoint != "" {
+		s.client, err = s3getServiceForEndpoint(ctx, s.endpoint, s.dialer)
+	} else if _, ok := s3ProviderPresets[s.provider]; ok {
+		s.client, err = s3getServiceForProvider(ctx, s.provider, s.dialer)
+	} else {
+		s.client, err = s3getServiceForBucket(ctx, s.bucket, s.dualStack, s.dialer)
+	}
+	if err != nil {
+		return err
+	}
+	s.validateAddressingStyle()
+	return nil
+}
+
 func (s *S3ObjectFetcher) setLogger(logger *slog.Logger) {
 	s.logger = logger
 }
 
+func (s *S3ObjectFetcher) setDialer(dialer Dialer) {
+	s.dialer = dialer
+}
+
+func (s *S3ObjectFetcher) setCredentials(cmd *CredentialsCommand) {
+	s.credentials = cmd
+	s.opts = append(s.opts, func(o *s3.Options) {
+		o.Credentials = cmd
+	})
+}
+
+func (s *S3ObjectFetcher) setS3AddressingStyle(style S3AddressingStyle) {
+	s.addressingStyle = style
+	s.opts = append(s.opts, style.apply)
+	s.validateAddressingStyle()
+	s.validateAccelerate()
+}
+
+// validateAddressingStyle checks the addressing style against the client's endpoint, once there is a client
+func (s *S3ObjectFetcher) validateAddressingStyle() {
+	if s.configErr != nil || s.addressingStyle == "" {
+		return
+	}
+	if client, ok := s.client.(*s3.Client); ok {
+		s.configErr = s.addressingStyle.validate(aws.ToString(client.Options().BaseEndpoint))
+	}
+}
+
+// setS3Provider creates the client from a provider preset rather than for AWS. It must be set before connect.
+func (s *S3ObjectFetcher) setS3Provider(provider S3Provider) {
+	s.provider = provider
+	s.validateAccelerate()
+	s.validateDualStack()
+}
+
+// setS3Endpoint creates the client for endpoint (e.g. a VPC endpoint of S3). It must be set before connect.
+func (s *S3ObjectFetcher) setS3Endpoint(endpoint string) {
+	s.endpoint = endpoint
+	s.validateAccelerate()
+	s.validateDualStack()
+	if s.configErr == nil && s.provider != "" && s.provider != S3ProviderAWS {
+		s.configErr = fmt.Errorf("%w: an endpoint can't be set along with the %s provider", ErrInvalidS3Config, s.provider)
+	}
+}
+
+// setS3Accelerate makes requests through the bucket's Transfer Acceleration endpoint.
+// The bucket's region is still looked up through the regular endpoint.
+func (s *S3ObjectFetcher) setS3Accelerate() {
+	s.accelerate = true
+	s.opts = append(s.opts, func(o *s3.Options) {
+		o.UseAccelerate = true
+	})
+	s.validateAccelerate()
+}
+
+// setS3DualStack makes requests through the bucket's dualstack endpoint, reachable over IPv6.
+// It must be set before connect for the bucket's region to be looked up through it as well.
+func (s *S3ObjectFetcher) setS3DualStack() {
+	s.dualStack = true
+	s.opts = append(s.opts, s3UseDualStack)
+	s.validateDualStack()
+}
+
+func (s *S3ObjectFetcher) validateDualStack() {
+	if !s.dualStack || s.configErr != nil {
+		return
+	}
+	if s.provider != "" && s.provider != S3ProviderAWS {
+		s.configErr = fmt.Errorf("%w: dualstack endpoints are only available on AWS, not with the %s provider",
+			ErrInvalidS3Config, s.provider)
+	} else if s.endpoint != "" {
+		s.configErr = fmt.Errorf("%w: dualstack endpoints can't be used with endpoint %s", ErrInvalidS3Config, s.endpoint)
+	}
+}
+
+func (s *S3ObjectFetcher) validateAccelerate() {
+	if !s.accelerate || s.configErr != nil {
+		return
+	}
+	switch {
+	case !s3AccelerateBucketName.MatchString(s.bucket):
+		s.configErr = fmt.Errorf("%w: transfer acceleration is not possible with bucket %s, its name must be DNS compatible and not contain dots",
+			ErrInvalidS3Config, s.bucket)
+	case s.addressingStyle == S3AddressingStylePath:
+		s.configErr = fmt.Errorf("%w: transfer acceleration is not possible with path style addressing", ErrInvalidS3Config)
+	case s.provider != "" && s.provider != S3ProviderAWS:
+		s.configErr = fmt.Errorf("%w: transfer acceleration is only available on AWS, not with the %s provider",
+			ErrInvalidS3Config, s.provider)
+	case s.endpoint != "":
+		s.configErr = fmt.Errorf("%w: transfer acceleration can't be used with endpoint %s", ErrInvalidS3Config, s.endpoint)
+	}
+}
+
+func (s *S3ObjectFetcher) versionIdParam() *string {
+	if s.versionId == "" {
+		return nil
+	}
+	return aws.String(s.versionId)
+}
+
+// invalidateCredentials makes the next request resolve credentials again, instead of using cached ones
+func (s *S3ObjectFetcher) invalidateCredentials() {
+	if s.credentials != nil {
+		s.credentials.Invalidate()
+		return
+	}
+	if client, ok := s.client.(*s3.Client); ok {
+		if cache, ok := client.Options().Credentials.(*aws.CredentialsCache); ok {
+			cache.Invalidate()
+		}
+	}
+}
+
+// withRecovery calls fn, retrying once with fresh credentials if the current ones have expired.
+// Clock skew can't be recovered from, so it is reported along with how to fix it.
+func (s *S3ObjectFetcher) withRecovery(ctx context.Context, op string, fn func() error) error {
+	err := fn()
+	if s3IsExpiredTokenErr(err) {
+		s.logger.WarnContext(ctx, op, "bucket", s.bucket, "key", s.path, "error", err, "retry", "refreshing credentials")
+		s.invalidateCredentials()
+		err = fn()
+	}
+	if s3IsClockSkewErr(err) {
+		return fmt.Errorf("%w: the system time differs too much from the S3 server's, check the system clock (e.g. enable NTP sync): %v", ErrClockSkew, err)
+	}
+	if s3IsThrottledErr(err) {
+		return fmt.Errorf("%w: %v", ErrThrottled, err)
+	}
+	if s.accelerate && s3IsAccelerateNotConfiguredErr(err) {
+		return fmt.Errorf("%w: transfer acceleration is not enabled on bucket %s: %v", ErrInvalidS3Config, s.bucket, err)
+	}
+	if s3IsAccessDeniedErr(err) {
+		// keep the API error inspectable: a denied HeadObject may still be retried as a GetObject
+		return fmt.Errorf("%w: %w", ErrAccessDenied, err)
+	}
+	return err
+}
+
 func (s *S3ObjectFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	if s.configErr != nil {
+		return nil, s.configErr
+	}
 	start := time.Now()
 	rng := buildRange(startOffset, endOffset)
-	response, err := s.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s.path),
-		Range:  rng,
+	var response *s3.GetObjectOutput
+	err := s.withRecovery(ctx, "s3.GetObject", func() (err error) {
+		response, err = s.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket:    aws.String(s.bucket),
+			Key:       aws.String(s.path),
+			Range:     rng,
+			VersionId: s.versionIdParam(),
+		}, s.opts...)
+		return err
 	})
 	tookMs := time.Since(start).Milliseconds()
 	rangeString := aws.ToString(rng)
@@ -121,3 +524,146 @@ func (s *S3ObjectFetcher) Fetch(ctx context.Context, startOffset *int64, endOffs
 	s.logger.DebugContext(ctx, "s3.GetObject", "range", rangeString, "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", nil)
 	return response.Body, nil
 }
+
+// SizeOf returns the size of the object from HeadObject. If HEAD requests are denied (e.g. a policy that only
+// allows s3:GetObject for GET) or the response has no length, it falls back to a ranged GetObject of a single byte.
+func (s *S3ObjectFetcher) SizeOf(ctx context.Context) (int64, error) {
+	if s.configErr != nil {
+		return 0, s.configErr
+	}
+	size, err := s.headSize(ctx)
+	if !errors.Is(err, ErrSizeUnsupported) && !s3IsHeadUnsupportedErr(err) {
+		return size, err
+	}
+	s.logger.DebugContext(ctx, "s3.HeadObject", "bucket", s.bucket, "key", s.path, "error", err, "fallback", "ranged GetObject")
+	return s.rangedGetSize(ctx)
+}
+
+func (s *S3ObjectFetcher) headSize(ctx context.Context) (int64, error) {
+	start := time.Now()
+	var response *s3.HeadObjectOutput
+	err := s.withRecovery(ctx, "s3.HeadObject", func() (err error) {
+		response, err = s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:    aws.String(s.bucket),
+			Key:       aws.String(s.path),
+			VersionId: s.versionIdParam(),
+		}, s.opts...)
+		return err
+	})
+	tookMs := time.Since(start).Milliseconds()
+	if s3IsNotFoundErr(err) {
+		s.logger.WarnContext(ctx, "s3.HeadObject", "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", "NotFound")
+		return 0, ErrDoesNotExist
+	} else if err != nil {
+		s.logger.ErrorContext(ctx, "s3.HeadObject", "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", err)
+		return 0, err
+	}
+	s.logger.DebugContext(ctx, "s3.HeadObject", "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", nil)
+	if response.ContentLength == nil {
+		return 0, fmt.Errorf("%w: HeadObject returned no content length", ErrSizeUnsupported)
+	}
+	return aws.ToInt64(response.ContentLength), nil
+}
+
+// ETag returns the ETag of the object from HeadObject
+func (s *S3ObjectFetcher) ETag(ctx context.Context) (string, error) {
+	if s.configErr != nil {
+		return "", s.configErr
+	}
+	start := time.Now()
+	var response *s3.HeadObjectOutput
+	err := s.withRecovery(ctx, "s3.HeadObject", func() (err error) {
+		response, err = s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:    aws.String(s.bucket),
+			Key:       aws.String(s.path),
+			VersionId: s.versionIdParam(),
+		}, s.opts...)
+		return err
+	})
+	tookMs := time.Since(start).Milliseconds()
+	if s3IsNotFoundErr(err) {
+		s.logger.WarnContext(ctx, "s3.HeadObject", "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", "NotFound")
+		return "", ErrDoesNotExist
+	} else if err != nil {
+		s.logger.ErrorContext(ctx, "s3.HeadObject", "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", err)
+		return "", err
+	}
+	s.logger.DebugContext(ctx, "s3.HeadObject", "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", nil)
+	if aws.ToString(response.ETag) == "" {
+		return "", fmt.Errorf("%w: s3://%s/%s", ErrNoETag, s.bucket, s.path)
+	}
+	return aws.ToString(response.ETag), nil
+}
+
+// StoredChecksum returns the checksum of the object S3 stored when it was uploaded, if it was uploaded with one.
+// Checksums of multipart uploads are checksums of the checksums of the parts, not of the object, so they're not returned.
+func (s *S3ObjectFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	if s.configErr != nil {
+		return nil, s.configErr
+	}
+	var response *s3.HeadObjectOutput
+	err := s.withRecovery(ctx, "s3.HeadObject", func() (err error) {
+		response, err = s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:       aws.String(s.bucket),
+			Key:          aws.String(s.path),
+			VersionId:    s.versionIdParam(),
+			ChecksumMode: types.ChecksumModeEnabled,
+		}, s.opts...)
+		return err
+	})
+	if s3IsNotFoundErr(err) {
+		return nil, ErrDoesNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	var stored *string
+	switch algorithm {
+	case ChecksumCRC32:
+		stored = response.ChecksumCRC32
+	case ChecksumCRC32C:
+		stored = response.ChecksumCRC32C
+	case ChecksumSHA256:
+		stored = response.ChecksumSHA256
+	}
+	checksum := aws.ToString(stored)
+	if checksum == "" {
+		return nil, fmt.Errorf("%w: s3://%s/%s has no %s checksum", ErrNoStoredChecksum, s.bucket, s.path, algorithm)
+	}
+	if strings.Contains(checksum, "-") {
+		return nil, fmt.Errorf("%w: s3://%s/%s has a composite %s checksum of a multipart upload (%s)",
+			ErrNoStoredChecksum, s.bucket, s.path, algorithm, checksum)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(checksum)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s checksum '%s': %v", ErrNoStoredChecksum, algorithm, checksum, err)
+	}
+	return decoded, nil
+}
+
+func (s *S3ObjectFetcher) rangedGetSize(ctx context.Context) (int64, error) {
+	start := time.Now()
+	var response *s3.GetObjectOutput
+	err := s.withRecovery(ctx, "s3.GetObject", func() (err error) {
+		response, err = s.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket:    aws.String(s.bucket),
+			Key:       aws.String(s.path),
+			Range:     aws.String(sizeProbeRange),
+			VersionId: s.versionIdParam(),
+		}, s.opts...)
+		return err
+	})
+	tookMs := time.Since(start).Milliseconds()
+	if s3IsNotFoundErr(err) {
+		s.logger.WarnContext(ctx, "s3.GetObject", "range", sizeProbeRange, "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", "NotFound")
+		return 0, ErrDoesNotExist
+	} else if err != nil {
+		s.logger.ErrorContext(ctx, "s3.GetObject", "range", sizeProbeRange, "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", err)
+		return 0, err
+	}
+	_ = response.Body.Close()
+	s.logger.DebugContext(ctx, "s3.GetObject", "range", sizeProbeRange, "bucket", s.bucket, "key", s.path, "took_ms", tookMs, "error", nil)
+	if response.ContentRange == nil {
+		return 0, fmt.Errorf("%w: GetObject returned no content range", ErrSizeUnsupported)
+	}
+	return sizeFromContentRange(aws.ToString(response.ContentRange))
+}
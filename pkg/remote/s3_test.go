@@ -0,0 +1,564 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// optionsRecorder is an S3Getter that records the client options requests were made with
+type optionsRecorder struct {
+	base    s3.Options
+	applied s3.Options
+}
+
+func (r *optionsRecorder) record(optFns []func(*s3.Options)) {
+	r.applied = r.base
+	for _, fn := range optFns {
+		fn(&r.applied)
+	}
+}
+
+func (r *optionsRecorder) GetObject(_ context.Context, _ *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	r.record(optFns)
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func (r *optionsRecorder) HeadObject(_ context.Context, _ *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	r.record(optFns)
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(0)}, nil
+}
+
+func TestS3AddressingStyle(t *testing.T) {
+	cases := []struct {
+		Name         string
+		Style        S3AddressingStyle
+		Endpoint     string
+		UsePathStyle bool
+	}{
+		{"path", S3AddressingStylePath, "", true},
+		{"virtual", S3AddressingStyleVirtual, "https://s3.example.com", false},
+		{"auto_default_endpoint", S3AddressingStyleAuto, "", false},
+		{"auto_ip_endpoint", S3AddressingStyleAuto, "http://10.0.0.1:9000", true},
+		{"auto_localhost_endpoint", S3AddressingStyleAuto, "http://localhost:9000", true},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			recorder := &optionsRecorder{base: s3.Options{BaseEndpoint: aws.String(c.Endpoint)}}
+			f := &S3ObjectFetcher{client: recorder, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+			WithS3AddressingStyle(c.Style)(f)
+			if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if recorder.applied.UsePathStyle != c.UsePathStyle {
+				t.Errorf("GetObject: expected UsePathStyle=%t, got %t", c.UsePathStyle, recorder.applied.UsePathStyle)
+			}
+			if _, err := f.SizeOf(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if recorder.applied.UsePathStyle != c.UsePathStyle {
+				t.Errorf("HeadObject: expected UsePathStyle=%t, got %t", c.UsePathStyle, recorder.applied.UsePathStyle)
+			}
+		})
+	}
+
+	t.Run("virtual_ip_endpoint", func(t *testing.T) {
+		client := s3.New(s3.Options{BaseEndpoint: aws.String("http://127.0.0.1:9000"), Region: "us-east-1"})
+		f := &S3ObjectFetcher{client: client, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		WithS3AddressingStyle(S3AddressingStyleVirtual)(f)
+		_, err := f.Fetch(context.Background(), nil, nil)
+		if !errors.Is(err, ErrInvalidS3Config) {
+			t.Errorf("expected ErrInvalidS3Config, got %v", err)
+		}
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		if _, err := ParseS3AddressingStyle("dns"); !errors.Is(err, ErrInvalidS3Config) {
+			t.Errorf("expected ErrInvalidS3Config, got %v", err)
+		}
+		if style, err := ParseS3AddressingStyle("path"); err != nil || style != S3AddressingStylePath {
+			t.Errorf("expected path style, got %s (%v)", style, err)
+		}
+	})
+}
+
+func TestS3Accelerate(t *testing.T) {
+	t.Run("applied", func(t *testing.T) {
+		recorder := &optionsRecorder{}
+		f := &S3ObjectFetcher{client: recorder, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		WithS3Accelerate()(f)
+		if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !recorder.applied.UseAccelerate {
+			t.Errorf("GetObject: expected UseAccelerate to be set")
+		}
+		if _, err := f.SizeOf(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !recorder.applied.UseAccelerate {
+			t.Errorf("HeadObject: expected UseAccelerate to be set")
+		}
+	})
+
+	invalid := []struct {
+		Name   string
+		Bucket string
+		Opts   []ObjectOpt
+	}{
+		{"dotted_bucket", "my.bucket", []ObjectOpt{WithS3Accelerate()}},
+		{"path_style", "bucket", []ObjectOpt{WithS3Accelerate(), WithS3AddressingStyle(S3AddressingStylePath)}},
+		{"path_style_first", "bucket", []ObjectOpt{WithS3AddressingStyle(S3AddressingStylePath), WithS3Accelerate()}},
+		{"other_provider", "bucket", []ObjectOpt{WithS3Provider(S3ProviderWasabi), WithS3Accelerate()}},
+	}
+	for _, c := range invalid {
+		t.Run(c.Name, func(t *testing.T) {
+			f := &S3ObjectFetcher{client: &optionsRecorder{}, bucket: c.Bucket, path: "a.zip", logger: DummyLogger()}
+			for _, opt := range c.Opts {
+				opt(f)
+			}
+			if _, err := f.Fetch(context.Background(), nil, nil); !errors.Is(err, ErrInvalidS3Config) {
+				t.Errorf("expected ErrInvalidS3Config, got %v", err)
+			}
+		})
+	}
+
+	t.Run("not_enabled_on_bucket", func(t *testing.T) {
+		getter := &failingGetter{errs: []error{&smithy.GenericAPIError{
+			Code:    "InvalidRequest",
+			Message: "S3 Transfer Acceleration is not configured on this bucket",
+		}}}
+		f := &S3ObjectFetcher{client: getter, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		WithS3Accelerate()(f)
+		if _, err := f.Fetch(context.Background(), nil, nil); !errors.Is(err, ErrInvalidS3Config) {
+			t.Errorf("expected ErrInvalidS3Config, got %v", err)
+		}
+	})
+}
+
+// hostRecorder is an HTTP client for S3 clients that records the hosts requested, answering with the bucket's region
+type hostRecorder struct {
+	hosts []string
+}
+
+func (r *hostRecorder) Do(req *http.Request) (*http.Response, error) {
+	r.hosts = append(r.hosts, req.URL.Host)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"X-Amz-Bucket-Region": []string{"us-east-1"}},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestS3DualStack(t *testing.T) {
+	t.Run("applied", func(t *testing.T) {
+		recorder := &optionsRecorder{}
+		f := &S3ObjectFetcher{client: recorder, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		WithS3DualStack()(f)
+		if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if recorder.applied.EndpointOptions.UseDualStackEndpoint != aws.DualStackEndpointStateEnabled {
+			t.Errorf("GetObject: expected UseDualStackEndpoint to be enabled")
+		}
+		if _, err := f.SizeOf(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if recorder.applied.EndpointOptions.UseDualStackEndpoint != aws.DualStackEndpointStateEnabled {
+			t.Errorf("HeadObject: expected UseDualStackEndpoint to be enabled")
+		}
+	})
+
+	t.Run("region_lookup", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+		t.Setenv("AWS_REGION", "")
+		recorder := &hostRecorder{}
+		_, err := s3newServiceForBucket(context.Background(), "bucket", nil, s3UseDualStack, func(o *s3.Options) {
+			o.HTTPClient = recorder
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := "bucket.s3.dualstack.us-east-1.amazonaws.com"
+		if len(recorder.hosts) != 1 || recorder.hosts[0] != expected {
+			t.Errorf("expected the region to be looked up at %s, got %v", expected, recorder.hosts)
+		}
+	})
+
+	t.Run("other_provider", func(t *testing.T) {
+		f := &S3ObjectFetcher{client: &optionsRecorder{}, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		WithS3Provider(S3ProviderR2)(f)
+		WithS3DualStack()(f)
+		if _, err := f.Fetch(context.Background(), nil, nil); !errors.Is(err, ErrInvalidS3Config) {
+			t.Errorf("expected ErrInvalidS3Config, got %v", err)
+		}
+	})
+}
+
+// failingGetter is an S3Getter that fails with the given errors, in order, before succeeding
+type failingGetter struct {
+	errs  []error
+	calls int
+}
+
+func (g *failingGetter) next() error {
+	g.calls++
+	if len(g.errs) == 0 {
+		return nil
+	}
+	err := g.errs[0]
+	g.errs = g.errs[1:]
+	return err
+}
+
+func (g *failingGetter) GetObject(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := g.next(); err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func (g *failingGetter) HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := g.next(); err != nil {
+		return nil, err
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(0)}, nil
+}
+
+func TestS3Provider(t *testing.T) {
+	for _, name := range []string{"aws", "do", "Wasabi", "r2", "minio"} {
+		if _, err := ParseS3Provider(name); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+	if _, err := ParseS3Provider("gcs"); !errors.Is(err, ErrInvalidS3Config) {
+		t.Errorf("expected ErrInvalidS3Config for an unknown provider, got %v", err)
+	}
+
+	t.Setenv(R2AccountIdEnvironmentVariable, "")
+	cases := []struct {
+		Name     string
+		Provider S3Provider
+		Config   aws.Config
+		Account  string
+		Endpoint string
+		Region   string
+	}{
+		{"do_default_region", S3ProviderDigitalOcean, aws.Config{}, "", "https://nyc3.digitaloceanspaces.com", "nyc3"},
+		{"do_configured_region", S3ProviderDigitalOcean, aws.Config{Region: "ams3"}, "", "https://ams3.digitaloceanspaces.com", "ams3"},
+		{"wasabi", S3ProviderWasabi, aws.Config{Region: "eu-central-1"}, "", "https://s3.eu-central-1.wasabisys.com", "eu-central-1"},
+		{"r2", S3ProviderR2, aws.Config{}, "abc123", "https://abc123.r2.cloudflarestorage.com", "auto"},
+		{"minio_configured_endpoint", S3ProviderMinIO, aws.Config{BaseEndpoint: aws.String("http://10.0.0.1:9000")}, "", "http://10.0.0.1:9000", "us-east-1"},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			t.Setenv(R2AccountIdEnvironmentVariable, c.Account)
+			endpoint, region, err := s3ProviderPresets[c.Provider].resolve(c.Provider, c.Config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if endpoint != c.Endpoint || region != c.Region {
+				t.Errorf("expected %s in %s, got %s in %s", c.Endpoint, c.Region, endpoint, region)
+			}
+		})
+	}
+	if _, _, err := s3ProviderPresets[S3ProviderR2].resolve(S3ProviderR2, aws.Config{}); !errors.Is(err, ErrInvalidS3Config) {
+		t.Errorf("expected ErrInvalidS3Config for R2 without an account ID, got %v", err)
+	}
+
+	t.Run("connect", func(t *testing.T) {
+		t.Setenv("AWS_REGION", "")
+		t.Setenv("AWS_ENDPOINT_URL", "")
+		t.Setenv("AWS_ENDPOINT_URL_S3", "")
+		f, err := newS3ObjectFetcher("s3://bucket/a.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		WithS3Provider(S3ProviderMinIO)(f)
+		WithS3AddressingStyle(S3AddressingStyleVirtual)(f)
+		if err := f.connect(context.Background()); err != nil {
+			t.Fatalf("unexpected error connecting: %v", err)
+		}
+		options := f.client.(*s3.Client).Options()
+		if aws.ToString(options.BaseEndpoint) != "http://localhost:9000" || !options.UsePathStyle {
+			t.Errorf("expected path style requests to http://localhost:9000, got %s (path style: %t)",
+				aws.ToString(options.BaseEndpoint), options.UsePathStyle)
+		}
+		// localhost can't be used with virtual-hosted-style requests
+		if _, err := f.Fetch(context.Background(), nil, nil); !errors.Is(err, ErrInvalidS3Config) {
+			t.Errorf("expected ErrInvalidS3Config, got %v", err)
+		}
+	})
+}
+
+func TestS3ObjectFetcher_Recovery(t *testing.T) {
+	expired := &smithy.GenericAPIError{Code: "ExpiredToken", Message: "The provided token has expired."}
+	skewed := &smithy.GenericAPIError{Code: "RequestTimeTooSkewed", Message: "The difference between the request time and the current time is too large."}
+
+	t.Run("expired token is retried with fresh credentials", func(t *testing.T) {
+		getter := &failingGetter{errs: []error{expired}}
+		f := &S3ObjectFetcher{client: getter, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		cmd := NewCredentialsCommand("true")
+		cmd.cached = &Credentials{AccessKeyId: "stale"}
+		WithCredentialsCommand(cmd)(f)
+		if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if getter.calls != 2 {
+			t.Errorf("expected 2 calls, got %d", getter.calls)
+		}
+		if cmd.cached != nil {
+			t.Error("expected cached credentials to be invalidated")
+		}
+	})
+
+	t.Run("expired token is retried once", func(t *testing.T) {
+		getter := &failingGetter{errs: []error{expired, expired}}
+		f := &S3ObjectFetcher{client: getter, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		_, err := f.SizeOf(context.Background())
+		if s3ErrorCode(err) != "ExpiredToken" {
+			t.Errorf("expected ExpiredToken error, got %v", err)
+		}
+		if getter.calls != 2 {
+			t.Errorf("expected 2 calls, got %d", getter.calls)
+		}
+	})
+
+	t.Run("clock skew", func(t *testing.T) {
+		getter := &failingGetter{errs: []error{skewed}}
+		f := &S3ObjectFetcher{client: getter, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		_, err := f.Fetch(context.Background(), nil, nil)
+		if !errors.Is(err, ErrClockSkew) {
+			t.Errorf("expected ErrClockSkew, got %v", err)
+		}
+		if getter.calls != 1 {
+			t.Errorf("expected 1 call, got %d", getter.calls)
+		}
+	})
+
+	t.Run("access denied", func(t *testing.T) {
+		denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+		getter := &failingGetter{errs: []error{denied}}
+		f := &S3ObjectFetcher{client: getter, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+		_, err := f.Fetch(context.Background(), nil, nil)
+		if !errors.Is(err, ErrAccessDenied) || s3ErrorCode(err) != "AccessDenied" {
+			t.Errorf("expected ErrAccessDenied wrapping the API error, got %v", err)
+		}
+	})
+}
+
+// headDeniedGetter is an S3Getter that rejects HeadObject requests, like a policy that only allows GET
+type headDeniedGetter struct {
+	size  int64
+	input *s3.GetObjectInput
+}
+
+func (g *headDeniedGetter) GetObject(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	g.input = input
+	return &s3.GetObjectOutput{
+		Body:         io.NopCloser(strings.NewReader("x")),
+		ContentRange: aws.String(fmt.Sprintf("bytes 0-0/%d", g.size)),
+	}, nil
+}
+
+func (g *headDeniedGetter) HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusForbidden}},
+		Err:      &smithy.GenericAPIError{Code: "Forbidden"},
+	}}
+}
+
+func TestS3ObjectFetcher_SizeOfFallback(t *testing.T) {
+	getter := &headDeniedGetter{size: 1234}
+	f := &S3ObjectFetcher{client: getter, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+	size, err := f.SizeOf(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size != 1234 {
+		t.Errorf("expected size 1234, got %d", size)
+	}
+	if getter.input == nil || aws.ToString(getter.input.Range) != "bytes=0-0" {
+		t.Errorf("expected a single byte ranged GetObject, got %+v", getter.input)
+	}
+}
+
+// inputRecorder is an S3Getter that records the inputs of the requests made
+type inputRecorder struct {
+	get  *s3.GetObjectInput
+	head *s3.HeadObjectInput
+}
+
+func (r *inputRecorder) GetObject(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	r.get = input
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func (r *inputRecorder) HeadObject(_ context.Context, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	r.head = input
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(0)}, nil
+}
+
+func TestS3ObjectFetcher_VersionId(t *testing.T) {
+	parsed, err := s3parseUri("s3://bucket/path/to/data.zip?versionId=3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.Bucket != "bucket" || parsed.Path != "path/to/data.zip" {
+		t.Errorf("unexpected bucket and path: %s, %s", parsed.Bucket, parsed.Path)
+	}
+	if parsed.VersionId != "3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY" {
+		t.Errorf("unexpected version id: %s", parsed.VersionId)
+	}
+
+	recorder := &inputRecorder{}
+	f := &S3ObjectFetcher{client: recorder, bucket: parsed.Bucket, path: parsed.Path, versionId: parsed.VersionId, logger: DummyLogger()}
+	if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := f.SizeOf(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if aws.ToString(recorder.get.VersionId) != parsed.VersionId {
+		t.Errorf("GetObject: expected version id %s, got %v", parsed.VersionId, recorder.get.VersionId)
+	}
+	if aws.ToString(recorder.head.VersionId) != parsed.VersionId {
+		t.Errorf("HeadObject: expected version id %s, got %v", parsed.VersionId, recorder.head.VersionId)
+	}
+
+	t.Run("current version", func(t *testing.T) {
+		recorder := &inputRecorder{}
+		f := &S3ObjectFetcher{client: recorder, bucket: "bucket", path: "data.zip", logger: DummyLogger()}
+		if _, err := f.Fetch(context.Background(), nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if recorder.get.VersionId != nil {
+			t.Errorf("expected no version id, got %s", aws.ToString(recorder.get.VersionId))
+		}
+	})
+}
+
+func TestS3ServiceCache(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		lookups = map[string]int{}
+		fail    = errors.New("lookup failed")
+		release = make(chan struct{})
+	)
+	cache := newS3ServiceCache(func(ctx context.Context, key s3ServiceKey) (S3Getter, error) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		lookups[key.bucket]++
+		if key.bucket == "missing" && lookups[key.bucket] == 1 {
+			return nil, fail
+		}
+		return &optionsRecorder{}, nil
+	})
+
+	var wg sync.WaitGroup
+	services := make([]S3Getter, 8)
+	for i := range services {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			svc, err := cache.get(context.Background(), s3ServiceKey{bucket: "bucket"})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			services[i] = svc
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+	for _, svc := range services[1:] {
+		if svc != services[0] {
+			t.Errorf("expected all callers to get the same client")
+		}
+	}
+	if _, err := cache.get(context.Background(), s3ServiceKey{bucket: "bucket"}); err != nil || lookups["bucket"] != 1 {
+		t.Errorf("expected a single lookup of the bucket's region, got %d (err: %v)", lookups["bucket"], err)
+	}
+
+	if _, err := cache.get(context.Background(), s3ServiceKey{bucket: "missing"}); !errors.Is(err, fail) {
+		t.Errorf("expected the lookup error, got %v", err)
+	}
+	if _, err := cache.get(context.Background(), s3ServiceKey{bucket: "missing"}); err != nil || lookups["missing"] != 2 {
+		t.Errorf("expected a failed lookup to be retried, got %d lookups (err: %v)", lookups["missing"], err)
+	}
+}
+
+func BenchmarkS3ServiceCache_Get(b *testing.B) {
+	buckets := []string{"a", "b", "c", "d"}
+	cache := newS3ServiceCache(func(ctx context.Context, key s3ServiceKey) (S3Getter, error) {
+		return &optionsRecorder{}, nil
+	})
+	for _, bucket := range buckets {
+		_, _ = cache.get(context.Background(), s3ServiceKey{bucket: bucket})
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if _, err := cache.get(context.Background(), s3ServiceKey{bucket: buckets[i%len(buckets)]}); err != nil {
+				b.Fatalf("unexpected error: %v", err)
+			}
+		}
+	})
+}
+
+// checksumGetter is an S3Getter that stores the given checksums, returning them only if they are requested
+type checksumGetter struct {
+	output s3.HeadObjectOutput
+}
+
+func (g *checksumGetter) GetObject(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func (g *checksumGetter) HeadObject(_ context.Context, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if input.ChecksumMode != types.ChecksumModeEnabled {
+		return &s3.HeadObjectOutput{ContentLength: aws.Int64(0)}, nil
+	}
+	return &g.output, nil
+}
+
+func TestS3ObjectFetcher_StoredChecksum(t *testing.T) {
+	getter := &checksumGetter{output: s3.HeadObjectOutput{
+		ChecksumCRC32C: aws.String("yZRlqg=="),
+		ChecksumSHA256: aws.String("n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=-3"),
+	}}
+	f := &S3ObjectFetcher{client: getter, bucket: "bucket", path: "a.zip", logger: DummyLogger()}
+	ctx := context.Background()
+
+	checksum, err := StoredChecksum(ctx, f, ChecksumCRC32C)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprintf("%x", checksum) != "c99465aa" {
+		t.Errorf("unexpected CRC32C checksum: %x", checksum)
+	}
+	if _, err := StoredChecksum(ctx, f, ChecksumCRC32); !errors.Is(err, ErrNoStoredChecksum) {
+		t.Errorf("expected ErrNoStoredChecksum for a missing checksum, got %v", err)
+	}
+	if _, err := StoredChecksum(ctx, f, ChecksumSHA256); !errors.Is(err, ErrNoStoredChecksum) {
+		t.Errorf("expected ErrNoStoredChecksum for a composite checksum, got %v", err)
+	}
+	// wrappers forward to the fetcher they wrap
+	if _, err := StoredChecksum(ctx, Chain(f, Counting(&Stats{})), ChecksumCRC32C); err != nil {
+		t.Errorf("unexpected error through a middleware: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Provider selects a preset for an S3 compatible service: its endpoint, default region and addressing style.
+// The bucket's region isn't probed for any of them, since that only works against AWS.
+type S3Provider string
+
+const (
+	S3ProviderAWS          S3Provider = "aws"
+	S3ProviderDigitalOcean S3Provider = "do"
+	S3ProviderWasabi       S3Provider = "wasabi"
+	S3ProviderR2           S3Provider = "r2"
+	S3ProviderMinIO        S3Provider = "minio"
+
+	// R2AccountIdEnvironmentVariable holds the Cloudflare account ID, which is part of R2 endpoints
+	R2AccountIdEnvironmentVariable = "CLOUDFLARE_ACCOUNT_ID"
+)
+
+type s3ProviderPreset struct {
+	// endpoint may contain {region} and {account}
+	endpoint        string
+	region          string
+	addressingStyle S3AddressingStyle
+}
+
+var s3ProviderPresets = map[S3Provider]s3ProviderPreset{
+	S3ProviderDigitalOcean: {endpoint: "https://{region}.digitaloceanspaces.com", region: "nyc3", addressingStyle: S3AddressingStyleVirtual},
+	S3ProviderWasabi:       {endpoint: "https://s3.{region}.wasabisys.com", region: "us-east-1", addressingStyle: S3AddressingStyleVirtual},
+	S3ProviderR2:           {endpoint: "https://{account}.r2.cloudflarestorage.com", region: "auto", addressingStyle: S3AddressingStylePath},
+	S3ProviderMinIO:        {endpoint: "http://localhost:9000", region: "us-east-1", addressingStyle: S3AddressingStylePath},
+}
+
+func ParseS3Provider(provider string) (S3Provider, error) {
+	p := S3Provider(strings.ToLower(strings.TrimSpace(provider)))
+	if _, ok := s3ProviderPresets[p]; ok || p == S3ProviderAWS {
+		return p, nil
+	}
+	names := []string{string(S3ProviderAWS)}
+	for name := range s3ProviderPresets {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("%w: unknown S3 provider '%s', expected one of: %s", ErrInvalidS3Config, provider, strings.Join(names, ", "))
+}
+
+// resolve returns the endpoint and region to use. The region and endpoint configured for the AWS SDK
+// (e.g. AWS_REGION and AWS_ENDPOINT_URL_S3) take precedence over the preset's.
+func (p s3ProviderPreset) resolve(provider S3Provider, cfg aws.Config) (string, string, error) {
+	region := p.region
+	if cfg.Region != "" {
+		region = cfg.Region
+	}
+	if cfg.BaseEndpoint != nil {
+		return aws.ToString(cfg.BaseEndpoint), region, nil
+	}
+	endpoint := strings.ReplaceAll(p.endpoint, "{region}", region)
+	if strings.Contains(endpoint, "{account}") {
+		account := os.Getenv(R2AccountIdEnvironmentVariable)
+		if account == "" {
+			return "", "", fmt.Errorf("%w: the %s provider needs an account ID in $%s",
+				ErrInvalidS3Config, provider, R2AccountIdEnvironmentVariable)
+		}
+		endpoint = strings.ReplaceAll(endpoint, "{account}", account)
+	}
+	return endpoint, region, nil
+}
+
+func s3getServiceForProvider(ctx context.Context, provider S3Provider, dialer Dialer) (S3Getter, error) {
+	preset := s3ProviderPresets[provider]
+	cfg, err := config.LoadDefaultConfig(ctx, awsConfigOpts(dialer)...)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, region, err := preset.resolve(provider, cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Region = region
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = preset.addressingStyle == S3AddressingStylePath
+	}), nil
+}
+
+// s3getServiceForEndpoint creates a client for a custom endpoint, in the region configured for the AWS SDK
+// (us-east-1 if none is). The bucket's region isn't looked up, as that goes through AWS's public endpoints.
+func s3getServiceForEndpoint(ctx context.Context, endpoint string, dialer Dialer) (S3Getter, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, awsConfigOpts(dialer)...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = s3EndpointRequiresPathStyle(endpoint)
+	}), nil
+}
@@ -0,0 +1,334 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sftpEnvPassword = "CLOUDZIP_SFTP_PASSWORD"
+	sftpEnvIdentity = "CLOUDZIP_SFTP_IDENTITY"
+
+	// sftpReadSize is the size of each read from the file, which the client splits into concurrent requests
+	sftpReadSize = 512 << 10
+)
+
+var ErrSFTP = errors.New("SFTP request failed")
+
+type sftpParsedUri struct {
+	User string
+	// Password is only set if given in the URI, which CLOUDZIP_SFTP_PASSWORD is preferable to
+	Password string
+	Addr     string
+	Path     string
+}
+
+// sftpParseUri parses sftp://[user[:password]@]host[:port]/path/to/archive.zip. Paths are absolute, except for
+// paths starting with /~/, which are relative to the user's home directory.
+func sftpParseUri(uri string) (*sftpParsedUri, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Host == "" || parsed.Path == "" || parsed.Path == "/" {
+		return nil, fmt.Errorf("%w: expected sftp://[user@]host[:port]/path, got %s", ErrInvalidURI, uri)
+	}
+	target := parsed.Host
+	if parsed.User != nil {
+		target = parsed.User.Username() + "@" + parsed.Host
+	}
+	username, addr, err := parseSSHTarget(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURI, err)
+	}
+	result := &sftpParsedUri{User: username, Addr: addr, Path: parsed.Path}
+	if strings.HasPrefix(result.Path, "/~/") {
+		result.Path = strings.TrimPrefix(result.Path, "/~/")
+	}
+	if parsed.User != nil {
+		result.Password, _ = parsed.User.Password()
+	}
+	return result, nil
+}
+
+// sftpAuthMethods returns the ways to authenticate: the key in CLOUDZIP_SFTP_IDENTITY, those of ssh-agent and
+// the default keys in ~/.ssh, then the password (from CLOUDZIP_SFTP_PASSWORD or the URI), if any
+func sftpAuthMethods(sshDir string, password string) ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	if identity := os.Getenv(sftpEnvIdentity); identity != "" {
+		data, err := os.ReadFile(identity)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read %s: %w", sftpEnvIdentity, err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not parse the key in %s (keys protected by a passphrase must be in ssh-agent): %w",
+				sftpEnvIdentity, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	agentMethods, closeAgent := sshAuthMethods(sshDir)
+	methods = append(methods, agentMethods...)
+	if env := os.Getenv(sftpEnvPassword); env != "" {
+		password = env
+	}
+	if password != "" {
+		// servers may only offer passwords through keyboard-interactive authentication
+		methods = append(methods, ssh.Password(password), ssh.KeyboardInteractive(
+			func(_, _ string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range questions {
+					if !echos[i] {
+						answers[i] = password
+					}
+				}
+				return answers, nil
+			}))
+	}
+	return methods, closeAgent, nil
+}
+
+// dialSFTP connects to the server of uri, through dialer if it is set, starting an SFTP session.
+// The host key must be in ~/.ssh/known_hosts.
+func dialSFTP(ctx context.Context, uri *sftpParsedUri, dialer Dialer) (*ssh.Client, *sftp.Client, error) {
+	authMethods := func(sshDir string) ([]ssh.AuthMethod, func(), error) {
+		auth, closeAgent, err := sftpAuthMethods(sshDir, uri.Password)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(auth) == 0 {
+			closeAgent()
+			return nil, nil, fmt.Errorf("%w: no SSH keys found in ssh-agent or in %s, and no password set in %s",
+				ErrAccessDenied, sshDir, sftpEnvPassword)
+		}
+		return auth, closeAgent, nil
+	}
+	var client *sftp.Client
+	conn, err := sshDial(ctx, dialer, uri.Addr, uri.User, authMethods, func(conn *ssh.Client) error {
+		var err error
+		client, err = sftp.NewClient(conn)
+		if err != nil {
+			return fmt.Errorf("could not start the sftp subsystem: %w", err)
+		}
+		return nil
+	}, ErrSFTP)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, client, nil
+}
+
+// sftpError turns errors of the SFTP client into the errors of this package, keeping io.EOF
+func sftpError(path string, err error) error {
+	switch {
+	case err == nil || err == io.EOF:
+		return err
+	case errors.Is(err, os.ErrNotExist):
+		return ErrDoesNotExist
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("%w: %s: %v", ErrAccessDenied, path, err)
+	}
+	return fmt.Errorf("%w: %s: %v", ErrSFTP, path, err)
+}
+
+// SFTPFetcher reads files from SSH servers over SFTP, authenticating with keys or a password.
+// The connection, and the file opened on it, are kept open and shared by reads, and opened again if lost.
+type SFTPFetcher struct {
+	uri    *sftpParsedUri
+	logger *slog.Logger
+	dialer Dialer
+
+	l      sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+	file   *sftp.File
+	// lost is closed once the SFTP session ends
+	lost <-chan struct{}
+}
+
+var _ Fetcher = &SFTPFetcher{}
+
+func NewSFTPFetcher(uri string) (*SFTPFetcher, error) {
+	parsed, err := sftpParseUri(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &SFTPFetcher{uri: parsed, logger: DummyLogger()}, nil
+}
+
+func (s *SFTPFetcher) setLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+func (s *SFTPFetcher) setDialer(dialer Dialer) {
+	s.dialer = dialer
+}
+
+// open returns the file, connecting and opening it first if needed
+func (s *SFTPFetcher) open(ctx context.Context) (*sftp.File, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.file != nil {
+		select {
+		case <-s.lost:
+			s.logger.WarnContext(ctx, "sftp connection lost, reconnecting", "addr", s.uri.Addr, "error", s.client.Wait())
+			s.close()
+		default:
+			return s.file, nil
+		}
+	}
+	start := time.Now()
+	conn, client, err := dialSFTP(ctx, s.uri, s.dialer)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "sftp.Connect", "addr", s.uri.Addr, "user", s.uri.User, "took_ms", time.Since(start).Milliseconds(), "error", err)
+		return nil, err
+	}
+	file, err := client.Open(s.uri.Path)
+	err = sftpError(s.uri.Path, err)
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		_ = client.Close()
+		_ = conn.Close()
+		s.logger.ErrorContext(ctx, "sftp.Open", "addr", s.uri.Addr, "path", s.uri.Path, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	s.logger.DebugContext(ctx, "sftp.Open", "addr", s.uri.Addr, "path", s.uri.Path, "took_ms", tookMs, "error", nil)
+	lost := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(lost)
+	}()
+	s.conn, s.client, s.file, s.lost = conn, client, file, lost
+	return file, nil
+}
+
+// close closes the file, the SFTP session and the connection, if open
+func (s *SFTPFetcher) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	// the session waits for the server to end it, which the connection being closed does
+	if closeErr := s.conn.Close(); err == nil {
+		err = closeErr
+	}
+	_ = s.client.Close()
+	s.conn, s.client, s.file, s.lost = nil, nil, nil, nil
+	return err
+}
+
+// Close closes the file and the connection to the server. Reads fetched after Close connect again.
+func (s *SFTPFetcher) Close() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.close()
+}
+
+func (s *SFTPFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	file, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &sftpReader{ctx: ctx, file: file, path: s.uri.Path, end: -1}
+	switch {
+	case startOffset != nil:
+		r.next = *startOffset
+		if endOffset != nil {
+			r.end = *endOffset + 1
+		}
+	case endOffset != nil:
+		// the last bytes of the file
+		size, err := s.SizeOf(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.next = max(size-*endOffset, 0)
+	}
+	rangeStr := ""
+	if rangeHeader := buildRange(startOffset, endOffset); rangeHeader != nil {
+		rangeStr = *rangeHeader
+	}
+	s.logger.DebugContext(ctx, "sftp.Read", "range", rangeStr, "addr", s.uri.Addr, "path", s.uri.Path)
+	return r, nil
+}
+
+// SizeOf returns the size of the file, from the attributes of the open file
+func (s *SFTPFetcher) SizeOf(ctx context.Context) (int64, error) {
+	file, err := s.open(ctx)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	info, err := file.Stat()
+	err = sftpError(s.uri.Path, err)
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "sftp.Stat", "addr", s.uri.Addr, "path", s.uri.Path, "took_ms", tookMs, "error", err)
+		return 0, err
+	}
+	s.logger.DebugContext(ctx, "sftp.Stat", "addr", s.uri.Addr, "path", s.uri.Path, "took_ms", tookMs, "error", nil)
+	return info.Size(), nil
+}
+
+// sftpReader streams a range of the file, sftpReadSize bytes at a time
+type sftpReader struct {
+	ctx  context.Context
+	file *sftp.File
+	path string
+	// next is the offset of the next read, and end the offset reading stops at (-1 for the end of the file)
+	next  int64
+	end   int64
+	chunk []byte
+	buf   []byte
+	err   error
+}
+
+func (r *sftpReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if err := r.ctx.Err(); err != nil {
+			r.err = err
+			return 0, err
+		}
+		length := int64(sftpReadSize)
+		if r.end >= 0 {
+			length = min(length, r.end-r.next)
+		}
+		if length <= 0 {
+			r.err = io.EOF
+			return 0, io.EOF
+		}
+		if r.chunk == nil {
+			r.chunk = make([]byte, sftpReadSize)
+		}
+		n, err := r.file.ReadAt(r.chunk[:length], r.next)
+		r.next += int64(n)
+		r.buf = r.chunk[:n]
+		// io.EOF past the end of the file
+		r.err = sftpError(r.path, err)
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *sftpReader) Close() error {
+	r.buf = nil
+	if r.err == nil {
+		r.err = errors.New("read from closed reader")
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// sftpServer is an SSH server accepting a client key or the password "secret", serving the files of dir
+// (which is also the home directory) read-only over SFTP
+type sftpServer struct {
+	addr string
+	dir  string
+	// ended counts the SFTP sessions that have ended
+	ended atomic.Int64
+}
+
+func startSFTPServer(t *testing.T, clientKey ssh.PublicKey, dir string) (*sftpServer, ssh.PublicKey) {
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	s := &sftpServer{addr: listener.Addr().String(), dir: dir}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, cfg)
+		}
+	}()
+	return s, hostSigner.PublicKey()
+}
+
+func (s *sftpServer) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range channelRequests {
+				_ = req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}()
+		go func() {
+			defer s.ended.Add(1)
+			server, err := sftp.NewServer(channel, sftp.ReadOnly(), sftp.WithServerWorkingDirectory(s.dir))
+			if err != nil {
+				_ = channel.Close()
+				return
+			}
+			_ = server.Serve()
+			_ = server.Close()
+		}()
+	}
+}
+
+func TestSFTPFetcher(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("CLOUDZIP_SFTP_PASSWORD", "")
+	_, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	clientSigner, _ := ssh.NewSignerFromKey(clientPriv)
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "archive-key")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content := make([]byte, 200000)
+	for i := range content {
+		content[i] = byte(i * 13)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "archive.zip"), content, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, hostKey := startSFTPServer(t, clientSigner.PublicKey(), dir)
+	_ = os.MkdirAll(filepath.Join(home, ".ssh"), 0o700)
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, hostKey)
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	uri := "sftp://user@" + s.addr + filepath.ToSlash(filepath.Join(dir, "archive.zip"))
+
+	read := func(t *testing.T, f remote.Fetcher, start, end *int64) []byte {
+		rc, err := f.Fetch(ctx, start, end)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = rc.Close() }()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return data
+	}
+	ptr := func(n int64) *int64 { return &n }
+
+	t.Run("key", func(t *testing.T) {
+		t.Setenv("CLOUDZIP_SFTP_IDENTITY", keyPath)
+		f, err := remote.Object(uri)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if size, err := remote.SizeOf(ctx, f); err != nil || size != int64(len(content)) {
+			t.Errorf("expected size %d, got %d (%v)", len(content), size, err)
+		}
+		// ranges larger than a request are read with concurrent requests
+		if data := read(t, f, ptr(1000), ptr(150999)); !bytes.Equal(data, content[1000:151000]) {
+			t.Errorf("unexpected content of a range (%d bytes)", len(data))
+		}
+		if data := read(t, f, nil, ptr(22)); !bytes.Equal(data, content[len(content)-22:]) {
+			t.Errorf("unexpected content of the end of the file: %x", data)
+		}
+		if data := read(t, f, ptr(190000), nil); !bytes.Equal(data, content[190000:]) {
+			t.Errorf("unexpected content from an offset (%d bytes)", len(data))
+		}
+		if data := read(t, f, nil, nil); !bytes.Equal(data, content) {
+			t.Errorf("unexpected content of the whole file (%d bytes)", len(data))
+		}
+	})
+
+	t.Run("password", func(t *testing.T) {
+		t.Setenv("CLOUDZIP_SFTP_PASSWORD", "secret")
+		f, err := remote.Object(uri)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if data := read(t, f, ptr(0), ptr(3)); !bytes.Equal(data, content[:4]) {
+			t.Errorf("unexpected content: %x", data)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		t.Setenv("CLOUDZIP_SFTP_IDENTITY", keyPath)
+		f, err := remote.NewSFTPFetcher("sftp://user@" + s.addr + "/~/archive.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if data := read(t, f, ptr(10), ptr(19)); !bytes.Equal(data, content[10:20]) {
+			t.Errorf("unexpected content of a file in the home directory: %x", data)
+		}
+		ended := s.ended.Load()
+		if err := f.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for deadline := time.Now().Add(5 * time.Second); s.ended.Load() == ended; {
+			if time.Now().After(deadline) {
+				t.Fatal("expected Close to end the SFTP session")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		// reads after Close connect again
+		if data := read(t, f, ptr(0), ptr(3)); !bytes.Equal(data, content[:4]) {
+			t.Errorf("unexpected content after reconnecting: %x", data)
+		}
+		_ = f.Close()
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		t.Setenv("CLOUDZIP_SFTP_PASSWORD", "guess")
+		f, err := remote.Object(uri)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = f.Fetch(ctx, ptr(0), ptr(3))
+		if !errors.Is(err, remote.ErrAccessDenied) || !errors.Is(err, remote.ErrSFTP) {
+			t.Errorf("expected ErrAccessDenied and ErrSFTP, got %v", err)
+		}
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		t.Setenv("CLOUDZIP_SFTP_IDENTITY", keyPath)
+		_ = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), nil, 0o600)
+		defer func() { _ = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0o600) }()
+		f, err := remote.Object(uri)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = f.Fetch(ctx, ptr(0), ptr(3))
+		if !errors.Is(err, remote.ErrSFTP) || errors.Is(err, remote.ErrAccessDenied) || errors.Is(err, remote.ErrSSHTunnel) ||
+			!strings.Contains(err.Error(), "not in known_hosts") {
+			t.Errorf("expected ErrSFTP for a host that isn't known, got %v", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("CLOUDZIP_SFTP_IDENTITY", keyPath)
+		f, err := remote.Object("sftp://user@" + s.addr + filepath.ToSlash(filepath.Join(dir, "missing.zip")))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := f.Fetch(ctx, ptr(0), ptr(3)); !errors.Is(err, remote.ErrDoesNotExist) {
+			t.Errorf("expected ErrDoesNotExist, got %v", err)
+		}
+	})
+}
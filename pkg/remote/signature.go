@@ -0,0 +1,117 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// maxSignatureSize bounds the size of detached signatures read, which are a few hundred bytes
+const maxSignatureSize = 64 * 1024
+
+// SignatureURI returns the URI of the detached signature of the object at uri, by convention alongside it:
+// the same URI with ".asc" appended to its path (query parameters, e.g. of a presigned URL, are kept as they are)
+func SignatureURI(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidURI, uri)
+	}
+	parsed.Path += ".asc"
+	if parsed.RawPath != "" {
+		parsed.RawPath += ".asc"
+	}
+	return parsed.String(), nil
+}
+
+// ReadKeyring reads the public keys signatures are checked against, either armored (gpg --export --armor)
+// or binary (gpg --export)
+func ReadKeyring(r io.Reader) (openpgp.EntityList, error) {
+	br := bufio.NewReader(r)
+	if isArmored(br) {
+		return openpgp.ReadArmoredKeyRing(br)
+	}
+	return openpgp.ReadKeyRing(br)
+}
+
+// ReadSignature reads a detached signature from the object behind f
+func ReadSignature(ctx context.Context, f Fetcher) ([]byte, error) {
+	rc, err := f.Fetch(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	data, err := io.ReadAll(io.LimitReader(rc, maxSignatureSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSignatureSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrBadSignature, maxSignatureSize)
+	}
+	return data, nil
+}
+
+// VerifySignature checks signature, a detached OpenPGP signature (armored or binary), of the object behind f
+// against the keys of keyring, returning the key that made it. Failed checks return ErrBadSignature.
+// The whole object is read once, streamed through the hash of the signature: signatures by keys that aren't in
+// keyring fail before anything is read.
+func VerifySignature(ctx context.Context, f Fetcher, signature []byte, keyring openpgp.KeyRing) (*openpgp.Entity, error) {
+	sig := io.Reader(bytes.NewReader(signature))
+	if isArmored(bufio.NewReader(bytes.NewReader(signature))) {
+		block, err := armor.Decode(sig)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+		}
+		sig = block.Body
+	}
+	signed := &objectReader{ctx: ctx, f: f}
+	signer, err := openpgp.CheckDetachedSignature(keyring, signed, sig, nil)
+	if signed.err != nil {
+		return nil, fmt.Errorf("could not read the signed object: %w", signed.err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	return signer, nil
+}
+
+// isArmored reports whether r starts with an ASCII armor header, without consuming it
+func isArmored(r *bufio.Reader) bool {
+	prefix, _ := r.Peek(len("-----BEGIN PGP"))
+	return string(prefix) == "-----BEGIN PGP"
+}
+
+// objectReader reads a whole object, fetching it on first read. The error reading it is kept, so that it's not
+// mistaken for a bad signature.
+type objectReader struct {
+	ctx  context.Context
+	f    Fetcher
+	body io.Reader
+	err  error
+}
+
+func (o *objectReader) Read(p []byte) (int, error) {
+	if o.body == nil {
+		var start, end *int64
+		if size, err := SizeOf(o.ctx, o.f); err == nil && size > 0 {
+			// a ranged read, which may be split into parts fetched concurrently
+			first, last := int64(0), size-1
+			start, end = &first, &last
+		}
+		// not closed: closing a local fetcher's reader closes the underlying file, it's read to EOF instead
+		o.body, o.err = o.f.Fetch(o.ctx, start, end)
+		if o.err != nil {
+			return 0, o.err
+		}
+	}
+	n, err := o.body.Read(p)
+	if err != nil && err != io.EOF {
+		o.err = err
+	}
+	return n, err
+}
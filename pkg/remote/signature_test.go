@@ -0,0 +1,99 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+func TestVerifySignature(t *testing.T) {
+	signer, err := openpgp.NewEntity("signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := bytes.Repeat([]byte("signed archive content\n"), 1000)
+	armored, binary := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(armored, signer, bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := openpgp.DetachSign(binary, signer, bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// keyrings are read as exported by gpg, armored or not
+	exported := &bytes.Buffer{}
+	if err := signer.Serialize(exported); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exportedArmored := &bytes.Buffer{}
+	w, err := armor.Encode(exportedArmored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = w.Write(exported.Bytes())
+	_ = w.Close()
+	var keyring openpgp.EntityList
+	for _, b := range [][]byte{exported.Bytes(), exportedArmored.Bytes()} {
+		keyring, err = remote.ReadKeyring(bytes.NewReader(b))
+		if err != nil || len(keyring) != 1 {
+			t.Fatalf("expected to read the key, got %d keys: %v", len(keyring), err)
+		}
+	}
+
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)/2] ^= 1
+	cases := []struct {
+		name      string
+		data      []byte
+		signature []byte
+		keyring   openpgp.EntityList
+		expectErr error
+	}{
+		{"armored", data, armored.Bytes(), keyring, nil},
+		{"binary", data, binary.Bytes(), keyring, nil},
+		{"tampered", tampered, armored.Bytes(), keyring, remote.ErrBadSignature},
+		{"unknown_key", data, armored.Bytes(), openpgp.EntityList{other}, remote.ErrBadSignature},
+		{"not_a_signature", data, []byte("not a signature"), keyring, remote.ErrBadSignature},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			next := &rangeRecorder{data: c.data}
+			entity, err := remote.VerifySignature(context.Background(), next, c.signature, c.keyring)
+			if !errors.Is(err, c.expectErr) {
+				t.Fatalf("expected error %v, got %v", c.expectErr, err)
+			}
+			if c.expectErr == nil && entity.PrimaryKey.KeyId != signer.PrimaryKey.KeyId {
+				t.Errorf("expected the signature to be made by the signer's key, got %s", entity.PrimaryKey.KeyIdString())
+			}
+			if c.name == "unknown_key" && len(next.requested) > 0 {
+				t.Errorf("expected the archive not to be read for a signature by an unknown key, got requests %v", next.requested)
+			}
+		})
+	}
+}
+
+func TestSignatureURI(t *testing.T) {
+	cases := []struct {
+		uri, expected string
+	}{
+		{"s3://bucket/path/archive.zip", "s3://bucket/path/archive.zip.asc"},
+		{"https://example.com/archive.zip?X-Amz-Signature=abc", "https://example.com/archive.zip.asc?X-Amz-Signature=abc"},
+		{"file:///tmp/archive.zip", "file:///tmp/archive.zip.asc"},
+	}
+	for _, c := range cases {
+		got, err := remote.SignatureURI(c.uri)
+		if err != nil || got != c.expected {
+			t.Errorf("expected %s for %s, got %s (%v)", c.expected, c.uri, got, err)
+		}
+	}
+}
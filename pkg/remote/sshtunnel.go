@@ -0,0 +1,319 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// sshConnectTimeout bounds connecting and authenticating to the jump host
+	sshConnectTimeout = 15 * time.Second
+	// sshKeepAliveInterval is how often the jump host is pinged, so that idle mounts keep their connection
+	sshKeepAliveInterval = 30 * time.Second
+)
+
+// sshIdentityFiles are the keys tried, in ~/.ssh, as ssh does by default. Keys protected by a passphrase are
+// skipped: load them into ssh-agent instead.
+var sshIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// Dialer opens network connections, as net.Dialer does. Objects opened with WithDialer connect through it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+var _ Dialer = &SSHTunnel{}
+
+// SSHTunnel is an SSH connection to a jump host, through which connections to hosts only it can reach are opened
+// (as "ssh -D" does for the connections of a SOCKS proxy). The connection is reopened if it is lost.
+type SSHTunnel struct {
+	target string
+	dial   func(ctx context.Context) (*ssh.Client, error)
+	logger atomic.Pointer[slog.Logger]
+
+	l         sync.RWMutex
+	client    *ssh.Client
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ConnectVia connects to the jump host target, "[user@]host[:port]", authenticating with the keys of ssh-agent
+// (if SSH_AUTH_SOCK is set) and the default keys in ~/.ssh. The host key must be in ~/.ssh/known_hosts.
+// The user defaults to the current user, and the port to 22.
+func ConnectVia(ctx context.Context, target string) (*SSHTunnel, error) {
+	username, addr, err := parseSSHTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	authMethods := func(sshDir string) ([]ssh.AuthMethod, func(), error) {
+		auth, closeAgent := sshAuthMethods(sshDir)
+		if len(auth) == 0 {
+			closeAgent()
+			return nil, nil, fmt.Errorf("no SSH keys found in ssh-agent or in %s", sshDir)
+		}
+		return auth, closeAgent, nil
+	}
+	dial := func(ctx context.Context) (*ssh.Client, error) {
+		return sshDial(ctx, nil, addr, username, authMethods, nil, ErrSSHTunnel)
+	}
+	client, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := &SSHTunnel{target: target, dial: dial, client: client, done: make(chan struct{})}
+	t.logger.Store(slog.Default())
+	go t.keepAlive(client)
+	return t, nil
+}
+
+// sshDial connects to addr through dialer (directly if it is nil), logging in as user with the methods authMethods
+// returns for the ~/.ssh directory, along with a function releasing them (e.g. the ssh-agent connection) once
+// the handshake is over. The host key must be in ~/.ssh/known_hosts. Connecting, and then calling setup
+// with the client if it is set, must take less than sshConnectTimeout.
+// Errors wrap kind, and ErrAccessDenied too if the server rejected every method.
+func sshDial(ctx context.Context, dialer Dialer, addr, user string, authMethods func(sshDir string) ([]ssh.AuthMethod, func(), error),
+	setup func(client *ssh.Client) error, kind error) (*ssh.Client, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", kind, addr, err)
+	}
+	sshDir := filepath.Join(home, ".ssh")
+	knownHosts, err := knownhosts.New(filepath.Join(sshDir, "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: could not read known hosts: %v", kind, addr, err)
+	}
+	auth, release, err := authMethods(sshDir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", kind, addr, err)
+	}
+	defer release()
+	// the SSH package doesn't return typed authentication errors: once the host key is accepted, all that is left
+	// of the handshake is authentication, so any other failure than the connection's is the server rejecting us
+	var hostKeyAccepted atomic.Bool
+	cfg := &ssh.ClientConfig{
+		User: user,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if err := knownHosts(hostname, remote, key); err != nil {
+				return err
+			}
+			hostKeyAccepted.Store(true)
+			return nil
+		},
+		Timeout: sshConnectTimeout,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sshConnectTimeout)
+	defer cancel()
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", kind, addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		_ = conn.Close()
+		var keyErr *knownhosts.KeyError
+		var netErr net.Error
+		switch {
+		case errors.As(err, &keyErr) && len(keyErr.Want) == 0:
+			return nil, fmt.Errorf("%w: %s: host key is not in known_hosts, connect with ssh once to add it", kind, addr)
+		case hostKeyAccepted.Load() && !errors.As(err, &netErr):
+			return nil, fmt.Errorf("%w: %w: %s: %v", kind, ErrAccessDenied, addr, err)
+		}
+		return nil, fmt.Errorf("%w: %s: %v", kind, addr, err)
+	}
+	client := ssh.NewClient(sshConn, channels, requests)
+	if setup != nil {
+		if err := setup(client); err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("%w: %s: %v", kind, addr, err)
+		}
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return client, nil
+}
+
+// parseSSHTarget splits "[user@]host[:port]" into the user to log in as and the address to connect to
+func parseSSHTarget(target string) (string, string, error) {
+	username, host, ok := strings.Cut(target, "@")
+	if !ok {
+		host = target
+		current, err := user.Current()
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %s: no user given, and the current user is unknown", ErrSSHTunnel, target)
+		}
+		username = current.Username
+	}
+	if host == "" || username == "" {
+		return "", "", fmt.Errorf("%w: '%s', expected [user@]host[:port]", ErrSSHTunnel, target)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+	return username, host, nil
+}
+
+// sshAuthMethods returns the keys of ssh-agent, if running, and the unencrypted default keys in dir, along with
+// a function closing the connection to ssh-agent, which signs with its keys until then
+func sshAuthMethods(dir string) ([]ssh.AuthMethod, func()) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { _ = conn.Close() }
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range sshIdentityFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods, closeAgent
+}
+
+// keepAlive pings the jump host through client until the tunnel is closed, reconnecting when the connection is
+// lost or the jump host stops answering
+func (t *SSHTunnel) keepAlive(client *ssh.Client) {
+	ticker := time.NewTicker(sshKeepAliveInterval)
+	defer ticker.Stop()
+	lost := waitClosed(client)
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-lost:
+			t.logger.Load().Warn("lost the connection to the SSH jump host, reconnecting", "target", t.target)
+		case <-ticker.C:
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			if err == nil {
+				continue
+			}
+			t.logger.Load().Warn("SSH jump host stopped answering, reconnecting", "target", t.target, "error", err)
+		}
+		_ = client.Close()
+		if client = t.reconnect(ticker); client == nil {
+			return
+		}
+		lost = waitClosed(client)
+	}
+}
+
+// reconnect connects to the jump host again, retrying on every tick until it succeeds, and returns the new client.
+// It returns nil if the tunnel was closed meanwhile.
+func (t *SSHTunnel) reconnect(ticker *time.Ticker) *ssh.Client {
+	for {
+		client, err := t.dial(context.Background())
+		if err == nil {
+			t.l.Lock()
+			defer t.l.Unlock()
+			select {
+			case <-t.done:
+				_ = client.Close()
+				return nil
+			default:
+			}
+			t.client = client
+			t.logger.Load().Info("reconnected to the SSH jump host", "target", t.target)
+			return client
+		}
+		t.logger.Load().Warn("could not reconnect to the SSH jump host", "target", t.target, "error", err)
+		select {
+		case <-t.done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitClosed returns a channel closed once the connection of client is
+func waitClosed(client *ssh.Client) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+	}()
+	return closed
+}
+
+// SetLogger sets the logger losing and reopening the connection is reported to, slog's default logger until then
+func (t *SSHTunnel) SetLogger(logger *slog.Logger) {
+	t.logger.Store(logger)
+}
+
+// DialContext opens a connection to addr from the jump host. Connections fail while the tunnel is reconnecting.
+func (t *SSHTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	t.l.RLock()
+	client := t.client
+	t.l.RUnlock()
+	conn, err := client.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: could not connect to %s: %v", ErrSSHTunnel, t.target, addr, err)
+	}
+	return conn, nil
+}
+
+// Close closes the connection to the jump host, calling it again has no effect
+func (t *SSHTunnel) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.l.Lock()
+		defer t.l.Unlock()
+		close(t.done)
+		err = t.client.Close()
+	})
+	return err
+}
+
+// dialClient returns an HTTP client whose connections are opened by dialer, or one using http.DefaultTransport
+// if dialer is nil
+func dialClient(dialer Dialer) *http.Client {
+	if dialer == nil {
+		return &http.Client{}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
+
+// awsConfigOpts returns the options AWS configuration is loaded with, on top of opts, opening connections with
+// dialer if it is set
+func awsConfigOpts(dialer Dialer, opts ...func(*config.LoadOptions) error) []func(*config.LoadOptions) error {
+	if dialer == nil {
+		return opts
+	}
+	client := awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+		t.DialContext = dialer.DialContext
+	})
+	return append(opts, config.WithHTTPClient(client))
+}
@@ -0,0 +1,262 @@
+package remote_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// jumpHost is an SSH server accepting a single client key, which forwards direct-tcpip channels as sshd does
+type jumpHost struct {
+	addr      string
+	forwarded atomic.Int64
+
+	l     sync.Mutex
+	conns []net.Conn
+}
+
+func startJumpHost(t *testing.T, clientKey ssh.PublicKey) (*jumpHost, ssh.PublicKey) {
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	h := &jumpHost{addr: listener.Addr().String()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			h.l.Lock()
+			h.conns = append(h.conns, conn)
+			h.l.Unlock()
+			go h.serve(conn, cfg)
+		}
+	}()
+	return h, hostSigner.PublicKey()
+}
+
+// drop closes the connections of all clients, as a jump host restarting would
+func (h *jumpHost) drop() {
+	h.l.Lock()
+	defer h.l.Unlock()
+	for _, conn := range h.conns {
+		_ = conn.Close()
+	}
+	h.conns = nil
+}
+
+func (h *jumpHost) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+			continue
+		}
+		// host, port, originator host, originator port
+		extra := newChannel.ExtraData()
+		hostLen := binary.BigEndian.Uint32(extra)
+		host := string(extra[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(extra[4+hostLen:])
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)))
+		if err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			_ = target.Close()
+			continue
+		}
+		h.forwarded.Add(1)
+		go ssh.DiscardRequests(channelRequests)
+		go func() {
+			_, _ = io.Copy(channel, target)
+			_ = channel.CloseWrite()
+		}()
+		go func() {
+			_, _ = io.Copy(target, channel)
+			_ = target.Close()
+		}()
+	}
+}
+
+func TestConnectVia(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	_, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	clientSigner, _ := ssh.NewSignerFromKey(clientPriv)
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = os.MkdirAll(filepath.Join(home, ".ssh"), 0o700)
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h, hostKey := startJumpHost(t, clientSigner.PublicKey())
+
+	t.Run("unknown_host", func(t *testing.T) {
+		_ = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), nil, 0o600)
+		_, err := remote.ConnectVia(context.Background(), "user@"+h.addr)
+		if !errors.Is(err, remote.ErrSSHTunnel) || !strings.Contains(err.Error(), "not in known_hosts") {
+			t.Errorf("expected ErrSSHTunnel for a host that isn't known, got %v", err)
+		}
+	})
+
+	t.Run("rejected_key", func(t *testing.T) {
+		// a jump host that only accepts another key
+		other, otherHostKey := startJumpHost(t, hostKey)
+		line := knownhosts.Line([]string{knownhosts.Normalize(other.addr)}, otherHostKey)
+		_ = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0o600)
+		_, err := remote.ConnectVia(context.Background(), "user@"+other.addr)
+		if !errors.Is(err, remote.ErrSSHTunnel) || !errors.Is(err, remote.ErrAccessDenied) {
+			t.Errorf("expected ErrSSHTunnel and ErrAccessDenied for a rejected key, got %v", err)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := listener.Addr().String()
+		_ = listener.Close()
+		_, err := remote.ConnectVia(context.Background(), "user@"+addr)
+		if !errors.Is(err, remote.ErrSSHTunnel) {
+			t.Errorf("expected ErrSSHTunnel for an unreachable host, got %v", err)
+		}
+	})
+
+	t.Run("routed", func(t *testing.T) {
+		line := knownhosts.Line([]string{knownhosts.Normalize(h.addr)}, hostKey)
+		_ = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0o600)
+		tunnel, err := remote.ConnectVia(context.Background(), "user@"+h.addr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = tunnel.Close() }()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("through the tunnel"))
+		}))
+		defer server.Close()
+		read := func(t *testing.T, uri string, opts ...remote.ObjectOpt) {
+			t.Helper()
+			f, err := remote.Object(uri, opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			rc, err := f.Fetch(context.Background(), nil, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, _ := io.ReadAll(rc)
+			_ = rc.Close()
+			if string(data) != "through the tunnel" {
+				t.Errorf("unexpected response: %q", data)
+			}
+		}
+
+		read(t, server.URL, remote.WithDialer(tunnel))
+		if h.forwarded.Load() != 1 {
+			t.Errorf("expected the request to be forwarded by the jump host, got %d forwarded", h.forwarded.Load())
+		}
+		// objects opened without the dialer connect directly
+		read(t, server.URL)
+		if h.forwarded.Load() != 1 {
+			t.Errorf("expected a request without the dialer not to be forwarded, got %d forwarded", h.forwarded.Load())
+		}
+
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		t.Setenv("AWS_CONFIG_FILE", filepath.Join(home, "aws-config"))
+		read(t, "s3://bucket/a.zip", remote.WithS3Endpoint(server.URL), remote.WithDialer(tunnel))
+		if h.forwarded.Load() != 2 {
+			t.Errorf("expected the S3 request to be forwarded by the jump host, got %d forwarded", h.forwarded.Load())
+		}
+	})
+
+	t.Run("reconnects", func(t *testing.T) {
+		line := knownhosts.Line([]string{knownhosts.Normalize(h.addr)}, hostKey)
+		_ = os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0o600)
+		tunnel, err := remote.ConnectVia(context.Background(), "user@"+h.addr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer func() { _ = listener.Close() }()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				_ = conn.Close()
+			}
+		}()
+
+		h.drop()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			conn, err := tunnel.DialContext(context.Background(), "tcp", listener.Addr().String())
+			if err == nil {
+				_ = conn.Close()
+				break
+			}
+			if !errors.Is(err, remote.ErrSSHTunnel) {
+				t.Fatalf("expected ErrSSHTunnel while reconnecting, got %v", err)
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the tunnel to reconnect, got %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if err := tunnel.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := tunnel.Close(); err != nil {
+			t.Errorf("expected closing twice not to fail, got %v", err)
+		}
+	})
+}
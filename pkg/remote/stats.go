@@ -0,0 +1,81 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// Stats accumulates the number of requests issued and bytes read from a remote object
+type Stats struct {
+	requests  atomic.Int64
+	bytesRead atomic.Int64
+
+	partSize        atomic.Int64
+	peakParallelism atomic.Int64
+}
+
+func (s *Stats) Requests() int64 {
+	return s.requests.Load()
+}
+
+func (s *Stats) BytesRead() int64 {
+	return s.bytesRead.Load()
+}
+
+// PartSize is the size of the parts reads are split into by ParallelFetcher, 0 if reads aren't split
+func (s *Stats) PartSize() int64 {
+	return s.partSize.Load()
+}
+
+// PeakParallelism is the largest number of parts ParallelFetcher fetched at once
+func (s *Stats) PeakParallelism() int64 {
+	return s.peakParallelism.Load()
+}
+
+// CountingFetcher wraps a Fetcher, accounting for every request made and every byte actually read
+// from the returned readers (rather than the size of the requested range).
+func CountingFetcher(f Fetcher, stats *Stats) Fetcher {
+	return &countingFetcher{next: f, stats: stats}
+}
+
+type countingFetcher struct {
+	next  Fetcher
+	stats *Stats
+}
+
+func (c *countingFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	c.stats.requests.Add(1)
+	rc, err := c.next.Fetch(ctx, startOffset, endOffset)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{next: rc, stats: c.stats}, nil
+}
+
+func (c *countingFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return SizeOf(ctx, c.next)
+}
+
+func (c *countingFetcher) StoredChecksum(ctx context.Context, algorithm string) ([]byte, error) {
+	return StoredChecksum(ctx, c.next, algorithm)
+}
+
+func (c *countingFetcher) ETag(ctx context.Context) (string, error) {
+	return ETagOf(ctx, c.next)
+}
+
+type countingReader struct {
+	next  io.ReadCloser
+	stats *Stats
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.next.Read(p)
+	r.stats.bytesRead.Add(int64(n))
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return r.next.Close()
+}
@@ -0,0 +1,393 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	swiftEnvAuthUrl                 = "OS_AUTH_URL"
+	swiftEnvUsername                = "OS_USERNAME"
+	swiftEnvUserId                  = "OS_USER_ID"
+	swiftEnvPassword                = "OS_PASSWORD"
+	swiftEnvUserDomainName          = "OS_USER_DOMAIN_NAME"
+	swiftEnvProjectName             = "OS_PROJECT_NAME"
+	swiftEnvProjectId               = "OS_PROJECT_ID"
+	swiftEnvProjectDomainName       = "OS_PROJECT_DOMAIN_NAME"
+	swiftEnvRegionName              = "OS_REGION_NAME"
+	swiftEnvInterface               = "OS_INTERFACE"
+	swiftEnvApplicationCredId       = "OS_APPLICATION_CREDENTIAL_ID"
+	swiftEnvApplicationCredSecret   = "OS_APPLICATION_CREDENTIAL_SECRET"
+	swiftEnvStorageUrl              = "OS_STORAGE_URL"
+	swiftEnvAuthToken               = "OS_AUTH_TOKEN"
+	swiftDefaultDomain              = "Default"
+	swiftDefaultInterface           = "public"
+	swiftObjectStoreServiceType     = "object-store"
+	swiftTokenExpiryWindow          = time.Minute
+	swiftKeystoneTokenPath          = "/auth/tokens"
+	swiftKeystoneSubjectTokenHeader = "X-Subject-Token"
+)
+
+var ErrSwiftAuth = errors.New("swift authentication failed")
+
+// swiftConfig holds the Keystone (v3) credentials used to authenticate, taken from the standard OS_* variables
+type swiftConfig struct {
+	AuthUrl           string
+	Username          string
+	UserId            string
+	Password          string
+	UserDomainName    string
+	ProjectName       string
+	ProjectId         string
+	ProjectDomainName string
+	Region            string
+	Interface         string
+	AppCredentialId   string
+	AppCredentialKey  string
+	// StorageUrl and AuthToken skip Keystone altogether, when both are set
+	StorageUrl string
+	AuthToken  string
+}
+
+func loadSwiftConfig() (*swiftConfig, error) {
+	cfg := &swiftConfig{
+		AuthUrl:           strings.TrimSuffix(os.Getenv(swiftEnvAuthUrl), "/"),
+		Username:          os.Getenv(swiftEnvUsername),
+		UserId:            os.Getenv(swiftEnvUserId),
+		Password:          os.Getenv(swiftEnvPassword),
+		UserDomainName:    os.Getenv(swiftEnvUserDomainName),
+		ProjectName:       os.Getenv(swiftEnvProjectName),
+		ProjectId:         os.Getenv(swiftEnvProjectId),
+		ProjectDomainName: os.Getenv(swiftEnvProjectDomainName),
+		Region:            os.Getenv(swiftEnvRegionName),
+		Interface:         os.Getenv(swiftEnvInterface),
+		AppCredentialId:   os.Getenv(swiftEnvApplicationCredId),
+		AppCredentialKey:  os.Getenv(swiftEnvApplicationCredSecret),
+		StorageUrl:        strings.TrimSuffix(os.Getenv(swiftEnvStorageUrl), "/"),
+		AuthToken:         os.Getenv(swiftEnvAuthToken),
+	}
+	if cfg.StorageUrl != "" && cfg.AuthToken != "" {
+		return cfg, nil
+	}
+	if cfg.AuthUrl == "" {
+		return nil, fmt.Errorf("%w: %s is not set", ErrSwiftAuth, swiftEnvAuthUrl)
+	}
+	if !strings.HasSuffix(cfg.AuthUrl, "/v3") {
+		cfg.AuthUrl += "/v3"
+	}
+	if cfg.Interface == "" {
+		cfg.Interface = swiftDefaultInterface
+	}
+	if cfg.UserDomainName == "" {
+		cfg.UserDomainName = swiftDefaultDomain
+	}
+	if cfg.ProjectDomainName == "" {
+		cfg.ProjectDomainName = swiftDefaultDomain
+	}
+	return cfg, nil
+}
+
+// keystoneAuthRequest returns the body of a Keystone v3 token request for cfg's credentials
+func (cfg *swiftConfig) keystoneAuthRequest() any {
+	type domain struct {
+		Name string `json:"name"`
+	}
+	type user struct {
+		Id       string  `json:"id,omitempty"`
+		Name     string  `json:"name,omitempty"`
+		Password string  `json:"password"`
+		Domain   *domain `json:"domain,omitempty"`
+	}
+	if cfg.AppCredentialId != "" {
+		// application credentials are already scoped to a project
+		return map[string]any{"auth": map[string]any{"identity": map[string]any{
+			"methods": []string{"application_credential"},
+			"application_credential": map[string]string{
+				"id": cfg.AppCredentialId, "secret": cfg.AppCredentialKey,
+			},
+		}}}
+	}
+	u := user{Id: cfg.UserId, Name: cfg.Username, Password: cfg.Password}
+	if u.Id == "" {
+		u.Domain = &domain{Name: cfg.UserDomainName}
+	}
+	project := map[string]any{"domain": domain{Name: cfg.ProjectDomainName}, "name": cfg.ProjectName}
+	if cfg.ProjectId != "" {
+		project = map[string]any{"id": cfg.ProjectId}
+	}
+	return map[string]any{"auth": map[string]any{
+		"identity": map[string]any{
+			"methods":  []string{"password"},
+			"password": map[string]any{"user": u},
+		},
+		"scope": map[string]any{"project": project},
+	}}
+}
+
+type keystoneTokenResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Catalog   []struct {
+			Type      string `json:"type"`
+			Endpoints []struct {
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				RegionId  string `json:"region_id"`
+				Url       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+// objectStoreUrl returns the object-store endpoint from the catalog matching the interface and region (if set)
+func (t *keystoneTokenResponse) objectStoreUrl(cfg *swiftConfig) (string, error) {
+	for _, service := range t.Token.Catalog {
+		if service.Type != swiftObjectStoreServiceType {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface != cfg.Interface {
+				continue
+			}
+			if cfg.Region != "" && endpoint.Region != cfg.Region && endpoint.RegionId != cfg.Region {
+				continue
+			}
+			return strings.TrimSuffix(endpoint.Url, "/"), nil
+		}
+	}
+	return "", fmt.Errorf("%w: no %s endpoint for interface '%s' and region '%s' in the service catalog",
+		ErrSwiftAuth, swiftObjectStoreServiceType, cfg.Interface, cfg.Region)
+}
+
+type swiftParsedUri struct {
+	Account   string
+	Container string
+	Object    string
+}
+
+// swiftParseUri parses swift://account/container/object.zip
+func swiftParseUri(uri string) (*swiftParsedUri, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	container, object, _ := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if parsed.Host == "" || container == "" || object == "" {
+		return nil, fmt.Errorf("%w: expected swift://account/container/object, got %s", ErrInvalidURI, uri)
+	}
+	return &swiftParsedUri{Account: parsed.Host, Container: container, Object: object}, nil
+}
+
+// SwiftFetcher reads objects from OpenStack Swift (or Swift-compatible APIs such as OCI Object Storage),
+// authenticating with Keystone v3
+type SwiftFetcher struct {
+	uri    *swiftParsedUri
+	cfg    *swiftConfig
+	logger *slog.Logger
+	client *http.Client
+
+	l          sync.Mutex
+	token      string
+	storageUrl string
+	expires    time.Time
+}
+
+var _ Fetcher = &SwiftFetcher{}
+
+func NewSwiftFetcher(uri string) (*SwiftFetcher, error) {
+	parsed, err := swiftParseUri(uri)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadSwiftConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &SwiftFetcher{
+		uri:    parsed,
+		cfg:    cfg,
+		logger: DummyLogger(),
+		client: dialClient(nil),
+	}, nil
+}
+
+func (s *SwiftFetcher) setLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+func (s *SwiftFetcher) setDialer(dialer Dialer) {
+	s.client = dialClient(dialer)
+}
+
+// authenticate returns a token and the storage URL of the authenticated account, from cache unless it expired
+func (s *SwiftFetcher) authenticate(ctx context.Context) (string, string, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.cfg.StorageUrl != "" && s.cfg.AuthToken != "" {
+		return s.cfg.AuthToken, s.cfg.StorageUrl, nil
+	}
+	if s.token != "" && (s.expires.IsZero() || time.Now().Add(swiftTokenExpiryWindow).Before(s.expires)) {
+		return s.token, s.storageUrl, nil
+	}
+	body, err := json.Marshal(s.cfg.keystoneAuthRequest())
+	if err != nil {
+		return "", "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.AuthUrl+swiftKeystoneTokenPath, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	start := time.Now()
+	response, err := s.client.Do(req)
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "keystone.Auth", "url", s.cfg.AuthUrl, "took_ms", tookMs, "error", err)
+		return "", "", err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		s.logger.ErrorContext(ctx, "keystone.Auth", "url", s.cfg.AuthUrl, "took_ms", tookMs, "error", response.Status)
+		return "", "", fmt.Errorf("%w: Keystone returned %s", ErrSwiftAuth, response.Status)
+	}
+	token := response.Header.Get(swiftKeystoneSubjectTokenHeader)
+	if token == "" {
+		return "", "", fmt.Errorf("%w: Keystone returned no token", ErrSwiftAuth)
+	}
+	tokenResponse := &keystoneTokenResponse{}
+	if err := json.NewDecoder(response.Body).Decode(tokenResponse); err != nil {
+		return "", "", fmt.Errorf("%w: could not parse Keystone response: %v", ErrSwiftAuth, err)
+	}
+	storageUrl, err := tokenResponse.objectStoreUrl(s.cfg)
+	if err != nil {
+		return "", "", err
+	}
+	s.logger.DebugContext(ctx, "keystone.Auth", "url", s.cfg.AuthUrl, "took_ms", tookMs,
+		"storage_url", storageUrl, "expires", tokenResponse.Token.ExpiresAt)
+	s.token, s.storageUrl, s.expires = token, storageUrl, tokenResponse.Token.ExpiresAt
+	return s.token, s.storageUrl, nil
+}
+
+// invalidateToken makes the next request authenticate again
+func (s *SwiftFetcher) invalidateToken() {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.token = ""
+}
+
+// objectUrl returns the URL of the object, in the account named by the URI rather than the one authenticated
+// against, which is the last path segment of the storage URL (e.g. https://swift.example.com/v1/AUTH_<project>)
+func (s *SwiftFetcher) objectUrl(storageUrl string) string {
+	base := storageUrl
+	if i := strings.LastIndex(storageUrl, "/"); i != -1 {
+		base = storageUrl[:i]
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", base, url.PathEscape(s.uri.Account), url.PathEscape(s.uri.Container),
+		(&url.URL{Path: s.uri.Object}).EscapedPath())
+}
+
+// do makes a request to the object, authenticating again once if the token was rejected
+func (s *SwiftFetcher) do(ctx context.Context, method string, rangeHeader *string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		token, storageUrl, err := s.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, s.objectUrl(storageUrl), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Auth-Token", token)
+		if rangeHeader != nil {
+			req.Header.Set("Range", *rangeHeader)
+		}
+		requestIdentity(req)
+		response, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode == http.StatusUnauthorized && attempt == 0 && s.cfg.AuthToken == "" {
+			_ = response.Body.Close()
+			s.invalidateToken()
+			continue
+		}
+		return response, nil
+	}
+}
+
+func (s *SwiftFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	rangeHeader := buildRange(startOffset, endOffset)
+	rangeHeaderStr := ""
+	if rangeHeader != nil {
+		rangeHeaderStr = *rangeHeader
+	}
+	start := time.Now()
+	response, err := s.do(ctx, http.MethodGet, rangeHeader)
+	if err == nil {
+		err = checkResponse("swift.Get", response, ErrSwiftAuth)
+	}
+	if err == nil {
+		err = checkIdentity(response)
+	}
+	tookMs := time.Since(start).Milliseconds()
+	if errors.Is(err, ErrDoesNotExist) {
+		s.logger.WarnContext(ctx, "swift.Get", "range", rangeHeaderStr, "container", s.uri.Container, "object", s.uri.Object, "took_ms", tookMs, "error", "NotFound")
+		return nil, err
+	} else if err != nil {
+		s.logger.ErrorContext(ctx, "swift.Get", "range", rangeHeaderStr, "container", s.uri.Container, "object", s.uri.Object, "took_ms", tookMs, "error", err)
+		return nil, err
+	}
+	s.logger.DebugContext(ctx, "swift.Get", "range", rangeHeaderStr, "container", s.uri.Container, "object", s.uri.Object, "took_ms", tookMs, "error", nil)
+	return response.Body, nil
+}
+
+// SizeOf returns the size of the object from a HEAD request
+func (s *SwiftFetcher) SizeOf(ctx context.Context) (int64, error) {
+	start := time.Now()
+	response, err := s.do(ctx, http.MethodHead, nil)
+	if err == nil {
+		err = checkResponse("swift.Head", response, ErrSwiftAuth)
+	}
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "swift.Head", "container", s.uri.Container, "object", s.uri.Object, "took_ms", tookMs, "error", err)
+		return 0, err
+	}
+	_ = response.Body.Close()
+	s.logger.DebugContext(ctx, "swift.Head", "container", s.uri.Container, "object", s.uri.Object, "took_ms", tookMs, "error", nil)
+	if response.ContentLength < 0 {
+		return 0, fmt.Errorf("%w: HEAD returned no content length", ErrSizeUnsupported)
+	}
+	return response.ContentLength, nil
+}
+
+// ETag returns the ETag of the object from a HEAD request
+func (s *SwiftFetcher) ETag(ctx context.Context) (string, error) {
+	start := time.Now()
+	response, err := s.do(ctx, http.MethodHead, nil)
+	if err == nil {
+		err = checkResponse("swift.Head", response, ErrSwiftAuth)
+	}
+	tookMs := time.Since(start).Milliseconds()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "swift.Head", "container", s.uri.Container, "object", s.uri.Object, "took_ms", tookMs, "error", err)
+		return "", err
+	}
+	_ = response.Body.Close()
+	s.logger.DebugContext(ctx, "swift.Head", "container", s.uri.Container, "object", s.uri.Object, "took_ms", tookMs, "error", nil)
+	if response.Header.Get("ETag") == "" {
+		return "", fmt.Errorf("%w: HEAD returned no ETag", ErrNoETag)
+	}
+	return response.Header.Get("ETag"), nil
+}
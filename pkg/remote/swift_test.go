@@ -0,0 +1,127 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// swiftServer serves a Keystone token endpoint and a Swift object store with a single object
+func swiftServer(t *testing.T, content string) (*httptest.Server, *atomic.Int64) {
+	var auths atomic.Int64
+	var currentToken atomic.Value
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"password":"secret"`) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		token := fmt.Sprintf("token-%d", auths.Add(1))
+		currentToken.Store(token)
+		w.Header().Set("X-Subject-Token", token)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"token": {"expires_at": "2999-01-01T00:00:00Z", "catalog": [
+			{"type": "identity", "endpoints": [{"interface": "public", "region": "r1", "url": "%[1]s/v3"}]},
+			{"type": "object-store", "endpoints": [
+				{"interface": "internal", "region": "r1", "url": "http://internal.invalid/v1/AUTH_project"},
+				{"interface": "public", "region": "r1", "url": "%[1]s/v1/AUTH_project"}
+			]}
+		]}}`, server.URL)
+	})
+	mux.HandleFunc("/v1/AUTH_shared/container/path/to/archive.zip", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != currentToken.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "archive.zip", time.Time{}, strings.NewReader(content))
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Setenv("OS_AUTH_URL", server.URL+"/v3")
+	t.Setenv("OS_USERNAME", "user")
+	t.Setenv("OS_PASSWORD", "secret")
+	t.Setenv("OS_PROJECT_NAME", "project")
+	t.Setenv("OS_REGION_NAME", "r1")
+	return server, &auths
+}
+
+func TestSwiftFetcher(t *testing.T) {
+	content := "0123456789abcdef"
+	_, auths := swiftServer(t, content)
+	ctx := context.Background()
+	f, err := remote.Object("swift://AUTH_shared/container/path/to/archive.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start, end := int64(2), int64(5)
+	r, err := f.Fetch(ctx, &start, &end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != content[2:6] {
+		t.Errorf("expected %q, got %q", content[2:6], data)
+	}
+	size, err := remote.SizeOf(ctx, f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size != int64(len(content)) {
+		t.Errorf("expected size %d, got %d", len(content), size)
+	}
+	if auths.Load() != 1 {
+		t.Errorf("expected the token to be reused, authenticated %d times", auths.Load())
+	}
+
+	t.Run("not_found", func(t *testing.T) {
+		missing, err := remote.Object("swift://AUTH_shared/container/missing.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := missing.Fetch(ctx, nil, nil); !errors.Is(err, remote.ErrDoesNotExist) {
+			t.Errorf("expected ErrDoesNotExist, got %v", err)
+		}
+	})
+
+	t.Run("rejected_token", func(t *testing.T) {
+		// another fetcher authenticated since, which revokes the token f holds
+		if auths.Load() < 2 {
+			t.Fatalf("expected another authentication, got %d", auths.Load())
+		}
+		r, err := f.Fetch(ctx, &start, &end)
+		if err != nil {
+			t.Fatalf("expected a rejected token to be refreshed, got %v", err)
+		}
+		_ = r.Close()
+	})
+
+	t.Run("bad_credentials", func(t *testing.T) {
+		t.Setenv("OS_PASSWORD", "wrong")
+		f, err := remote.Object("swift://AUTH_shared/container/path/to/archive.zip")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := f.Fetch(ctx, nil, nil); !errors.Is(err, remote.ErrSwiftAuth) {
+			t.Errorf("expected ErrSwiftAuth, got %v", err)
+		}
+	})
+
+	t.Run("invalid_uri", func(t *testing.T) {
+		if _, err := remote.Object("swift://AUTH_shared/container"); !errors.Is(err, remote.ErrInvalidURI) {
+			t.Errorf("expected ErrInvalidURI, got %v", err)
+		}
+	})
+}
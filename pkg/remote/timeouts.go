@@ -0,0 +1,184 @@
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HttpTimeoutPhase is the part of an HTTP request an HttpTimeoutError applies to
+type HttpTimeoutPhase string
+
+const (
+	// HttpPhaseTLSHandshake is the TLS handshake with the server
+	HttpPhaseTLSHandshake HttpTimeoutPhase = "tls"
+	// HttpPhaseFirstByte is the time from sending the request to receiving the first byte of the response
+	HttpPhaseFirstByte HttpTimeoutPhase = "first-byte"
+	// HttpPhaseTotal is the entire request, including reading the response body
+	HttpPhaseTotal HttpTimeoutPhase = "total"
+)
+
+var ErrHttpTimeout = errors.New("HTTP request timed out")
+
+// HttpTimeoutError wraps ErrHttpTimeout, naming the phase of an HTTP request that exceeded its timeout
+type HttpTimeoutError struct {
+	Phase HttpTimeoutPhase
+	Limit time.Duration
+}
+
+func (e *HttpTimeoutError) Error() string {
+	return fmt.Sprintf("%s: %s timeout of %s exceeded", ErrHttpTimeout, e.Phase, e.Limit)
+}
+
+func (e *HttpTimeoutError) Unwrap() error {
+	return ErrHttpTimeout
+}
+
+// HttpTimeouts bounds the phases of HTTP requests separately. A zero timeout means no limit.
+type HttpTimeouts struct {
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+	// Total includes reading the response body. A single request may stream an entire entry,
+	// so it isn't limited by default.
+	Total time.Duration
+}
+
+var DefaultHttpTimeouts = HttpTimeouts{
+	TLSHandshake: 10 * time.Second,
+	FirstByte:    30 * time.Second,
+}
+
+// ParseHttpTimeouts parses a comma separated list of phase=duration pairs, e.g. "tls=5s,first-byte=10s,total=5m".
+// Phases that aren't listed keep their default, and a duration of 0 removes the limit.
+func ParseHttpTimeouts(s string) (HttpTimeouts, error) {
+	timeouts := DefaultHttpTimeouts
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		phase, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return timeouts, fmt.Errorf("%w: invalid HTTP timeout '%s', expected phase=duration", ErrInvalidHttpConfig, pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return timeouts, fmt.Errorf("%w: invalid duration for HTTP timeout '%s': '%s'", ErrInvalidHttpConfig, phase, value)
+		}
+		switch HttpTimeoutPhase(strings.TrimSpace(phase)) {
+		case HttpPhaseTLSHandshake:
+			timeouts.TLSHandshake = d
+		case HttpPhaseFirstByte:
+			timeouts.FirstByte = d
+		case HttpPhaseTotal:
+			timeouts.Total = d
+		default:
+			return timeouts, fmt.Errorf("%w: unknown HTTP timeout phase '%s', expected one of: %s, %s, %s",
+				ErrInvalidHttpConfig, phase, HttpPhaseTLSHandshake, HttpPhaseFirstByte, HttpPhaseTotal)
+		}
+	}
+	return timeouts, nil
+}
+
+// timedRequest enforces HttpTimeouts on a single request: each phase runs a timer that cancels the request
+// with an HttpTimeoutError as its cause
+type timedRequest struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	timers map[HttpTimeoutPhase]*time.Timer
+}
+
+// withTimeouts returns req with timeouts applied, and the timedRequest tracking it
+func withTimeouts(req *http.Request, timeouts HttpTimeouts) (*http.Request, *timedRequest) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	t := &timedRequest{ctx: ctx, cancel: cancel, timers: make(map[HttpTimeoutPhase]*time.Timer)}
+	t.start(HttpPhaseTotal, timeouts.Total)
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart:    func() { t.start(HttpPhaseTLSHandshake, timeouts.TLSHandshake) },
+		TLSHandshakeDone:     func(_ tls.ConnectionState, _ error) { t.stop(HttpPhaseTLSHandshake) },
+		WroteRequest:         func(_ httptrace.WroteRequestInfo) { t.start(HttpPhaseFirstByte, timeouts.FirstByte) },
+		GotFirstResponseByte: func() { t.stop(HttpPhaseFirstByte) },
+	}
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace)), t
+}
+
+func (t *timedRequest) start(phase HttpTimeoutPhase, limit time.Duration) {
+	if limit <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if timer, ok := t.timers[phase]; ok {
+		timer.Stop()
+	}
+	t.timers[phase] = time.AfterFunc(limit, func() {
+		t.cancel(&HttpTimeoutError{Phase: phase, Limit: limit})
+	})
+}
+
+func (t *timedRequest) stop(phase HttpTimeoutPhase) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if timer, ok := t.timers[phase]; ok {
+		timer.Stop()
+		delete(t.timers, phase)
+	}
+}
+
+func (t *timedRequest) stopAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for phase, timer := range t.timers {
+		timer.Stop()
+		delete(t.timers, phase)
+	}
+}
+
+// err returns the HttpTimeoutError that interrupted the request, if that is what caused err
+func (t *timedRequest) err(err error) error {
+	var timeoutErr *HttpTimeoutError
+	if err != nil && err != io.EOF && errors.As(context.Cause(t.ctx), &timeoutErr) {
+		return timeoutErr
+	}
+	return err
+}
+
+// done stops the timers and releases the request's context
+func (t *timedRequest) done() {
+	t.stopAll()
+	t.cancel(nil)
+}
+
+// body wraps the response body, so that reads interrupted by a timeout return the HttpTimeoutError.
+// The timers are released once the body is read to the end or closed.
+func (t *timedRequest) body(body io.ReadCloser) io.ReadCloser {
+	return &timedBody{body: body, t: t}
+}
+
+type timedBody struct {
+	body io.ReadCloser
+	t    *timedRequest
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if err == io.EOF {
+		b.t.stopAll()
+	}
+	return n, b.t.err(err)
+}
+
+func (b *timedBody) Close() error {
+	err := b.body.Close()
+	b.t.done()
+	return err
+}
@@ -0,0 +1,144 @@
+package zipfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// ChecksumAlgorithm is the checksum that content is verified with
+type ChecksumAlgorithm string
+
+const (
+	// ChecksumCRC32 is the CRC32 (IEEE polynomial) that zip archives store for every entry
+	ChecksumCRC32 ChecksumAlgorithm = remote.ChecksumCRC32
+	// ChecksumCRC32C is the CRC32 with the Castagnoli polynomial, which S3 may store for whole objects
+	ChecksumCRC32C ChecksumAlgorithm = remote.ChecksumCRC32C
+	// ChecksumSHA256 is a cryptographic hash, which S3 may store for whole objects
+	ChecksumSHA256 ChecksumAlgorithm = remote.ChecksumSHA256
+	// ChecksumNone only checks the size of entries
+	ChecksumNone ChecksumAlgorithm = "none"
+)
+
+var (
+	ErrUnknownChecksumAlgorithm = errors.New("unknown checksum algorithm")
+	ErrChecksumMismatch         = fmt.Errorf("%w: checksum mismatch", ErrCorruptArchive)
+
+	checksumAlgorithms = []ChecksumAlgorithm{ChecksumCRC32, ChecksumCRC32C, ChecksumSHA256, ChecksumNone}
+)
+
+// ParseChecksumAlgorithm parses one of "crc32-ieee" ("crc32" is accepted too), "crc32c", "sha256" or "none".
+// An empty string means crc32-ieee.
+func ParseChecksumAlgorithm(s string) (ChecksumAlgorithm, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "crc32" {
+		return ChecksumCRC32, nil
+	}
+	if !slices.Contains(checksumAlgorithms, ChecksumAlgorithm(s)) {
+		names := make([]string, len(checksumAlgorithms))
+		for i, a := range checksumAlgorithms {
+			names[i] = string(a)
+		}
+		return "", fmt.Errorf("%w: '%s' (expected one of: %s)", ErrUnknownChecksumAlgorithm, s, strings.Join(names, ", "))
+	}
+	return ChecksumAlgorithm(s), nil
+}
+
+// New returns a hash computing the checksum, or nil for ChecksumNone
+func (a ChecksumAlgorithm) New() hash.Hash {
+	switch a {
+	case ChecksumCRC32, "":
+		return crc32.NewIEEE()
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case ChecksumSHA256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// StoredForEntries reports whether zip archives store the checksum for each entry: only CRC32 is.
+// Entries read with other algorithms can only be checked for size.
+func (a ChecksumAlgorithm) StoredForEntries() bool {
+	return a == ChecksumCRC32 || a == ""
+}
+
+// VerifyingReaderFor is VerifyingReader, with the checksum checked chosen by algorithm.
+// The size of entries is checked regardless; their content only if zip stores the algorithm's checksum (CRC32).
+func VerifyingReaderFor(r io.Reader, f *CDR, algorithm ChecksumAlgorithm) io.Reader {
+	if decompressor(f.CompressionMethod) == nil {
+		return r
+	}
+	v := &verifyingReader{r: r, f: f}
+	if algorithm.StoredForEntries() {
+		v.crc = crc32.NewIEEE()
+	}
+	return v
+}
+
+// warnUnstoredChecksum logs, once per parser, that entries can't be checked with the configured algorithm
+func (p *CentralDirectoryParser) warnUnstoredChecksum() {
+	p.checksumWarning.Do(func() {
+		if p.checksum.StoredForEntries() || p.checksum == ChecksumNone {
+			return
+		}
+		p.logger.WarnContext(p.ctx, "zip archives don't store this checksum for entries, only checking their size",
+			"checksum_algorithm", p.checksum)
+	})
+}
+
+// verifyArchiveChecksum reads the whole archive, comparing its checksum to the one stored by the backend.
+// It is skipped (with a warning, if entries couldn't be checked either) when the backend doesn't store one.
+func (p *CentralDirectoryParser) verifyArchiveChecksum() error {
+	if p.checksum == ChecksumNone {
+		return nil
+	}
+	store, ok := p.reader.(interface {
+		StoredChecksum(algorithm string) ([]byte, error)
+	})
+	var expected []byte
+	err := fmt.Errorf("%w: backend doesn't store checksums", remote.ErrNoStoredChecksum)
+	if ok {
+		expected, err = store.StoredChecksum(string(p.checksum))
+	}
+	if errors.Is(err, remote.ErrNoStoredChecksum) {
+		log := p.logger.DebugContext
+		if !p.checksum.StoredForEntries() {
+			log = p.logger.WarnContext
+		}
+		log(p.ctx, "no stored checksum of the archive, skipping its verification",
+			"checksum_algorithm", p.checksum, "reason", err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	sizer, ok := p.reader.(SizeFetcher)
+	if !ok {
+		return nil
+	}
+	size, err := sizer.Size()
+	if err != nil {
+		return err
+	}
+	h := p.checksum.New()
+	if _, err := io.Copy(h, &windowReader{ctx: p.ctx, fetcher: p.reader, end: size, window: p.cdWindowSize}); err != nil {
+		return err
+	}
+	if actual := h.Sum(nil); !bytes.Equal(actual, expected) {
+		return fmt.Errorf("%w: %s of the archive is %x, the backend stored %x", ErrChecksumMismatch, p.checksum, actual, expected)
+	}
+	p.logger.InfoContext(p.ctx, "verified the archive against its stored checksum", "checksum_algorithm", p.checksum)
+	return nil
+}
+
+func (a ChecksumAlgorithm) String() string {
+	return string(a)
+}
@@ -0,0 +1,123 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// checksumStoringFetcher is a fetcher whose backend stores checksums of the whole object
+type checksumStoringFetcher struct {
+	remote.Fetcher
+	stored map[string][]byte
+}
+
+func (f *checksumStoringFetcher) SizeOf(ctx context.Context) (int64, error) {
+	return remote.SizeOf(ctx, f.Fetcher)
+}
+
+func (f *checksumStoringFetcher) StoredChecksum(_ context.Context, algorithm string) ([]byte, error) {
+	checksum, ok := f.stored[algorithm]
+	if !ok {
+		return nil, remote.ErrNoStoredChecksum
+	}
+	return checksum, nil
+}
+
+func TestCentralDirectoryParser_ChecksumAlgorithm(t *testing.T) {
+	data := verifyTestZip(t)
+	crc32c := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	_, _ = crc32c.Write(data)
+	digest := sha256.Sum256(data)
+	stored := map[string][]byte{zipfile.ChecksumCRC32C.String(): crc32c.Sum(nil), zipfile.ChecksumSHA256.String(): digest[:]}
+	corrupt := bytes.Clone(data)
+	corrupt[bytes.Index(corrupt, []byte("contents of b.txt"))] ^= 0xff
+
+	newParser := func(data []byte, stored map[string][]byte, algorithm zipfile.ChecksumAlgorithm) *zipfile.CentralDirectoryParser {
+		fetcher := &checksumStoringFetcher{
+			Fetcher: memFetcher(data),
+			stored:  stored,
+		}
+		return zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), fetcher),
+			zipfile.WithVerifyReads(true), zipfile.WithChecksumAlgorithm(algorithm), zipfile.WithLogger(remote.DummyLogger()))
+	}
+	verify := func(p *zipfile.CentralDirectoryParser) error {
+		records, err := p.GetCentralDirectory()
+		if err != nil {
+			t.Fatalf("unexpected error parsing central directory: %v", err)
+		}
+		return p.Verify(records, zipfile.VerifyFull)
+	}
+	read := func(p *zipfile.CentralDirectoryParser, name string) error {
+		r, err := p.Read(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = io.ReadAll(r)
+		return err
+	}
+
+	cases := []struct {
+		Name      string
+		Algorithm zipfile.ChecksumAlgorithm
+		Data      []byte
+		Stored    map[string][]byte
+		// ReadErr is expected reading the corrupt entry, VerifyErr verifying the archive
+		ReadErr   error
+		VerifyErr error
+	}{
+		{"crc32_valid", zipfile.ChecksumCRC32, data, nil, nil, nil},
+		{"crc32_corrupt", zipfile.ChecksumCRC32, corrupt, stored, zipfile.ErrCRCMismatch, zipfile.ErrCRCMismatch},
+		{"crc32c_valid", zipfile.ChecksumCRC32C, data, stored, nil, nil},
+		// entries only store CRC32: reads are checked for size only, the archive against the stored CRC32C
+		{"crc32c_corrupt", zipfile.ChecksumCRC32C, corrupt, stored, nil, zipfile.ErrChecksumMismatch},
+		{"sha256_valid", zipfile.ChecksumSHA256, data, stored, nil, nil},
+		{"sha256_corrupt", zipfile.ChecksumSHA256, corrupt, stored, nil, zipfile.ErrChecksumMismatch},
+		// not stored anywhere: skipped
+		{"sha256_not_stored", zipfile.ChecksumSHA256, corrupt, nil, nil, nil},
+		{"none_corrupt", zipfile.ChecksumNone, corrupt, stored, nil, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if err := read(newParser(c.Data, c.Stored, c.Algorithm), "b.txt"); !errors.Is(err, c.ReadErr) {
+				t.Errorf("expected read error %v, got: %v", c.ReadErr, err)
+			}
+			if err := verify(newParser(c.Data, c.Stored, c.Algorithm)); !errors.Is(err, c.VerifyErr) {
+				t.Errorf("expected verify error %v, got: %v", c.VerifyErr, err)
+			}
+		})
+	}
+
+	// sizes are checked regardless of the algorithm
+	f := &zipfile.CDR{FileName: "a.txt", UncompressedSizeBytes: 3}
+	if _, err := io.ReadAll(zipfile.VerifyingReaderFor(strings.NewReader("abcd"), f, zipfile.ChecksumNone)); !errors.Is(err, zipfile.ErrSizeMismatch) {
+		t.Errorf("expected ErrSizeMismatch, got: %v", err)
+	}
+}
+
+func TestParseChecksumAlgorithm(t *testing.T) {
+	for input, expected := range map[string]zipfile.ChecksumAlgorithm{
+		"":           zipfile.ChecksumCRC32,
+		"CRC32":      zipfile.ChecksumCRC32,
+		"crc32-ieee": zipfile.ChecksumCRC32,
+		"crc32c":     zipfile.ChecksumCRC32C,
+		"sha256":     zipfile.ChecksumSHA256,
+		"none":       zipfile.ChecksumNone,
+	} {
+		algorithm, err := zipfile.ParseChecksumAlgorithm(input)
+		if err != nil || algorithm != expected {
+			t.Errorf("%q: expected %s, got: %s (%v)", input, expected, algorithm, err)
+		}
+	}
+	if _, err := zipfile.ParseChecksumAlgorithm("md5"); !errors.Is(err, zipfile.ErrUnknownChecksumAlgorithm) {
+		t.Errorf("expected ErrUnknownChecksumAlgorithm, got: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package zipfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// CollisionPolicy decides which entry is kept when archives concatenated into one object
+// (e.g. "cat a.zip b.zip > combined.zip") have entries of the same name, see WithConcatenated
+type CollisionPolicy string
+
+const (
+	// CollisionLast keeps the entry of the later archive, as readers that only use the last central directory would
+	CollisionLast CollisionPolicy = "last"
+	// CollisionFirst keeps the entry of the earlier archive
+	CollisionFirst CollisionPolicy = "first"
+	// CollisionError fails reading the central directory. Directories present in more than one archive aren't collisions.
+	CollisionError CollisionPolicy = "error"
+)
+
+var (
+	ErrUnknownCollisionPolicy = errors.New("unknown collision policy")
+	ErrNameCollision          = errors.New("entry name collision between concatenated archives")
+
+	collisionPolicies = []CollisionPolicy{CollisionLast, CollisionFirst, CollisionError}
+)
+
+// ParseCollisionPolicy parses one of "last", "first" or "error"
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !slices.Contains(collisionPolicies, CollisionPolicy(s)) {
+		names := make([]string, len(collisionPolicies))
+		for i, policy := range collisionPolicies {
+			names[i] = string(policy)
+		}
+		return "", fmt.Errorf("%w: '%s' (expected one of: %s)", ErrUnknownCollisionPolicy, s, strings.Join(names, ", "))
+	}
+	return CollisionPolicy(s), nil
+}
+
+// WithConcatenated reads every archive concatenated into the object, rather than only the last one:
+// the data preceding each archive is parsed as an archive of its own, until it isn't one.
+// The records of all archives are returned in order, name collisions resolved with policy.
+func WithConcatenated(policy CollisionPolicy) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.concatenated = policy
+	}
+}
+
+// readConcatenated reads the archives preceding the last one, whose records and start are given,
+// returning the merged records of all of them
+func (p *CentralDirectoryParser) readConcatenated(records []*CDR, start int64) ([]*CDR, error) {
+	archives := [][]*CDR{records}
+	for start > 0 {
+		prefix := NewCentralDirectoryParser(&prefixFetcher{next: p.reader, size: start},
+			WithContext(p.ctx), WithLogger(p.logger), WithCDWindowSize(p.cdWindowSize), WithTolerant(p.tolerant))
+		previous, err := prefix.GetCentralDirectory()
+		if errors.Is(err, ErrInvalidZip) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// whatever precedes the first archive (a self-extracting stub, or nothing at all)
+			p.logger.DebugContext(p.ctx, "no archive precedes offset", "offset", start, "err", err)
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		archives = append(archives, previous)
+		// records of archives at the start of the object have absolute offsets already
+		start = prefix.stubSize
+	}
+	p.stubSize = start
+	if len(archives) > 1 {
+		p.logger.DebugContext(p.ctx, "read concatenated archives", "archives", len(archives))
+	}
+	slices.Reverse(archives)
+	return mergeArchives(archives, p.concatenated)
+}
+
+// mergeArchives returns the records of archives in order, resolving name collisions with policy
+func mergeArchives(archives [][]*CDR, policy CollisionPolicy) ([]*CDR, error) {
+	// kept maps names to the position of their record in merged
+	kept := make(map[string]int)
+	var merged []*CDR
+	for _, records := range archives {
+		for _, f := range records {
+			i, exists := kept[f.FileName]
+			switch {
+			case !exists:
+				kept[f.FileName] = len(merged)
+				merged = append(merged, f)
+			case f.Mode.IsDir() && merged[i].Mode.IsDir():
+				// the same directory in another archive
+			case policy == CollisionError:
+				return nil, fmt.Errorf("%w: %s", ErrNameCollision, f.FileName)
+			case policy == CollisionLast:
+				merged[i] = nil
+				kept[f.FileName] = len(merged)
+				merged = append(merged, f)
+			}
+		}
+	}
+	return slices.DeleteFunc(merged, func(f *CDR) bool { return f == nil }), nil
+}
+
+// prefixFetcher reads the first size bytes of next as an object of its own
+type prefixFetcher struct {
+	next OffsetFetcher
+	size int64
+}
+
+func (f *prefixFetcher) Fetch(start, end *int64) (io.Reader, error) {
+	from, to := int64(0), f.size-1
+	switch {
+	case start != nil && end != nil:
+		from, to = *start, min(*end, to)
+	case start != nil:
+		from = *start
+	case end != nil:
+		// the last end bytes
+		from = max(f.size-*end, 0)
+	}
+	if from > to {
+		return bytes.NewReader(nil), nil
+	}
+	return f.next.Fetch(&from, &to)
+}
+
+func (f *prefixFetcher) Size() (int64, error) {
+	return f.size, nil
+}
@@ -0,0 +1,85 @@
+package zipfile_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestCentralDirectoryParser_Concatenated(t *testing.T) {
+	// testdata/concatenated.zip is two archives, each with dir/, its own file in dir/ and shared.txt
+	open := func(opts ...zipfile.ParserOpt) *zipfile.CentralDirectoryParser {
+		fetcher, err := remote.Object("file://testdata/concatenated.zip")
+		if err != nil {
+			t.Fatalf("unexpected error opening zip file: %v", err)
+		}
+		return zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), fetcher), opts...)
+	}
+	names := func(records []*zipfile.CDR) []string {
+		var names []string
+		for _, f := range records {
+			names = append(names, f.FileName)
+		}
+		return names
+	}
+
+	// only the last archive, which looks like it has a stub prepended
+	records, err := open().GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"dir", "dir/b.txt", "shared.txt"}; !slices.Equal(names(records), expected) {
+		t.Errorf("expected %v, got %v", expected, names(records))
+	}
+
+	cases := []struct {
+		Policy   zipfile.CollisionPolicy
+		Names    []string
+		Shared   string
+		Expected error
+	}{
+		{zipfile.CollisionLast, []string{"dir", "dir/a.txt", "dir/b.txt", "shared.txt"}, "from b\n", nil},
+		{zipfile.CollisionFirst, []string{"dir", "dir/a.txt", "shared.txt", "dir/b.txt"}, "from a\n", nil},
+		{zipfile.CollisionError, nil, "", zipfile.ErrNameCollision},
+	}
+	for _, c := range cases {
+		t.Run(string(c.Policy), func(t *testing.T) {
+			p := open(zipfile.WithConcatenated(c.Policy))
+			records, err := p.GetCentralDirectory()
+			if !errors.Is(err, c.Expected) {
+				t.Fatalf("expected error %v, got %v", c.Expected, err)
+			}
+			if err != nil {
+				return
+			}
+			if !slices.Equal(names(records), c.Names) {
+				t.Errorf("expected %v, got %v", c.Names, names(records))
+			}
+			for _, name := range []string{"dir/a.txt", "dir/b.txt", "shared.txt"} {
+				r, err := p.Read(name)
+				if err != nil {
+					t.Fatalf("unexpected error reading %s: %v", name, err)
+				}
+				data, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("unexpected error reading %s: %v", name, err)
+				}
+				if name == "shared.txt" && string(data) != c.Shared {
+					t.Errorf("expected shared.txt to be %q, got %q", c.Shared, data)
+				}
+			}
+			if stub, err := p.Stub(); err != nil || stub != nil {
+				t.Errorf("expected no stub before the first archive, got %v (err: %v)", stub, err)
+			}
+		})
+	}
+
+	if _, err := zipfile.ParseCollisionPolicy("newest"); !errors.Is(err, zipfile.ErrUnknownCollisionPolicy) {
+		t.Errorf("expected ErrUnknownCollisionPolicy, got: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package zipfile
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// Decompressor returns a reader of the decompressed content of an entry, given a reader of its compressed data
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+var (
+	decompressorsMu sync.RWMutex
+	// decompressors are the registered decompressors by compression method, including the built-in ones
+	decompressors = map[uint16]Decompressor{
+		zip.Store: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(r), nil
+		},
+		zip.Deflate: func(r io.Reader) (io.ReadCloser, error) {
+			return flate.NewReader(r), nil
+		},
+		Deflate64: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(NewDeflate64Reader(r)), nil
+		},
+	}
+)
+
+// RegisterDecompressor teaches the read path to decode entries compressed with method, e.g. a proprietary codec.
+// It replaces the decompressor registered for method, if any (built-in ones included).
+// Entries compressed with a registered method are verified like built-in ones and, unless an allowlist
+// is configured (see WithAllowedMethods), allowed to be read.
+func RegisterDecompressor(method uint16, d Decompressor) {
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	decompressors[method] = d
+}
+
+// decompressor returns the decompressor registered for method, or nil if its entries can't be decoded
+func decompressor(method uint16) Decompressor {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	return decompressors[method]
+}
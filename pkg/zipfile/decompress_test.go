@@ -0,0 +1,83 @@
+package zipfile_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// xorMethod is a made up compression method, XOR-ing every byte with xorKey
+const (
+	xorMethod uint16 = 0xc0de
+	xorKey    byte   = 0x5a
+)
+
+// xorStream applies xorMethod to what is read from r, or written to w
+type xorStream struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (x *xorStream) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	xor(p[:n])
+	return n, err
+}
+
+func (x *xorStream) Write(p []byte) (int, error) {
+	return x.w.Write(xor(bytes.Clone(p)))
+}
+
+func (x *xorStream) Close() error {
+	return nil
+}
+
+func xor(p []byte) []byte {
+	for i := range p {
+		p[i] ^= xorKey
+	}
+	return p
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	content := strings.Repeat("a custom codec ", 100)
+	data := newZip(t, func(w *zip.Writer) {
+		w.RegisterCompressor(xorMethod, func(out io.Writer) (io.WriteCloser, error) {
+			return &xorStream{w: out}, nil
+		})
+		addEntry(t, w, &zip.FileHeader{Name: "custom.txt", Method: xorMethod}, []byte(content))
+		addPadding(t, w)
+	})
+
+	p := memParser(data)
+	if _, err := p.Read("custom.txt"); !errors.Is(err, zipfile.ErrMethodNotAllowed) {
+		t.Fatalf("expected ErrMethodNotAllowed before registering a decompressor, got: %v", err)
+	}
+
+	zipfile.RegisterDecompressor(xorMethod, func(r io.Reader) (io.ReadCloser, error) {
+		return &xorStream{r: r}, nil
+	})
+	p = memParser(data, zipfile.WithVerifyReads(true))
+	r, err := p.Read("custom.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error reading entry: %v", err)
+	}
+	if string(decoded) != content {
+		t.Errorf("expected the entry to be decoded by the registered decompressor, got %q", decoded)
+	}
+
+	// an explicit allowlist still applies
+	p = memParser(data, zipfile.WithAllowedMethods(zipfile.DefaultAllowedMethods))
+	if _, err := p.Read("custom.txt"); !errors.Is(err, zipfile.ErrMethodNotAllowed) {
+		t.Errorf("expected ErrMethodNotAllowed with an allowlist without the method, got: %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package zipfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Deflate64 ("enhanced deflate") is deflate with a 64KiB window, 32 distance codes
+// and a length code (285) carrying 16 extra bits. It isn't supported by compress/flate.
+const Deflate64 uint16 = 9
+
+const (
+	deflate64WindowSize = 1 << 16
+	deflate64MaxBits    = 15
+	deflate64MaxLitLen  = 288
+	deflate64MaxDist    = 32
+)
+
+var (
+	ErrDeflate64 = fmt.Errorf("%w: invalid deflate64 data", ErrCorruptArchive)
+
+	deflate64LengthBase = [29]uint16{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+		35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 3}
+	deflate64LengthExtra = [29]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+		3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 16}
+	deflate64DistBase = [32]uint32{
+		1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+		257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577, 32769, 49153}
+	deflate64DistExtra = [32]uint8{
+		0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+		7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13, 14, 14}
+	// order in which code length code lengths are stored in a dynamic block header
+	deflate64CodeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+	deflate64FixedLitLen, deflate64FixedDist = deflate64FixedTables()
+)
+
+// huffman is a canonical Huffman code, stored as the number of codes of each length
+// and the symbols ordered by code
+type huffman struct {
+	count  [deflate64MaxBits + 1]uint16
+	symbol []uint16
+}
+
+func newHuffman(lengths []uint8) (*huffman, error) {
+	h := &huffman{symbol: make([]uint16, len(lengths))}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	if int(h.count[0]) == len(lengths) {
+		return h, nil // no codes: fine, as long as nothing is decoded with it
+	}
+	left := 1
+	for l := 1; l <= deflate64MaxBits; l++ {
+		left <<= 1
+		left -= int(h.count[l])
+		if left < 0 {
+			return nil, fmt.Errorf("%w: over-subscribed Huffman code", ErrDeflate64)
+		}
+	}
+	var offsets [deflate64MaxBits + 1]uint16
+	for l := 1; l < deflate64MaxBits; l++ {
+		offsets[l+1] = offsets[l] + h.count[l]
+	}
+	for symbol, l := range lengths {
+		if l != 0 {
+			h.symbol[offsets[l]] = uint16(symbol)
+			offsets[l]++
+		}
+	}
+	return h, nil
+}
+
+func deflate64FixedTables() (*huffman, *huffman) {
+	lengths := make([]uint8, deflate64MaxLitLen)
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	litLen, _ := newHuffman(lengths)
+	dist := make([]uint8, deflate64MaxDist)
+	for i := range dist {
+		dist[i] = 5
+	}
+	distances, _ := newHuffman(dist)
+	return litLen, distances
+}
+
+type deflate64State int
+
+const (
+	deflate64BlockHeader deflate64State = iota
+	deflate64StoredBlock
+	deflate64HuffmanBlock
+	deflate64Done
+)
+
+// deflate64Reader decompresses a Deflate64 stream, decoding as much as needed to satisfy each Read
+type deflate64Reader struct {
+	r       io.ByteReader
+	bits    uint32
+	bitsLen uint
+	err     error
+
+	state     deflate64State
+	lastBlock bool
+	stored    int // bytes left in the current stored block
+	litLen    *huffman
+	dist      *huffman
+
+	window    [deflate64WindowSize]byte
+	windowPos int
+	filled    bool // whether the window has wrapped around
+	out       []byte
+	outPos    int
+}
+
+// NewDeflate64Reader returns a reader decompressing the Deflate64 stream read from r
+func NewDeflate64Reader(r io.Reader) io.Reader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &deflate64Reader{r: br}
+}
+
+func (d *deflate64Reader) Read(p []byte) (int, error) {
+	if d.outPos == len(d.out) {
+		d.out, d.outPos = d.out[:0], 0
+		for len(d.out) == 0 && d.err == nil {
+			d.err = d.step()
+		}
+	}
+	n := copy(p, d.out[d.outPos:])
+	d.outPos += n
+	if d.outPos < len(d.out) {
+		return n, nil
+	}
+	return n, d.err
+}
+
+// step decodes the next unit of the stream (a block header, some stored bytes or a Huffman symbol)
+func (d *deflate64Reader) step() error {
+	switch d.state {
+	case deflate64BlockHeader:
+		return d.blockHeader()
+	case deflate64StoredBlock:
+		return d.storedBytes()
+	case deflate64HuffmanBlock:
+		return d.symbol()
+	default:
+		return io.EOF
+	}
+}
+
+func (d *deflate64Reader) endBlock() {
+	if d.lastBlock {
+		d.state = deflate64Done
+	} else {
+		d.state = deflate64BlockHeader
+	}
+}
+
+func (d *deflate64Reader) blockHeader() error {
+	header, err := d.readBits(3)
+	if err != nil {
+		return err
+	}
+	d.lastBlock = header&1 == 1
+	switch header >> 1 {
+	case 0:
+		// stored blocks start at a byte boundary, with the length and its complement
+		d.bits, d.bitsLen = 0, 0
+		lengths, err := d.readBits(32)
+		if err != nil {
+			return err
+		}
+		length, complement := lengths&0xffff, lengths>>16
+		if length != ^complement&0xffff {
+			return fmt.Errorf("%w: stored block length mismatch", ErrDeflate64)
+		}
+		d.stored = int(length)
+		d.state = deflate64StoredBlock
+	case 1:
+		d.litLen, d.dist = deflate64FixedLitLen, deflate64FixedDist
+		d.state = deflate64HuffmanBlock
+	case 2:
+		if err := d.dynamicTables(); err != nil {
+			return err
+		}
+		d.state = deflate64HuffmanBlock
+	default:
+		return fmt.Errorf("%w: invalid block type", ErrDeflate64)
+	}
+	return nil
+}
+
+func (d *deflate64Reader) dynamicTables() error {
+	counts, err := d.readBits(14)
+	if err != nil {
+		return err
+	}
+	nLitLen := int(counts&0x1f) + 257
+	nDist := int(counts>>5&0x1f) + 1
+	nCodeLen := int(counts>>10) + 4
+	if nLitLen > 286 {
+		return fmt.Errorf("%w: too many length codes", ErrDeflate64)
+	}
+	codeLengths := make([]uint8, len(deflate64CodeLengthOrder))
+	for i := 0; i < nCodeLen; i++ {
+		l, err := d.readBits(3)
+		if err != nil {
+			return err
+		}
+		codeLengths[deflate64CodeLengthOrder[i]] = uint8(l)
+	}
+	codeLengthCode, err := newHuffman(codeLengths)
+	if err != nil {
+		return err
+	}
+	lengths := make([]uint8, nLitLen+nDist)
+	for i := 0; i < len(lengths); {
+		symbol, err := d.decode(codeLengthCode)
+		if err != nil {
+			return err
+		}
+		if symbol < 16 {
+			lengths[i] = uint8(symbol)
+			i++
+			continue
+		}
+		var value uint8
+		var repeat uint32
+		switch symbol {
+		case 16:
+			if i == 0 {
+				return fmt.Errorf("%w: repeated length with no previous length", ErrDeflate64)
+			}
+			value = lengths[i-1]
+			repeat, err = d.readBits(2)
+			repeat += 3
+		case 17:
+			repeat, err = d.readBits(3)
+			repeat += 3
+		default:
+			repeat, err = d.readBits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(repeat) > len(lengths) {
+			return fmt.Errorf("%w: too many code lengths", ErrDeflate64)
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[i] = value
+			i++
+		}
+	}
+	if lengths[256] == 0 {
+		return fmt.Errorf("%w: missing end of block code", ErrDeflate64)
+	}
+	if d.litLen, err = newHuffman(lengths[:nLitLen]); err != nil {
+		return err
+	}
+	d.dist, err = newHuffman(lengths[nLitLen:])
+	return err
+}
+
+func (d *deflate64Reader) storedBytes() error {
+	if d.stored == 0 {
+		d.endBlock()
+		return nil
+	}
+	start := len(d.out)
+	for ; d.stored > 0 && len(d.out)-start < 4096; d.stored-- {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		d.emit(b)
+	}
+	return nil
+}
+
+func (d *deflate64Reader) symbol() error {
+	symbol, err := d.decode(d.litLen)
+	if err != nil {
+		return err
+	}
+	switch {
+	case symbol < 256:
+		d.emit(byte(symbol))
+		return nil
+	case symbol == 256:
+		d.endBlock()
+		return nil
+	case symbol > 285:
+		return fmt.Errorf("%w: invalid length code %d", ErrDeflate64, symbol)
+	}
+	symbol -= 257
+	extra, err := d.readBits(uint(deflate64LengthExtra[symbol]))
+	if err != nil {
+		return err
+	}
+	length := int(deflate64LengthBase[symbol]) + int(extra)
+
+	symbol, err = d.decode(d.dist)
+	if err != nil {
+		return err
+	}
+	if int(symbol) >= len(deflate64DistBase) {
+		return fmt.Errorf("%w: invalid distance code %d", ErrDeflate64, symbol)
+	}
+	extra, err = d.readBits(uint(deflate64DistExtra[symbol]))
+	if err != nil {
+		return err
+	}
+	distance := int(deflate64DistBase[symbol]) + int(extra)
+	if !d.filled && distance > d.windowPos {
+		return fmt.Errorf("%w: distance %d is before the start of the stream", ErrDeflate64, distance)
+	}
+	from := (d.windowPos - distance + deflate64WindowSize) % deflate64WindowSize
+	for ; length > 0; length-- {
+		d.emit(d.window[from])
+		from = (from + 1) % deflate64WindowSize
+	}
+	return nil
+}
+
+func (d *deflate64Reader) emit(b byte) {
+	d.out = append(d.out, b)
+	d.window[d.windowPos] = b
+	d.windowPos++
+	if d.windowPos == deflate64WindowSize {
+		d.windowPos = 0
+		d.filled = true
+	}
+}
+
+// readBits returns the next n (up to 32) bits of the stream, least significant bit first
+func (d *deflate64Reader) readBits(n uint) (uint32, error) {
+	value := uint64(d.bits)
+	have := d.bitsLen
+	for have < n {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		value |= uint64(b) << have
+		have += 8
+	}
+	d.bits = uint32(value >> n)
+	d.bitsLen = have - n
+	return uint32(value & (1<<n - 1)), nil
+}
+
+// decode reads a single symbol coded with h, one bit at a time
+func (d *deflate64Reader) decode(h *huffman) (uint16, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= deflate64MaxBits; l++ {
+		bit, err := d.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := int(h.count[l])
+		if code-first < count {
+			return h.symbol[index+code-first], nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, fmt.Errorf("%w: invalid Huffman code", ErrDeflate64)
+}
+
+// noEOF turns an EOF in the middle of the stream into io.ErrUnexpectedEOF
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
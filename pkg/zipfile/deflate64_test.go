@@ -0,0 +1,64 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestCentralDirectoryParser_ReadDeflate64(t *testing.T) {
+	// dynamic.txt uses dynamic Huffman blocks, enhanced.bin uses a 16 bit length and a distance over 32KiB
+	p, err := parser("file://testdata/deflate64.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	files, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error reading central directory: %v", err)
+	}
+	for _, f := range files {
+		if f.FileName == "padding.bin" {
+			continue
+		}
+		t.Run(f.FileName, func(t *testing.T) {
+			if f.CompressionMethod != zipfile.Deflate64 {
+				t.Fatalf("expected method %d, got %d", zipfile.Deflate64, f.CompressionMethod)
+			}
+			r, err := p.Read(f.FileName)
+			if err != nil {
+				t.Fatalf("unexpected error opening entry: %v", err)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("unexpected error reading entry: %v", err)
+			}
+			if uint64(len(data)) != f.UncompressedSizeBytes || crc32.ChecksumIEEE(data) != f.CRC32Uncompressed {
+				t.Errorf("expected %d bytes with CRC32 %08x, got %d bytes with CRC32 %08x",
+					f.UncompressedSizeBytes, f.CRC32Uncompressed, len(data), crc32.ChecksumIEEE(data))
+			}
+		})
+	}
+}
+
+func TestDeflate64Reader_Invalid(t *testing.T) {
+	cases := map[string][]byte{
+		"reserved block type": {0x07},
+		"stored length":       {0x01, 0x05, 0x00, 0x00, 0x00},
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := io.ReadAll(zipfile.NewDeflate64Reader(bytes.NewReader(data)))
+			if !errors.Is(err, zipfile.ErrDeflate64) {
+				t.Errorf("expected ErrDeflate64, got %v", err)
+			}
+		})
+	}
+	_, err := io.ReadAll(zipfile.NewDeflate64Reader(bytes.NewReader([]byte{0x01, 0x05, 0x00})))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated stream, got %v", err)
+	}
+}
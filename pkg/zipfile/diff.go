@@ -0,0 +1,102 @@
+package zipfile
+
+import (
+	"sort"
+)
+
+// ChangeKind is how an entry changed between two archives
+type ChangeKind string
+
+const (
+	EntryAdded   ChangeKind = "added"
+	EntryRemoved ChangeKind = "removed"
+	EntryChanged ChangeKind = "changed"
+)
+
+// Fields of entries compared by DiffRecords, as listed in EntryChange.Fields
+const (
+	FieldSize     = "size"
+	FieldCRC32    = "crc32"
+	FieldModified = "modified"
+	FieldMode     = "mode"
+)
+
+// EntryChange describes an entry that differs between two archives
+type EntryChange struct {
+	Name string
+	Kind ChangeKind
+	// Old and New are the entry in each archive, Old is nil for added entries and New for removed ones
+	Old, New *CDR
+	// Fields lists the fields that differ between Old and New, for changed entries
+	Fields []string
+}
+
+// DiffRecords compares the central directories of two archives (before and after) by entry name, returning the
+// entries that were added, removed, or whose uncompressed size, CRC32, modification time or mode changed, sorted by name.
+// Only metadata is compared: entries whose content changed without changing their size or CRC32 aren't detected.
+// Directories are only compared by their mode. If a name appears more than once, its last entry is compared.
+func DiffRecords(before, after []*CDR) []EntryChange {
+	oldByName, newByName := recordsByName(before), recordsByName(after)
+	var changes []EntryChange
+	for name, o := range oldByName {
+		n, ok := newByName[name]
+		if !ok {
+			changes = append(changes, EntryChange{Name: name, Kind: EntryRemoved, Old: o})
+			continue
+		}
+		if fields := changedFields(o, n); len(fields) > 0 {
+			changes = append(changes, EntryChange{Name: name, Kind: EntryChanged, Old: o, New: n, Fields: fields})
+		}
+	}
+	for name, n := range newByName {
+		if _, ok := oldByName[name]; !ok {
+			changes = append(changes, EntryChange{Name: name, Kind: EntryAdded, New: n})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+func recordsByName(records []*CDR) map[string]*CDR {
+	byName := make(map[string]*CDR, len(records))
+	for _, f := range records {
+		byName[f.FileName] = f
+	}
+	return byName
+}
+
+func changedFields(o, n *CDR) []string {
+	var fields []string
+	if o.Mode != n.Mode {
+		fields = append(fields, FieldMode)
+	}
+	if o.Mode.IsDir() && n.Mode.IsDir() {
+		return fields
+	}
+	if o.UncompressedSizeBytes != n.UncompressedSizeBytes {
+		fields = append(fields, FieldSize)
+	}
+	if o.CRC32Uncompressed != n.CRC32Uncompressed {
+		fields = append(fields, FieldCRC32)
+	}
+	if !o.Modified.Equal(n.Modified) {
+		fields = append(fields, FieldModified)
+	}
+	return fields
+}
+
+// ContentChanged reports whether the content of a changed entry differs, by hashing it with algorithm in both archives
+// (before and after). Entries are streamed through the hash, without being kept in memory.
+func ContentChanged(change EntryChange, before, after *CentralDirectoryParser, algorithm HashAlgorithm) (bool, error) {
+	oldDigest, err := before.Hash(change.Old, algorithm)
+	if err != nil {
+		return false, err
+	}
+	newDigest, err := after.Hash(change.New, algorithm)
+	if err != nil {
+		return false, err
+	}
+	return oldDigest != newDigest, nil
+}
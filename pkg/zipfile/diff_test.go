@@ -0,0 +1,52 @@
+package zipfile_test
+
+import (
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestDiffRecords(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)
+	record := func(name string, size uint64, crc uint32) *zipfile.CDR {
+		mode := fs.FileMode(0644)
+		if strings.HasSuffix(name, "/") {
+			mode = fs.ModeDir | 0755
+		}
+		return &zipfile.CDR{FileName: name, UncompressedSizeBytes: size, CRC32Uncompressed: crc, Modified: modified, Mode: mode}
+	}
+	touched := record("touched.txt", 5, 1)
+	touched.Modified = modified.Add(time.Hour)
+	before := []*zipfile.CDR{record("dir/", 0, 0), record("removed.txt", 1, 1), record("same.txt", 2, 2),
+		record("grown.txt", 3, 3), record("touched.txt", 5, 1)}
+	after := []*zipfile.CDR{record("dir/", 0, 0), record("same.txt", 2, 2), record("grown.txt", 4, 4),
+		touched, record("added.txt", 1, 1)}
+
+	changes := zipfile.DiffRecords(before, after)
+	expected := []struct {
+		Name   string
+		Kind   zipfile.ChangeKind
+		Fields []string
+	}{
+		{"added.txt", zipfile.EntryAdded, nil},
+		{"grown.txt", zipfile.EntryChanged, []string{zipfile.FieldSize, zipfile.FieldCRC32}},
+		{"removed.txt", zipfile.EntryRemoved, nil},
+		{"touched.txt", zipfile.EntryChanged, []string{zipfile.FieldModified}},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), changes)
+	}
+	for i, e := range expected {
+		c := changes[i]
+		if c.Name != e.Name || c.Kind != e.Kind || !slices.Equal(c.Fields, e.Fields) {
+			t.Errorf("expected %s to be %s (%v), got %s %s (%v)", e.Name, e.Kind, e.Fields, c.Name, c.Kind, c.Fields)
+		}
+	}
+	if len(zipfile.DiffRecords(after, after)) != 0 {
+		t.Error("expected no changes between an archive and itself")
+	}
+}
@@ -0,0 +1,65 @@
+package zipfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// encryptedFlag is set in the general purpose bit flag of encrypted entries
+	encryptedFlag = 0x1
+	// strongEncryptionFlag is set, along with encryptedFlag, in entries encrypted with PKWARE strong encryption
+	strongEncryptionFlag = 0x40
+	// maskedHeaderFlag is set when the central directory is encrypted, and the values of local headers are masked
+	maskedHeaderFlag = 0x2000
+	// StrongEncryptionHeaderId is the extra field describing the algorithm an entry is strongly encrypted with
+	StrongEncryptionHeaderId = 0x0017
+
+	// strongEncryptionMinVersion is the version needed to extract an archive with an encrypted central directory,
+	// which is stored in a version 2 zip64 EOCD record
+	strongEncryptionMinVersion = 62
+	// eocd64AlgIdOffset is the offset of the encryption algorithm in a version 2 zip64 EOCD record, following
+	// the compression method, compressed and uncompressed size of the central directory
+	eocd64AlgIdOffset = 56 + 2 + 8 + 8
+)
+
+var (
+	// ArchiveExtraDataSignature starts the archive extra data record, which precedes an encrypted central directory
+	ArchiveExtraDataSignature = []byte{0x50, 0x4b, 0x06, 0x08}
+
+	// ErrStrongEncryptionUnsupported is returned for archives using PKWARE strong encryption (as opposed to
+	// traditional ZipCrypto or WinZip AES), either of their entries or of the central directory itself
+	ErrStrongEncryptionUnsupported = errors.New("PKWARE strong encryption is not supported")
+)
+
+// checkStrongEncryption fails entries encrypted with PKWARE strong encryption, identified by the general purpose
+// bit flag, or by a strong encryption header, as their content can't be decrypted
+func checkStrongEncryption(name string, flags uint16, extraFields []byte) error {
+	switch {
+	case flags&maskedHeaderFlag != 0:
+		return fmt.Errorf("%w: %s: local header values are masked, as the central directory is encrypted",
+			ErrStrongEncryptionUnsupported, name)
+	case flags&encryptedFlag == 0:
+		return nil
+	case flags&strongEncryptionFlag != 0, findExtraField(extraFields, StrongEncryptionHeaderId) != nil:
+		return fmt.Errorf("%w: %s is strongly encrypted", ErrStrongEncryptionUnsupported, name)
+	}
+	return nil
+}
+
+// checkEncryptedCD fails archives whose zip64 EOCD record (starting at record) declares the central directory
+// to be encrypted, rather than reading the encrypted data as records
+func checkEncryptedCD(record []byte, eocd *EOCD64) error {
+	if eocd.VersionNeededToExtract&0xff < strongEncryptionMinVersion || len(record) < eocd64AlgIdOffset+2 {
+		return nil
+	}
+	// the size excludes the signature and the size itself
+	if eocd.SizeBytes+12 < eocd64AlgIdOffset+2 {
+		return nil
+	}
+	if algId := binary.LittleEndian.Uint16(record[eocd64AlgIdOffset:]); algId != 0 {
+		return fmt.Errorf("%w: the central directory is encrypted (algorithm 0x%04x)", ErrStrongEncryptionUnsupported, algId)
+	}
+	return nil
+}
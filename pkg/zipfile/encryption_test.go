@@ -0,0 +1,81 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestCentralDirectoryParser_StrongEncryption(t *testing.T) {
+	// secret.bin is flagged as strongly encrypted, with a strong encryption header (AES-128)
+	p, err := parser("file://testdata/strong_encryption.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	_, err = p.GetCentralDirectory()
+	if !errors.Is(err, zipfile.ErrStrongEncryptionUnsupported) {
+		t.Fatalf("expected ErrStrongEncryptionUnsupported, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "secret.bin is strongly encrypted") {
+		t.Errorf("expected the error to name the encrypted entry, got: %v", err)
+	}
+
+	// an encrypted central directory, preceded by an archive extra data record and entry data
+	const dataSize = zipfile.EOCDPrefetchBufferSize
+	encrypted := append(bytes.Repeat([]byte{0xaa}, dataSize), zipfile.ArchiveExtraDataSignature...)
+	encrypted = append(encrypted, bytes.Repeat([]byte{0xbb}, 28)...)
+	cdSize := uint32(len(encrypted) - dataSize)
+	eocd := binary.LittleEndian.AppendUint32(nil, binary.LittleEndian.Uint32(zipfile.EOCDSignature))
+	eocd = binary.LittleEndian.AppendUint16(eocd, 0)
+	eocd = binary.LittleEndian.AppendUint16(eocd, 0)
+	eocd = binary.LittleEndian.AppendUint16(eocd, 1)
+	eocd = binary.LittleEndian.AppendUint16(eocd, 1)
+	eocd = binary.LittleEndian.AppendUint32(eocd, cdSize)
+	eocd = binary.LittleEndian.AppendUint32(eocd, dataSize)
+	eocd = binary.LittleEndian.AppendUint16(eocd, 0)
+	_, err = memParser(append(encrypted, eocd...)).GetCentralDirectory()
+	if !errors.Is(err, zipfile.ErrStrongEncryptionUnsupported) || !strings.Contains(err.Error(), "archive extra data record") {
+		t.Errorf("expected ErrStrongEncryptionUnsupported for an archive extra data record, got: %v", err)
+	}
+
+	// an encrypted central directory, declared by a version 2 zip64 EOCD record
+	eocd64 := &zipfile.EOCD64{
+		Signature:              binary.LittleEndian.Uint32(zipfile.EOCD64Signature),
+		SizeBytes:              44 + 28,
+		VersionNeededToExtract: 62,
+		DiskCDRs:               1,
+		TotalCDRs:              1,
+		CDSizeBytes:            uint64(cdSize),
+		CDByteOffset:           dataSize,
+	}
+	buf := &bytes.Buffer{}
+	buf.Write(encrypted)
+	_ = binary.Write(buf, binary.LittleEndian, eocd64)
+	// compression method, compressed and uncompressed size, algorithm (AES-256), bit length, flags, hash id and length
+	_ = binary.Write(buf, binary.LittleEndian, struct {
+		Method           uint16
+		Compressed, Size uint64
+		AlgId, BitLen    uint16
+		Flags            uint16
+		HashId, HashLen  uint16
+	}{0, uint64(cdSize), uint64(cdSize), 0x6610, 256, 1, 0, 0})
+	eocd64Offset := uint64(buf.Len())
+	buf.Write(binary.LittleEndian.AppendUint32(nil, 0x07064b50)) // zip64 EOCD locator
+	_ = binary.Write(buf, binary.LittleEndian, struct {
+		Disk   uint32
+		Offset uint64
+		Disks  uint32
+	}{0, eocd64Offset, 1})
+	eocd = binary.LittleEndian.AppendUint32(nil, binary.LittleEndian.Uint32(zipfile.EOCDSignature))
+	eocd = append(eocd, bytes.Repeat([]byte{0xff}, 16)...)
+	eocd = binary.LittleEndian.AppendUint16(eocd, 0)
+	buf.Write(eocd)
+	_, err = memParser(buf.Bytes()).GetCentralDirectory()
+	if !errors.Is(err, zipfile.ErrStrongEncryptionUnsupported) || !strings.Contains(err.Error(), "algorithm 0x6610") {
+		t.Errorf("expected ErrStrongEncryptionUnsupported for a version 2 zip64 EOCD record, got: %v", err)
+	}
+}
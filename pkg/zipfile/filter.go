@@ -0,0 +1,109 @@
+package zipfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filter decides whether an entry of the central directory should be included
+type Filter func(f *CDR) bool
+
+// msDosEpoch is the earliest time representable by MS-DOS timestamps.
+// Entries with an all-zero date/time field decode to an earlier time, and are considered to have no mtime at all.
+var msDosEpoch = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// HasModTime returns false if the entry carries no modification time
+func (f *CDR) HasModTime() bool {
+	return !f.Modified.Before(msDosEpoch)
+}
+
+// ModifiedBetween includes entries modified at or after since and before until.
+// A zero since or until leaves that side of the range open.
+// Entries without a modification time are included only if includeMissing is set.
+func ModifiedBetween(since, until time.Time, includeMissing bool) Filter {
+	return func(f *CDR) bool {
+		if !f.HasModTime() {
+			return includeMissing
+		}
+		if !since.IsZero() && f.Modified.Before(since) {
+			return false
+		}
+		if !until.IsZero() && !f.Modified.Before(until) {
+			return false
+		}
+		return true
+	}
+}
+
+// MatchPatterns includes entries whose path matches one of include (all entries, if it's empty),
+// and that don't match any of exclude. Patterns use path.Match syntax and match full paths within the archive.
+// Excluding a directory excludes everything below it.
+func MatchPatterns(include, exclude []string) (Filter, error) {
+	for _, pattern := range append(slices.Clone(include), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	return func(f *CDR) bool {
+		name := strings.Trim(f.FileName, "/")
+		for dir := name; dir != "." && dir != ""; dir = path.Dir(dir) {
+			if matchesAny(dir, exclude) {
+				return false
+			}
+		}
+		return len(include) == 0 || matchesAny(name, include)
+	}, nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadPatterns reads the patterns listed in r, one per line, for MatchPatterns.
+// Surrounding whitespace is ignored, as are blank lines and comments (lines starting with '#').
+func ReadPatterns(r io.Reader) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// FilterRecords returns the records matching all given filters
+func FilterRecords(records []*CDR, filters ...Filter) []*CDR {
+	if len(filters) == 0 {
+		return records
+	}
+	filtered := make([]*CDR, 0, len(records))
+	for _, f := range records {
+		if MatchAll(f, filters...) {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// MatchAll returns true if f matches all given filters
+func MatchAll(f *CDR, filters ...Filter) bool {
+	for _, filter := range filters {
+		if !filter(f) {
+			return false
+		}
+	}
+	return true
+}
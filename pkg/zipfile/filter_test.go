@@ -0,0 +1,101 @@
+package zipfile_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestModifiedBetween(t *testing.T) {
+	p, err := parser("file://testdata/regular.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	records, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error reading central directory: %v", err)
+	}
+	modified := records[0].Modified
+	cases := []struct {
+		Name     string
+		Since    time.Time
+		Until    time.Time
+		Expected int
+	}{
+		{"open", time.Time{}, time.Time{}, len(records)},
+		{"since_inclusive", modified, time.Time{}, len(records)},
+		{"until_exclusive", time.Time{}, modified, 0},
+		{"after", modified.Add(time.Hour), time.Time{}, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			filtered := zipfile.FilterRecords(records, zipfile.ModifiedBetween(c.Since, c.Until, true))
+			if len(filtered) != c.Expected {
+				t.Errorf("expected %d records, got %d", c.Expected, len(filtered))
+			}
+		})
+	}
+
+	missing := &zipfile.CDR{}
+	if zipfile.ModifiedBetween(modified, time.Time{}, false)(missing) {
+		t.Error("expected entry without mtime to be excluded")
+	}
+	if !zipfile.ModifiedBetween(modified, time.Time{}, true)(missing) {
+		t.Error("expected entry without mtime to be included")
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	records := []*zipfile.CDR{
+		{FileName: "README.md"},
+		{FileName: "src/main.go"},
+		{FileName: "src/secrets/"},
+		{FileName: "src/secrets/token.txt"},
+		{FileName: "config/prod.key"},
+	}
+	names := func(include, exclude []string) []string {
+		filter, err := zipfile.MatchPatterns(include, exclude)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var names []string
+		for _, f := range zipfile.FilterRecords(records, filter) {
+			names = append(names, f.FileName)
+		}
+		return names
+	}
+	cases := []struct {
+		Name     string
+		Include  []string
+		Exclude  []string
+		Expected []string
+	}{
+		{"none", nil, nil, []string{"README.md", "src/main.go", "src/secrets/", "src/secrets/token.txt", "config/prod.key"}},
+		{"include", []string{"src/*.go", "*.md"}, nil, []string{"README.md", "src/main.go"}},
+		{"exclude_directory", nil, []string{"src/secrets", "*/*.key"}, []string{"README.md", "src/main.go"}},
+		{"exclude_wins", []string{"src/*/*"}, []string{"src/secrets"}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if got := names(c.Include, c.Exclude); !slices.Equal(got, c.Expected) {
+				t.Errorf("expected %v, got %v", c.Expected, got)
+			}
+		})
+	}
+	if _, err := zipfile.MatchPatterns(nil, []string{"[unterminated"}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestReadPatterns(t *testing.T) {
+	patterns, err := zipfile.ReadPatterns(strings.NewReader("# secrets\nsrc/secrets\n\n  *.key  \n#*.md\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"src/secrets", "*.key"}; !slices.Equal(patterns, expected) {
+		t.Errorf("expected %v, got %v", expected, patterns)
+	}
+}
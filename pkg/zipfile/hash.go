@@ -0,0 +1,139 @@
+package zipfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// HashAlgorithm names a hash function used to compute digests of entry contents
+type HashAlgorithm string
+
+const (
+	HashSHA256 HashAlgorithm = "sha256"
+	// HashXXH64 is the 64 bit xxHash: not a cryptographic hash, but much faster to compute
+	HashXXH64 HashAlgorithm = "xxh64"
+)
+
+var (
+	ErrUnknownHashAlgorithm = errors.New("unknown hash algorithm")
+
+	hashAlgorithms = []HashAlgorithm{HashSHA256, HashXXH64}
+)
+
+// ParseHashAlgorithm parses one of "sha256" or "xxh64" ("xxhash" is accepted for the latter)
+func ParseHashAlgorithm(s string) (HashAlgorithm, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "xxhash" {
+		return HashXXH64, nil
+	}
+	if !slices.Contains(hashAlgorithms, HashAlgorithm(s)) {
+		names := make([]string, len(hashAlgorithms))
+		for i, a := range hashAlgorithms {
+			names[i] = string(a)
+		}
+		return "", fmt.Errorf("%w: '%s' (expected one of: %s)", ErrUnknownHashAlgorithm, s, strings.Join(names, ", "))
+	}
+	return HashAlgorithm(s), nil
+}
+
+// New returns a new hash.Hash computing a digest with a
+func (a HashAlgorithm) New() (hash.Hash, error) {
+	switch a {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashXXH64:
+		return newXXH64(), nil
+	}
+	return nil, fmt.Errorf("%w: '%s'", ErrUnknownHashAlgorithm, a)
+}
+
+// HashKey identifies an entry's digest in a HashCache.
+// Entries are identified by their location in the archive, so a cache must only hold digests of a single archive.
+type HashKey struct {
+	Offset    uint64
+	Size      uint64
+	Algorithm HashAlgorithm
+}
+
+func hashKeyFor(f *CDR, algorithm HashAlgorithm) HashKey {
+	return HashKey{Offset: f.LocalFileHeaderOffset, Size: f.CompressedSizeBytes, Algorithm: algorithm}
+}
+
+// HashCache stores digests computed by Hash, so that entries aren't read again to compute them
+type HashCache interface {
+	Get(key HashKey) (string, bool)
+	Set(key HashKey, digest string)
+}
+
+// MemoryHashCache is a HashCache held in memory, safe for concurrent use
+type MemoryHashCache struct {
+	mu      sync.Mutex
+	digests map[HashKey]string
+}
+
+func NewMemoryHashCache() *MemoryHashCache {
+	return &MemoryHashCache{digests: make(map[HashKey]string)}
+}
+
+func (c *MemoryHashCache) Get(key HashKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	digest, ok := c.digests[key]
+	return digest, ok
+}
+
+func (c *MemoryHashCache) Set(key HashKey, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.digests[key] = digest
+}
+
+// WithHashCache stores digests computed by Hash in cache, which defaults to one held by the parser
+func WithHashCache(cache HashCache) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		if cache != nil {
+			p.hashCache = cache
+		}
+	}
+}
+
+// Hash returns the hex encoded digest of the decompressed content of f, or an empty string for directories.
+// The content is streamed through the hash as it is read, and checked against the size and CRC32 declared for f,
+// so a corrupt entry returns an error wrapping ErrCorruptArchive rather than a digest.
+// Digests are cached by the location of the entry in the archive, see WithHashCache.
+func (p *CentralDirectoryParser) Hash(f *CDR, algorithm HashAlgorithm) (string, error) {
+	h, err := algorithm.New()
+	if err != nil {
+		return "", err
+	}
+	if f.Mode.IsDir() {
+		return "", nil
+	}
+	key := hashKeyFor(f, algorithm)
+	if digest, ok := p.hashCache.Get(key); ok {
+		return digest, nil
+	}
+	if err := CheckEntryLimit(f, p.entryLimit); err != nil {
+		return "", err
+	}
+	if err := CheckCompressionMethod(f, p.allowedMethods); err != nil {
+		return "", err
+	}
+	r, err := p.readerForRecord(f)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, VerifyingReader(r, f)); err != nil {
+		return "", fmt.Errorf("could not hash %s: %w", f.FileName, err)
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	p.hashCache.Set(key, digest)
+	return digest, nil
+}
@@ -0,0 +1,61 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestCentralDirectoryParser_Hash(t *testing.T) {
+	data := verifyTestZip(t)
+	cache := zipfile.NewMemoryHashCache()
+	p := memParser(data, zipfile.WithHashCache(cache))
+	records, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error parsing central directory: %v", err)
+	}
+	f := records[0]
+	digest, err := p.Hash(f, zipfile.HashSHA256)
+	if err != nil {
+		t.Fatalf("unexpected error hashing %s: %v", f.FileName, err)
+	}
+	expected := sha256.Sum256([]byte("contents of " + f.FileName))
+	if digest != hex.EncodeToString(expected[:]) {
+		t.Errorf("expected digest %x, got %s", expected, digest)
+	}
+
+	// cached digests are returned without reading the entry
+	key := zipfile.HashKey{Offset: f.LocalFileHeaderOffset, Size: f.CompressedSizeBytes, Algorithm: zipfile.HashXXH64}
+	cache.Set(key, "cached")
+	if digest, err := p.Hash(f, zipfile.HashXXH64); err != nil || digest != "cached" {
+		t.Errorf("expected cached digest, got %q (err: %v)", digest, err)
+	}
+
+	corrupt := bytes.Clone(data)
+	corrupt[bytes.Index(corrupt, []byte("contents of b.txt"))] ^= 0xff
+	p = memParser(corrupt)
+	records, err = p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error parsing central directory: %v", err)
+	}
+	if _, err := p.Hash(records[1], zipfile.HashSHA256); !errors.Is(err, zipfile.ErrCorruptArchive) {
+		t.Errorf("expected ErrCorruptArchive hashing a corrupt entry, got: %v", err)
+	}
+}
+
+func TestParseHashAlgorithm(t *testing.T) {
+	for input, expected := range map[string]zipfile.HashAlgorithm{
+		"sha256": zipfile.HashSHA256, " SHA256": zipfile.HashSHA256, "xxh64": zipfile.HashXXH64, "xxhash": zipfile.HashXXH64,
+	} {
+		if algorithm, err := zipfile.ParseHashAlgorithm(input); err != nil || algorithm != expected {
+			t.Errorf("%q: expected %s, got %s (err: %v)", input, expected, algorithm, err)
+		}
+	}
+	if _, err := zipfile.ParseHashAlgorithm("md5"); !errors.Is(err, zipfile.ErrUnknownHashAlgorithm) {
+		t.Errorf("expected ErrUnknownHashAlgorithm, got: %v", err)
+	}
+}
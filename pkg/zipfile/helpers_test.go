@@ -0,0 +1,88 @@
+package zipfile_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func parser(uri string) (*zipfile.CentralDirectoryParser, error) {
+	fetcher, err := remote.Object(uri)
+	if err != nil {
+		return nil, err
+	}
+	return zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), fetcher)), nil
+}
+
+type byteReadSeekCloser struct {
+	*bytes.Reader
+}
+
+func (b *byteReadSeekCloser) Close() error {
+	return nil
+}
+
+// memFetcher serves data as if it were a remote object
+func memFetcher(data []byte) remote.Fetcher {
+	return remote.NewLocalFetcherFromData(&byteReadSeekCloser{Reader: bytes.NewReader(data)})
+}
+
+func memParser(data []byte, opts ...zipfile.ParserOpt) *zipfile.CentralDirectoryParser {
+	return zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), memFetcher(data)), opts...)
+}
+
+// newZip builds a fixture archive, whose entries are written by add
+func newZip(t *testing.T, add func(w *zip.Writer)) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	add(w)
+	if err := w.Close(); err != nil {
+		t.Fatalf("could not write zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// addEntry writes an entry with the given header and content to w
+func addEntry(t *testing.T, w *zip.Writer, header *zip.FileHeader, content []byte) {
+	t.Helper()
+	f, err := w.CreateHeader(header)
+	if err != nil {
+		t.Fatalf("could not create entry: %v", err)
+	}
+	if _, err := f.Write(content); err != nil {
+		t.Fatalf("could not write entry: %v", err)
+	}
+}
+
+// addPadding writes a stored entry of zeros to w: the parser prefetches the last 64kb of the archive, so make sure
+// there are at least that many
+func addPadding(t *testing.T, w *zip.Writer) {
+	t.Helper()
+	addEntry(t, w, &zip.FileHeader{Name: "padding.bin", Method: zip.Store}, make([]byte, zipfile.EOCDPrefetchBufferSize))
+}
+
+// zipOf builds an archive holding the given entries, in order, with the given compression method
+func zipOf(t *testing.T, method uint16, entries ...[2]string) []byte {
+	t.Helper()
+	return newZip(t, func(w *zip.Writer) {
+		for _, e := range entries {
+			addEntry(t, w, &zip.FileHeader{Name: e[0], Method: method}, []byte(e[1]))
+		}
+	})
+}
+
+// verifyTestZip builds an archive of stored a.txt, b.txt and c.txt, holding "contents of <name>", and padding
+func verifyTestZip(t *testing.T) []byte {
+	t.Helper()
+	return newZip(t, func(w *zip.Writer) {
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			addEntry(t, w, &zip.FileHeader{Name: name, Method: zip.Store}, []byte("contents of "+name))
+		}
+		addPadding(t, w)
+	})
+}
@@ -0,0 +1,353 @@
+package zipfile
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// Index files store a parsed central directory, so it can be shared without re-reading the archive.
+// All integers are little-endian. The layout is:
+//
+//	header:
+//	  magic          [4]byte  "CZIX"
+//	  version        uint16   currently 2
+//	  flags          uint16   reserved, 0
+//	  record count   uint64
+//	archive (version 2 and later):
+//	  archive length uint32   length of the archive fields, not including this field
+//	  uri            uint16 length, followed by the URI of the archive the index was built from
+//	  size           int64    size of the archive in bytes, -1 if unknown
+//	  etag           uint16 length, followed by the ETag of the archive (empty if its backend has none)
+//	records (record count times):
+//	  record length  uint32   length of the record, not including this field
+//	  compression    uint16   zip compression method
+//	  modified       int64    seconds since the unix epoch, UTC
+//	  crc32          uint32   CRC32 of the uncompressed data
+//	  compressed     uint64   compressed size in bytes
+//	  uncompressed   uint64   uncompressed size in bytes
+//	  mode           uint32   Go io/fs.FileMode bits (permissions in the lower 9 bits, directory = 1<<31)
+//	  header offset  uint64   offset of the local file header in the archive
+//	  name           uint16 length, followed by the UTF-8 name
+//	  extra fields   uint32 length, followed by the raw extra fields
+//	  comment        uint32 length, followed by the raw file comment
+//	  modified nsec  uint32   nanoseconds to add to modified
+//	  times          uint8    bit 0: accessed is set, bit 1: created is set
+//	  accessed       int64    nanoseconds since the unix epoch, UTC
+//	  created        int64    nanoseconds since the unix epoch, UTC
+//
+// Readers must skip any bytes remaining in a record (or in the archive fields) after the fields they know about,
+// so fields can be appended in later versions without bumping the version.
+// The version only changes for incompatible layout changes.
+
+const (
+	IndexVersion = 2
+	// indexVersionNoArchive is the version of index files without archive fields, which can still be loaded
+	indexVersionNoArchive = 1
+)
+
+var (
+	ErrInvalidIndex            = errors.New("invalid index file")
+	ErrUnsupportedIndexVersion = errors.New("unsupported index version")
+	// ErrIndexMismatch is returned validating an index against an archive it wasn't built from, or that changed since
+	ErrIndexMismatch = errors.New("index doesn't match the archive")
+
+	indexMagic = [4]byte{'C', 'Z', 'I', 'X'}
+)
+
+type indexHeader struct {
+	Magic   [4]byte
+	Version uint16
+	Flags   uint16
+	Count   uint64
+}
+
+const (
+	indexTimesAccessed = 1 << iota
+	indexTimesCreated
+)
+
+// indexRecordTimes are fields appended to indexRecordFixed, after the variable length fields
+type indexRecordTimes struct {
+	ModifiedNsec uint32
+	Times        uint8
+	Accessed     int64
+	Created      int64
+}
+
+type indexRecordFixed struct {
+	CompressionMethod     uint16
+	Modified              int64
+	CRC32Uncompressed     uint32
+	CompressedSizeBytes   uint64
+	UncompressedSizeBytes uint64
+	Mode                  uint32
+	LocalFileHeaderOffset uint64
+}
+
+// IndexArchive describes the archive an index was built from, so that an index can be checked against
+// the archive before it's used in place of its central directory
+type IndexArchive struct {
+	URI string
+	// Size is the size of the archive in bytes, -1 if unknown
+	Size int64
+	// ETag is the ETag of the archive, empty if its backend doesn't provide one
+	ETag string
+}
+
+// DescribeArchive returns the IndexArchive of f, the archive at uri. Archives of backends without ETags
+// are described by their size alone.
+func DescribeArchive(ctx context.Context, uri string, f remote.Fetcher) (IndexArchive, error) {
+	size, err := remote.SizeOf(ctx, f)
+	if err != nil {
+		return IndexArchive{}, err
+	}
+	etag, err := remote.ETagOf(ctx, f)
+	if err != nil && !errors.Is(err, remote.ErrNoETag) {
+		return IndexArchive{}, err
+	}
+	return IndexArchive{URI: uri, Size: size, ETag: etag}, nil
+}
+
+// Validate returns ErrIndexMismatch unless f, the archive at uri, is the archive a describes: it has the same URI,
+// size and, if a has one, ETag. Indexes that don't record the size of their archive never match.
+func (a IndexArchive) Validate(ctx context.Context, uri string, f remote.Fetcher) error {
+	if a.URI != uri {
+		return fmt.Errorf("%w: index was built from %q", ErrIndexMismatch, a.URI)
+	}
+	if a.Size < 0 {
+		return fmt.Errorf("%w: index doesn't record the size of the archive", ErrIndexMismatch)
+	}
+	size, err := remote.SizeOf(ctx, f)
+	if err != nil {
+		return err
+	}
+	if size != a.Size {
+		return fmt.Errorf("%w: archive is %d bytes, index was built from %d bytes", ErrIndexMismatch, size, a.Size)
+	}
+	if a.ETag == "" {
+		return nil
+	}
+	etag, err := remote.ETagOf(ctx, f)
+	if errors.Is(err, remote.ErrNoETag) {
+		return fmt.Errorf("%w: %v, index was built from ETag %s", ErrIndexMismatch, err, a.ETag)
+	} else if err != nil {
+		return err
+	}
+	if etag != a.ETag {
+		return fmt.Errorf("%w: archive has ETag %s, index was built from ETag %s", ErrIndexMismatch, etag, a.ETag)
+	}
+	return nil
+}
+
+// ExportIndex writes records to w in the index format, without describing the archive they were read from
+func ExportIndex(w io.Writer, records []*CDR) error {
+	return ExportArchiveIndex(w, IndexArchive{Size: -1}, records)
+}
+
+// ExportArchiveIndex writes records, read from archive, to w in the index format
+func ExportArchiveIndex(w io.Writer, archive IndexArchive, records []*CDR) error {
+	if len(archive.URI) > 0xffff || len(archive.ETag) > 0xffff {
+		return fmt.Errorf("%w: archive URI or ETag too long", ErrInvalidIndex)
+	}
+	bw := bufio.NewWriter(w)
+	err := binary.Write(bw, binary.LittleEndian, &indexHeader{
+		Magic:   indexMagic,
+		Version: IndexVersion,
+		Count:   uint64(len(records)),
+	})
+	if err != nil {
+		return err
+	}
+	record := &bytes.Buffer{}
+	_ = binary.Write(record, binary.LittleEndian, uint16(len(archive.URI)))
+	record.WriteString(archive.URI)
+	_ = binary.Write(record, binary.LittleEndian, archive.Size)
+	_ = binary.Write(record, binary.LittleEndian, uint16(len(archive.ETag)))
+	record.WriteString(archive.ETag)
+	if err := binary.Write(bw, binary.LittleEndian, uint32(record.Len())); err != nil {
+		return err
+	}
+	if _, err := bw.Write(record.Bytes()); err != nil {
+		return err
+	}
+	for _, f := range records {
+		if len(f.FileName) > 0xffff || uint64(len(f.ExtraFields)) > 0xffffffff || uint64(len(f.FileComment)) > 0xffffffff {
+			return fmt.Errorf("%w: record too large: %s", ErrInvalidIndex, f.FileName)
+		}
+		record.Reset()
+		_ = binary.Write(record, binary.LittleEndian, &indexRecordFixed{
+			CompressionMethod:     f.CompressionMethod,
+			Modified:              f.Modified.Unix(),
+			CRC32Uncompressed:     f.CRC32Uncompressed,
+			CompressedSizeBytes:   f.CompressedSizeBytes,
+			UncompressedSizeBytes: f.UncompressedSizeBytes,
+			Mode:                  uint32(f.Mode),
+			LocalFileHeaderOffset: f.LocalFileHeaderOffset,
+		})
+		_ = binary.Write(record, binary.LittleEndian, uint16(len(f.FileName)))
+		record.WriteString(f.FileName)
+		_ = binary.Write(record, binary.LittleEndian, uint32(len(f.ExtraFields)))
+		record.Write(f.ExtraFields)
+		_ = binary.Write(record, binary.LittleEndian, uint32(len(f.FileComment)))
+		record.Write(f.FileComment)
+		_ = binary.Write(record, binary.LittleEndian, recordTimes(f))
+
+		if err := binary.Write(bw, binary.LittleEndian, uint32(record.Len())); err != nil {
+			return err
+		}
+		if _, err := bw.Write(record.Bytes()); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// LoadIndex reads records written by ExportIndex (or ExportArchiveIndex)
+func LoadIndex(r io.Reader) ([]*CDR, error) {
+	_, records, err := LoadArchiveIndex(r)
+	return records, err
+}
+
+// LoadArchiveIndex reads records written by ExportArchiveIndex, along with the archive they were read from.
+// The archive of indexes that don't describe it has an empty URI and a Size of -1.
+func LoadArchiveIndex(r io.Reader) (IndexArchive, []*CDR, error) {
+	br := bufio.NewReader(r)
+	header := &indexHeader{}
+	archive := IndexArchive{Size: -1}
+	if err := binary.Read(br, binary.LittleEndian, header); err != nil {
+		return archive, nil, fmt.Errorf("%w: could not read header: %v", ErrInvalidIndex, err)
+	}
+	if header.Magic != indexMagic {
+		return archive, nil, fmt.Errorf("%w: bad magic", ErrInvalidIndex)
+	}
+	if header.Version != IndexVersion && header.Version != indexVersionNoArchive {
+		return archive, nil, fmt.Errorf("%w: %d", ErrUnsupportedIndexVersion, header.Version)
+	}
+	if header.Version != indexVersionNoArchive {
+		var err error
+		if archive, err = readIndexArchive(br); err != nil {
+			return archive, nil, fmt.Errorf("%w: archive: %v", ErrInvalidIndex, err)
+		}
+	}
+	// don't trust the count for allocation, a corrupt header shouldn't exhaust memory
+	records := make([]*CDR, 0, min(header.Count, 1<<16))
+	for i := uint64(0); i < header.Count; i++ {
+		f, err := readIndexRecord(br)
+		if err != nil {
+			return archive, nil, fmt.Errorf("%w: record %d: %v", ErrInvalidIndex, i, err)
+		}
+		records = append(records, f)
+	}
+	return archive, records, nil
+}
+
+func readIndexArchive(r io.Reader) (IndexArchive, error) {
+	archive := IndexArchive{Size: -1}
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return archive, err
+	}
+	fields := io.LimitReader(r, int64(length))
+	uri, err := readLengthPrefixed[uint16](fields)
+	if err != nil {
+		return archive, err
+	}
+	if err := binary.Read(fields, binary.LittleEndian, &archive.Size); err != nil {
+		return archive, err
+	}
+	etag, err := readLengthPrefixed[uint16](fields)
+	if err != nil {
+		return archive, err
+	}
+	// skip fields added by later versions
+	if _, err := io.Copy(io.Discard, fields); err != nil {
+		return archive, err
+	}
+	archive.URI, archive.ETag = string(uri), string(etag)
+	return archive, nil
+}
+
+func readIndexRecord(r io.Reader) (*CDR, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	record := io.LimitReader(r, int64(length))
+	fixed := &indexRecordFixed{}
+	if err := binary.Read(record, binary.LittleEndian, fixed); err != nil {
+		return nil, err
+	}
+	name, err := readLengthPrefixed[uint16](record)
+	if err != nil {
+		return nil, err
+	}
+	extra, err := readLengthPrefixed[uint32](record)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := readLengthPrefixed[uint32](record)
+	if err != nil {
+		return nil, err
+	}
+	times := &indexRecordTimes{}
+	if err := binary.Read(record, binary.LittleEndian, times); err != nil && err != io.EOF {
+		return nil, err
+	}
+	// skip fields added by later versions
+	if _, err := io.Copy(io.Discard, record); err != nil {
+		return nil, err
+	}
+	f := &CDR{
+		CompressionMethod:     fixed.CompressionMethod,
+		Modified:              time.Unix(fixed.Modified, int64(times.ModifiedNsec)).UTC(),
+		CRC32Uncompressed:     fixed.CRC32Uncompressed,
+		CompressedSizeBytes:   fixed.CompressedSizeBytes,
+		UncompressedSizeBytes: fixed.UncompressedSizeBytes,
+		Mode:                  fs.FileMode(fixed.Mode),
+		LocalFileHeaderOffset: fixed.LocalFileHeaderOffset,
+		FileName:              string(name),
+		ExtraFields:           extra,
+		FileComment:           comment,
+	}
+	if times.Times&indexTimesAccessed != 0 {
+		f.Accessed = time.Unix(0, times.Accessed).UTC()
+	}
+	if times.Times&indexTimesCreated != 0 {
+		f.Created = time.Unix(0, times.Created).UTC()
+	}
+	return f, nil
+}
+
+func recordTimes(f *CDR) *indexRecordTimes {
+	times := &indexRecordTimes{ModifiedNsec: uint32(f.Modified.Nanosecond())}
+	if !f.Accessed.IsZero() {
+		times.Times |= indexTimesAccessed
+		times.Accessed = f.Accessed.UnixNano()
+	}
+	if !f.Created.IsZero() {
+		times.Times |= indexTimesCreated
+		times.Created = f.Created.UnixNano()
+	}
+	return times
+}
+
+func readLengthPrefixed[T uint16 | uint32](r io.Reader) ([]byte, error) {
+	var length T
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
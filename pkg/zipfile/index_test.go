@@ -0,0 +1,129 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestExportIndex(t *testing.T) {
+	var records []*zipfile.CDR
+	for _, uri := range []string{"file://testdata/unicode_path.zip", "file://testdata/timestamps.zip"} {
+		p, err := parser(uri)
+		if err != nil {
+			t.Fatalf("unexpected error opening zip file: %v", err)
+		}
+		r, err := p.GetCentralDirectory()
+		if err != nil {
+			t.Fatalf("unexpected error reading central directory: %v", err)
+		}
+		records = append(records, r...)
+	}
+	buf := &bytes.Buffer{}
+	if err := zipfile.ExportIndex(buf, records); err != nil {
+		t.Fatalf("unexpected error exporting index: %v", err)
+	}
+	exported := buf.Bytes()
+
+	loaded, err := zipfile.LoadIndex(bytes.NewReader(exported))
+	if err != nil {
+		t.Fatalf("unexpected error loading index: %v", err)
+	}
+	if len(loaded) != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), len(loaded))
+	}
+	for i, expected := range records {
+		got := loaded[i]
+		if got.FileName != expected.FileName ||
+			got.CompressionMethod != expected.CompressionMethod ||
+			!got.Modified.Equal(expected.Modified) ||
+			!got.Accessed.Equal(expected.Accessed) ||
+			!got.Created.Equal(expected.Created) ||
+			got.CRC32Uncompressed != expected.CRC32Uncompressed ||
+			got.CompressedSizeBytes != expected.CompressedSizeBytes ||
+			got.UncompressedSizeBytes != expected.UncompressedSizeBytes ||
+			got.Mode != expected.Mode ||
+			got.LocalFileHeaderOffset != expected.LocalFileHeaderOffset ||
+			!bytes.Equal(got.ExtraFields, expected.ExtraFields) ||
+			!bytes.Equal(got.FileComment, expected.FileComment) {
+			t.Errorf("record %d: expected %+v, got %+v", i, expected, got)
+		}
+	}
+
+	t.Run("bad magic", func(t *testing.T) {
+		_, err := zipfile.LoadIndex(bytes.NewReader([]byte("PK\x03\x04 not an index")))
+		if !errors.Is(err, zipfile.ErrInvalidIndex) {
+			t.Errorf("expected ErrInvalidIndex, got %v", err)
+		}
+	})
+	t.Run("newer version", func(t *testing.T) {
+		data := bytes.Clone(exported)
+		data[4] = zipfile.IndexVersion + 1
+		_, err := zipfile.LoadIndex(bytes.NewReader(data))
+		if !errors.Is(err, zipfile.ErrUnsupportedIndexVersion) {
+			t.Errorf("expected ErrUnsupportedIndexVersion, got %v", err)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		_, err := zipfile.LoadIndex(bytes.NewReader(exported[:len(exported)-1]))
+		if !errors.Is(err, zipfile.ErrInvalidIndex) {
+			t.Errorf("expected ErrInvalidIndex, got %v", err)
+		}
+	})
+	t.Run("version 1", func(t *testing.T) {
+		// version 1 has no archive fields: drop them (their length, then the fields themselves)
+		archiveLength := binary.LittleEndian.Uint32(exported[16:20])
+		data := append(bytes.Clone(exported[:16]), exported[20+archiveLength:]...)
+		data[4] = 1
+		archive, loaded, err := zipfile.LoadArchiveIndex(bytes.NewReader(data))
+		if err != nil || len(loaded) != len(records) {
+			t.Fatalf("expected %d records, got %d (err: %v)", len(records), len(loaded), err)
+		}
+		if archive.URI != "" || archive.Size != -1 {
+			t.Errorf("expected no archive, got %+v", archive)
+		}
+	})
+}
+
+func TestIndexArchive_Validate(t *testing.T) {
+	const uri = "file://testdata/regular.zip"
+	fetcher, err := remote.Object(uri)
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	ctx := context.Background()
+	archive, err := zipfile.DescribeArchive(ctx, uri, fetcher)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := zipfile.ExportArchiveIndex(buf, archive, nil); err != nil {
+		t.Fatalf("unexpected error exporting index: %v", err)
+	}
+	loaded, _, err := zipfile.LoadArchiveIndex(buf)
+	if err != nil || loaded != archive {
+		t.Fatalf("expected %+v, got %+v (err: %v)", archive, loaded, err)
+	}
+	if err := loaded.Validate(ctx, uri, fetcher); err != nil {
+		t.Errorf("expected the index to match its archive, got %v", err)
+	}
+
+	for name, mismatched := range map[string]zipfile.IndexArchive{
+		"uri":     {URI: "file://testdata/zip64.zip", Size: archive.Size},
+		"size":    {URI: uri, Size: archive.Size + 1},
+		"no size": {URI: uri, Size: -1},
+		// local files have no ETag to compare
+		"etag": {URI: uri, Size: archive.Size, ETag: `"abc"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := mismatched.Validate(ctx, uri, fetcher); !errors.Is(err, zipfile.ErrIndexMismatch) {
+				t.Errorf("expected ErrIndexMismatch, got %v", err)
+			}
+		})
+	}
+}
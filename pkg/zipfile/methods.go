@@ -0,0 +1,72 @@
+package zipfile
+
+import (
+	"archive/zip"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// DefaultAllowedMethods are the built-in compression methods, decoded when no allowlist is configured
+	// along with the methods of registered decompressors (see RegisterDecompressor)
+	DefaultAllowedMethods = []uint16{zip.Store, zip.Deflate, Deflate64}
+
+	compressionMethodNames = map[string]uint16{
+		"store":     zip.Store,
+		"deflate":   zip.Deflate,
+		"deflate64": Deflate64,
+		"bzip2":     12,
+		"lzma":      14,
+		"zstd":      93,
+		"xz":        95,
+	}
+)
+
+// CompressionMethodName returns a human-readable name for a zip compression method
+func CompressionMethodName(method uint16) string {
+	for name, m := range compressionMethodNames {
+		if m == method {
+			return name
+		}
+	}
+	return strconv.Itoa(int(method))
+}
+
+// ParseCompressionMethods parses a comma-separated list of compression method names (e.g. "store,deflate")
+// or numeric method IDs, as defined by the zip APPNOTE
+func ParseCompressionMethods(s string) ([]uint16, error) {
+	var methods []uint16
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		if method, ok := compressionMethodNames[part]; ok {
+			methods = append(methods, method)
+			continue
+		}
+		method, err := strconv.ParseUint(part, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("unknown compression method: '%s'", part)
+		}
+		methods = append(methods, uint16(method))
+	}
+	return methods, nil
+}
+
+// CheckCompressionMethod returns ErrMethodNotAllowed if f is compressed with a method not in allowed.
+// A nil allowlist means DefaultAllowedMethods, and the methods of registered decompressors.
+func CheckCompressionMethod(f *CDR, allowed []uint16) error {
+	if allowed == nil {
+		allowed = DefaultAllowedMethods
+		if decompressor(f.CompressionMethod) != nil {
+			return nil
+		}
+	}
+	if !slices.Contains(allowed, f.CompressionMethod) {
+		return fmt.Errorf("%w: %s is compressed with %s", ErrMethodNotAllowed, f.FileName, CompressionMethodName(f.CompressionMethod))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package zipfile_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestCentralDirectoryParser_AllowedMethods(t *testing.T) {
+	deflateOnly, err := zipfile.ParseCompressionMethods("deflate")
+	if err != nil {
+		t.Fatalf("unexpected error parsing methods: %v", err)
+	}
+	fetcher, err := remote.Object("file://testdata/regular.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	// regular.zip entries are stored, not deflated
+	p := zipfile.NewCentralDirectoryParser(
+		zipfile.NewStorageAdapter(context.Background(), fetcher),
+		zipfile.WithAllowedMethods(deflateOnly))
+	_, err = p.Read("foo/bar.txt")
+	if !errors.Is(err, zipfile.ErrMethodNotAllowed) {
+		t.Errorf("expected ErrMethodNotAllowed, got %v", err)
+	}
+
+	if _, err := zipfile.ParseCompressionMethods("store,shrink"); err == nil {
+		t.Error("expected error parsing unknown method")
+	}
+	methods, err := zipfile.ParseCompressionMethods("store, Deflate,93")
+	if err != nil {
+		t.Fatalf("unexpected error parsing methods: %v", err)
+	}
+	if len(methods) != 3 || methods[0] != 0 || methods[1] != 8 || methods[2] != 93 {
+		t.Errorf("unexpected methods: %v", methods)
+	}
+}
@@ -0,0 +1,216 @@
+package zipfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+const (
+	// NestedSeparator separates the URI of an archive from the path of an archive nested in it,
+	// e.g. s3://bucket/outer.zip!inner.zip. A literal "!" in an object name can be written as %21.
+	NestedSeparator = "!"
+	// MaxNestingDepth is the number of archives that can be nested in one another
+	MaxNestingDepth = 4
+)
+
+var (
+	ErrNotZipArchive  = fmt.Errorf("%w: not a zip archive", ErrInvalidZip)
+	ErrNestingTooDeep = fmt.Errorf("archives nested more than %d levels deep", MaxNestingDepth)
+)
+
+// SplitNestedURI splits uri into the URI of the outermost archive and the paths of the archives nested in it, in order
+func SplitNestedURI(uri string) (string, []string, error) {
+	parts := strings.Split(uri, NestedSeparator)
+	if len(parts)-1 > MaxNestingDepth {
+		return "", nil, fmt.Errorf("%w: %s", ErrNestingTooDeep, uri)
+	}
+	for _, part := range parts[1:] {
+		if part == "" {
+			return "", nil, fmt.Errorf("%w: empty nested path in %s", remote.ErrInvalidURI, uri)
+		}
+	}
+	return parts[0], parts[1:], nil
+}
+
+// NestedArchive locates an archive stored as an entry of another archive (possibly several levels deep).
+// Stored (uncompressed) archives are read with ranged requests to the outermost archive;
+// compressed ones have to be decompressed, into a temporary file, which Close removes.
+type NestedArchive struct {
+	// spooled, if set, holds the decompressed archive the section is relative to, rather than the outermost archive
+	spooled *os.File
+	offset  int64
+	size    int64
+}
+
+// OpenNested follows path from the archive read by outer, returning the innermost archive.
+// Every archive along the path, including the last, must be a zip archive.
+func OpenNested(ctx context.Context, outer remote.Fetcher, path []string, opts ...ParserOpt) (*NestedArchive, error) {
+	if len(path) > MaxNestingDepth {
+		return nil, fmt.Errorf("%w: %s", ErrNestingTooDeep, strings.Join(path, NestedSeparator))
+	}
+	var n *NestedArchive
+	current := outer
+	for _, name := range path {
+		next, err := openNestedEntry(ctx, current, name, n, opts...)
+		if err != nil {
+			_ = n.Close()
+			return nil, err
+		}
+		if n != nil && next.spooled != n.spooled {
+			_ = n.Close()
+		}
+		n = next
+		current = n.Fetcher(outer)
+		probe := NewCentralDirectoryParser(NewStorageAdapter(ctx, current), opts...)
+		if err := probe.ProbeRange(); err != nil {
+			_ = n.Close()
+			if errors.Is(err, ErrInvalidZip) {
+				return nil, fmt.Errorf("%w: %s: %v", ErrNotZipArchive, name, err)
+			}
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// openNestedEntry locates the entry name in the archive read by f, which is parent (or the outermost archive if nil)
+func openNestedEntry(ctx context.Context, f remote.Fetcher, name string, parent *NestedArchive, opts ...ParserOpt) (*NestedArchive, error) {
+	adapter := NewStorageAdapter(ctx, f)
+	p := NewCentralDirectoryParser(adapter, opts...)
+	records, err := p.GetCentralDirectory()
+	if err != nil {
+		return nil, err
+	}
+	var record *CDR
+	for _, r := range records {
+		if r.FileName == name {
+			record = r
+			break
+		}
+	}
+	if record == nil {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, name)
+	}
+	if record.Mode.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a directory", ErrNotZipArchive, name)
+	}
+	if err := CheckEntryLimit(record, p.entryLimit); err != nil {
+		return nil, err
+	}
+	if err := CheckCompressionMethod(record, p.allowedMethods); err != nil {
+		return nil, err
+	}
+	if record.CompressionMethod == zip.Store {
+		dataOffset, err := entryDataOffset(record, adapter)
+		if err != nil {
+			return nil, err
+		}
+		n := &NestedArchive{offset: dataOffset, size: int64(record.UncompressedSizeBytes)}
+		if parent != nil {
+			n.spooled = parent.spooled
+			n.offset += parent.offset
+		}
+		return n, nil
+	}
+	return spoolEntry(p, record)
+}
+
+// entryDataOffset returns the offset of the data of f, following its local header
+func entryDataOffset(f *CDR, fetcher OffsetFetcher) (int64, error) {
+	r, err := fetcher.Fetch(offset(f.LocalFileHeaderOffset), offset(f.LocalFileHeaderOffset+localHeaderFixedSize-1))
+	if err != nil {
+		return 0, err
+	}
+	h := &localHeader{}
+	if err := binary.Read(r, binary.LittleEndian, h); err != nil {
+		return 0, ErrInvalidZip
+	}
+	return int64(f.LocalFileHeaderOffset) + localHeaderFixedSize + int64(h.FileNameLength) + int64(h.ExtraFieldLength), nil
+}
+
+// spoolEntry decompresses f into an unlinked temporary file
+func spoolEntry(p *CentralDirectoryParser, f *CDR) (*NestedArchive, error) {
+	r, err := p.readerForRecord(f)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", "cz-nested-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	// only the open handle is needed: remove it right away, so it can't be left behind
+	_ = os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, VerifyingReader(r, f))
+	if err != nil {
+		_ = tmp.Close()
+		return nil, fmt.Errorf("could not decompress %s: %w", f.FileName, err)
+	}
+	return &NestedArchive{spooled: tmp, size: size}, nil
+}
+
+// Fetcher returns a fetcher for the nested archive, given a fetcher for the outermost archive
+func (n *NestedArchive) Fetcher(outer remote.Fetcher) remote.Fetcher {
+	if n.spooled != nil {
+		return &sectionFetcher{next: &readerAtFetcher{r: n.spooled}, offset: n.offset, size: n.size}
+	}
+	return &sectionFetcher{next: outer, offset: n.offset, size: n.size}
+}
+
+// Close removes the temporary file holding a decompressed archive, if there is one
+func (n *NestedArchive) Close() error {
+	if n == nil || n.spooled == nil {
+		return nil
+	}
+	return n.spooled.Close()
+}
+
+// sectionFetcher reads size bytes at offset of next as an object of its own
+type sectionFetcher struct {
+	next   remote.Fetcher
+	offset int64
+	size   int64
+}
+
+func (s *sectionFetcher) Fetch(ctx context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	start, end := int64(0), s.size-1
+	switch {
+	case startOffset != nil && endOffset != nil:
+		start, end = *startOffset, min(*endOffset, end)
+	case startOffset != nil:
+		start = *startOffset
+	case endOffset != nil:
+		// the last endOffset bytes
+		start = max(s.size-*endOffset, 0)
+	}
+	if start > end {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	start, end = s.offset+start, s.offset+end
+	return s.next.Fetch(ctx, &start, &end)
+}
+
+func (s *sectionFetcher) SizeOf(_ context.Context) (int64, error) {
+	return s.size, nil
+}
+
+// readerAtFetcher serves ranges of r, which can be read concurrently (unlike a LocalFetcher)
+type readerAtFetcher struct {
+	r io.ReaderAt
+}
+
+func (f *readerAtFetcher) Fetch(_ context.Context, startOffset *int64, endOffset *int64) (io.ReadCloser, error) {
+	if startOffset == nil || endOffset == nil {
+		// sectionFetcher always passes both
+		return nil, fmt.Errorf("%w: open-ended range", remote.ErrInvalidURI)
+	}
+	return io.NopCloser(io.NewSectionReader(f.r, *startOffset, *endOffset-*startOffset+1)), nil
+}
@@ -0,0 +1,59 @@
+package zipfile_test
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestOpenNested(t *testing.T) {
+	innermost := zipOf(t, zip.Deflate, [2]string{"hello.txt", "hello from the inside"})
+	inner := zipOf(t, zip.Store, [2]string{"notes.txt", "not a zip"}, [2]string{"deflated.zip", string(innermost)})
+	// the parser prefetches the last 64kb of the archive, so make sure the outer one is at least that big
+	outer := zipOf(t, zip.Store, [2]string{"padding.bin", string(make([]byte, 65536))},
+		[2]string{"dir/stored.zip", string(inner)},
+		[2]string{"compressed.zip", string(zipOf(t, zip.Deflate, [2]string{"deflated.zip", string(innermost)}))})
+	fetcher := memFetcher(outer)
+	ctx := context.Background()
+
+	for _, uri := range []string{"outer.zip!dir/stored.zip!deflated.zip", "outer.zip!compressed.zip!deflated.zip"} {
+		t.Run(uri, func(t *testing.T) {
+			outerURI, path, err := zipfile.SplitNestedURI(uri)
+			if err != nil || outerURI != "outer.zip" || len(path) != 2 {
+				t.Fatalf("unexpected split of %s: %s %v (err: %v)", uri, outerURI, path, err)
+			}
+			n, err := zipfile.OpenNested(ctx, fetcher, path)
+			if err != nil {
+				t.Fatalf("unexpected error opening %s: %v", uri, err)
+			}
+			defer func() { _ = n.Close() }()
+			p := zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(ctx, n.Fetcher(fetcher)))
+			r, err := p.Read("hello.txt")
+			if err != nil {
+				t.Fatalf("unexpected error reading nested entry: %v", err)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil || string(data) != "hello from the inside" {
+				t.Errorf("unexpected content %q (err: %v)", data, err)
+			}
+		})
+	}
+
+	if _, err := zipfile.OpenNested(ctx, fetcher, []string{"dir/stored.zip", "notes.txt"}); !errors.Is(err, zipfile.ErrNotZipArchive) {
+		t.Errorf("expected ErrNotZipArchive for a text entry, got: %v", err)
+	}
+	if _, err := zipfile.OpenNested(ctx, fetcher, []string{"dir/"}); !errors.Is(err, zipfile.ErrFileNotFound) {
+		t.Errorf("expected ErrFileNotFound for a missing entry, got: %v", err)
+	}
+	if _, _, err := zipfile.SplitNestedURI("a.zip!b!c!d!e!f"); !errors.Is(err, zipfile.ErrNestingTooDeep) {
+		t.Errorf("expected ErrNestingTooDeep, got: %v", err)
+	}
+	if _, _, err := zipfile.SplitNestedURI("a.zip!!b"); !errors.Is(err, remote.ErrInvalidURI) {
+		t.Errorf("expected ErrInvalidURI for an empty nested path, got: %v", err)
+	}
+}
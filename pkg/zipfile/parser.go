@@ -1,30 +1,54 @@
 package zipfile
 
 import (
-	"archive/zip"
+	"bufio"
 	"bytes"
-	"compress/flate"
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"io/fs"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	EOCDPrefetchBufferSize = 65536 // 64kb is more than enough
-	Zip64HeaderId          = 0x0001
+
+	// DefaultCDWindowSize is the size of the ranged requests the central directory is read with
+	DefaultCDWindowSize = 16 * 1024 * 1024
+	// cdReadBufferSize is the buffer records are parsed from, as the central directory is downloaded
+	cdReadBufferSize     = 64 * 1024
+	Zip64HeaderId        = 0x0001
+	UnicodePathHeaderId  = 0x7075
+	ExtTimestampHeaderId = 0x5455
+	NTFSHeaderId         = 0x000a
+
+	// progress is reported every progressEntriesInterval records / progressBytesInterval bytes read
+	progressEntriesInterval = 10000
+	progressBytesInterval   = 1024 * 1024
 )
 
 var (
 	EOCDSignature   = []byte{0x50, 0x4b, 0x05, 0x06}
 	EOCD64Signature = []byte{0x50, 0x4b, 0x06, 0x06}
+	CDRSignature    = []byte{0x50, 0x4b, 0x01, 0x02}
+	// LocalHeaderSignature starts the local file header preceding the data of each entry
+	LocalHeaderSignature = []byte{0x50, 0x4b, 0x03, 0x04}
+	// DataDescriptorSignature optionally starts the data descriptor following the data of entries that have one
+	DataDescriptorSignature = []byte{0x50, 0x4b, 0x07, 0x08}
 )
 
 var (
-	ErrInvalidZip   = errors.New("invalid zip file")
-	ErrFileNotFound = errors.New("file not found")
+	ErrInvalidZip    = errors.New("invalid zip file")
+	ErrFileNotFound  = errors.New("file not found")
+	ErrEntryTooLarge = errors.New("entry too large")
+
+	ErrMethodNotAllowed = errors.New("compression method not allowed")
 )
 
 type EOCD struct {
@@ -35,6 +59,7 @@ type EOCD struct {
 	TotalCDRs         uint16
 	CDSizeBytes       uint32
 	CDByteOffset      uint32
+	CommentLength     uint16
 }
 
 type EOCD64 struct {
@@ -70,13 +95,28 @@ type cdrMetadata struct {
 	LocalFileHeaderOffsetRaw uint32
 }
 
+// zip64ExtraFields holds the values of a zip64 extra field. The field only holds the values whose header field
+// stores the zip64 placeholder, in a fixed order: the uncompressed size, the compressed size, the local file header
+// offset and the disk number (APPNOTE 4.5.3).
 type zip64ExtraFields struct {
 	UncompressedSizeBytes uint64
 	CompressedSizeBytes   uint64
 	LocalFileHeaderOffset uint64
 	FileStartDiskNumber   uint32
+	// missing are the values that were needed, but that the field ends before
+	missing zip64Values
 }
 
+// zip64Values is a set of values held by a zip64 extra field
+type zip64Values uint8
+
+const (
+	zip64UncompressedSize zip64Values = 1 << iota
+	zip64CompressedSize
+	zip64LocalHeaderOffset
+	zip64DiskNumber
+)
+
 type localHeader struct {
 	Signature                uint32
 	VersionNeededToExtract   uint16
@@ -92,8 +132,11 @@ type localHeader struct {
 }
 
 type CDR struct {
-	CompressionMethod     uint16
-	Modified              time.Time
+	CompressionMethod uint16
+	Modified          time.Time
+	// Accessed and Created are only set if the entry has an extended timestamp or NTFS extra field
+	Accessed              time.Time
+	Created               time.Time
 	CRC32Uncompressed     uint32
 	CompressedSizeBytes   uint64
 	UncompressedSizeBytes uint64
@@ -102,26 +145,198 @@ type CDR struct {
 	FileName              string
 	ExtraFields           []byte
 	FileComment           []byte
+	// unknownSizes are the sizes that are stored as zip64 placeholders, without a zip64 extra field holding them,
+	// which are then recovered from the local file header, see WithTolerant
+	unknownSizes unknownSizes
 }
 
+// unknownSizes is a set of sizes a central directory record is missing
+type unknownSizes uint8
+
+const (
+	unknownUncompressedSize unknownSizes = 1 << iota
+	unknownCompressedSize
+)
+
 type CDLocation struct {
 	SizeBytes uint64
 	Offset    uint64
 	Zip64     bool
+	// Entries is the total number of records declared by the EOCD (or EOCD64) record
+	Entries uint64
+	// Comment is the archive comment, stored after the EOCD record
+	Comment string
+	// BaseOffset is the number of bytes prepended to the zip data (e.g. a self-extracting stub)
+	// that aren't accounted for in the offsets declared by the archive
+	BaseOffset int64
+
+	// number of bytes from the start of the EOCD (or EOCD64) record to the end of the file
+	eocdDistanceFromEnd uint64
 }
 
 type OffsetFetcher interface {
 	Fetch(start, end *int64) (io.Reader, error)
 }
 
+// Progress describes how far along the parser is in reading and parsing the central directory
+type Progress struct {
+	EntriesParsed int
+	BytesRead     int64
+	BytesTotal    int64
+}
+
+type ProgressFn func(p Progress)
+
+type ParserOpt func(p *CentralDirectoryParser)
+
+// WithProgress registers a callback that is periodically called while the central directory is read and parsed
+func WithProgress(fn ProgressFn) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.progress = fn
+	}
+}
+
+// WithContext allows cancelling a long-running parse of the central directory
+func WithContext(ctx context.Context) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.ctx = ctx
+	}
+}
+
+// WithLogger sets the logger used to report on reading the central directory. Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		if logger != nil {
+			p.logger = logger
+		}
+	}
+}
+
+// WithCDWindowSize reads the central directory with ranged requests of up to size bytes each.
+// Records are parsed as they are downloaded either way, so this bounds the size of each request, not memory use.
+func WithCDWindowSize(size int64) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		if size > 0 {
+			p.cdWindowSize = size
+		}
+	}
+}
+
+// WithVerifyReads checks the size and CRC32 of entries as they are read, see VerifyingReader
+func WithVerifyReads(verify bool) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.verifyReads = verify
+	}
+}
+
+// WithEntryLimit refuses to read entries whose uncompressed size is larger than limitBytes
+func WithEntryLimit(limitBytes uint64) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.entryLimit = limitBytes
+	}
+}
+
+// WithScanForStart scans the start of the file for the zip data when the archive can't be parsed otherwise,
+// for archives with arbitrary bytes prepended to them. Scanning reads up to ScanLimit bytes, so it is off by default.
+func WithScanForStart(scan bool) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.scanForStart = scan
+	}
+}
+
+// WithChecksumAlgorithm selects the checksum verification uses (CRC32 by default), see ChecksumAlgorithm.
+// Zip archives only store the CRC32 of entries: with other algorithms, entries are only checked for size,
+// and full verification compares the whole archive to the checksum stored by the backend, if it stores one.
+func WithChecksumAlgorithm(algorithm ChecksumAlgorithm) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.checksum = algorithm
+	}
+}
+
+// WithTolerant recovers the sizes of entries whose central directory record stores the zip64 placeholder
+// (0xffffffff) without the zip64 extra field holding the actual size, as some broken writers do, from their local
+// file header or the data descriptor following their data. This costs a request per such entry.
+// Otherwise, such entries fail parsing the central directory with ErrMissingZip64Extra.
+func WithTolerant(tolerant bool) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.tolerant = tolerant
+	}
+}
+
+// WithAllowedMethods refuses to read entries compressed with a method not in methods
+func WithAllowedMethods(methods []uint16) ParserOpt {
+	return func(p *CentralDirectoryParser) {
+		p.allowedMethods = methods
+	}
+}
+
 type CentralDirectoryParser struct {
-	reader OffsetFetcher
+	reader         OffsetFetcher
+	ctx            context.Context
+	logger         *slog.Logger
+	progress       ProgressFn
+	entryLimit     uint64
+	allowedMethods []uint16
+	verifyReads    bool
+	tolerant       bool
+	checksum       ChecksumAlgorithm
+	cdWindowSize   int64
+	hashCache      HashCache
+	// checksumWarning makes sure warnUnstoredChecksum warns once
+	checksumWarning sync.Once
+	// location is the central directory location found by the last call to GetCentralDirectory
+	location *CDLocation
+	// stubSize is the number of bytes before the zip data found by the last call to GetCentralDirectory, see Stub
+	stubSize int64
+	// scanForStart enables scanForZipStart, scanned is set if the last call to GetCentralDirectory used it
+	scanForStart bool
+	scanned      bool
+	// concatenated is the collision policy of WithConcatenated, empty unless it's used
+	concatenated CollisionPolicy
+}
+
+func NewCentralDirectoryParser(reader OffsetFetcher, opts ...ParserOpt) *CentralDirectoryParser {
+	p := &CentralDirectoryParser{
+		reader:       reader,
+		ctx:          context.Background(),
+		logger:       slog.Default(),
+		checksum:     ChecksumCRC32,
+		cdWindowSize: DefaultCDWindowSize,
+		hashCache:    NewMemoryHashCache(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *CentralDirectoryParser) reportProgress(entries int, bytesRead, bytesTotal int64) {
+	if p.progress == nil {
+		return
+	}
+	p.progress(Progress{
+		EntriesParsed: entries,
+		BytesRead:     bytesRead,
+		BytesTotal:    bytesTotal,
+	})
+}
+
+// progressReader reports the amount of bytes read from the underlying reader as it is consumed
+type progressReader struct {
+	r        io.Reader
+	n        int64
+	reported int64
+	fn       func(n int64)
 }
 
-func NewCentralDirectoryParser(reader OffsetFetcher) *CentralDirectoryParser {
-	return &CentralDirectoryParser{
-		reader: reader,
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	if r.n-r.reported >= progressBytesInterval || (err == io.EOF && r.n > r.reported) {
+		r.reported = r.n
+		r.fn(r.n)
 	}
+	return n, err
 }
 
 func (p *CentralDirectoryParser) getEOCDBuffer() ([]byte, error) {
@@ -148,6 +363,9 @@ func (p *CentralDirectoryParser) getCDLocation() (*CDLocation, error) {
 	if err != nil {
 		return nil, ErrInvalidZip
 	}
+	// the comment is all that follows the EOCD record, so it's in the buffer already
+	commentStart := eocdStartOffset + binary.Size(eocd)
+	comment := string(buf[commentStart:min(commentStart+int(eocd.CommentLength), len(buf))])
 	// check if zip64
 	if eocd.CurrentDiskNumber == 0xffff ||
 		eocd.CDDiskNumber == 0xffff ||
@@ -155,13 +373,21 @@ func (p *CentralDirectoryParser) getCDLocation() (*CDLocation, error) {
 		eocd.TotalCDRs == 0xffff ||
 		eocd.CDByteOffset == 0xffffffff ||
 		eocd.CDSizeBytes == 0xffffffff {
-		return p.getCD64Location(buf)
+		loc, err := p.getCD64Location(buf)
+		if err != nil {
+			return nil, err
+		}
+		loc.Comment = comment
+		return loc, nil
 	}
 
 	return &CDLocation{
-		SizeBytes: uint64(eocd.CDSizeBytes),
-		Offset:    uint64(eocd.CDByteOffset),
-		Zip64:     false,
+		SizeBytes:           uint64(eocd.CDSizeBytes),
+		Offset:              uint64(eocd.CDByteOffset),
+		Zip64:               false,
+		Entries:             uint64(eocd.TotalCDRs),
+		Comment:             comment,
+		eocdDistanceFromEnd: uint64(len(buf) - eocdStartOffset),
 	}, nil
 }
 
@@ -176,45 +402,83 @@ func (p *CentralDirectoryParser) getCD64Location(buf []byte) (*CDLocation, error
 	if err != nil {
 		return nil, ErrInvalidZip
 	}
+	if err := checkEncryptedCD(buf[eocdStartOffset:], eocd); err != nil {
+		return nil, err
+	}
 
 	return &CDLocation{
-		SizeBytes: eocd.CDSizeBytes,
-		Offset:    eocd.CDByteOffset,
-		Zip64:     true,
+		SizeBytes:           eocd.CDSizeBytes,
+		Offset:              eocd.CDByteOffset,
+		Zip64:               true,
+		Entries:             eocd.TotalCDRs,
+		eocdDistanceFromEnd: uint64(len(buf) - eocdStartOffset),
 	}, nil
 }
 
-func parseZip64ExtraFields(extraFields []byte) *zip64ExtraFields {
-	var ef zip64ExtraFields
-	zip64Offset := -1
-	var i int
-	for i < len(extraFields) {
-		header := binary.LittleEndian.Uint16(extraFields[i : i+2])
-		if header == Zip64HeaderId {
-			zip64Offset = i
-			break
+// parseZip64ExtraFields reads the needed values from the zip64 extra field, in order, or returns nil if there is none
+func parseZip64ExtraFields(extraFields []byte, needed zip64Values) *zip64ExtraFields {
+	data := findExtraField(extraFields, Zip64HeaderId)
+	if data == nil {
+		return nil
+	}
+	ef := &zip64ExtraFields{}
+	next := func(value zip64Values, size int) []byte {
+		if needed&value == 0 {
+			return nil
 		}
-		// otherwise, read next 2 bytes and skip to next header
-		incrementOffset := binary.LittleEndian.Uint16(extraFields[i+2 : i+4])
-		i += 4 + int(incrementOffset)
+		if len(data) < size {
+			ef.missing |= value
+			return nil
+		}
+		field := data[:size]
+		data = data[size:]
+		return field
 	}
-	if zip64Offset == -1 {
-		return nil
+	if field := next(zip64UncompressedSize, 8); field != nil {
+		ef.UncompressedSizeBytes = binary.LittleEndian.Uint64(field)
 	}
-	zip64ChunkSize := binary.LittleEndian.Uint16(extraFields[zip64Offset+2 : zip64Offset+4])
-	if zip64ChunkSize >= 8 {
-		ef.UncompressedSizeBytes = binary.LittleEndian.Uint64(extraFields[zip64Offset+4 : zip64Offset+12])
+	if field := next(zip64CompressedSize, 8); field != nil {
+		ef.CompressedSizeBytes = binary.LittleEndian.Uint64(field)
 	}
-	if zip64ChunkSize >= 16 {
-		ef.CompressedSizeBytes = binary.LittleEndian.Uint64(extraFields[zip64Offset+12 : zip64Offset+20])
+	if field := next(zip64LocalHeaderOffset, 8); field != nil {
+		ef.LocalFileHeaderOffset = binary.LittleEndian.Uint64(field)
 	}
-	if zip64ChunkSize >= 24 {
-		ef.LocalFileHeaderOffset = binary.LittleEndian.Uint64(extraFields[zip64Offset+20 : zip64Offset+28])
+	if field := next(zip64DiskNumber, 4); field != nil {
+		ef.FileStartDiskNumber = binary.LittleEndian.Uint32(field)
 	}
-	if zip64ChunkSize >= 32 {
-		ef.FileStartDiskNumber = binary.LittleEndian.Uint32(extraFields[zip64Offset+28 : zip64Offset+32])
+	return ef
+}
+
+// findExtraField returns the data of the first extra field with the given header id, or nil if none found
+func findExtraField(extraFields []byte, headerId uint16) []byte {
+	var i int
+	for i+4 <= len(extraFields) {
+		header := binary.LittleEndian.Uint16(extraFields[i : i+2])
+		size := int(binary.LittleEndian.Uint16(extraFields[i+2 : i+4]))
+		if i+4+size > len(extraFields) {
+			return nil // malformed
+		}
+		if header == headerId {
+			return extraFields[i+4 : i+4+size]
+		}
+		i += 4 + size
 	}
-	return &ef
+	return nil
+}
+
+// parseUnicodePath returns the UTF-8 name stored in an Info-ZIP Unicode Path extra field (0x7075).
+// The name is only used if the CRC32 stored along with it matches the file name in the header,
+// otherwise the header was changed by a tool unaware of the extra field, and the extra field is stale.
+func parseUnicodePath(extraFields []byte, headerFileName []byte) (string, bool) {
+	data := findExtraField(extraFields, UnicodePathHeaderId)
+	if len(data) < 5 || data[0] != 1 { // version 1 is the only one defined
+		return "", false
+	}
+	nameCRC := binary.LittleEndian.Uint32(data[1:5])
+	if nameCRC != crc32.ChecksumIEEE(headerFileName) {
+		return "", false
+	}
+	return string(data[5:]), true
 }
 
 func offset(n uint64) *int64 {
@@ -222,7 +486,14 @@ func offset(n uint64) *int64 {
 	return &a
 }
 
+// ReadCDR reads a central directory record from r
 func ReadCDR(r io.Reader) (*CDR, error) {
+	return readCDR(r, false)
+}
+
+// readCDR reads a central directory record from r. If tolerant, sizes stored as zip64 placeholders without a zip64
+// extra field are left in unknownSizes rather than failing, to be recovered from the local file header.
+func readCDR(r io.Reader, tolerant bool) (*CDR, error) {
 	cdr := &CDR{}
 	metadata := &cdrMetadata{}
 	err := binary.Read(r, binary.LittleEndian, metadata)
@@ -243,7 +514,7 @@ func ReadCDR(r io.Reader) (*CDR, error) {
 
 	fileNameBuffer := make([]byte, metadata.FileNameLength)
 	if metadata.FileNameLength > 0 {
-		_, err = r.Read(fileNameBuffer)
+		_, err = io.ReadFull(r, fileNameBuffer)
 		if err != nil {
 			return nil, err
 		}
@@ -251,7 +522,7 @@ func ReadCDR(r io.Reader) (*CDR, error) {
 
 	extraFieldBuffer := make([]byte, metadata.ExtraFieldLength)
 	if metadata.ExtraFieldLength > 0 {
-		_, err = r.Read(extraFieldBuffer)
+		_, err = io.ReadFull(r, extraFieldBuffer)
 		if err != nil {
 			return nil, err
 		}
@@ -259,46 +530,70 @@ func ReadCDR(r io.Reader) (*CDR, error) {
 
 	fileCommentBuffer := make([]byte, metadata.FileCommentLength)
 	if metadata.FileCommentLength > 0 {
-		_, err = r.Read(fileCommentBuffer)
+		_, err = io.ReadFull(r, fileCommentBuffer)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	cdr.FileName = string(fileNameBuffer)
+	if unicodeName, ok := parseUnicodePath(extraFieldBuffer, fileNameBuffer); ok {
+		cdr.FileName = unicodeName
+	}
+	if err := checkStrongEncryption(cdr.FileName, metadata.GeneralPurposeBitFlag, extraFieldBuffer); err != nil {
+		return nil, err
+	}
 	cdr.ExtraFields = extraFieldBuffer
 	cdr.FileComment = fileCommentBuffer
+	parseExtraTimestamps(cdr)
 
-	zip64Fields := parseZip64ExtraFields(cdr.ExtraFields)
-
+	// fields stored as the zip64 placeholder are in the zip64 extra field, which holds only those
+	var needed zip64Values
 	if metadata.UncompressedSizeBytesRaw == 0xffffffff {
-		// zip64
-		if zip64Fields == nil {
-			return nil, ErrInvalidZip
-		}
-		cdr.UncompressedSizeBytes = zip64Fields.UncompressedSizeBytes
-	} else {
-		cdr.UncompressedSizeBytes = uint64(metadata.UncompressedSizeBytesRaw)
+		needed |= zip64UncompressedSize
 	}
-
 	if metadata.CompressedSizeBytesRaw == 0xffffffff {
-		// zip64
-		if zip64Fields == nil {
-			return nil, ErrInvalidZip
-		}
-		cdr.CompressedSizeBytes = zip64Fields.CompressedSizeBytes
-	} else {
-		cdr.CompressedSizeBytes = uint64(metadata.CompressedSizeBytesRaw)
+		needed |= zip64CompressedSize
 	}
-
 	if metadata.LocalFileHeaderOffsetRaw == 0xffffffff {
-		//  zip64
-		if zip64Fields == nil {
-			return nil, ErrInvalidZip
+		needed |= zip64LocalHeaderOffset
+	}
+	if metadata.FileStartDiskNumberRaw == 0xffff {
+		needed |= zip64DiskNumber
+	}
+	zip64Fields := parseZip64ExtraFields(cdr.ExtraFields, needed)
+	if zip64Fields == nil {
+		zip64Fields = &zip64ExtraFields{missing: needed}
+	}
+	var missing []string
+	cdr.UncompressedSizeBytes = uint64(metadata.UncompressedSizeBytesRaw)
+	if needed&zip64UncompressedSize != 0 {
+		cdr.UncompressedSizeBytes = zip64Fields.UncompressedSizeBytes
+		if zip64Fields.missing&zip64UncompressedSize != 0 {
+			cdr.unknownSizes |= unknownUncompressedSize
+			missing = append(missing, "uncompressed size")
 		}
+	}
+	cdr.CompressedSizeBytes = uint64(metadata.CompressedSizeBytesRaw)
+	if needed&zip64CompressedSize != 0 {
+		cdr.CompressedSizeBytes = zip64Fields.CompressedSizeBytes
+		if zip64Fields.missing&zip64CompressedSize != 0 {
+			cdr.unknownSizes |= unknownCompressedSize
+			missing = append(missing, "compressed size")
+		}
+	}
+	cdr.LocalFileHeaderOffset = uint64(metadata.LocalFileHeaderOffsetRaw)
+	if needed&zip64LocalHeaderOffset != 0 {
 		cdr.LocalFileHeaderOffset = zip64Fields.LocalFileHeaderOffset
-	} else {
-		cdr.LocalFileHeaderOffset = uint64(metadata.LocalFileHeaderOffsetRaw)
+		if zip64Fields.missing&zip64LocalHeaderOffset != 0 {
+			// the local file header can't be found without it, so there's nothing to recover the sizes from
+			tolerant = false
+			missing = append(missing, "local file header offset")
+		}
+	}
+	if len(missing) > 0 && !tolerant {
+		return nil, fmt.Errorf("%w: %s: %s stored as 0xffffffff, with no zip64 extra field holding the actual value",
+			ErrMissingZip64Extra, cdr.FileName, strings.Join(missing, " and "))
 	}
 
 	if len(cdr.FileName) > 0 && cdr.FileName[len(cdr.FileName)-1] == '/' {
@@ -309,48 +604,265 @@ func ReadCDR(r io.Reader) (*CDR, error) {
 	return cdr, nil
 }
 
-func (p *CentralDirectoryParser) parseCDR(loc *CDLocation) ([]*CDR, error) {
-	reader, err := p.reader.Fetch(offset(loc.Offset), offset(loc.Offset+loc.SizeBytes))
-	if err != nil {
+// SizeFetcher is implemented by OffsetFetchers that know the total size of the underlying file
+type SizeFetcher interface {
+	Size() (int64, error)
+}
+
+// locateShiftedCD handles archives with data prepended to them (such as self-extracting archives), where all
+// declared offsets are shifted by a constant. The central directory immediately precedes the EOCD record, so its
+// real location can be computed from the end of the file and compared to the declared offset.
+func (p *CentralDirectoryParser) locateShiftedCD(loc *CDLocation) (*CDLocation, error) {
+	sizer, ok := p.reader.(SizeFetcher)
+	if !ok {
 		return nil, ErrInvalidZip
 	}
-	start := time.Now()
-	buf, err := io.ReadAll(reader)
-	slog.Debug("read Central Directory",
-		"size_bytes", len(buf), "took_ms", time.Since(start).Milliseconds())
+	size, err := sizer.Size()
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidZip
+	}
+	if uint64(size) < loc.eocdDistanceFromEnd+loc.SizeBytes {
+		return nil, ErrInvalidZip
+	}
+	actualOffset := uint64(size) - loc.eocdDistanceFromEnd - loc.SizeBytes
+	if actualOffset == loc.Offset {
+		return nil, ErrInvalidZip // not shifted, just broken
+	}
+	shifted := *loc
+	shifted.Offset = actualOffset
+	shifted.BaseOffset = int64(actualOffset) - int64(loc.Offset)
+	p.logger.DebugContext(p.ctx, "central directory offset is shifted",
+		"declared_offset", loc.Offset, "actual_offset", actualOffset, "base_offset", shifted.BaseOffset)
+	return &shifted, nil
+}
+
+// openCD returns a reader over the central directory at loc, read in windows of p.cdWindowSize bytes
+func (p *CentralDirectoryParser) openCD(loc *CDLocation) *bufio.Reader {
+	return bufio.NewReaderSize(&windowReader{
+		ctx:     p.ctx,
+		fetcher: p.reader,
+		pos:     int64(loc.Offset),
+		end:     int64(loc.Offset + loc.SizeBytes),
+		window:  p.cdWindowSize,
+	}, cdReadBufferSize)
+}
+
+// startsWithCDR returns whether r is positioned at a central directory record
+func startsWithCDR(r *bufio.Reader) (bool, error) {
+	return startsWithSignature(r, CDRSignature)
+}
+
+// startsWithSignature returns whether r is positioned at a record starting with signature
+func startsWithSignature(r *bufio.Reader, signature []byte) (bool, error) {
+	sig, err := r.Peek(len(signature))
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, nil
+	} else if err != nil {
+		return false, err
 	}
+	return bytes.Equal(sig, signature), nil
+}
 
+// parseCDR reads and parses the central directory as it is downloaded, so that (apart from the parsed records)
+// memory use doesn't grow with its size
+func (p *CentralDirectoryParser) parseCDR(loc *CDLocation) ([]*CDR, error) {
 	parsingStart := time.Now()
-	r := bytes.NewReader(buf)
+	cd := p.openCD(loc)
+	if loc.SizeBytes > 0 {
+		ok, err := startsWithCDR(cd)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if encrypted, err := startsWithSignature(cd, ArchiveExtraDataSignature); err != nil {
+				return nil, err
+			} else if encrypted {
+				return nil, fmt.Errorf("%w: the central directory is preceded by an archive extra data record, "+
+					"as it is encrypted", ErrStrongEncryptionUnsupported)
+			}
+			// declared offset doesn't point at the central directory, perhaps it's shifted
+			loc, err = p.locateShiftedCD(loc)
+			if err != nil {
+				return nil, err
+			}
+			cd = p.openCD(loc)
+			if ok, err = startsWithCDR(cd); err != nil {
+				return nil, err
+			} else if !ok {
+				return nil, ErrInvalidZip
+			}
+		}
+	}
+	return p.parseRecords(loc, cd, parsingStart)
+}
+
+// parseRecords parses the central directory at loc, read from cd, and validates the start of the zip data it implies
+func (p *CentralDirectoryParser) parseRecords(loc *CDLocation, cd *bufio.Reader, parsingStart time.Time) ([]*CDR, error) {
+	if err := p.ctx.Err(); err != nil {
+		return nil, err
+	}
 	records := make([]*CDR, 0)
-	var pos int64
-	for pos < int64(loc.SizeBytes) {
-		cdr, err := ReadCDR(r)
+	r := &progressReader{r: cd, fn: func(n int64) {
+		p.reportProgress(len(records), n, int64(loc.SizeBytes))
+	}}
+	for r.n < int64(loc.SizeBytes) {
+		cdr, err := readCDR(r, p.tolerant)
 		if err != nil {
 			return nil, err
 		}
+		cdr.LocalFileHeaderOffset = uint64(int64(cdr.LocalFileHeaderOffset) + loc.BaseOffset)
 		records = append(records, cdr)
-		pos, err = r.Seek(0, io.SeekCurrent)
-		if err != nil {
+		if len(records)%progressEntriesInterval == 0 {
+			// don't leave partial results around if we were cancelled mid-parse
+			if err := p.ctx.Err(); err != nil {
+				return nil, err
+			}
+			p.reportProgress(len(records), r.n, int64(loc.SizeBytes))
+		}
+	}
+	p.reportProgress(len(records), r.n, int64(loc.SizeBytes))
+	if err := p.checkEntryCount(loc, len(records)); err != nil {
+		return nil, err
+	}
+	for _, cdr := range records {
+		if cdr.unknownSizes != 0 {
+			if err := p.recoverSizes(cdr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	stubSize := archiveStart(records, loc)
+	// when scanning for the start of the zip data, even archives that seem to start at 0 are checked
+	if (stubSize > 0 || p.scanForStart) && len(records) > 0 {
+		if err := p.checkArchiveStart(stubSize); err != nil {
 			return nil, err
 		}
 	}
-	slog.Debug("parse Central Directory",
-		"records", len(records), "took_ms", time.Since(parsingStart).Milliseconds())
+	if stubSize > 0 {
+		p.logger.DebugContext(p.ctx, "zip data is preceded by a self-extracting stub",
+			"stub_size", stubSize, "base_offset", loc.BaseOffset)
+	}
+	p.location, p.stubSize = loc, stubSize
+	p.logger.DebugContext(p.ctx, "parse Central Directory",
+		"records", len(records), "size_bytes", r.n, "took_ms", time.Since(parsingStart).Milliseconds())
 	return records, nil
 }
 
+// checkEntryCount compares the number of records found in the central directory to the number the EOCD declares.
+// Running out of central directory before reaching the declared count is an error, since the tree would be partial;
+// finding more records than declared is only logged.
+func (p *CentralDirectoryParser) checkEntryCount(loc *CDLocation, found int) error {
+	declared, counted := loc.Entries, uint64(found)
+	if !loc.Zip64 && counted > 0xffff {
+		// some writers wrap the 16 bit count instead of switching to zip64, so only the low bits can be compared
+		if counted&0xffff != declared {
+			p.logger.WarnContext(p.ctx, "central directory record count doesn't match the end of central directory",
+				"declared_entries", declared, "found_entries", found)
+		}
+		return nil
+	}
+	switch {
+	case counted < declared:
+		return fmt.Errorf("%w: end of central directory declares %d entries, central directory ends after %d",
+			ErrTruncatedCentralDirectory, declared, found)
+	case counted > declared:
+		p.logger.WarnContext(p.ctx, "central directory has more records than the end of central directory declares",
+			"declared_entries", declared, "found_entries", found)
+	}
+	return nil
+}
+
+// windowReader reads the range [pos, end) of an OffsetFetcher with successive ranged requests of up to window bytes.
+// Some backends (and proxies) cap the size of ranged responses: a response shorter than requested is followed by
+// a request for the rest of its window, it's only an error if a response returns nothing at all.
+type windowReader struct {
+	ctx       context.Context
+	fetcher   OffsetFetcher
+	pos, end  int64
+	window    int64
+	current   io.Reader
+	windowEnd int64
+	// currentRead is the number of bytes read from current
+	currentRead int64
+}
+
+func (w *windowReader) Read(b []byte) (int, error) {
+	for {
+		if w.current == nil {
+			if w.pos >= w.end {
+				return 0, io.EOF
+			}
+			if err := w.ctx.Err(); err != nil {
+				return 0, err
+			}
+			start := w.pos
+			w.windowEnd = min(w.pos+w.window, w.end)
+			last := w.windowEnd - 1
+			r, err := w.fetcher.Fetch(&start, &last)
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return 0, err
+			} else if err != nil {
+				return 0, ErrInvalidZip
+			}
+			w.current, w.currentRead = r, 0
+		}
+		n, err := w.current.Read(b)
+		w.pos += int64(n)
+		w.currentRead += int64(n)
+		if errors.Is(err, io.EOF) {
+			w.current = nil
+			if w.pos < w.windowEnd && w.currentRead == 0 {
+				return n, io.ErrUnexpectedEOF
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// ArchiveComment returns the comment of the archive, if any.
+// It doesn't make another request if the central directory was already read.
+func (p *CentralDirectoryParser) ArchiveComment() (string, error) {
+	if p.location != nil {
+		return p.location.Comment, nil
+	}
+	loc, err := p.getCDLocation()
+	if err != nil {
+		return "", err
+	}
+	return loc.Comment, nil
+}
+
 func (p *CentralDirectoryParser) GetCentralDirectory() ([]*CDR, error) {
+	records, err := p.readCentralDirectory()
+	if err != nil || p.concatenated == "" || p.stubSize == 0 {
+		return records, err
+	}
+	return p.readConcatenated(records, p.stubSize)
+}
+
+// readCentralDirectory reads the central directory the EOCD record at the end of the file points to
+func (p *CentralDirectoryParser) readCentralDirectory() ([]*CDR, error) {
 	loc, err := p.getCDLocation()
 	if err != nil {
 		return nil, err
 	}
-	return p.parseCDR(loc)
+	p.scanned = false
+	records, err := p.parseCDR(loc)
+	if err == nil || !p.scanForStart || p.ctx.Err() != nil {
+		return records, err
+	}
+	p.logger.DebugContext(p.ctx, "could not parse archive, scanning for the start of the zip data", "err", err)
+	return p.scanForZipStart(loc)
 }
 
 func ReaderForRecord(f *CDR, fetcher OffsetFetcher) (io.Reader, error) {
+	if f.UncompressedSizeBytes == 0 {
+		// nothing to read: don't make a request just to skip over the local header
+		return bytes.NewReader(nil), nil
+	}
 	// found record!
 	off := f.LocalFileHeaderOffset
 	approxHeaderSize := uint64(localHeaderSizeHeuristic(f.FileName))
@@ -377,9 +889,10 @@ func ReaderForRecord(f *CDR, fetcher OffsetFetcher) (io.Reader, error) {
 	dataReader = io.LimitReader(dataReader, int64(f.CompressedSizeBytes))
 
 	// now we should have a stream of the body, let's see if we have need to inflate it:
-	if f.CompressionMethod == zip.Deflate {
-		return flate.NewReader(dataReader), nil
+	if decompress := decompressor(f.CompressionMethod); decompress != nil {
+		return decompress(dataReader)
 	}
+	// entries compressed with unknown methods are returned as they are stored, if they are allowed at all
 	return dataReader, nil
 }
 
@@ -394,12 +907,50 @@ func (p *CentralDirectoryParser) Read(fileName string) (io.Reader, error) {
 	}
 	for _, f := range directory {
 		if f.FileName == fileName {
-			return p.readerForRecord(f)
+			return p.checkedReaderForRecord(f)
 		}
 	}
 	return nil, ErrFileNotFound
 }
 
+// ReadIndex returns a reader for the n-th (0-based) entry, in central directory order.
+// This allows reading entries with duplicate or otherwise awkward names.
+func (p *CentralDirectoryParser) ReadIndex(n int) (io.Reader, error) {
+	directory, err := p.GetCentralDirectory()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n >= len(directory) {
+		return nil, fmt.Errorf("%w: no entry at index %d, archive has %d entries", ErrFileNotFound, n, len(directory))
+	}
+	return p.checkedReaderForRecord(directory[n])
+}
+
+func (p *CentralDirectoryParser) checkedReaderForRecord(f *CDR) (io.Reader, error) {
+	if err := CheckEntryLimit(f, p.entryLimit); err != nil {
+		return nil, err
+	}
+	if err := CheckCompressionMethod(f, p.allowedMethods); err != nil {
+		return nil, err
+	}
+	r, err := p.readerForRecord(f)
+	if err != nil || !p.verifyReads {
+		return r, err
+	}
+	p.warnUnstoredChecksum()
+	return VerifyingReaderFor(r, f, p.checksum), nil
+}
+
+// CheckEntryLimit returns ErrEntryTooLarge if the declared uncompressed size of f exceeds limitBytes.
+// A limit of 0 means no limit.
+func CheckEntryLimit(f *CDR, limitBytes uint64) error {
+	if limitBytes > 0 && f.UncompressedSizeBytes > limitBytes {
+		return fmt.Errorf("%w: %s is %d bytes, limit is %d bytes",
+			ErrEntryTooLarge, f.FileName, f.UncompressedSizeBytes, limitBytes)
+	}
+	return nil
+}
+
 func localHeaderSizeHeuristic(filename string) int64 {
 	nameLength := len([]byte(filename))
 	headerSize := int64(30 + nameLength) // we are at the extra field, not knowing its size
@@ -1,38 +1,22 @@
 package zipfile_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"hash/crc32"
 	"io"
+	"log/slog"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/ozkatz/cloudzip/pkg/remote"
 	"github.com/ozkatz/cloudzip/pkg/zipfile"
 )
 
-func parser(uri string) (*zipfile.CentralDirectoryParser, error) {
-	fetcher, err := remote.Object(uri)
-	if err != nil {
-		return nil, err
-	}
-	return zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), fetcher)), nil
-}
-
-type byteReadSeekCloser struct {
-	*bytes.Reader
-}
-
-func (b *byteReadSeekCloser) Close() error {
-	return nil
-}
-
-func memParser(data []byte) *zipfile.CentralDirectoryParser {
-	fetcher := remote.NewLocalFetcherFromData(&byteReadSeekCloser{Reader: bytes.NewReader(data)})
-	return zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), fetcher))
-}
-
 func BenchmarkCentralDirectoryParser_Read(b *testing.B) {
 	zip, err := os.Open("testdata/big_directory.zip")
 	if err != nil {
@@ -43,6 +27,7 @@ func BenchmarkCentralDirectoryParser_Read(b *testing.B) {
 		b.Fatalf("could not read big directory: %v\n", err)
 	}
 	parser := memParser(data)
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		b.StartTimer()
@@ -67,6 +52,167 @@ func TestCentralDirectoryParser_GetCentralDirectory(t *testing.T) {
 	}
 }
 
+func TestCentralDirectoryParser_CDWindowSize(t *testing.T) {
+	requests := func(opts ...zipfile.ParserOpt) int64 {
+		fetcher, err := remote.Object("file://testdata/big_directory.zip")
+		if err != nil {
+			t.Fatalf("unexpected error opening zip file: %v", err)
+		}
+		stats := &remote.Stats{}
+		p := zipfile.NewCentralDirectoryParser(
+			zipfile.NewStorageAdapter(context.Background(), remote.CountingFetcher(fetcher, stats)), opts...)
+		files, err := p.GetCentralDirectory()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(files) != 150000 {
+			t.Errorf("expected 150,000 files, got %d", len(files))
+		}
+		return stats.Requests()
+	}
+	whole := requests()
+	windowed := requests(zipfile.WithCDWindowSize(64 * 1024))
+	if windowed <= whole+10 {
+		t.Errorf("expected the central directory to be read in many windows, got %d requests (%d when read whole)",
+			windowed, whole)
+	}
+	// records split across windows are still parsed
+	requests(zipfile.WithCDWindowSize(100))
+}
+
+// cappingFetcher returns at most limit bytes of each ranged response, like backends that cap range sizes
+type cappingFetcher struct {
+	zipfile.OffsetFetcher
+	limit    int64
+	requests int
+}
+
+func (f *cappingFetcher) Fetch(start, end *int64) (io.Reader, error) {
+	f.requests++
+	r, err := f.OffsetFetcher.Fetch(start, end)
+	if err != nil || start == nil {
+		return r, err
+	}
+	return io.LimitReader(r, f.limit), nil
+}
+
+func TestCentralDirectoryParser_CappedRanges(t *testing.T) {
+	fetcher, err := remote.Object("file://testdata/big_directory.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	capping := &cappingFetcher{OffsetFetcher: zipfile.NewStorageAdapter(context.Background(), fetcher), limit: 1024 * 1024}
+	files, err := zipfile.NewCentralDirectoryParser(capping).GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 150000 {
+		t.Errorf("expected 150,000 files, got %d", len(files))
+	}
+	if capping.requests < 3 {
+		t.Errorf("expected the rest of the central directory to be requested, got %d requests", capping.requests)
+	}
+}
+
+func TestCentralDirectoryParser_Progress(t *testing.T) {
+	fetcher, err := remote.Object("file://testdata/big_directory.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	var last zipfile.Progress
+	p := zipfile.NewCentralDirectoryParser(
+		zipfile.NewStorageAdapter(context.Background(), fetcher),
+		zipfile.WithProgress(func(p zipfile.Progress) {
+			last = p
+		}))
+	files, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last.EntriesParsed != len(files) {
+		t.Errorf("expected last progress to report %d entries, got %d", len(files), last.EntriesParsed)
+	}
+	if last.BytesRead < last.BytesTotal || last.BytesTotal == 0 {
+		t.Errorf("expected all bytes to be read, got %d/%d", last.BytesRead, last.BytesTotal)
+	}
+}
+
+func TestCentralDirectoryParser_Cancelled(t *testing.T) {
+	fetcher, err := remote.Object("file://testdata/big_directory.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := zipfile.NewCentralDirectoryParser(
+		zipfile.NewStorageAdapter(context.Background(), fetcher),
+		zipfile.WithContext(ctx))
+	files, err := p.GetCentralDirectory()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if files != nil {
+		t.Errorf("expected no partial results, got %d files", len(files))
+	}
+
+	// archives with fewer records than are parsed between checks are cancelled too
+	p = memParser(verifyTestZip(t), zipfile.WithContext(ctx))
+	if files, err := p.GetCentralDirectory(); !errors.Is(err, context.Canceled) || files != nil {
+		t.Errorf("expected context.Canceled without results, got %d files (err: %v)", len(files), err)
+	}
+}
+
+// cancellingFetcher cancels its context once it served a number of requests, failing the following ones
+type cancellingFetcher struct {
+	remote.Fetcher
+	ctx      context.Context
+	cancel   context.CancelFunc
+	requests int
+}
+
+func (f *cancellingFetcher) Fetch(ctx context.Context, start, end *int64) (io.ReadCloser, error) {
+	if f.requests--; f.requests == 0 {
+		f.cancel()
+	}
+	if err := f.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.Fetcher.Fetch(ctx, start, end)
+}
+
+func TestCentralDirectoryParser_CancelledWhileReading(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the first request prefetches the end of the archive, the central directory is read in windows after it
+	fetcher := &cancellingFetcher{Fetcher: memFetcher(verifyTestZip(t)), ctx: ctx, cancel: cancel, requests: 2}
+	p := zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), fetcher),
+		zipfile.WithContext(ctx), zipfile.WithCDWindowSize(50))
+	files, err := p.GetCentralDirectory()
+	if !errors.Is(err, context.Canceled) || errors.Is(err, zipfile.ErrInvalidZip) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if files != nil {
+		t.Errorf("expected no partial results, got %d files", len(files))
+	}
+}
+
+func TestCentralDirectoryParser_Logger(t *testing.T) {
+	fetcher, err := remote.Object("file://testdata/regular.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p := zipfile.NewCentralDirectoryParser(
+		zipfile.NewStorageAdapter(context.Background(), fetcher), zipfile.WithLogger(logger))
+	if _, err := p.GetCentralDirectory(); err != nil {
+		t.Fatalf("unexpected error parsing central directory: %v", err)
+	}
+	if !bytes.Contains(logs.Bytes(), []byte("parse Central Directory")) {
+		t.Errorf("expected parser logs to be written to the given logger, got: %q", logs.String())
+	}
+}
+
 func TestCentralDirectoryParser_GetCentralDirectory64(t *testing.T) {
 	p, err := parser("file://testdata/huge.zip")
 	if err != nil {
@@ -132,12 +278,145 @@ func TestCentralDirectoryParser_GetCentralDirectory64FromStdlib(t *testing.T) {
 	}
 }
 
+func TestCentralDirectoryParser_Zip64ExtraOrder(t *testing.T) {
+	// the zip64 extra field only holds the values stored as 0xffffffff, in order
+	cases := map[string]map[string]string{
+		// b.txt stores its local file header offset as 0xffffffff, its extra field holds only the offset
+		"file://testdata/zip64_offset_only.zip": {
+			"a.txt": "no zip64 extra field\n",
+			"b.txt": "the offset is in the zip64 extra field\n",
+		},
+		// a.txt stores both sizes and its offset as 0xffffffff, b.txt only its compressed size
+		"file://testdata/zip64_compressed_only.zip": {
+			"a.txt": "both sizes and the offset\n",
+			"b.txt": "the compressed size is in the zip64 extra field\n",
+		},
+	}
+	for uri, expected := range cases {
+		t.Run(uri, func(t *testing.T) {
+			p, err := parser(uri)
+			if err != nil {
+				t.Fatalf("unexpected error opening zip file: %v", err)
+			}
+			records, err := p.GetCentralDirectory()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, f := range records {
+				if f.CompressedSizeBytes != uint64(len(expected[f.FileName])) || f.UncompressedSizeBytes != f.CompressedSizeBytes {
+					t.Errorf("%s: expected sizes of %d, got %d and %d", f.FileName, len(expected[f.FileName]),
+						f.CompressedSizeBytes, f.UncompressedSizeBytes)
+				}
+				r, err := p.Read(f.FileName)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", f.FileName, err)
+				}
+				if data, err := io.ReadAll(r); err != nil || string(data) != expected[f.FileName] {
+					t.Errorf("%s: unexpected content %q (err: %v)", f.FileName, data, err)
+				}
+			}
+		})
+	}
+
+	// a placeholder is only missing once the extra field runs out
+	data, err := os.ReadFile("testdata/zip64_offset_only.zip")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cd := bytes.LastIndex(data, []byte("PK\x01\x02"))
+	binary.LittleEndian.PutUint32(data[cd+20:], 0xffffffff) // b.txt's compressed size
+	_, err = zipfile.ReadCDR(bytes.NewReader(data[cd:]))
+	if !errors.Is(err, zipfile.ErrMissingZip64Extra) || !strings.Contains(err.Error(), "b.txt: local file header offset stored") {
+		t.Errorf("expected the local file header offset to be missing, got: %v", err)
+	}
+}
+
+func TestCentralDirectoryParser_UnicodePath(t *testing.T) {
+	p, err := parser("file://testdata/unicode_path.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	files, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error listing zip file: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	if files[0].FileName != "café.txt" {
+		t.Errorf("expected unicode path to be used, got %s", files[0].FileName)
+	}
+	if files[1].FileName != "stale.txt" {
+		t.Errorf("expected stale unicode path to be ignored, got %s", files[1].FileName)
+	}
+	r, err := p.Read("café.txt")
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %v", err)
+	}
+	if string(data) != "unicode path!\n" {
+		t.Errorf("got wrong string: %s\n", string(data))
+	}
+}
+
+func TestCentralDirectoryParser_EntryLimit(t *testing.T) {
+	fetcher, err := remote.Object("file://testdata/regular.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	p := zipfile.NewCentralDirectoryParser(
+		zipfile.NewStorageAdapter(context.Background(), fetcher),
+		zipfile.WithEntryLimit(10))
+	_, err = p.Read("foo/bar.txt")
+	if !errors.Is(err, zipfile.ErrEntryTooLarge) {
+		t.Errorf("expected ErrEntryTooLarge, got %v", err)
+	}
+}
+
+func TestCentralDirectoryParser_ReadIndex(t *testing.T) {
+	p, err := parser("file://testdata/regular.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	records, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error reading central directory: %v", err)
+	}
+	for i, f := range records {
+		if f.Mode.IsDir() {
+			continue
+		}
+		r, err := p.ReadIndex(i)
+		if err != nil {
+			t.Fatalf("unexpected error reading entry %d: %v", i, err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("unexpected error reading entry %d: %v", i, err)
+		}
+		if crc32.ChecksumIEEE(data) != f.CRC32Uncompressed {
+			t.Errorf("entry %d (%s): CRC mismatch", i, f.FileName)
+		}
+	}
+	for _, n := range []int{-1, len(records)} {
+		if _, err := p.ReadIndex(n); !errors.Is(err, zipfile.ErrFileNotFound) {
+			t.Errorf("index %d: expected ErrFileNotFound, got %v", n, err)
+		}
+	}
+}
+
 func TestNewRemoteZipReader(t *testing.T) {
 	zipFiles := []string{
 		"file://testdata/regular.zip",
 		"file://testdata/huge.zip",
 		"file://testdata/uncompressed.zip",
 		"file://testdata/zip64.zip",
+		"file://testdata/unicode_path.zip",
+		"file://testdata/sfx_stub.zip",
+		"file://testdata/timestamps.zip",
 	}
 
 	for _, zipFile := range zipFiles {
@@ -182,3 +461,60 @@ func testZip(t *testing.T, path string) {
 		}
 	})
 }
+
+func TestCentralDirectoryParser_Comments(t *testing.T) {
+	data := newZip(t, func(w *zip.Writer) {
+		addEntry(t, w, &zip.FileHeader{Name: "a.txt", Method: zip.Store, Comment: "built by ci #42"}, []byte("a"))
+		addPadding(t, w)
+		if err := w.SetComment("license: Apache-2.0"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	p := memParser(data)
+	comment, err := p.ArchiveComment()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if comment != "license: Apache-2.0" {
+		t.Errorf("unexpected archive comment: %q", comment)
+	}
+	files, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(files[0].FileComment) != "built by ci #42" {
+		t.Errorf("unexpected entry comment: %q", files[0].FileComment)
+	}
+}
+
+func TestCentralDirectoryParser_EntryCountMismatch(t *testing.T) {
+	// declares 5 entries, holds 3
+	p, err := parser("file://testdata/truncated_cd.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	_, err = p.GetCentralDirectory()
+	if !errors.Is(err, zipfile.ErrTruncatedCentralDirectory) || !errors.Is(err, zipfile.ErrCorruptArchive) {
+		t.Fatalf("expected ErrTruncatedCentralDirectory, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "declares 5 entries, central directory ends after 3") {
+		t.Errorf("expected the error to name the declared and found counts, got: %v", err)
+	}
+
+	// declares 2 entries, holds 3
+	fetcher, err := remote.Object("file://testdata/extra_records.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	logs := &bytes.Buffer{}
+	p = zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), fetcher),
+		zipfile.WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+	records, err := p.GetCentralDirectory()
+	if err != nil || len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d (err: %v)", len(records), err)
+	}
+	if !strings.Contains(logs.String(), "declared_entries=2 found_entries=3") {
+		t.Errorf("expected a warning naming the declared and found counts, got: %q", logs.String())
+	}
+}
@@ -0,0 +1,58 @@
+package zipfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+)
+
+// probeSize is the number of bytes read by ProbeRange, enough for a record signature
+const probeSize = 4
+
+var (
+	// ErrRangeIgnored is returned when the backend answers a range request with more than the range
+	ErrRangeIgnored = remote.ErrRangeIgnored
+
+	// archiveStartSignatures are the records a zip archive may start with: a local file header,
+	// the end of central directory record of an empty archive, or a spanned archive marker
+	archiveStartSignatures = [][]byte{
+		LocalHeaderSignature,
+		EOCDSignature,
+		spannedArchiveSignature,
+	}
+	spannedArchiveSignature = []byte{0x50, 0x4b, 0x07, 0x08}
+)
+
+// ProbeRange reads the first few bytes of the archive, checking that the backend honors range requests
+// and that the archive starts with a zip signature. It's a cheap check to run before relying on the archive.
+// Self-extracting archives pass it if their stub is a recognized kind of program (see StubKind);
+// archives with other data prepended to them don't.
+func (p *CentralDirectoryParser) ProbeRange() error {
+	start, end := int64(0), int64(probeSize-1)
+	r, err := p.reader.Fetch(&start, &end)
+	if err != nil {
+		return err
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, probeSize+1))
+	if err != nil {
+		return err
+	}
+	if len(buf) > probeSize {
+		return fmt.Errorf("%w: asked for bytes 0-%d, got more", ErrRangeIgnored, end)
+	}
+	if len(buf) < probeSize {
+		return fmt.Errorf("%w: archive is only %d bytes", ErrInvalidZip, len(buf))
+	}
+	for _, signature := range archiveStartSignatures {
+		if bytes.Equal(buf, signature) {
+			return nil
+		}
+	}
+	if stubKind(buf) != StubUnknown {
+		// the zip data may follow the stub, which only reading the central directory can tell
+		return nil
+	}
+	return fmt.Errorf("%w: archive starts with %x, not a zip signature", ErrInvalidZip, buf)
+}
@@ -0,0 +1,38 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// rangeIgnoringFetcher returns the whole archive, regardless of the requested range
+type rangeIgnoringFetcher struct {
+	data []byte
+}
+
+func (f *rangeIgnoringFetcher) Fetch(_, _ *int64) (io.Reader, error) {
+	return bytes.NewReader(f.data), nil
+}
+
+func TestCentralDirectoryParser_ProbeRange(t *testing.T) {
+	data := verifyTestZip(t)
+	if err := memParser(data).ProbeRange(); err != nil {
+		t.Errorf("unexpected error probing valid archive: %v", err)
+	}
+	if err := zipfile.NewCentralDirectoryParser(&rangeIgnoringFetcher{data: data}).ProbeRange(); !errors.Is(err, zipfile.ErrRangeIgnored) {
+		t.Errorf("expected ErrRangeIgnored, got: %v", err)
+	}
+	notZip := append([]byte("%PDF"), data...)
+	if err := memParser(notZip).ProbeRange(); !errors.Is(err, zipfile.ErrInvalidZip) {
+		t.Errorf("expected ErrInvalidZip, got: %v", err)
+	}
+	// self-extracting archives start with a program, which the zip data may follow
+	sfx := append([]byte("MZ\x90\x00"), data...)
+	if err := memParser(sfx).ProbeRange(); err != nil {
+		t.Errorf("unexpected error probing self-extracting archive: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package zipfile
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// OpenReaderAt returns an io.ReaderAt over the uncompressed content of the entry fileName, along with its size,
+// for consumers that read parts of an entry at arbitrary offsets (e.g. a page of a PDF) rather than all of it.
+//
+// Stored entries are read with a ranged request per ReadAt, concurrently if needed.
+// Compressed entries can't be read from the middle: their stream is decompressed from the start up to the offset read,
+// and kept open so that a read at a later offset continues from where the previous one ended. A read at an earlier
+// offset decompresses the entry from its start again, so each backwards read costs up to the whole entry: fetching
+// its compressed bytes and decompressing them. Reads of compressed entries are serialized.
+//
+// Reads aren't verified against the entry's CRC32, even with WithVerifyReads, since they rarely cover the whole entry.
+func (p *CentralDirectoryParser) OpenReaderAt(fileName string) (io.ReaderAt, int64, error) {
+	directory, err := p.GetCentralDirectory()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, f := range directory {
+		if f.FileName != fileName {
+			continue
+		}
+		if err := CheckEntryLimit(f, p.entryLimit); err != nil {
+			return nil, 0, err
+		}
+		if err := CheckCompressionMethod(f, p.allowedMethods); err != nil {
+			return nil, 0, err
+		}
+		size := int64(f.UncompressedSizeBytes)
+		return &entryReaderAt{reader: p.reader, f: f, size: size}, size, nil
+	}
+	return nil, 0, ErrFileNotFound
+}
+
+// ReaderAtForRecord returns an io.ReaderAt over the uncompressed content of f, read from fetcher as described
+// in OpenReaderAt. Closing it releases the decompressed stream a compressed entry is read from.
+func ReaderAtForRecord(f *CDR, fetcher OffsetFetcher) interface {
+	io.ReaderAt
+	io.Closer
+} {
+	return &entryReaderAt{reader: fetcher, f: f, size: int64(f.UncompressedSizeBytes)}
+}
+
+type entryReaderAt struct {
+	reader OffsetFetcher
+	f      *CDR
+	size   int64
+
+	// dataOffset is where the data of a stored entry starts, found by reading its local header on first use
+	dataOnce   sync.Once
+	dataOffset int64
+	dataErr    error
+
+	// stream is the decompressed content of a compressed entry, of which position bytes were read
+	mu       sync.Mutex
+	stream   io.Reader
+	position int64
+}
+
+func (r *entryReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("%s: negative offset %d", r.f.FileName, off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := b[:min(int64(len(b)), r.size-off)]
+	var n int
+	var err error
+	if r.f.CompressionMethod == zip.Store {
+		n, err = r.readStored(want, off)
+	} else {
+		n, err = r.readCompressed(want, off)
+	}
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *entryReaderAt) readStored(b []byte, off int64) (int, error) {
+	r.dataOnce.Do(func() {
+		r.dataOffset, r.dataErr = entryDataOffset(r.f, r.reader)
+	})
+	if r.dataErr != nil {
+		return 0, r.dataErr
+	}
+	start, end := r.dataOffset+off, r.dataOffset+off+int64(len(b))-1
+	data, err := r.reader.Fetch(&start, &end)
+	if err != nil {
+		return 0, err
+	}
+	return io.ReadFull(data, b)
+}
+
+func (r *entryReaderAt) readCompressed(b []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stream == nil || off < r.position {
+		r.closeStream()
+		stream, err := ReaderForRecord(r.f, r.reader)
+		if err != nil {
+			return 0, err
+		}
+		r.stream, r.position = stream, 0
+	}
+	if off > r.position {
+		skipped, err := io.CopyN(io.Discard, r.stream, off-r.position)
+		r.position += skipped
+		if err != nil {
+			r.closeStream()
+			return 0, fmt.Errorf("could not decompress %s up to offset %d: %w", r.f.FileName, off, err)
+		}
+	}
+	n, err := io.ReadFull(r.stream, b)
+	r.position += int64(n)
+	if err != nil {
+		r.closeStream()
+	}
+	return n, err
+}
+
+func (r *entryReaderAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeStream()
+	return nil
+}
+
+func (r *entryReaderAt) closeStream() {
+	if c, ok := r.stream.(io.Closer); ok {
+		_ = c.Close()
+	}
+	r.stream = nil
+}
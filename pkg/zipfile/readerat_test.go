@@ -0,0 +1,77 @@
+package zipfile_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// countingFetcher counts the bytes of the ranges requested from it
+type countingFetcher struct {
+	zipfile.OffsetFetcher
+	requested int64
+}
+
+func (f *countingFetcher) Fetch(start, end *int64) (io.Reader, error) {
+	if start != nil && end != nil {
+		f.requested += *end - *start + 1
+	}
+	return f.OffsetFetcher.Fetch(start, end)
+}
+
+func TestCentralDirectoryParser_OpenReaderAt(t *testing.T) {
+	// incompressible content, so that the deflated archive is larger than the prefetched EOCD buffer too
+	content := make([]byte, 256*1024)
+	x := uint32(1)
+	for i := range content {
+		x = x*1664525 + 1013904223
+		content[i] = byte(x >> 24)
+	}
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		t.Run(zipfile.CompressionMethodName(method), func(t *testing.T) {
+			data := zipOf(t, method, [2]string{"doc.pdf", string(content)})
+			fetcher := &countingFetcher{
+				OffsetFetcher: zipfile.NewStorageAdapter(context.Background(), memFetcher(data)),
+			}
+			p := zipfile.NewCentralDirectoryParser(fetcher)
+			r, size, err := p.OpenReaderAt("doc.pdf")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != int64(len(content)) {
+				t.Fatalf("expected size %d, got %d", len(content), size)
+			}
+			fetcher.requested = 0
+			// forwards, backwards, and past the end
+			for _, off := range []int64{100_000, 200_000, 10, 250_000} {
+				buf := make([]byte, 10_000)
+				n, err := r.ReadAt(buf, off)
+				expected := content[off:min(off+int64(len(buf)), size)]
+				if n != len(expected) || !bytes.Equal(buf[:n], expected) {
+					t.Fatalf("unexpected content at offset %d (%d bytes)", off, n)
+				}
+				if off+int64(len(buf)) > size && err != io.EOF {
+					t.Errorf("expected io.EOF reading past the end, got %v", err)
+				} else if off+int64(len(buf)) <= size && err != nil {
+					t.Errorf("unexpected error at offset %d: %v", off, err)
+				}
+			}
+			if method == zip.Store && fetcher.requested > 50_000 {
+				t.Errorf("expected only the ranges read to be fetched, %d bytes were", fetcher.requested)
+			}
+			if _, err := r.ReadAt(make([]byte, 1), size); err != io.EOF {
+				t.Errorf("expected io.EOF at the end, got %v", err)
+			}
+		})
+	}
+
+	padding := [2]string{"padding.bin", string(make([]byte, zipfile.EOCDPrefetchBufferSize))}
+	if _, _, err := memParser(zipOf(t, zip.Store, padding)).OpenReaderAt("missing"); !errors.Is(err, zipfile.ErrFileNotFound) {
+		t.Errorf("expected ErrFileNotFound, got %v", err)
+	}
+}
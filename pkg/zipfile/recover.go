@@ -0,0 +1,106 @@
+package zipfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// dataDescriptorMaxSize is the size of the largest data descriptor: a signature, the CRC32 and two 64 bit sizes
+const dataDescriptorMaxSize = 24
+
+// recoverSizes reads the sizes f's central directory record is missing (see WithTolerant) from its local file
+// header, or, for entries whose local file header defers them to a data descriptor, from the data descriptor
+// following its data, which can only be found if the compressed size is known.
+func (p *CentralDirectoryParser) recoverSizes(f *CDR) error {
+	off := f.LocalFileHeaderOffset
+	h, extra, err := p.readLocalHeader(f)
+	if err != nil {
+		return err
+	}
+	var compressed, uncompressed uint64
+	if h.GeneralPurposeBitFlag&dataDescriptorFlag == 0 {
+		compressed, uncompressed = uint64(h.CompressedSizeBytesRaw), uint64(h.UncompressedSizeBytesRaw)
+		if h.CompressedSizeBytesRaw == 0xffffffff || h.UncompressedSizeBytesRaw == 0xffffffff {
+			// the zip64 extra field of local file headers holds both sizes
+			ef := parseZip64ExtraFields(extra, zip64UncompressedSize|zip64CompressedSize)
+			if ef == nil || ef.missing != 0 {
+				return fmt.Errorf("%w: %s: its local file header has no zip64 extra field either", ErrMissingZip64Extra, f.FileName)
+			}
+			compressed, uncompressed = ef.CompressedSizeBytes, ef.UncompressedSizeBytes
+		}
+	} else {
+		if f.unknownSizes&unknownCompressedSize != 0 {
+			return fmt.Errorf("%w: %s: its sizes are in a data descriptor, which can't be found without its compressed size",
+				ErrMissingZip64Extra, f.FileName)
+		}
+		dataEnd := off + localHeaderFixedSize + uint64(h.FileNameLength) + uint64(h.ExtraFieldLength) + f.CompressedSizeBytes
+		compressed = f.CompressedSizeBytes
+		// data descriptors of entries with a zip64 extra field in their local file header have 64 bit sizes
+		uncompressed, err = p.readDataDescriptor(f, dataEnd, findExtraField(extra, Zip64HeaderId) != nil)
+		if err != nil {
+			return err
+		}
+	}
+	if f.unknownSizes&unknownCompressedSize != 0 {
+		f.CompressedSizeBytes = compressed
+	}
+	if f.unknownSizes&unknownUncompressedSize != 0 {
+		f.UncompressedSizeBytes = uncompressed
+	}
+	f.unknownSizes = 0
+	p.logger.WarnContext(p.ctx, "recovered the sizes of an entry missing its zip64 extra field",
+		"name", f.FileName, "compressed_size", f.CompressedSizeBytes, "uncompressed_size", f.UncompressedSizeBytes)
+	return nil
+}
+
+// readLocalHeader reads the local file header of f, along with its extra field
+func (p *CentralDirectoryParser) readLocalHeader(f *CDR) (*localHeader, []byte, error) {
+	off := f.LocalFileHeaderOffset
+	r, err := p.reader.Fetch(offset(off), offset(off+localHeaderFixedSize-1))
+	if err != nil {
+		return nil, nil, err
+	}
+	h := &localHeader{}
+	if err := binary.Read(r, binary.LittleEndian, h); err != nil ||
+		!bytes.Equal(binary.LittleEndian.AppendUint32(nil, h.Signature), LocalHeaderSignature) {
+		return nil, nil, fmt.Errorf("%w: %s: no local file header at offset %d to recover its sizes from",
+			ErrMissingZip64Extra, f.FileName, off)
+	}
+	if h.ExtraFieldLength == 0 {
+		return h, nil, nil
+	}
+	start := off + localHeaderFixedSize + uint64(h.FileNameLength)
+	r, err = p.reader.Fetch(offset(start), offset(start+uint64(h.ExtraFieldLength)-1))
+	if err != nil {
+		return nil, nil, err
+	}
+	extra := make([]byte, h.ExtraFieldLength)
+	if _, err := io.ReadFull(r, extra); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: could not read its local file header: %v", ErrMissingZip64Extra, f.FileName, err)
+	}
+	return h, extra, nil
+}
+
+// readDataDescriptor returns the uncompressed size stored in the data descriptor of f at offset off, which has
+// an optional signature, and 64 bit sizes if zip64 is set, 32 bit sizes otherwise. The compressed size it holds
+// must match the one f has.
+func (p *CentralDirectoryParser) readDataDescriptor(f *CDR, off uint64, zip64 bool) (uint64, error) {
+	r, err := p.reader.Fetch(offset(off), offset(off+dataDescriptorMaxSize-1))
+	if err != nil {
+		return 0, err
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, dataDescriptorMaxSize))
+	if err != nil {
+		return 0, err
+	}
+	buf = bytes.TrimPrefix(buf, DataDescriptorSignature)
+	if zip64 && len(buf) >= 20 && binary.LittleEndian.Uint64(buf[4:12]) == f.CompressedSizeBytes {
+		return binary.LittleEndian.Uint64(buf[12:20]), nil
+	}
+	if !zip64 && len(buf) >= 12 && uint64(binary.LittleEndian.Uint32(buf[4:8])) == f.CompressedSizeBytes {
+		return uint64(binary.LittleEndian.Uint32(buf[8:12])), nil
+	}
+	return 0, fmt.Errorf("%w: %s: no data descriptor at offset %d to recover its sizes from", ErrMissingZip64Extra, f.FileName, off)
+}
@@ -0,0 +1,56 @@
+package zipfile_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/remote"
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestCentralDirectoryParser_MissingZip64Extra(t *testing.T) {
+	// a.txt stores both sizes as 0xffffffff, b.txt (which has a data descriptor) its uncompressed size,
+	// neither has a zip64 extra field
+	p, err := parser("file://testdata/missing_zip64_extra.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	_, err = p.GetCentralDirectory()
+	if !errors.Is(err, zipfile.ErrMissingZip64Extra) || !errors.Is(err, zipfile.ErrCorruptArchive) {
+		t.Fatalf("expected ErrMissingZip64Extra, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "a.txt: uncompressed size and compressed size stored as 0xffffffff") {
+		t.Errorf("expected the error to name the entry and its missing sizes, got: %v", err)
+	}
+
+	fetcher, err := remote.Object("file://testdata/missing_zip64_extra.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	p = zipfile.NewCentralDirectoryParser(zipfile.NewStorageAdapter(context.Background(), fetcher),
+		zipfile.WithTolerant(true), zipfile.WithVerifyReads(true), zipfile.WithLogger(remote.DummyLogger()))
+	records, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"a.txt": "hello, tolerant parser\n",
+		"b.txt": strings.Repeat("data descriptor\n", 100),
+	}
+	for _, f := range records {
+		if f.UncompressedSizeBytes != uint64(len(expected[f.FileName])) {
+			t.Errorf("%s: expected size %d, got %d", f.FileName, len(expected[f.FileName]), f.UncompressedSizeBytes)
+		}
+		r, err := p.Read(f.FileName)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil || string(data) != expected[f.FileName] {
+			t.Errorf("%s: unexpected content %q (err: %v)", f.FileName, data, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package zipfile
 
 import (
+	"bytes"
 	"context"
 	"io"
 
@@ -19,6 +20,20 @@ func NewStorageAdapter(ctx context.Context, f remote.Fetcher) *StorageAdapter {
 	}
 }
 
+// Fetch returns the bytes between start and end (inclusive).
+// An empty range (end before start) returns an empty reader without making a request.
 func (z *StorageAdapter) Fetch(start, end *int64) (io.Reader, error) {
+	if start != nil && end != nil && *end < *start {
+		return bytes.NewReader(nil), nil
+	}
 	return z.f.Fetch(z.ctx, start, end)
 }
+
+func (z *StorageAdapter) Size() (int64, error) {
+	return remote.SizeOf(z.ctx, z.f)
+}
+
+// StoredChecksum returns the checksum of the whole object stored by the backend, see remote.StoredChecksum
+func (z *StorageAdapter) StoredChecksum(algorithm string) ([]byte, error) {
+	return remote.StoredChecksum(z.ctx, z.f, algorithm)
+}
@@ -0,0 +1,31 @@
+package zipfile_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+type failingFetcher struct {
+	t *testing.T
+}
+
+func (f failingFetcher) Fetch(_ context.Context, _, _ *int64) (io.ReadCloser, error) {
+	f.t.Fatalf("unexpected request")
+	return nil, nil
+}
+
+func TestStorageAdapter_EmptyRange(t *testing.T) {
+	adapter := zipfile.NewStorageAdapter(context.Background(), failingFetcher{t: t})
+	start, end := int64(10), int64(9)
+	r, err := adapter.Fetch(&start, &end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil || len(data) != 0 {
+		t.Errorf("expected an empty reader, got %d bytes (err: %v)", len(data), err)
+	}
+}
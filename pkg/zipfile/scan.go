@@ -0,0 +1,77 @@
+package zipfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// ScanLimit is how far into the file scanning for the start of the zip data goes, see WithScanForStart
+	ScanLimit = 16 << 20
+	// maxScanCandidates bounds the number of possible starts tried, each costing a request or two
+	maxScanCandidates = 64
+)
+
+// scanForZipStart is the last resort for archives that can't be parsed as they are: it looks for local file headers
+// in the first ScanLimit bytes, and tries each as the start of the zip data, until one is consistent
+// with the central directory declared by the EOCD record at loc.
+// Each candidate is tried both with the central directory offset shifted along with the entries,
+// as when bytes are prepended to an archive, and with it left as declared, as some tools fix up only that offset.
+func (p *CentralDirectoryParser) scanForZipStart(loc *CDLocation) ([]*CDR, error) {
+	candidates, err := p.localHeaderOffsets()
+	if err != nil {
+		return nil, err
+	}
+	for _, start := range candidates {
+		for _, cdOffset := range []int64{int64(loc.Offset) + start, int64(loc.Offset)} {
+			if err := p.ctx.Err(); err != nil {
+				return nil, err
+			}
+			shifted := *loc
+			shifted.Offset = uint64(cdOffset)
+			shifted.BaseOffset = start
+			cd := p.openCD(&shifted)
+			if ok, err := startsWithCDR(cd); err != nil || !ok {
+				continue
+			}
+			records, err := p.parseRecords(&shifted, cd, time.Now())
+			if err != nil {
+				// the signatures are a coincidence, or the entries don't start where the candidate implies
+				continue
+			}
+			p.scanned = true
+			p.logger.InfoContext(p.ctx, "found the start of the zip data by scanning",
+				"offset", p.stubSize, "cd_offset", cdOffset)
+			return records, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no zip data found in the first %d bytes", ErrInvalidZip, ScanLimit)
+}
+
+// localHeaderOffsets returns the offsets of local file header signatures in the first ScanLimit bytes,
+// other than at the very start (where the archive would have been parsed without scanning)
+func (p *CentralDirectoryParser) localHeaderOffsets() ([]int64, error) {
+	limit := int64(ScanLimit)
+	if sizer, ok := p.reader.(SizeFetcher); ok {
+		if size, err := sizer.Size(); err == nil {
+			limit = min(limit, size)
+		}
+	}
+	buf, err := io.ReadAll(&windowReader{ctx: p.ctx, fetcher: p.reader, end: limit, window: p.cdWindowSize})
+	if err != nil && len(buf) == 0 {
+		// without the size, the limit may be past the end of the file: the data read up to it is enough
+		return nil, err
+	}
+	var offsets []int64
+	for pos := 1; pos < len(buf) && len(offsets) < maxScanCandidates; {
+		i := bytes.Index(buf[pos:], LocalHeaderSignature)
+		if i == -1 {
+			break
+		}
+		offsets = append(offsets, int64(pos+i))
+		pos += i + 1
+	}
+	return offsets, nil
+}
@@ -0,0 +1,58 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// sizelessFetcher hides the size of the archive, so shifted offsets can't be computed from it
+type sizelessFetcher struct {
+	zipfile.OffsetFetcher
+}
+
+func TestCentralDirectoryParser_ScanForStart(t *testing.T) {
+	junk := []byte("\xef\xbb\xbfexported by some pipeline\n")
+	data := append(bytes.Clone(junk), verifyTestZip(t)...)
+	open := func(data []byte, opts ...zipfile.ParserOpt) *zipfile.CentralDirectoryParser {
+		fetcher := memFetcher(data)
+		return zipfile.NewCentralDirectoryParser(&sizelessFetcher{zipfile.NewStorageAdapter(context.Background(), fetcher)}, opts...)
+	}
+	if _, err := open(data).GetCentralDirectory(); !errors.Is(err, zipfile.ErrInvalidZip) {
+		t.Fatalf("expected ErrInvalidZip without scanning, got: %v", err)
+	}
+
+	// some tools fix up the central directory offset, but not the offsets of the entries
+	fixedUp := bytes.Clone(data)
+	eocd := fixedUp[len(fixedUp)-22:]
+	binary.LittleEndian.PutUint32(eocd[16:], binary.LittleEndian.Uint32(eocd[16:])+uint32(len(junk)))
+
+	for name, data := range map[string][]byte{"prepended": data, "fixed up": fixedUp} {
+		p := open(data, zipfile.WithScanForStart(true))
+		records, err := p.GetCentralDirectory()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		r, err := p.Read(records[0].FileName)
+		if err != nil {
+			t.Fatalf("%s: unexpected error reading entry: %v", name, err)
+		}
+		if _, err := io.ReadAll(zipfile.VerifyingReader(r, records[0])); err != nil {
+			t.Errorf("%s: unexpected error reading entry: %v", name, err)
+		}
+		stub, err := p.Stub()
+		if err != nil || stub == nil || !stub.Scanned || stub.Size != int64(len(junk)) || stub.Kind != zipfile.StubByteOrderMark {
+			t.Errorf("%s: expected the zip data to be found by scanning at %d, got: %+v (err: %v)", name, len(junk), stub, err)
+		}
+	}
+
+	noCD := bytes.ReplaceAll(data, []byte("PK\x01\x02"), []byte("XX\x01\x02"))
+	if _, err := open(noCD, zipfile.WithScanForStart(true)).GetCentralDirectory(); !errors.Is(err, zipfile.ErrInvalidZip) {
+		t.Errorf("expected ErrInvalidZip scanning an archive without a central directory, got: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package zipfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// StubKind identifies the program prepended to a self-extracting archive
+type StubKind string
+
+const (
+	StubWindowsExecutable StubKind = "windows executable"
+	StubELFExecutable     StubKind = "elf executable"
+	StubScript            StubKind = "script"
+	StubByteOrderMark     StubKind = "byte order mark"
+	StubUnknown           StubKind = "unknown"
+)
+
+// stubSignatures are the starts of programs commonly prepended to zip data to make it self-extracting
+var stubSignatures = []struct {
+	prefix []byte
+	kind   StubKind
+}{
+	{[]byte("MZ"), StubWindowsExecutable},
+	{[]byte("\x7fELF"), StubELFExecutable},
+	{[]byte("#!"), StubScript},
+	{[]byte("\xef\xbb\xbf"), StubByteOrderMark},
+}
+
+// Stub describes the data prepended to the zip data of a self-extracting (SFX) archive
+type Stub struct {
+	// Size is the number of bytes before the zip data, which starts with the first local file header
+	Size int64
+	Kind StubKind
+	// Scanned is set if the zip data was only found by scanning for it, see WithScanForStart
+	Scanned bool
+}
+
+func stubKind(start []byte) StubKind {
+	for _, s := range stubSignatures {
+		if bytes.HasPrefix(start, s.prefix) {
+			return s.kind
+		}
+	}
+	return StubUnknown
+}
+
+// archiveStart returns the offset of the first local file header: the start of the zip data, following a stub
+// if there is one. Entry offsets are already adjusted for a stub the archive doesn't account for.
+func archiveStart(records []*CDR, loc *CDLocation) int64 {
+	start := int64(loc.Offset)
+	for _, f := range records {
+		start = min(start, int64(f.LocalFileHeaderOffset))
+	}
+	return start
+}
+
+// checkArchiveStart validates that the zip data following a stub of stubSize bytes starts with a local file header.
+// A misplaced start means the stub size (and so every entry offset) was computed wrong.
+func (p *CentralDirectoryParser) checkArchiveStart(stubSize int64) error {
+	start, end := stubSize, stubSize+int64(len(LocalHeaderSignature))-1
+	r, err := p.reader.Fetch(&start, &end)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, len(LocalHeaderSignature))
+	if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, LocalHeaderSignature) {
+		return fmt.Errorf("%w: no local file header at offset %d, where the zip data should start", ErrInvalidZip, stubSize)
+	}
+	return nil
+}
+
+// Stub returns the program prepended to a self-extracting archive, or nil if the zip data starts at the beginning.
+// Archives whose offsets account for the stub (as written by "zip -A") are detected, as well as ones with shifted offsets.
+// The central directory is read if it wasn't already.
+func (p *CentralDirectoryParser) Stub() (*Stub, error) {
+	if p.location == nil {
+		if _, err := p.GetCentralDirectory(); err != nil {
+			return nil, err
+		}
+	}
+	if p.stubSize == 0 {
+		return nil, nil
+	}
+	start, end := int64(0), int64(probeSize-1)
+	r, err := p.reader.Fetch(&start, &end)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, probeSize))
+	if err != nil {
+		return nil, err
+	}
+	if p.stubSize == int64(len(spannedArchiveSignature)) && bytes.Equal(buf, spannedArchiveSignature) {
+		// not a stub: archives written for spanning may start with a marker before the first local header
+		return nil, nil
+	}
+	return &Stub{Size: p.stubSize, Kind: stubKind(buf), Scanned: p.scanned}, nil
+}
@@ -0,0 +1,105 @@
+package zipfile_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestCentralDirectoryParser_ShiftedOffsets(t *testing.T) {
+	p, err := parser("file://testdata/sfx_stub.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	files, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error listing zip file: %v", err)
+	}
+	if len(files) != 7 {
+		t.Fatalf("expected 7 files, got %d", len(files))
+	}
+	r, err := p.Read("foo/bar.txt")
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %v", err)
+	}
+	if string(data) != "file in a directory!\n" {
+		t.Errorf("got wrong string: %s\n", string(data))
+	}
+}
+
+func TestCentralDirectoryParser_SFX(t *testing.T) {
+	// a stub bigger than the window the end of central directory record is searched for in
+	stub := append([]byte("MZ\x90\x00"), bytes.Repeat([]byte{0xcc}, 1<<20)...)
+	archive := func(adjusted bool) []byte {
+		buf := &bytes.Buffer{}
+		w := zip.NewWriter(buf)
+		if adjusted {
+			// like "zip -A": offsets account for the stub
+			buf.Write(stub)
+			w.SetOffset(int64(len(stub)))
+		}
+		for _, name := range []string{"setup.ini", "payload/app.bin"} {
+			f, err := w.Create(name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, _ = f.Write([]byte("contents of " + name))
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if adjusted {
+			return buf.Bytes()
+		}
+		// otherwise offsets are relative to the start of the zip data, as when a stub is simply prepended
+		return append(bytes.Clone(stub), buf.Bytes()...)
+	}
+
+	for _, adjusted := range []bool{false, true} {
+		data := archive(adjusted)
+		p := memParser(data)
+		if err := p.ProbeRange(); err != nil {
+			t.Errorf("adjusted=%t: unexpected error probing: %v", adjusted, err)
+		}
+		r, err := p.Read("payload/app.bin")
+		if err != nil {
+			t.Fatalf("adjusted=%t: unexpected error reading entry: %v", adjusted, err)
+		}
+		if content, _ := io.ReadAll(r); string(content) != "contents of payload/app.bin" {
+			t.Errorf("adjusted=%t: unexpected content %q", adjusted, content)
+		}
+		stub, err := p.Stub()
+		if err != nil {
+			t.Fatalf("adjusted=%t: unexpected error: %v", adjusted, err)
+		}
+		if stub == nil || stub.Size != int64(1<<20+4) || stub.Kind != zipfile.StubWindowsExecutable {
+			t.Errorf("adjusted=%t: expected a windows executable stub of %d bytes, got: %+v", adjusted, 1<<20+4, stub)
+		}
+	}
+
+	// the zip data must start where the offsets say it does
+	corrupt := archive(false)
+	corrupt[len(stub)] = 'X'
+	if _, err := memParser(corrupt).GetCentralDirectory(); !errors.Is(err, zipfile.ErrInvalidZip) {
+		t.Errorf("expected ErrInvalidZip without a local header at the start of the zip data, got: %v", err)
+	}
+
+	p, err := parser("file://testdata/sfx_stub.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	if stub, err := p.Stub(); err != nil || stub == nil || stub.Kind != zipfile.StubScript {
+		t.Errorf("expected a script stub, got: %+v (err: %v)", stub, err)
+	}
+	if stub, err := memParser(verifyTestZip(t)).Stub(); err != nil || stub != nil {
+		t.Errorf("expected no stub in a regular archive, got: %+v (err: %v)", stub, err)
+	}
+}
@@ -0,0 +1,91 @@
+package zipfile
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// ntfsEpochOffset is the number of seconds between the NTFS epoch (1601-01-01) and the unix epoch
+	ntfsEpochOffset = 11644473600
+	ntfsTimesTag    = 0x0001
+)
+
+type extraTimestamps struct {
+	modified, accessed, created time.Time
+}
+
+// parseExtTimestamp parses the Info-ZIP extended timestamp extra field (0x5455).
+// Times have a precision of seconds. Central directory records usually only carry the modification time,
+// so the flags may announce times that aren't actually present.
+func parseExtTimestamp(extraFields []byte) (extraTimestamps, bool) {
+	var ts extraTimestamps
+	data := findExtraField(extraFields, ExtTimestampHeaderId)
+	if len(data) < 1 {
+		return ts, false
+	}
+	flags := data[0]
+	data = data[1:]
+	for i, t := range []*time.Time{&ts.modified, &ts.accessed, &ts.created} {
+		if flags&(1<<i) == 0 {
+			continue
+		}
+		if len(data) < 4 {
+			break
+		}
+		*t = time.Unix(int64(int32(binary.LittleEndian.Uint32(data[:4]))), 0).UTC()
+		data = data[4:]
+	}
+	return ts, !ts.modified.IsZero()
+}
+
+// parseNTFSTimestamps parses the NTFS extra field (0x000a), which stores times with 100ns precision
+func parseNTFSTimestamps(extraFields []byte) (extraTimestamps, bool) {
+	var ts extraTimestamps
+	data := findExtraField(extraFields, NTFSHeaderId)
+	if len(data) < 4 {
+		return ts, false
+	}
+	data = data[4:] // reserved
+	for len(data) >= 4 {
+		tag := binary.LittleEndian.Uint16(data[:2])
+		size := int(binary.LittleEndian.Uint16(data[2:4]))
+		data = data[4:]
+		if size > len(data) {
+			return ts, false
+		}
+		if tag == ntfsTimesTag && size >= 24 {
+			ts.modified = ntfsTime(binary.LittleEndian.Uint64(data[0:8]))
+			ts.accessed = ntfsTime(binary.LittleEndian.Uint64(data[8:16]))
+			ts.created = ntfsTime(binary.LittleEndian.Uint64(data[16:24]))
+			return ts, !ts.modified.IsZero()
+		}
+		data = data[size:]
+	}
+	return ts, false
+}
+
+// ntfsTime converts an NTFS FILETIME (100ns intervals since 1601-01-01) to a time.Time. 0 means unset.
+func ntfsTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	secs := int64(ft/1e7) - ntfsEpochOffset
+	nsec := int64(ft%1e7) * 100
+	return time.Unix(secs, nsec).UTC()
+}
+
+// parseExtraTimestamps replaces the MS-DOS modification time of f with the most precise time available
+// in its extra fields (NTFS, then extended timestamp), and sets its access and creation times if present
+func parseExtraTimestamps(f *CDR) {
+	ts, ok := parseNTFSTimestamps(f.ExtraFields)
+	if !ok {
+		ts, ok = parseExtTimestamp(f.ExtraFields)
+	}
+	if !ok {
+		return
+	}
+	f.Modified = ts.modified
+	f.Accessed = ts.accessed
+	f.Created = ts.created
+}
@@ -0,0 +1,46 @@
+package zipfile_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCentralDirectoryParser_ExtraTimestamps(t *testing.T) {
+	p, err := parser("file://testdata/timestamps.zip")
+	if err != nil {
+		t.Fatalf("unexpected error opening zip file: %v", err)
+	}
+	records, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error reading central directory: %v", err)
+	}
+	dos := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	modified := time.Date(2021, 6, 1, 12, 30, 15, 123456000, time.UTC)
+	accessed := time.Date(2022, 1, 2, 3, 4, 5, 654321000, time.UTC)
+	created := time.Date(2020, 5, 6, 7, 8, 9, 111111000, time.UTC)
+	seconds := func(t time.Time) time.Time { return t.Truncate(time.Second) }
+	cases := map[string]struct {
+		Modified, Accessed, Created time.Time
+	}{
+		"dos.txt":        {dos, time.Time{}, time.Time{}},
+		"ut.txt":         {seconds(modified), seconds(accessed), seconds(created)},
+		"ut_central.txt": {seconds(modified), time.Time{}, time.Time{}},
+		"ntfs.txt":       {modified, accessed, created},
+		"both.txt":       {modified, accessed, created},
+	}
+	for _, f := range records {
+		expected, ok := cases[f.FileName]
+		if !ok {
+			t.Fatalf("unexpected entry: %s", f.FileName)
+		}
+		if !f.Modified.Equal(expected.Modified) {
+			t.Errorf("%s: expected modified %s, got %s", f.FileName, expected.Modified, f.Modified)
+		}
+		if !f.Accessed.Equal(expected.Accessed) {
+			t.Errorf("%s: expected accessed %s, got %s", f.FileName, expected.Accessed, f.Accessed)
+		}
+		if !f.Created.Equal(expected.Created) {
+			t.Errorf("%s: expected created %s, got %s", f.FileName, expected.Created, f.Created)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package zipfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	// verifySampleSize is the number of entries read by VerifySample
+	verifySampleSize = 16
+	// localHeaderFixedSize is the size of a local file header, not including its variable length fields
+	localHeaderFixedSize = 30
+	// dataDescriptorFlag is set in the general purpose bit flag of entries whose CRC32 and sizes
+	// follow their data, rather than being stored in their local file header
+	dataDescriptorFlag = 0x8
+)
+
+var (
+	ErrCorruptArchive = errors.New("corrupt archive")
+	ErrSizeMismatch   = fmt.Errorf("%w: size mismatch", ErrCorruptArchive)
+	ErrCRCMismatch    = fmt.Errorf("%w: CRC32 mismatch", ErrCorruptArchive)
+	// ErrTruncatedCentralDirectory is returned when the central directory holds fewer records than the EOCD declares
+	ErrTruncatedCentralDirectory = fmt.Errorf("%w: truncated central directory", ErrCorruptArchive)
+	// ErrMissingZip64Extra is returned when a central directory record stores the zip64 placeholder in place of
+	// a size or offset, without the zip64 extra field holding it, see WithTolerant
+	ErrMissingZip64Extra = fmt.Errorf("%w: missing zip64 extra field", ErrCorruptArchive)
+	ErrEntryChanged      = errors.New("entry changed in the archive")
+)
+
+// VerifyLevel determines how thoroughly an archive is checked before it is used
+type VerifyLevel int
+
+const (
+	// VerifyNone skips verification
+	VerifyNone VerifyLevel = iota
+	// VerifyStructure checks that the EOCD and central directory are consistent with each other
+	// and that all entries lie within the archive. It doesn't read any entry data.
+	VerifyStructure
+	// VerifySample also reads a sample of entries, checking their size and CRC32
+	VerifySample
+	// VerifyFull reads all entries, checking their size and CRC32, and then the whole archive
+	// against the checksum stored by the backend, if any (see WithChecksumAlgorithm)
+	VerifyFull
+)
+
+var verifyLevelNames = []string{"none", "structure", "sample", "full"}
+
+func (l VerifyLevel) String() string {
+	if l < 0 || int(l) >= len(verifyLevelNames) {
+		return fmt.Sprintf("VerifyLevel(%d)", int(l))
+	}
+	return verifyLevelNames[l]
+}
+
+// ParseVerifyLevel parses one of "none", "structure", "sample" or "full". An empty string means none.
+func ParseVerifyLevel(s string) (VerifyLevel, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return VerifyNone, nil
+	}
+	i := slices.Index(verifyLevelNames, s)
+	if i == -1 {
+		return VerifyNone, fmt.Errorf("unknown verification level: '%s' (expected one of: %s)",
+			s, strings.Join(verifyLevelNames, ", "))
+	}
+	return VerifyLevel(i), nil
+}
+
+// Verify checks records, as returned by GetCentralDirectory, against the archive.
+// It returns an error wrapping ErrCorruptArchive describing the first problem found.
+func (p *CentralDirectoryParser) Verify(records []*CDR, level VerifyLevel) error {
+	if level == VerifyNone {
+		return nil
+	}
+	if p.location == nil {
+		if _, err := p.GetCentralDirectory(); err != nil {
+			return err
+		}
+	}
+	if err := p.verifyStructure(records); err != nil {
+		return err
+	}
+	var entries []*CDR
+	switch level {
+	case VerifySample:
+		entries = sampleRecords(records, verifySampleSize)
+	case VerifyFull:
+		entries = records
+	}
+	if len(entries) > 0 {
+		p.warnUnstoredChecksum()
+	}
+	for _, f := range entries {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.verifyEntry(f); err != nil {
+			return err
+		}
+	}
+	if level == VerifyFull {
+		return p.verifyArchiveChecksum()
+	}
+	return nil
+}
+
+func (p *CentralDirectoryParser) verifyStructure(records []*CDR) error {
+	loc := p.location
+	entries := uint64(len(records))
+	if !loc.Zip64 {
+		// some writers wrap the 16 bit count instead of switching to zip64
+		entries &= 0xffff
+	}
+	if entries != loc.Entries {
+		return fmt.Errorf("%w: end of central directory declares %d entries, central directory has %d",
+			ErrCorruptArchive, loc.Entries, len(records))
+	}
+	if sizer, ok := p.reader.(SizeFetcher); ok {
+		size, err := sizer.Size()
+		if err != nil {
+			return err
+		}
+		if loc.Offset+loc.SizeBytes > uint64(size) {
+			return fmt.Errorf("%w: central directory ends at offset %d, archive is %d bytes",
+				ErrCorruptArchive, loc.Offset+loc.SizeBytes, size)
+		}
+	}
+	// entries are stored before the central directory
+	for _, f := range records {
+		headerSize := uint64(localHeaderFixedSize + len(f.FileName))
+		if f.LocalFileHeaderOffset > loc.Offset ||
+			f.CompressedSizeBytes > loc.Offset ||
+			f.LocalFileHeaderOffset+headerSize+f.CompressedSizeBytes > loc.Offset {
+			return fmt.Errorf("%w: %s: entry at offset %d (%d bytes) overlaps the central directory at offset %d",
+				ErrCorruptArchive, f.FileName, f.LocalFileHeaderOffset, f.CompressedSizeBytes, loc.Offset)
+		}
+	}
+	return nil
+}
+
+func (p *CentralDirectoryParser) verifyEntry(f *CDR) error {
+	if f.Mode.IsDir() {
+		return nil
+	}
+	r, err := p.readerForRecord(f)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptArchive, f.FileName, err)
+	}
+	_, err = io.Copy(io.Discard, VerifyingReaderFor(r, f, p.checksum))
+	if err != nil && !errors.Is(err, ErrCorruptArchive) {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptArchive, f.FileName, err)
+	}
+	return err
+}
+
+// VerifyingReader wraps r, the decompressed content of f, failing the read with ErrSizeMismatch
+// if its length differs from the size declared for f, or with ErrCRCMismatch if its CRC32 doesn't match.
+// Entries compressed with methods that aren't decoded are returned as is, since their content can't be checked.
+func VerifyingReader(r io.Reader, f *CDR) io.Reader {
+	return VerifyingReaderFor(r, f, ChecksumCRC32)
+}
+
+type verifyingReader struct {
+	r io.Reader
+	f *CDR
+	// crc is nil when only the size is checked
+	crc hash.Hash32
+	n   uint64
+	err error
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.r.Read(p)
+	if v.crc != nil {
+		_, _ = v.crc.Write(p[:n])
+	}
+	v.n += uint64(n)
+	switch {
+	case v.n > v.f.UncompressedSizeBytes:
+		v.err = fmt.Errorf("%w: %s: read more than the declared %d bytes",
+			ErrSizeMismatch, v.f.FileName, v.f.UncompressedSizeBytes)
+	case err == io.EOF && v.n != v.f.UncompressedSizeBytes:
+		v.err = fmt.Errorf("%w: %s: read %d bytes, expected %d",
+			ErrSizeMismatch, v.f.FileName, v.n, v.f.UncompressedSizeBytes)
+	case err == io.EOF && v.crc != nil && v.crc.Sum32() != v.f.CRC32Uncompressed:
+		v.err = fmt.Errorf("%w: %s: got %08x, expected %08x",
+			ErrCRCMismatch, v.f.FileName, v.crc.Sum32(), v.f.CRC32Uncompressed)
+	}
+	if v.err != nil {
+		return n, v.err
+	}
+	return n, err
+}
+
+// CheckLocalHeader reads the local file header of f (a single small request), returning ErrEntryChanged
+// if it doesn't describe f: the archive was replaced, or changed, since its central directory was read.
+// The CRC32 and sizes are only compared if the header carries them, rather than a data descriptor following the data.
+func CheckLocalHeader(f *CDR, fetcher OffsetFetcher) error {
+	off := f.LocalFileHeaderOffset
+	r, err := fetcher.Fetch(offset(off), offset(off+localHeaderFixedSize-1))
+	if err != nil {
+		return err
+	}
+	h := &localHeader{}
+	if err := binary.Read(r, binary.LittleEndian, h); err != nil ||
+		!bytes.Equal(binary.LittleEndian.AppendUint32(nil, h.Signature), LocalHeaderSignature) {
+		return fmt.Errorf("%w: %s: no local file header at offset %d", ErrEntryChanged, f.FileName, off)
+	}
+	switch {
+	case h.GeneralPurposeBitFlag&maskedHeaderFlag != 0:
+		return checkStrongEncryption(f.FileName, h.GeneralPurposeBitFlag, nil)
+	case h.CompressionMethod != f.CompressionMethod:
+		return fmt.Errorf("%w: %s: compression method is %d, expected %d", ErrEntryChanged, f.FileName, h.CompressionMethod, f.CompressionMethod)
+	case h.GeneralPurposeBitFlag&dataDescriptorFlag != 0:
+		return nil
+	case h.CRC32Uncompressed != f.CRC32Uncompressed:
+		return fmt.Errorf("%w: %s: CRC32 is %08x, expected %08x", ErrEntryChanged, f.FileName, h.CRC32Uncompressed, f.CRC32Uncompressed)
+	case h.CompressedSizeBytesRaw != math.MaxUint32 && uint64(h.CompressedSizeBytesRaw) != f.CompressedSizeBytes:
+		return fmt.Errorf("%w: %s: compressed size is %d bytes, expected %d", ErrEntryChanged, f.FileName, h.CompressedSizeBytesRaw, f.CompressedSizeBytes)
+	}
+	return nil
+}
+
+// sampleRecords returns up to n records, evenly spread across records
+func sampleRecords(records []*CDR, n int) []*CDR {
+	if len(records) <= n {
+		return records
+	}
+	sample := make([]*CDR, 0, n)
+	for i := 0; i < n; i++ {
+		sample = append(sample, records[i*len(records)/n])
+	}
+	return sample
+}
@@ -0,0 +1,126 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestCentralDirectoryParser_Verify(t *testing.T) {
+	verify := func(data []byte, level zipfile.VerifyLevel) error {
+		p := memParser(data)
+		records, err := p.GetCentralDirectory()
+		if err != nil {
+			t.Fatalf("unexpected error parsing central directory: %v", err)
+		}
+		return p.Verify(records, level)
+	}
+
+	data := verifyTestZip(t)
+	for _, level := range []zipfile.VerifyLevel{zipfile.VerifyStructure, zipfile.VerifySample, zipfile.VerifyFull} {
+		if err := verify(data, level); err != nil {
+			t.Errorf("%s: unexpected error verifying valid archive: %v", level, err)
+		}
+	}
+
+	// flip a byte in the body of b.txt: the structure is intact, but the CRC doesn't match
+	corrupt := bytes.Clone(data)
+	corrupt[bytes.Index(corrupt, []byte("contents of b.txt"))] ^= 0xff
+	if err := verify(corrupt, zipfile.VerifyStructure); err != nil {
+		t.Errorf("unexpected error verifying structure: %v", err)
+	}
+	if err := verify(corrupt, zipfile.VerifyFull); !errors.Is(err, zipfile.ErrCorruptArchive) {
+		t.Errorf("expected ErrCorruptArchive for corrupt entry, got: %v", err)
+	}
+
+	// declare one entry fewer than the central directory holds: parsing only warns, verification fails
+	miscounted := bytes.Clone(data)
+	eocd := bytes.LastIndex(miscounted, zipfile.EOCDSignature)
+	miscounted[eocd+10]--
+	if err := verify(miscounted, zipfile.VerifyStructure); !errors.Is(err, zipfile.ErrCorruptArchive) {
+		t.Errorf("expected ErrCorruptArchive for entry count mismatch, got: %v", err)
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	content := []byte("hello, world")
+	checksum := crc32.ChecksumIEEE(content)
+	cases := []struct {
+		Name     string
+		Size     uint64
+		CRC      uint32
+		Expected error
+	}{
+		{"valid", uint64(len(content)), checksum, nil},
+		{"truncated", uint64(len(content)) + 1, checksum, zipfile.ErrSizeMismatch},
+		{"too_long", uint64(len(content)) - 1, checksum, zipfile.ErrSizeMismatch},
+		{"bad_crc", uint64(len(content)), checksum + 1, zipfile.ErrCRCMismatch},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			f := &zipfile.CDR{FileName: "a.txt", UncompressedSizeBytes: c.Size, CRC32Uncompressed: c.CRC}
+			data, err := io.ReadAll(zipfile.VerifyingReader(bytes.NewReader(content), f))
+			if !errors.Is(err, c.Expected) {
+				t.Fatalf("expected error %v, got: %v", c.Expected, err)
+			}
+			if c.Expected == nil && !bytes.Equal(data, content) {
+				t.Errorf("unexpected content: %q", data)
+			}
+		})
+	}
+
+	// reading through the parser
+	corrupt := verifyTestZip(t)
+	corrupt[bytes.Index(corrupt, []byte("contents of b.txt"))] ^= 0xff
+	p := memParser(corrupt, zipfile.WithVerifyReads(true))
+	r, err := p.Read("b.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, zipfile.ErrCRCMismatch) {
+		t.Errorf("expected ErrCRCMismatch reading corrupt entry, got: %v", err)
+	}
+}
+
+func TestCheckLocalHeader(t *testing.T) {
+	p := memParser(verifyTestZip(t))
+	records, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error parsing central directory: %v", err)
+	}
+	fetcher := zipfile.NewStorageAdapter(context.Background(), memFetcher(verifyTestZip(t)))
+	for _, f := range records {
+		if err := zipfile.CheckLocalHeader(f, fetcher); err != nil {
+			t.Errorf("%s: unexpected error: %v", f.FileName, err)
+		}
+	}
+	moved := *records[0]
+	moved.LocalFileHeaderOffset++
+	if err := zipfile.CheckLocalHeader(&moved, fetcher); !errors.Is(err, zipfile.ErrEntryChanged) {
+		t.Errorf("expected ErrEntryChanged for a record pointing past its local header, got: %v", err)
+	}
+	recompressed := *records[0]
+	recompressed.CompressionMethod = zipfile.Deflate64
+	if err := zipfile.CheckLocalHeader(&recompressed, fetcher); !errors.Is(err, zipfile.ErrEntryChanged) {
+		t.Errorf("expected ErrEntryChanged for a record with another compression method, got: %v", err)
+	}
+}
+
+func TestParseVerifyLevel(t *testing.T) {
+	level, err := zipfile.ParseVerifyLevel("Sample")
+	if err != nil || level != zipfile.VerifySample {
+		t.Errorf("expected sample, got: %s (%v)", level, err)
+	}
+	level, err = zipfile.ParseVerifyLevel("")
+	if err != nil || level != zipfile.VerifyNone {
+		t.Errorf("expected none, got: %s (%v)", level, err)
+	}
+	if _, err := zipfile.ParseVerifyLevel("thorough"); err == nil {
+		t.Error("expected error parsing unknown level")
+	}
+}
@@ -0,0 +1,170 @@
+package zipfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Archivers on macOS (Finder, ditto) don't store extended attributes in extra fields: each entry's extended
+// attributes and resource fork are stored in an AppleDouble file of its own, under __MACOSX/.
+// There is no common extra field for extended attributes on other platforms.
+const (
+	AppleDoublePrefix = "__MACOSX/"
+
+	// MaxAppleDoubleSize bounds the size of the AppleDouble files read, resource forks included
+	MaxAppleDoubleSize = 64 * 1024 * 1024
+
+	appleDoubleMagic        = 0x00051607
+	appleDoubleHeaderSize   = 26
+	appleDoubleEntrySize    = 12
+	appleDoubleResourceFork = 2
+	appleDoubleFinderInfo   = 9
+
+	// the Finder info entry is followed by the extended attributes (see xnu's bsd/vfs/vfs_xattr.c):
+	// 32 bytes of Finder info, 2 bytes of padding and an "ATTR" header, followed by the attribute entries
+	finderInfoSize      = 32
+	attrHeaderOffset    = finderInfoSize + 2
+	attrHeaderMagic     = 0x41545452
+	attrHeaderSize      = 36
+	attrEntryHeaderSize = 11
+
+	XattrFinderInfo   = "com.apple.FinderInfo"
+	XattrResourceFork = "com.apple.ResourceFork"
+)
+
+var ErrInvalidAppleDouble = errors.New("invalid AppleDouble file")
+
+// AppleDoubleName returns the name of the AppleDouble file holding the extended attributes of the entry name
+func AppleDoubleName(name string) string {
+	dir, base := path.Split(strings.TrimSuffix(name, "/"))
+	return AppleDoublePrefix + dir + "._" + base
+}
+
+// AppleDoubleIndex maps the names of entries (without the trailing slash of directories)
+// to the AppleDouble files in records that hold their extended attributes
+func AppleDoubleIndex(records []*CDR) map[string]*CDR {
+	index := make(map[string]*CDR)
+	for _, f := range records {
+		name, ok := strings.CutPrefix(f.FileName, AppleDoublePrefix)
+		if !ok || f.Mode.IsDir() {
+			continue
+		}
+		dir, base := path.Split(name)
+		if target, ok := strings.CutPrefix(base, "._"); ok && target != "" {
+			index[dir+target] = f
+		}
+	}
+	return index
+}
+
+// ExtendedAttributes reads and parses the AppleDouble file appleDouble, returning the extended attributes it holds
+// (see AppleDoubleIndex). The Finder info and resource fork are returned as the attributes macOS exposes them as.
+func (p *CentralDirectoryParser) ExtendedAttributes(appleDouble *CDR) (map[string][]byte, error) {
+	if appleDouble.UncompressedSizeBytes > MaxAppleDoubleSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes", ErrEntryTooLarge, appleDouble.FileName, appleDouble.UncompressedSizeBytes)
+	}
+	if err := CheckEntryLimit(appleDouble, p.entryLimit); err != nil {
+		return nil, err
+	}
+	if err := CheckCompressionMethod(appleDouble, p.allowedMethods); err != nil {
+		return nil, err
+	}
+	r, err := p.readerForRecord(appleDouble)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(VerifyingReader(r, appleDouble))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", appleDouble.FileName, err)
+	}
+	xattrs, err := ParseAppleDouble(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", appleDouble.FileName, err)
+	}
+	return xattrs, nil
+}
+
+// ParseAppleDouble returns the extended attributes held in an AppleDouble file
+func ParseAppleDouble(data []byte) (map[string][]byte, error) {
+	if len(data) < appleDoubleHeaderSize || binary.BigEndian.Uint32(data) != appleDoubleMagic {
+		return nil, ErrInvalidAppleDouble
+	}
+	entries := int(binary.BigEndian.Uint16(data[24:]))
+	if len(data) < appleDoubleHeaderSize+entries*appleDoubleEntrySize {
+		return nil, fmt.Errorf("%w: truncated entry table", ErrInvalidAppleDouble)
+	}
+	xattrs := make(map[string][]byte)
+	for i := 0; i < entries; i++ {
+		entry := data[appleDoubleHeaderSize+i*appleDoubleEntrySize:]
+		id := binary.BigEndian.Uint32(entry)
+		content, err := appleDoubleRange(data, binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:]))
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case appleDoubleResourceFork:
+			if len(content) > 0 {
+				xattrs[XattrResourceFork] = content
+			}
+		case appleDoubleFinderInfo:
+			if len(content) < finderInfoSize {
+				continue
+			}
+			if finderInfo := content[:finderInfoSize]; !bytes.Equal(finderInfo, make([]byte, finderInfoSize)) {
+				xattrs[XattrFinderInfo] = finderInfo
+			}
+			if err := parseAttrHeader(data, content, xattrs); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return xattrs, nil
+}
+
+// parseAttrHeader parses the extended attributes following the Finder info in finderInfoEntry, if there are any.
+// Their offsets are relative to the start of the AppleDouble file, data.
+func parseAttrHeader(data, finderInfoEntry []byte, xattrs map[string][]byte) error {
+	if len(finderInfoEntry) < attrHeaderOffset+attrHeaderSize {
+		return nil
+	}
+	header := finderInfoEntry[attrHeaderOffset:]
+	if binary.BigEndian.Uint32(header) != attrHeaderMagic {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint16(header[34:]))
+	entries := header[attrHeaderSize:]
+	for i := 0; i < count; i++ {
+		if len(entries) < attrEntryHeaderSize {
+			return fmt.Errorf("%w: truncated attribute entries", ErrInvalidAppleDouble)
+		}
+		nameLen := int(entries[10])
+		entrySize := (attrEntryHeaderSize + nameLen + 3) &^ 3
+		if len(entries) < attrEntryHeaderSize+nameLen {
+			return fmt.Errorf("%w: truncated attribute name", ErrInvalidAppleDouble)
+		}
+		// names are NUL terminated
+		name := string(bytes.TrimRight(entries[attrEntryHeaderSize:attrEntryHeaderSize+nameLen], "\x00"))
+		value, err := appleDoubleRange(data, binary.BigEndian.Uint32(entries), binary.BigEndian.Uint32(entries[4:]))
+		if err != nil {
+			return err
+		}
+		if name != "" {
+			xattrs[name] = value
+		}
+		entries = entries[min(entrySize, len(entries)):]
+	}
+	return nil
+}
+
+func appleDoubleRange(data []byte, offset, length uint32) ([]byte, error) {
+	end := uint64(offset) + uint64(length)
+	if end > uint64(len(data)) {
+		return nil, fmt.Errorf("%w: %d bytes at offset %d are out of bounds", ErrInvalidAppleDouble, length, offset)
+	}
+	return data[offset:end], nil
+}
@@ -0,0 +1,114 @@
+package zipfile_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+// appleDouble encodes an AppleDouble file like the ones macOS archivers write, holding the given Finder info,
+// extended attributes and resource fork
+func appleDouble(finderInfo []byte, names []string, values [][]byte, resourceFork []byte) []byte {
+	be := binary.BigEndian
+	entriesSize := 0
+	for _, name := range names {
+		entriesSize += (11 + len(name) + 1 + 3) &^ 3
+	}
+	attrs := &bytes.Buffer{}
+	dataStart := 120 + entriesSize
+	dataLen := 0
+	for i, name := range names {
+		entry := make([]byte, (11+len(name)+1+3)&^3)
+		be.PutUint32(entry, uint32(dataStart+dataLen))
+		be.PutUint32(entry[4:], uint32(len(values[i])))
+		entry[10] = byte(len(name) + 1)
+		copy(entry[11:], name)
+		attrs.Write(entry)
+		dataLen += len(values[i])
+	}
+	finderInfoLen := 32 + 2 + 36 + entriesSize + dataLen
+	buf := make([]byte, 50, 50+finderInfoLen+len(resourceFork))
+	be.PutUint32(buf, 0x00051607)
+	be.PutUint32(buf[4:], 0x00020000)
+	be.PutUint16(buf[24:], 2)
+	be.PutUint32(buf[26:], 9)
+	be.PutUint32(buf[30:], 50)
+	be.PutUint32(buf[34:], uint32(finderInfoLen))
+	be.PutUint32(buf[38:], 2)
+	be.PutUint32(buf[42:], uint32(50+finderInfoLen))
+	be.PutUint32(buf[46:], uint32(len(resourceFork)))
+	buf = append(buf, finderInfo...)
+	buf = append(buf, 0, 0)
+	header := make([]byte, 36)
+	be.PutUint32(header, 0x41545452)
+	be.PutUint16(header[34:], uint16(len(names)))
+	buf = append(buf, header...)
+	buf = append(buf, attrs.Bytes()...)
+	for _, value := range values {
+		buf = append(buf, value...)
+	}
+	return append(buf, resourceFork...)
+}
+
+func TestCentralDirectoryParser_ExtendedAttributes(t *testing.T) {
+	finderInfo := append([]byte("TEXTttxt"), make([]byte, 24)...)
+	files := map[string][]byte{
+		"docs/readme.txt": []byte("read me"),
+		zipfile.AppleDoubleName("docs/readme.txt"): appleDouble(finderInfo,
+			[]string{"com.apple.quarantine", "user.origin"}, [][]byte{[]byte("0081;quarantined"), []byte("backup")},
+			[]byte("resource fork")),
+		zipfile.AppleDoubleName("docs/"): appleDouble(make([]byte, 32), []string{"user.tag"}, [][]byte{[]byte("x")}, nil),
+		"plain.txt":                      []byte("no attributes"),
+	}
+	data := newZip(t, func(w *zip.Writer) {
+		for _, name := range []string{"docs/", "docs/readme.txt", "__MACOSX/._docs", "__MACOSX/docs/._readme.txt", "plain.txt"} {
+			addEntry(t, w, &zip.FileHeader{Name: name, Method: zip.Deflate}, files[name])
+		}
+		addPadding(t, w)
+	})
+	p := memParser(data)
+	records, err := p.GetCentralDirectory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	index := zipfile.AppleDoubleIndex(records)
+	if len(index) != 2 || index["docs"] == nil || index["docs/readme.txt"] == nil {
+		t.Fatalf("expected AppleDouble files of docs and docs/readme.txt, got %v", index)
+	}
+
+	xattrs, err := p.ExtendedAttributes(index["docs/readme.txt"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"com.apple.quarantine":    "0081;quarantined",
+		"user.origin":             "backup",
+		zipfile.XattrFinderInfo:   string(finderInfo),
+		zipfile.XattrResourceFork: "resource fork",
+	}
+	if len(xattrs) != len(expected) {
+		t.Errorf("expected %d attributes, got %d", len(expected), len(xattrs))
+	}
+	for name, value := range expected {
+		if string(xattrs[name]) != value {
+			t.Errorf("expected %s to be %q, got %q", name, value, xattrs[name])
+		}
+	}
+	// empty Finder info isn't an attribute
+	xattrs, err = p.ExtendedAttributes(index["docs"])
+	if err != nil || len(xattrs) != 1 || string(xattrs["user.tag"]) != "x" {
+		t.Errorf("expected only user.tag, got %v (err: %v)", xattrs, err)
+	}
+
+	if _, err := zipfile.ParseAppleDouble([]byte("not AppleDouble at all")); !errors.Is(err, zipfile.ErrInvalidAppleDouble) {
+		t.Errorf("expected ErrInvalidAppleDouble, got: %v", err)
+	}
+	truncated := files["__MACOSX/docs/._readme.txt"]
+	if _, err := zipfile.ParseAppleDouble(truncated[:len(truncated)-20]); !errors.Is(err, zipfile.ErrInvalidAppleDouble) {
+		t.Errorf("expected ErrInvalidAppleDouble for a truncated file, got: %v", err)
+	}
+}
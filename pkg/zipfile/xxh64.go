@@ -0,0 +1,125 @@
+package zipfile
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// XXH64 primes, from the xxHash specification
+const (
+	xxh64Prime1 uint64 = 11400714785074694791
+	xxh64Prime2 uint64 = 14029467366897019727
+	xxh64Prime3 uint64 = 1609587929392839161
+	xxh64Prime4 uint64 = 9650029242287828579
+	xxh64Prime5 uint64 = 2870177450012600261
+
+	xxh64BlockSize = 32
+)
+
+// xxh64 is a streaming implementation of the 64 bit xxHash (seed 0)
+type xxh64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	buf            [xxh64BlockSize]byte
+	n              int // bytes in buf
+}
+
+func newXXH64() hash.Hash64 {
+	h := &xxh64{}
+	h.Reset()
+	return h
+}
+
+func (h *xxh64) Reset() {
+	// the seed is 0: these wrap around, so they can't be constant expressions
+	prime1, prime2 := xxh64Prime1, xxh64Prime2
+	h.v1 = prime1 + prime2
+	h.v2 = prime2
+	h.v3 = 0
+	h.v4 = -prime1
+	h.total = 0
+	h.n = 0
+}
+
+func (h *xxh64) Size() int      { return 8 }
+func (h *xxh64) BlockSize() int { return xxh64BlockSize }
+
+func xxh64Round(acc, input uint64) uint64 {
+	acc += input * xxh64Prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxh64Prime1
+}
+
+func xxh64MergeRound(acc, val uint64) uint64 {
+	acc ^= xxh64Round(0, val)
+	return acc*xxh64Prime1 + xxh64Prime4
+}
+
+func (h *xxh64) block(b []byte) {
+	h.v1 = xxh64Round(h.v1, binary.LittleEndian.Uint64(b[0:]))
+	h.v2 = xxh64Round(h.v2, binary.LittleEndian.Uint64(b[8:]))
+	h.v3 = xxh64Round(h.v3, binary.LittleEndian.Uint64(b[16:]))
+	h.v4 = xxh64Round(h.v4, binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (h *xxh64) Write(p []byte) (int, error) {
+	n := len(p)
+	h.total += uint64(n)
+	if h.n > 0 {
+		copied := copy(h.buf[h.n:], p)
+		h.n += copied
+		p = p[copied:]
+		if h.n < xxh64BlockSize {
+			return n, nil
+		}
+		h.block(h.buf[:])
+		h.n = 0
+	}
+	for ; len(p) >= xxh64BlockSize; p = p[xxh64BlockSize:] {
+		h.block(p)
+	}
+	h.n = copy(h.buf[:], p)
+	return n, nil
+}
+
+func (h *xxh64) Sum64() uint64 {
+	var acc uint64
+	if h.total >= xxh64BlockSize {
+		acc = bits.RotateLeft64(h.v1, 1) + bits.RotateLeft64(h.v2, 7) +
+			bits.RotateLeft64(h.v3, 12) + bits.RotateLeft64(h.v4, 18)
+		acc = xxh64MergeRound(acc, h.v1)
+		acc = xxh64MergeRound(acc, h.v2)
+		acc = xxh64MergeRound(acc, h.v3)
+		acc = xxh64MergeRound(acc, h.v4)
+	} else {
+		acc = h.v3 + xxh64Prime5
+	}
+	acc += h.total
+
+	p := h.buf[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxh64Round(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxh64Prime1 + xxh64Prime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxh64Prime1
+		acc = bits.RotateLeft64(acc, 23)*xxh64Prime2 + xxh64Prime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * xxh64Prime5
+		acc = bits.RotateLeft64(acc, 11) * xxh64Prime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxh64Prime2
+	acc ^= acc >> 29
+	acc *= xxh64Prime3
+	acc ^= acc >> 32
+	return acc
+}
+
+func (h *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, h.Sum64())
+}
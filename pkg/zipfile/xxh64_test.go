@@ -0,0 +1,43 @@
+package zipfile_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ozkatz/cloudzip/pkg/zipfile"
+)
+
+func TestHashAlgorithm_XXH64(t *testing.T) {
+	cases := map[string]string{
+		"":    "ef46db3751d8e999",
+		"a":   "d24ec4f1a98c6e5b",
+		"abc": "44bc2cf5ad770999",
+	}
+	for input, expected := range cases {
+		h, err := zipfile.HashXXH64.New()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, _ = h.Write([]byte(input))
+		if digest := hex.EncodeToString(h.Sum(nil)); digest != expected {
+			t.Errorf("%q: expected %s, got %s", input, expected, digest)
+		}
+	}
+
+	// the digest doesn't depend on how the input is split between writes
+	input := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	whole, _ := zipfile.HashXXH64.New()
+	_, _ = whole.Write(input)
+	for _, chunk := range []int{1, 7, 31, 32, 33, 500} {
+		h, _ := zipfile.HashXXH64.New()
+		for rest := input; len(rest) > 0; {
+			n := min(chunk, len(rest))
+			_, _ = h.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if !bytes.Equal(h.Sum(nil), whole.Sum(nil)) {
+			t.Errorf("chunks of %d: digest differs from a single write", chunk)
+		}
+	}
+}